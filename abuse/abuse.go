@@ -0,0 +1,74 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package abuse classifies requests to stop bots and abusive clients before their requests are proxied
+//
+// Classifiers are consulted in order, the first which does not allow a request decides what
+// is done with it. Add your own, or the built-in heuristics such as BurstScoring:
+//
+//	abuse.Classifiers = append(abuse.Classifiers, (&abuse.BurstScoring{Throttle: 50, Block: 500}).Classify)
+package abuse
+
+import (
+	"net/http"
+	"time"
+)
+
+// Actions taken on a classified request
+const (
+	//Allow lets the request through
+	Allow = ""
+	//Throttle rejects the request with 429 Too Many Requests
+	Throttle = "throttle"
+	//Challenge redirects the caller to ChallengeURL to prove they are human, or blocks them without one
+	Challenge = "challenge"
+	//Block rejects the request with 403 Forbidden
+	Block = "block"
+)
+
+// Verdict is what is done with a classified request
+type Verdict struct {
+	//Action is Allow, Throttle, Challenge or Block
+	Action string
+	//Reason describes why the request was classified so, for the logs and the audit trail
+	Reason string
+	//RetryAfter is when a throttled client may try again
+	RetryAfter time.Duration
+}
+
+// Classifier decides what is done with a request
+type Classifier func(r *http.Request) Verdict
+
+// Classifiers are consulted in order for every request, none allows every request
+var Classifiers []Classifier
+
+// ChallengeURL is where challenged callers are redirected to, e.g. a CAPTCHA page, empty to block them instead
+//
+// The URL of the challenged request is passed in the return query parameter.
+var ChallengeURL = ""
+
+// ChallengePassed reports if a request proves its caller passed a challenge, e.g. with a cookie set by the CAPTCHA page
+//
+// Challenged requests which passed are allowed. Nil treats every challenged request as not passed.
+var ChallengePassed func(r *http.Request) bool
+
+// Classify returns the verdict of the first classifier which does not allow the request
+func Classify(r *http.Request) Verdict {
+	for _, classify := range Classifiers {
+		verdict := classify(r)
+		if verdict.Action == Challenge && ChallengePassed != nil && ChallengePassed(r) {
+			continue
+		}
+		if verdict.Action != Allow {
+			return verdict
+		}
+	}
+	return Verdict{}
+}
@@ -0,0 +1,90 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package abuse
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// BurstScoring scores client IPs by how many requests they sent recently, throttling and then blocking bursts
+//
+// Each request adds one to its IP's score, which decays exponentially with the Window, so a
+// client sending steadily at n requests per Window settles at a score of about n.
+type BurstScoring struct {
+	//Window is how long requests weigh in the score, a minute if unset
+	Window time.Duration
+	//Throttle and Block are the scores over which clients are throttled and blocked, zero never does
+	Throttle float64
+	Block    float64
+
+	mutex  sync.Mutex
+	scores map[string]*burstScore
+	swept  time.Time
+}
+
+type burstScore struct {
+	score float64
+	at    time.Time
+}
+
+// Classify scores the request's client IP
+func (b *BurstScoring) Classify(r *http.Request) Verdict {
+	window := b.Window
+	if window <= 0 {
+		window = time.Minute
+	}
+	now := clock.Now()
+	ip := clientip.Address(r)
+
+	b.mutex.Lock()
+	if b.scores == nil {
+		b.scores = map[string]*burstScore{}
+	}
+	// Scores which decayed away are dropped once per window, so the map only holds active clients
+	if now.Sub(b.swept) >= window {
+		for key, s := range b.scores {
+			if decay(s.score, now.Sub(s.at), window) < 0.5 {
+				delete(b.scores, key)
+			}
+		}
+		b.swept = now
+	}
+	s, ok := b.scores[ip]
+	if !ok {
+		s = &burstScore{}
+		b.scores[ip] = s
+	}
+	s.score = decay(s.score, now.Sub(s.at), window) + 1
+	s.at = now
+	score := s.score
+	b.mutex.Unlock()
+
+	if b.Block > 0 && score > b.Block {
+		return Verdict{Action: Block, Reason: "burst score over block threshold"}
+	}
+	if b.Throttle > 0 && score > b.Throttle {
+		// The client may retry once its score decayed back to the threshold
+		retryAfter := time.Duration(float64(window) * math.Log(score/b.Throttle))
+		return Verdict{Action: Throttle, Reason: "burst score over throttle threshold", RetryAfter: retryAfter}
+	}
+	return Verdict{}
+}
+
+// decay is what score is worth after elapsed
+func decay(score float64, elapsed time.Duration, window time.Duration) float64 {
+	return score * math.Exp(-float64(elapsed)/float64(window))
+}
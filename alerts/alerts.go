@@ -0,0 +1,203 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package alerts sends alerts about routes and backends to the teams owning them
+//
+// Alerts go to the Sinks of the teams owning the route or backend they are about, as named
+// by the routes' Docs, or to DefaultSink if no owning team has a sink:
+//
+//	alerts.Sinks["checkout"] = alerts.Slack{WebhookURL: "https://hooks.slack.com/services/..."}
+//	alerts.Sinks["search"] = alerts.Webhook{URL: "https://oncall.example.com/alerts"}
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Kinds of alerts
+const (
+	//BackendDown is sent when a probed backend is marked down
+	BackendDown = "backend_down"
+	//BackendUp is sent when a backend which was down is marked up again
+	BackendUp = "backend_up"
+	//ErrorBudgetBurn is sent when a route fails fast enough to burn through its error budget
+	ErrorBudgetBurn = "error_budget_burn"
+)
+
+// Alert is something the team owning a route or backend should know about
+type Alert struct {
+	Time time.Time `json:"time"`
+	//Kind is BackendDown, BackendUp or ErrorBudgetBurn
+	Kind string `json:"kind"`
+	//Owner is the team the alert was sent to, empty when sent to DefaultSink
+	Owner   string                 `json:"owner,omitempty"`
+	Route   string                 `json:"route,omitempty"`
+	Backend string                 `json:"backend,omitempty"`
+	Summary string                 `json:"summary"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Sink delivers alerts
+type Sink interface {
+	Send(alert Alert) error
+}
+
+// SinkFunc is a function delivering alerts
+type SinkFunc func(alert Alert) error
+
+// Send calls f
+func (f SinkFunc) Send(alert Alert) error {
+	return f(alert)
+}
+
+// Webhook POSTs alerts as JSON to URL
+type Webhook struct {
+	URL string
+}
+
+// Send posts the alert
+func (h Webhook) Send(alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return post(h.URL, body)
+}
+
+// Slack posts alerts to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+}
+
+// Send posts the alert's summary as a message
+func (s Slack) Send(alert Alert) error {
+	body, err := json.Marshal(map[string]string{"text": "[" + alert.Kind + "] " + alert.Summary})
+	if err != nil {
+		return err
+	}
+	return post(s.WebhookURL, body)
+}
+
+// Client sends alerts to webhooks
+var Client = &http.Client{Timeout: 10 * time.Second}
+
+func post(url string, body []byte) error {
+	resp, err := Client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sinks are the sinks of the teams owning routes, keyed by the Owner of the routes' Docs
+var Sinks = map[string]Sink{}
+
+// DefaultSink receives the alerts no owning team has a sink for, nil drops them
+var DefaultSink Sink
+
+var (
+	ownersMutex   sync.Mutex
+	routeOwners   = map[string]string{}
+	backendRoutes = map[string]map[string]bool{}
+)
+
+// SetRoutes records the teams owning routes, the router calls it with the routes it serves
+func SetRoutes(routes services.RouteCollection) {
+	owners := map[string]string{}
+	for _, route := range routes {
+		if route.Docs != nil && route.Docs.Owner != "" {
+			owners[route.Name] = route.Docs.Owner
+		}
+	}
+	ownersMutex.Lock()
+	defer ownersMutex.Unlock()
+	routeOwners = owners
+}
+
+// ObserveBackend records that route sends requests to the backend at host, whose alerts then go to the route's owner
+func ObserveBackend(route string, host string) {
+	ownersMutex.Lock()
+	defer ownersMutex.Unlock()
+	if backendRoutes[host] == nil {
+		backendRoutes[host] = map[string]bool{}
+	}
+	backendRoutes[host][route] = true
+}
+
+// owners returns the teams owning the route, or the routes sending requests to the backend at host
+func owners(route string, host string) []string {
+	ownersMutex.Lock()
+	defer ownersMutex.Unlock()
+	if route != "" {
+		if owner, ok := routeOwners[route]; ok {
+			return []string{owner}
+		}
+		return nil
+	}
+	teams := map[string]bool{}
+	for name := range backendRoutes[host] {
+		if owner, ok := routeOwners[name]; ok {
+			teams[owner] = true
+		}
+	}
+	var sorted []string
+	for team := range teams {
+		sorted = append(sorted, team)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Send delivers an alert about route, or the backend at host, to the sinks of the teams owning it in the background
+//
+// Alerts with an Owner go to that team. Each team is sent the alert once, and if none of
+// them has a sink it goes to DefaultSink instead.
+func Send(alert Alert, host string) {
+	if alert.Time.IsZero() {
+		alert.Time = clock.Now()
+	}
+	teams := []string{alert.Owner}
+	if alert.Owner == "" {
+		teams = owners(alert.Route, host)
+	}
+	delivered := false
+	for _, team := range teams {
+		if sink, ok := Sinks[team]; ok {
+			owned := alert
+			owned.Owner = team
+			go deliver(sink, owned)
+			delivered = true
+		}
+	}
+	if !delivered && DefaultSink != nil {
+		alert.Owner = ""
+		go deliver(DefaultSink, alert)
+	}
+}
+
+func deliver(sink Sink, alert Alert) {
+	if err := sink.Send(alert); err != nil {
+		logger.Log(logger.ERR, "Could not send "+alert.Kind+" alert to "+alert.Owner+": "+err.Error())
+	}
+}
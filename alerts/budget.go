@@ -0,0 +1,82 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package alerts
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// BurnWindow is the window a route's error rate is measured over to detect it burning its error budget
+var BurnWindow = 5 * time.Minute
+
+// BurnRate is how many times faster than its objective allows a route must fail for an ErrorBudgetBurn alert
+//
+// The default of 14.4 spends 2% of a 30 day budget in an hour.
+var BurnRate = 14.4
+
+// BurnMinRequests is how many requests a window must hold before its error rate is trusted
+var BurnMinRequests = 20
+
+// budgetWindow counts the requests and errors of a route in the current window
+type budgetWindow struct {
+	start    time.Time
+	requests int
+	errors   int
+	alerted  bool
+}
+
+var (
+	budgetMutex   sync.Mutex
+	budgetWindows = map[string]*budgetWindow{}
+)
+
+// RecordRequest counts a response against the error budget of the route serving r, alerting its owner once per window if it burns too fast
+//
+// Only routes with an SLA Objective have an error budget, and only 5xx responses spend it.
+func RecordRequest(r *http.Request, status int) {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || route.SLA == nil || route.SLA.Objective <= 0 || route.SLA.Objective >= 1 {
+		return
+	}
+	now := clock.Now()
+	budgetMutex.Lock()
+	window, ok := budgetWindows[route.Name]
+	if !ok || now.Sub(window.start) >= BurnWindow {
+		window = &budgetWindow{start: now}
+		budgetWindows[route.Name] = window
+	}
+	window.requests++
+	if status >= 500 {
+		window.errors++
+	}
+	requests := window.requests
+	errorRate := float64(window.errors) / float64(requests)
+	burning := !window.alerted && requests >= BurnMinRequests && errorRate > BurnRate*(1-route.SLA.Objective)
+	if burning {
+		window.alerted = true
+	}
+	budgetMutex.Unlock()
+
+	if burning {
+		Send(Alert{
+			Kind:    ErrorBudgetBurn,
+			Route:   route.Name,
+			Summary: fmt.Sprintf("Route %s failed %.1f%% of %d requests, burning its error budget %.0f times too fast", route.Name, errorRate*100, requests, errorRate/(1-route.SLA.Objective)),
+			Details: map[string]interface{}{"error_rate": errorRate, "requests": requests, "objective": route.SLA.Objective},
+		}, "")
+	}
+}
@@ -0,0 +1,78 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package apierror renders the errors arbor responds with in one envelope, whichever part of
+// the gateway rejects the request
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/arbor-dev/arbor/requestid"
+)
+
+// Error is the envelope of every error arbor responds with
+type Error struct {
+	//Status is the HTTP status of the response
+	Status int `json:"status"`
+	//Code is a stable, machine readable name of the error, such as rate_limited
+	Code string `json:"code"`
+	//Message describes the error for people, it never holds internal details such as backend addresses
+	Message string `json:"message"`
+	//RequestID correlates the error with arbor's logs
+	RequestID string `json:"request_id,omitempty"`
+	//Details are specific to the error, such as the fields which failed validation
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Codes are the codes of errors by their status, statuses without one are named after their status text
+var Codes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthenticated",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "gateway_timeout",
+}
+
+// Renderer writes errors to callers, replace it to render them differently (e.g. as application/problem+json)
+//
+// Headers already set on w, such as Retry-After, are sent with the error.
+var Renderer = func(w http.ResponseWriter, r *http.Request, e Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// Write rejects the caller's request r with the error of status, message and details (optional)
+func Write(w http.ResponseWriter, r *http.Request, status int, message string, details map[string]interface{}) {
+	Renderer(w, r, New(r, status, message, details))
+}
+
+// New creates the error of status for the caller's request r
+func New(r *http.Request, status int, message string, details map[string]interface{}) Error {
+	code, ok := Codes[status]
+	if !ok {
+		code = strings.Replace(strings.ToLower(http.StatusText(status)), " ", "_", -1)
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return Error{Status: status, Code: code, Message: message, RequestID: requestid.FromRequest(r), Details: details}
+}
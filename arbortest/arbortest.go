@@ -0,0 +1,34 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package arbortest provides utilities for testing gateways built with arbor
+package arbortest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/random"
+)
+
+// UseFakeClock makes arbor use a fake clock set to start for the rest of the test
+//
+// Advance the returned clock to deterministically expire caches, tokens and timers.
+func UseFakeClock(tb testing.TB, start time.Time) *clock.Fake {
+	fake := clock.NewFake(start)
+	tb.Cleanup(clock.Use(fake))
+	return fake
+}
+
+// Seed makes arbor's backend selection, retry jitter and sampling deterministic for the rest of the test
+func Seed(tb testing.TB, seed int64) {
+	tb.Cleanup(random.Seed(seed))
+}
@@ -0,0 +1,136 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package audit records security relevant events, such as rejected credentials and rotated keys,
+// in an append-only trail kept apart from the application and access logs
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Types of audit events
+const (
+	//AuthenticationSucceeded is a caller proving who they are with a token, API key or signature
+	AuthenticationSucceeded = "authentication.succeeded"
+	//AuthenticationFailed is a caller presenting missing, invalid or expired credentials
+	AuthenticationFailed = "authentication.failed"
+	//AuthorizationDenied is an authenticated caller refused a route, e.g. for a missing scope or role
+	AuthorizationDenied = "authorization.denied"
+	//ConfigurationChanged is a change made to the running gateway, such as reloaded routes or an issued API key
+	ConfigurationChanged = "admin.changed"
+	//CredentialRotated is a credential replaced by a new one, such as a rotated API key or token signing key
+	CredentialRotated = "credential.rotated"
+)
+
+// Event is an entry of the audit trail, written as one line of JSON
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	//Subject is who the event concerns, e.g. the subject of a token or the client of an API key
+	Subject   string `json:"subject,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	ClientIP  string `json:"client_ip,omitempty"`
+	Method    string `json:"method,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Route     string `json:"route,omitempty"`
+	//Reason explains the event, e.g. why a caller was refused, and never holds the credentials themselves
+	Reason  string                 `json:"reason,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Output is where audit events are written, nil disables the audit trail
+//
+// Events are written whole, one per line and never rewritten. Files are synced after each event.
+var Output io.Writer
+
+// Types are the types of events recorded, nil records every type
+//
+// Busy gateways may leave AuthenticationSucceeded out, as every authenticated request records it.
+var Types []string
+
+var outputMutex sync.Mutex
+
+// Open directs the audit trail to the file at location, appending to it
+func Open(location string) error {
+	f, err := os.OpenFile(location, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	Output = f
+	return nil
+}
+
+// Record writes an event to the audit trail, stamping it with the current time if it has none
+func Record(e Event) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if Output == nil || !recorded(e.Type) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = clock.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		logger.Log(logger.ERR, "Could not encode audit event: "+err.Error())
+		return
+	}
+	_, err = Output.Write(append(line, '\n'))
+	if f, ok := Output.(*os.File); ok && err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		logger.Log(logger.ERR, "Could not write audit event: "+err.Error())
+	}
+}
+
+// RecordRequest writes an event about the caller's request r to the audit trail
+func RecordRequest(r *http.Request, eventType string, subject string, reason string, details map[string]interface{}) {
+	e := Event{
+		Type:      eventType,
+		Subject:   subject,
+		RequestID: requestid.FromRequest(r),
+		ClientIP:  clientip.Address(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Reason:    reason,
+		Details:   details,
+	}
+	if route, ok := services.RouteFromContext(r.Context()); ok {
+		e.Route = route.Name
+	}
+	Record(e)
+}
+
+func recorded(eventType string) bool {
+	if Types == nil {
+		return true
+	}
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
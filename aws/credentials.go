@@ -0,0 +1,236 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package aws
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// Credentials are the AWS credentials requests are signed with
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	//SessionToken is set for temporary credentials, such as those of a role
+	SessionToken string
+	//Expires is when temporary credentials expire, zero for long-lived ones
+	Expires time.Time
+}
+
+// Provider provides the current credentials of an AWS identity
+type Provider interface {
+	Retrieve() (Credentials, error)
+}
+
+// StaticCredentials are long-lived credentials, such as the access key of an IAM user
+type StaticCredentials Credentials
+
+// Retrieve returns the credentials themselves
+func (c StaticCredentials) Retrieve() (Credentials, error) {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return Credentials{}, errors.New("aws: no access key configured")
+	}
+	return Credentials(c), nil
+}
+
+// EnvironmentCredentials are the credentials in the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables
+func EnvironmentCredentials() StaticCredentials {
+	return StaticCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// refreshing caches temporary credentials, fetching new ones five minutes before they expire
+type refreshing struct {
+	mutex       sync.Mutex
+	credentials Credentials
+}
+
+func (r *refreshing) retrieve(name string, fetch func() (Credentials, error)) (Credentials, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := clock.Now()
+	if r.credentials.AccessKeyID != "" && now.Add(5*time.Minute).Before(r.credentials.Expires) {
+		return r.credentials, nil
+	}
+	credentials, err := fetch()
+	if err != nil {
+		if r.credentials.AccessKeyID != "" && now.Before(r.credentials.Expires) {
+			logger.Log(logger.ERR, "Could not refresh AWS credentials of "+name+", using the current ones: "+err.Error())
+			return r.credentials, nil
+		}
+		return Credentials{}, err
+	}
+	r.credentials = credentials
+	return credentials, nil
+}
+
+// AssumeRole provides the temporary credentials of a role, assumed through STS with the credentials of another identity
+type AssumeRole struct {
+	//Credentials are those of the identity which assumes the role
+	Credentials Provider
+	//RoleARN is the role to assume, e.g. "arn:aws:iam::123456789012:role/arbor"
+	RoleARN string
+	//SessionName identifies arbor in the role's CloudTrail events, empty is "arbor"
+	SessionName string
+	//ExternalID is required by roles which other accounts assume (optional)
+	ExternalID string
+	//Duration is how long the credentials are valid for, zero is an hour
+	Duration time.Duration
+	//Region is the region of the STS endpoint, empty uses the global endpoint
+	Region string
+
+	refreshing
+}
+
+// Retrieve returns the role's current credentials, assuming it again if they are about to expire
+func (a *AssumeRole) Retrieve() (Credentials, error) {
+	return a.retrieve(a.RoleARN, a.assume)
+}
+
+func (a *AssumeRole) assume() (Credentials, error) {
+	sessionName := a.SessionName
+	if sessionName == "" {
+		sessionName = "arbor"
+	}
+	duration := a.Duration
+	if duration == 0 {
+		duration = time.Hour
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {a.RoleARN},
+		"RoleSessionName": {sessionName},
+		"DurationSeconds": {strconv.Itoa(int(duration / time.Second))},
+	}
+	if a.ExternalID != "" {
+		form.Set("ExternalId", a.ExternalID)
+	}
+
+	endpoint, region := "https://sts.amazonaws.com/", "us-east-1"
+	if a.Region != "" {
+		endpoint, region = "https://sts."+a.Region+".amazonaws.com/", a.Region
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signer := Signer{Region: region, Service: "sts", Credentials: a.Credentials}
+	if err := signer.Sign(req); err != nil {
+		return Credentials{}, err
+	}
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Credentials{}, fmt.Errorf("aws: STS responded with %d assuming %s", resp.StatusCode, a.RoleARN)
+	}
+	var response struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleResult>Credentials"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&response); err != nil {
+		return Credentials{}, err
+	}
+	c := response.Credentials
+	return Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expires: c.Expiration}, nil
+}
+
+// InstanceRole provides the temporary credentials of the role of the EC2 instance arbor runs on, from the instance metadata service (IMDSv2)
+type InstanceRole struct {
+	//Endpoint is the address of the instance metadata service, empty is "http://169.254.169.254"
+	Endpoint string
+
+	refreshing
+}
+
+// Retrieve returns the instance role's current credentials, fetching them again if they are about to expire
+func (i *InstanceRole) Retrieve() (Credentials, error) {
+	return i.retrieve("the instance role", i.fetch)
+}
+
+func (i *InstanceRole) fetch() (Credentials, error) {
+	endpoint := i.Endpoint
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	get := func(method string, path string, header http.Header) ([]byte, error) {
+		req, err := http.NewRequest(method, endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("aws: instance metadata service responded with %d to %s", resp.StatusCode, path)
+		}
+		return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+
+	token, err := get(http.MethodPut, "/latest/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"21600"}})
+	if err != nil {
+		return Credentials{}, err
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	role, err := get(http.MethodGet, "/latest/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return Credentials{}, err
+	}
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if name == "" {
+		return Credentials{}, errors.New("aws: instance has no role")
+	}
+	body, err := get(http.MethodGet, "/latest/meta-data/iam/security-credentials/"+name, header)
+	if err != nil {
+		return Credentials{}, err
+	}
+	var response struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		Token           string    `json:"Token"`
+		Expiration      time.Time `json:"Expiration"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{AccessKeyID: response.AccessKeyID, SecretAccessKey: response.SecretAccessKey, SessionToken: response.Token, Expires: response.Expiration}, nil
+}
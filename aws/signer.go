@@ -0,0 +1,196 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package aws signs requests to AWS-hosted backends, such as API Gateway, Lambda function URLs, S3 and
+// OpenSearch, with Signature Version 4
+package aws
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	dateFormat = "20060102T150405Z"
+)
+
+// Signer signs requests for one AWS service in one region
+type Signer struct {
+	//Region is the region of the backend, e.g. "us-east-1"
+	Region string
+	//Service is the signing name of the backend's service, e.g. "execute-api", "lambda", "s3" or "es"
+	Service string
+	//Credentials provides the credentials requests are signed with
+	Credentials Provider
+}
+
+// Sign adds the Signature Version 4 headers to req, replacing its Authorization header
+//
+// Only the host, Content-MD5 and X-Amz-* headers are signed, so the other headers of the
+// request may be changed in transit. The body is read through req.GetBody.
+func (s *Signer) Sign(req *http.Request) error {
+	credentials, err := s.Credentials.Retrieve()
+	if err != nil {
+		return err
+	}
+	payloadHash, err := hashBody(req)
+	if err != nil {
+		return err
+	}
+
+	now := clock.Now().UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", now.Format(dateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	} else {
+		req.Header.Del("X-Amz-Security-Token")
+	}
+
+	// The path and query are sent as they are signed, so servers see the same canonical form
+	req.URL.RawPath = escapePath(req.URL.Path)
+	req.URL.RawQuery = canonicalQuery(req)
+
+	canonicalHeaders, signedHeaders := canonicalHeaders(req)
+	uri := req.URL.RawPath
+	if uri == "" {
+		uri = "/"
+	}
+	// Every service but S3 expects the path to be escaped twice
+	if s.Service != "s3" {
+		uri = escapePath(uri)
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	stringToSign := algorithm + "\n" + now.Format(dateFormat) + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", algorithm+" Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+func hashBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hashHex(nil), nil
+	}
+	if req.GetBody == nil {
+		return "UNSIGNED-PAYLOAD", nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		name := strings.ToLower(k)
+		if name != "content-md5" && !strings.HasPrefix(name, "x-amz-") {
+			continue
+		}
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[name] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+	return canonical.String(), strings.Join(names, ";")
+}
+
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	pairs := make([]string, 0, len(query))
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapePath escapes each segment of path as Signature Version 4 requires
+func escapePath(path string) string {
+	return escape(path, false)
+}
+
+// escape percent-encodes every byte of s but the unreserved characters of RFC 3986, and / unless slash is set
+func escape(s string, slash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var escaped strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !slash {
+			escaped.WriteByte(c)
+			continue
+		}
+		escaped.WriteByte('%')
+		escaped.WriteByte(hexDigits[c>>4])
+		escaped.WriteByte(hexDigits[c&15])
+	}
+	return escaped.String()
+}
+
+func hashHex(b []byte) string {
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
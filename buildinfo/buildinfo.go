@@ -0,0 +1,103 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package buildinfo describes the running arbor build and its configuration
+//
+// Set the build variables when linking, e.g.
+//
+//	go build -ldflags "-X github.com/arbor-dev/arbor/buildinfo.Version=v1.2.0 -X github.com/arbor-dev/arbor/buildinfo.GitSHA=$(git rev-parse HEAD)"
+//
+// Variables which are not set are filled in from the module and VCS information Go embeds.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+)
+
+// Version, GitSHA and BuildTime identify the build, set with -ldflags -X
+var (
+	Version   = ""
+	GitSHA    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version    string   `json:"version"`
+	GitSHA     string   `json:"git_sha"`
+	BuildTime  string   `json:"build_time"`
+	GoVersion  string   `json:"go_version"`
+	Features   []string `json:"features"`
+	ConfigHash string   `json:"config_hash"`
+}
+
+var (
+	mutex      sync.Mutex
+	features   = map[string]func() bool{}
+	configHash string
+)
+
+// RegisterFeature adds a feature whose state is reported, enabled is checked each time
+func RegisterFeature(name string, enabled func() bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	features[name] = enabled
+}
+
+// SetConfigHash records the hash of the loaded configuration
+func SetConfigHash(hash string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	configHash = hash
+}
+
+// Get describes the running build and the features enabled in it
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = build.Main.Version
+		}
+		embeddedSHA := info.GitSHA == ""
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && embeddedSHA:
+				info.GitSHA = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = setting.Value
+			case setting.Key == "vcs.modified" && setting.Value == "true" && embeddedSHA:
+				info.GitSHA += "-dirty"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	info.ConfigHash = configHash
+	info.Features = []string{}
+	for name, enabled := range features {
+		if enabled() {
+			info.Features = append(info.Features, name)
+		}
+	}
+	sort.Strings(info.Features)
+	return info
+}
@@ -0,0 +1,258 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package cache caches proxied GET responses for routes which opt in with a CachePolicy
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/payload"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Entry is a cached response
+type Entry struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+}
+
+// Store holds cached responses
+type Store interface {
+	// Get returns the entry stored under key, or nil if there is none
+	Get(key string) (*Entry, error)
+	// Set stores entry under key until it expires
+	Set(key string, entry *Entry) error
+}
+
+// Responses is the store of cached responses, replace it with a RedisStore to share the cache between replicas
+var Responses Store = NewLRUStore(64 << 20)
+
+// MaxEntrySize is the size of the largest response body which is cached
+var MaxEntrySize = 1 << 20
+
+// cacheableStatus are the statuses which are cached (RFC 7231 6.1)
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+}
+
+// Policy returns the cache policy of the route r was routed to, or nil if it is not cached
+func Policy(r *http.Request) *services.CachePolicy {
+	if r.Method != http.MethodGet {
+		return nil
+	}
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	return route.Cache
+}
+
+// Key is the key r is cached under when proxied to backend: its host, path and query, the backend
+// and the values of the policy's KeyHeaders
+//
+// Virtual hosts serving the same path, and requests routed to other backends, are cached apart.
+func Key(r *http.Request, policy *services.CachePolicy, backend string) string {
+	var key strings.Builder
+	key.WriteString(r.Method)
+	key.WriteByte(' ')
+	key.WriteString(strings.ToLower(r.Host))
+	key.WriteString(r.URL.RequestURI())
+	key.WriteString("\nBackend:")
+	key.WriteString(backend)
+	for _, header := range policy.KeyHeaders {
+		key.WriteByte('\n')
+		key.WriteString(http.CanonicalHeaderKey(header))
+		key.WriteByte(':')
+		key.WriteString(strings.Join(r.Header.Values(header), ","))
+	}
+	return key.String()
+}
+
+// directives parses a Cache-Control header
+func directives(header http.Header) map[string]string {
+	parsed := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, arg = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			parsed[strings.ToLower(name)] = arg
+		}
+	}
+	return parsed
+}
+
+// Bypass reports whether the caller asked for a response which is not from the cache
+func Bypass(r *http.Request) bool {
+	d := directives(r.Header)
+	_, noCache := d["no-cache"]
+	_, noStore := d["no-store"]
+	return noCache || noStore || r.Header.Get("Pragma") == "no-cache"
+}
+
+// TTL returns how long a response to r may be cached for under policy, or 0 if it may not be
+//
+// The policy's TTL overrides the freshness given by the backend, but responses the backend
+// marks no-store or private are never cached. Responses to requests with credentials are only
+// cached if they are public or the credentials are part of the key. Responses which vary on a
+// request header are only cached if the header is one of the policy's KeyHeaders, so callers
+// sending other values never share them.
+func TTL(r *http.Request, policy *services.CachePolicy, status int, header http.Header, size int) time.Duration {
+	if !cacheableStatus[status] || size > MaxEntrySize || header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	d := directives(header)
+	if _, ok := d["no-store"]; ok {
+		return 0
+	}
+	if _, ok := d["private"]; ok {
+		return 0
+	}
+	if _, ok := d["no-cache"]; ok {
+		return 0
+	}
+	if !variesOnKey(policy, header) {
+		return 0
+	}
+
+	_, public := d["public"]
+	_, shared := d["s-maxage"]
+	if r.Header.Get("Authorization") != "" && !public && !shared && !keyed(policy, "Authorization") {
+		return 0
+	}
+
+	if policy.TTL > 0 {
+		return policy.TTL
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if arg, ok := d[name]; ok {
+			seconds, err := strconv.Atoi(arg)
+			if err != nil || seconds <= 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires.Sub(clock.Now())
+	}
+	return 0
+}
+
+// variesOnKey reports whether every request header a response varies on is part of the key
+func variesOnKey(policy *services.CachePolicy, header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && (name == "*" || !keyed(policy, name)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func keyed(policy *services.CachePolicy, header string) bool {
+	for _, h := range policy.KeyHeaders {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEntry creates an entry caching a response for ttl
+//
+// Responses without validators are given an ETag from a hash of their body (see etag) and a
+// Last-Modified of when they were stored, so callers can revalidate them with arbor.
+func NewEntry(status int, header http.Header, body []byte, ttl time.Duration) *Entry {
+	now := clock.Now()
+	entry := &Entry{
+		Status:  status,
+		Header:  header.Clone(),
+		Body:    body,
+		Stored:  now,
+		Expires: now.Add(ttl),
+	}
+	if entry.Header.Get("ETag") == "" {
+		entry.Header.Set("ETag", etag(entry.Header.Get("Content-Type"), body))
+	}
+	if entry.Header.Get("Last-Modified") == "" {
+		entry.Header.Set("Last-Modified", now.UTC().Format(http.TimeFormat))
+	}
+	return entry
+}
+
+// etag identifies a body, bodies differing only in payload.IgnoredFields share a weak ETag
+func etag(contentType string, body []byte) string {
+	canonical, removed := payload.Canonicalize(contentType, body)
+	if removed {
+		sum := sha256.Sum256(canonical)
+		return `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	}
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified reports whether the caller already has entry, by its ETag or, if the caller
+// did not send If-None-Match, by its Last-Modified time (RFC 7232 section 6)
+func NotModified(r *http.Request, entry *Entry) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		etag := entry.Header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, value := range values {
+			for _, candidate := range strings.Split(value, ",") {
+				candidate = strings.TrimSpace(candidate)
+				// If-None-Match uses weak comparison
+				if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(entry.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
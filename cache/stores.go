@@ -0,0 +1,180 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/redis"
+)
+
+// LRUStore keeps responses in memory, evicting the least recently used once it is full
+type LRUStore struct {
+	maxBytes int64
+	bytes    int64
+
+	mutex   sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+// NewLRUStore creates an in memory store holding up to maxBytes of responses
+func NewLRUStore(maxBytes int64) *LRUStore {
+	return &LRUStore{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func entrySize(key string, entry *Entry) int64 {
+	size := int64(len(key) + len(entry.Body))
+	for k, vs := range entry.Header {
+		for _, v := range vs {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+// Get returns the entry stored under key, or nil if there is none
+func (s *LRUStore) Get(key string) (*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*lruItem)
+	if !clock.Now().Before(item.entry.Expires) {
+		s.remove(element)
+		return nil, nil
+	}
+	s.order.MoveToFront(element)
+	return item.entry, nil
+}
+
+// Set stores entry under key, evicting the least recently used entries to make room
+func (s *LRUStore) Set(key string, entry *Entry) error {
+	item := &lruItem{key: key, entry: entry, size: entrySize(key, entry)}
+	if item.size > s.maxBytes {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	s.entries[key] = s.order.PushFront(item)
+	s.bytes += item.size
+	for s.bytes > s.maxBytes {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Stats describes how full the store is
+type Stats struct {
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// Stats returns how full the store is
+func (s *LRUStore) Stats() Stats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return Stats{Entries: len(s.entries), Bytes: s.bytes, MaxBytes: s.maxBytes}
+}
+
+func (s *LRUStore) remove(element *list.Element) {
+	item := s.order.Remove(element).(*lruItem)
+	delete(s.entries, item.key)
+	s.bytes -= item.size
+}
+
+// RedisStore keeps responses in Redis so all replicas share the cache
+//
+// Responses are encrypted with encryption.AtRest when it is configured.
+type RedisStore struct {
+	Client *redis.Client
+	//Prefix namespaces the responses in Redis
+	Prefix string
+}
+
+// key hashes cache keys, as they may hold header values such as credentials
+func (s *RedisStore) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	if s.Prefix == "" {
+		return "arbor:cache:" + hex.EncodeToString(sum[:])
+	}
+	return s.Prefix + hex.EncodeToString(sum[:])
+}
+
+// Get returns the entry stored under key, or nil if there is none
+func (s *RedisStore) Get(key string) (*Entry, error) {
+	redisKey := s.key(key)
+	data, err := s.Client.String("GET", redisKey)
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	opened, err := encryption.OpenAtRest([]byte(data), []byte(redisKey))
+	if err == encryption.ErrUnknownKey {
+		// Responses sealed with a retired key are refetched rather than kept
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := new(Entry)
+	err = json.Unmarshal(opened, entry)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Set stores entry under key, letting Redis expire it
+func (s *RedisStore) Set(key string, entry *Entry) error {
+	ttl := entry.Expires.Sub(clock.Now())
+	if ttl < time.Millisecond {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	redisKey := s.key(key)
+	data, err = encryption.SealAtRest(data, []byte(redisKey))
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.Do("SET", redisKey, string(data), "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return err
+}
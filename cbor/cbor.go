@@ -0,0 +1,466 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package cbor translates between CBOR (RFC 8949) and JSON
+//
+// Maps become objects in the order of their entries, their keys must be strings or integers.
+// Byte strings become base64 strings, bignums become numbers and undefined becomes null, other
+// tags are dropped in favour of the values they tag. Translating JSON to CBOR keeps the order of
+// object members and uses the shortest head of each value, integers become integers and other
+// numbers 64 bit floats.
+package cbor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// MediaType is the media type of CBOR bodies
+const MediaType = "application/cbor"
+
+// maxDepth bounds the nesting of arrays, maps and tags, so deeply nested input can not exhaust the stack
+const maxDepth = 100
+
+// ErrMalformed is returned for bodies which are not CBOR
+var ErrMalformed = errors.New("cbor: malformed body")
+
+// ErrUnsupported is returned for CBOR values JSON can not hold
+var ErrUnsupported = errors.New("cbor: value has no JSON translation")
+
+var errTooDeep = errors.New("cbor: body is nested too deeply")
+
+// IsCBOR reports whether a content type is CBOR
+func IsCBOR(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == MediaType || strings.HasSuffix(mediaType, "+cbor")
+}
+
+// Major types
+const (
+	majorUint = iota
+	majorNegative
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// indefinite is the additional information of items whose length is not given in their head
+const indefinite = 31
+
+// breakCode ends the items of indefinite length
+const breakCode = 0xff
+
+// reader reads the items of a body in order
+type reader struct {
+	data []byte
+}
+
+func (r *reader) next(n uint64) ([]byte, error) {
+	if uint64(len(r.data)) < n {
+		return nil, ErrMalformed
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// head reads the head of an item, its major type and argument, indefinite is true for items of indefinite length
+func (r *reader) head() (major byte, info byte, argument uint64, err error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		bytes, err := r.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range bytes {
+			argument = argument<<8 | uint64(c)
+		}
+		return major, info, argument, nil
+	case info == indefinite && major != majorUint && major != majorNegative && major != majorTag:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, ErrMalformed
+}
+
+// atBreak consumes the break code ending items of indefinite length, if it is next
+func (r *reader) atBreak() (bool, error) {
+	if len(r.data) == 0 {
+		return false, ErrMalformed
+	}
+	if r.data[0] != breakCode {
+		return false, nil
+	}
+	r.data = r.data[1:]
+	return true, nil
+}
+
+// ToJSON translates a CBOR body to JSON
+func ToJSON(body []byte) ([]byte, error) {
+	r := &reader{data: body}
+	var buf bytes.Buffer
+	if err := writeItem(&buf, r, 0); err != nil {
+		return nil, err
+	}
+	if len(r.data) > 0 {
+		return nil, ErrMalformed
+	}
+	return buf.Bytes(), nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Encode ends values with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+func writeFloat(buf *bytes.Buffer, f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrUnsupported
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	return nil
+}
+
+// halfFloat converts an IEEE 754 half precision float
+func halfFloat(h uint16) float64 {
+	exponent, mantissa := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exponent {
+	case 0:
+		f = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		f = math.Inf(1)
+		if mantissa != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// writeItem writes the next item of r as JSON
+func writeItem(buf *bytes.Buffer, r *reader, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+	major, info, argument, err := r.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorUint:
+		buf.WriteString(strconv.FormatUint(argument, 10))
+	case majorNegative:
+		// The value is -1 - argument, which may be below the smallest int64
+		buf.WriteString(new(big.Int).Sub(big.NewInt(-1), new(big.Int).SetUint64(argument)).String())
+	case majorBytes:
+		bytes, err := readString(r, major, info, argument)
+		if err != nil {
+			return err
+		}
+		writeString(buf, base64.StdEncoding.EncodeToString(bytes))
+	case majorText:
+		text, err := readString(r, major, info, argument)
+		if err != nil {
+			return err
+		}
+		writeString(buf, string(text))
+	case majorArray:
+		return writeArray(buf, r, info, argument, depth)
+	case majorMap:
+		return writeMap(buf, r, info, argument, depth)
+	case majorTag:
+		return writeTag(buf, r, argument, depth)
+	case majorSimple:
+		return writeSimple(buf, info, argument)
+	}
+	return nil
+}
+
+// readString reads the content of a byte or text string, joining the chunks of indefinite length strings
+func readString(r *reader, major byte, info byte, argument uint64) ([]byte, error) {
+	if info != indefinite {
+		return r.next(argument)
+	}
+	var joined []byte
+	for {
+		done, err := r.atBreak()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return joined, nil
+		}
+		chunkMajor, chunkInfo, n, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		// Chunks must be definite length strings of the same type
+		if chunkMajor != major || chunkInfo == indefinite {
+			return nil, ErrMalformed
+		}
+		chunk, err := r.next(n)
+		if err != nil {
+			return nil, err
+		}
+		joined = append(joined, chunk...)
+	}
+}
+
+// more reports whether an array or map has an item left, i counting the items read so far
+func more(r *reader, info byte, argument uint64, i uint64) (bool, error) {
+	if info == indefinite {
+		done, err := r.atBreak()
+		return !done, err
+	}
+	return i < argument, nil
+}
+
+func writeArray(buf *bytes.Buffer, r *reader, info byte, n uint64, depth int) error {
+	// Every item takes at least a byte
+	if info != indefinite && n > uint64(len(r.data)) {
+		return ErrMalformed
+	}
+	buf.WriteByte('[')
+	for i := uint64(0); ; i++ {
+		ok, err := more(r, info, n, i)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeItem(buf, r, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeMap(buf *bytes.Buffer, r *reader, info byte, n uint64, depth int) error {
+	if info != indefinite && n > uint64(len(r.data)) {
+		return ErrMalformed
+	}
+	buf.WriteByte('{')
+	var key bytes.Buffer
+	for i := uint64(0); ; i++ {
+		ok, err := more(r, info, n, i)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key.Reset()
+		if err := writeItem(&key, r, depth+1); err != nil {
+			return err
+		}
+		// Keys are strings in JSON, integer keys are written as their decimal text
+		switch k := key.Bytes(); {
+		case k[0] == '"':
+			buf.Write(k)
+		case k[0] == '-' || k[0] >= '0' && k[0] <= '9':
+			if bytes.ContainsAny(k, ".eE") {
+				return ErrUnsupported
+			}
+			buf.WriteByte('"')
+			buf.Write(k)
+			buf.WriteByte('"')
+		default:
+			return ErrUnsupported
+		}
+		buf.WriteByte(':')
+		if err := writeItem(buf, r, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// Tags of positive and negative bignums
+const (
+	tagBignum         = 2
+	tagNegativeBignum = 3
+)
+
+// writeTag writes a tagged item, bignums as numbers and other items as they are without their tag
+func writeTag(buf *bytes.Buffer, r *reader, tag uint64, depth int) error {
+	if tag != tagBignum && tag != tagNegativeBignum {
+		return writeItem(buf, r, depth+1)
+	}
+	major, info, argument, err := r.head()
+	if err != nil {
+		return err
+	}
+	if major != majorBytes {
+		return ErrMalformed
+	}
+	bytes, err := readString(r, major, info, argument)
+	if err != nil {
+		return err
+	}
+	n := new(big.Int).SetBytes(bytes)
+	if tag == tagNegativeBignum {
+		n.Sub(big.NewInt(-1), n)
+	}
+	buf.WriteString(n.String())
+	return nil
+}
+
+func writeSimple(buf *bytes.Buffer, info byte, argument uint64) error {
+	switch info {
+	case 20:
+		buf.WriteString("false")
+	case 21:
+		buf.WriteString("true")
+	case 22, 23:
+		// undefined has no JSON counterpart, null is the closest
+		buf.WriteString("null")
+	case 25:
+		return writeFloat(buf, halfFloat(uint16(argument)), 32)
+	case 26:
+		return writeFloat(buf, float64(math.Float32frombits(uint32(argument))), 32)
+	case 27:
+		return writeFloat(buf, math.Float64frombits(argument), 64)
+	case indefinite:
+		// A break outside of an item of indefinite length
+		return ErrMalformed
+	default:
+		return ErrUnsupported
+	}
+	return nil
+}
+
+// FromJSON translates a JSON body to CBOR
+func FromJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	encoded, err := appendValue(nil, decoder, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("cbor: body is not a single JSON value")
+	}
+	return encoded, nil
+}
+
+// appendValue appends the next value of decoder, reading its tokens so object members keep their order
+func appendValue(buf []byte, decoder *json.Decoder, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		// Heads hold the number of items, so they are written after the items are counted
+		var items []byte
+		n := 0
+		for decoder.More() {
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				items = appendHead(items, majorText, uint64(len(key.(string))))
+				items = append(items, key.(string)...)
+			}
+			if items, err = appendValue(items, decoder, depth+1); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		if t == '{' {
+			buf = appendHead(buf, majorMap, uint64(n))
+		} else {
+			buf = appendHead(buf, majorArray, uint64(n))
+		}
+		return append(buf, items...), nil
+	case string:
+		return append(appendHead(buf, majorText, uint64(len(t))), t...), nil
+	case json.Number:
+		return appendNumber(buf, t), nil
+	case bool:
+		if t {
+			return append(buf, majorSimple<<5|21), nil
+		}
+		return append(buf, majorSimple<<5|20), nil
+	}
+	return append(buf, majorSimple<<5|22), nil
+}
+
+// appendHead appends the shortest head of an item
+func appendHead(buf []byte, major byte, argument uint64) []byte {
+	major <<= 5
+	switch {
+	case argument < 24:
+		return append(buf, major|byte(argument))
+	case argument <= math.MaxUint8:
+		return append(buf, major|24, byte(argument))
+	case argument <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(argument))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major|27), argument)
+}
+
+func appendNumber(buf []byte, n json.Number) []byte {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		if i < 0 {
+			return appendHead(buf, majorNegative, uint64(-1-i))
+		}
+		return appendHead(buf, majorUint, uint64(i))
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return appendHead(buf, majorUint, u)
+	}
+	f, _ := n.Float64()
+	return binary.BigEndian.AppendUint64(append(buf, majorSimple<<5|27), math.Float64bits(f))
+}
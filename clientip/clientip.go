@@ -0,0 +1,129 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package clientip resolves the address of the client which sent a request, through the proxies trusted to forward it
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ForwardedForHeader lists the addresses a request was forwarded for, the client's first
+const ForwardedForHeader = "X-Forwarded-For"
+
+// TrustedProxies are the CIDRs (e.g. "10.0.0.0/8") or addresses of the load balancers and proxies in front of arbor
+//
+// The X-Forwarded-For header is only believed as far as it was appended to by trusted proxies,
+// as any client can send one. None are trusted by default, so the client is the peer.
+//
+// The client it resolves is the one rate limits, network filters, local-only endpoints, the
+// access log and the audit log apply to.
+var TrustedProxies []string
+
+var (
+	networksMutex sync.Mutex
+	networks      = map[string][]*net.IPNet{}
+)
+
+// ParseNetworks parses a list of CIDRs and addresses, addresses match only themselves
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	parsed := make([]*net.IPNet, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: entry}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			parsed = append(parsed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, network)
+	}
+	return parsed, nil
+}
+
+// Contains reports whether ip is in one of the networks of list
+//
+// Lists are parsed once and kept, so configured lists can be checked for every request.
+func Contains(list []string, ip net.IP) (bool, error) {
+	if len(list) == 0 {
+		return false, nil
+	}
+	key := strings.Join(list, ",")
+	networksMutex.Lock()
+	parsed, cached := networks[key]
+	networksMutex.Unlock()
+	if !cached {
+		var err error
+		parsed, err = ParseNetworks(list)
+		if err != nil {
+			return false, err
+		}
+		networksMutex.Lock()
+		networks[key] = parsed
+		networksMutex.Unlock()
+	}
+	for _, network := range parsed {
+		if network.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FromRequest returns the address of the client which sent r, nil if it can not be parsed
+//
+// Starting from the peer, each address forwarded by a trusted proxy is replaced by the address
+// the proxy received the request from, until an address which is not a trusted proxy is reached.
+func FromRequest(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	client := net.ParseIP(host)
+	if len(TrustedProxies) == 0 {
+		return client
+	}
+	var forwarded []string
+	for _, header := range r.Header.Values(ForwardedForHeader) {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		if trusted, _ := Contains(TrustedProxies, client); !trusted {
+			return client
+		}
+		next := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if next == nil {
+			return client
+		}
+		client = next
+	}
+	return client
+}
+
+// Address returns the address of the client which sent r as text, or the peer's address as given if it can not be parsed
+func Address(r *http.Request) string {
+	if ip := FromRequest(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
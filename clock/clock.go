@@ -0,0 +1,107 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package clock is the source of time for arbor's timeouts, caches, rate limiters and schedulers
+//
+// Components read the time through this package rather than the time package so
+// tests can substitute a Fake clock and control time deterministically.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules events
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the Clock backed by the system time
+type Real struct{}
+
+// Now returns the current time
+func (Real) Now() time.Time { return time.Now() }
+
+// Since returns the time elapsed since t
+func (Real) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// After waits for d to elapse and then sends the current time on the returned channel
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Sleep pauses the current goroutine for d
+func (Real) Sleep(d time.Duration) { time.Sleep(d) }
+
+// NewTicker returns a Ticker ticking every d
+func (Real) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+var mutex sync.RWMutex
+var current Clock = Real{}
+
+// Use makes c the clock used by arbor and returns a function restoring the previous clock
+func Use(c Clock) (restore func()) {
+	mutex.Lock()
+	previous := current
+	current = c
+	mutex.Unlock()
+	return func() {
+		mutex.Lock()
+		current = previous
+		mutex.Unlock()
+	}
+}
+
+// Current returns the clock used by arbor
+func Current() Clock {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+// Now returns the current time of the clock used by arbor
+func Now() time.Time {
+	return Current().Now()
+}
+
+// Since returns the time elapsed since t on the clock used by arbor
+func Since(t time.Time) time.Duration {
+	return Current().Since(t)
+}
+
+// After waits for d to elapse on the clock used by arbor
+func After(d time.Duration) <-chan time.Time {
+	return Current().After(d)
+}
+
+// Sleep pauses the current goroutine for d on the clock used by arbor
+func Sleep(d time.Duration) {
+	Current().Sleep(d)
+}
+
+// NewTicker returns a Ticker ticking every d on the clock used by arbor
+func NewTicker(d time.Duration) Ticker {
+	return Current().NewTicker(d)
+}
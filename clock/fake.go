@@ -0,0 +1,121 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock which only moves when it is advanced
+type Fake struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	interval time.Duration
+	c        chan time.Time
+	stopped  bool
+}
+
+// NewFake returns a Fake clock set to start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Since returns the time elapsed since t on the fake clock
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel receiving the time once the clock is advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.schedule(d, 0).c
+}
+
+// Sleep blocks until the clock is advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTicker returns a Ticker ticking each time the clock is advanced past an interval of d
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	return &fakeTicker{clock: f, waiter: f.schedule(d, d)}
+}
+
+func (f *Fake) schedule(d time.Duration, interval time.Duration) *fakeWaiter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w := &fakeWaiter{deadline: f.now.Add(d), interval: interval, c: make(chan time.Time, 1)}
+	if d <= 0 && interval == 0 {
+		w.c <- f.now
+		return w
+	}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// Advance moves the clock forward by d, firing any timers and tickers which come due
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing any timers and tickers which come due
+func (f *Fake) Set(t time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = t
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.stopped {
+			continue
+		}
+		if !t.Before(w.deadline) {
+			select {
+			case w.c <- t:
+			default:
+			}
+			if w.interval == 0 {
+				continue
+			}
+			for !t.Before(w.deadline) {
+				w.deadline = w.deadline.Add(w.interval)
+			}
+		}
+		pending = append(pending, w)
+	}
+	f.waiters = pending
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mutex.Lock()
+	t.waiter.stopped = true
+	t.clock.mutex.Unlock()
+}
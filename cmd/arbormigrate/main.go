@@ -0,0 +1,217 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Command arbormigrate finds calls to arbor's deprecated proxy functions and rewrites them to arbor.Proxy
+//
+// Usage:
+//
+//	arbormigrate [-w] [packages]
+//
+// Packages are directories, "dir/..." for a directory and those below it, or Go files,
+// "./..." if none are given. Like go vet, each call found is reported and the command
+// exits with status 1. With -w the calls are rewritten in place instead, e.g.
+//
+//	arbor.GET(w, url, "JSON", token, r)
+//
+// becomes
+//
+//	arbor.Proxy(w, r, url, arbor.WithFormat("JSON"), arbor.WithToken(token))
+//
+// The rewritten call evaluates r before url and the options, which only matters if they have side effects.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const arborPath = "github.com/arbor-dev/arbor"
+
+var deprecated = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+var write = flag.Bool("w", false, "rewrite calls in place instead of reporting them")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: arbormigrate [-w] [packages]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		found, err := goFiles(pattern)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		files = append(files, found...)
+	}
+
+	calls := 0
+	for _, file := range files {
+		n, err := migrate(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		calls += n
+	}
+	if calls > 0 && !*write {
+		os.Exit(1)
+	}
+}
+
+// goFiles lists the Go files matched by a pattern
+func goFiles(pattern string) ([]string, error) {
+	if strings.HasSuffix(pattern, ".go") {
+		return []string{pattern}, nil
+	}
+	recursive := pattern == "..." || strings.HasSuffix(pattern, "/...")
+	root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if root == "" {
+		root = "."
+	}
+
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (!recursive || name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".go") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// arborName returns the name the file imports arbor as, empty if it does not
+func arborName(file *ast.File) string {
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil || path != arborPath {
+			continue
+		}
+		if spec.Name == nil {
+			return "arbor"
+		}
+		if spec.Name.Name == "_" || spec.Name.Name == "." {
+			return ""
+		}
+		return spec.Name.Name
+	}
+	return ""
+}
+
+func isString(expr ast.Expr, value string) bool {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return false
+	}
+	unquoted, err := strconv.Unquote(lit.Value)
+	return err == nil && unquoted == value
+}
+
+// migrate reports or rewrites the deprecated calls in a file, returning how many it found
+func migrate(path string) (int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return 0, err
+	}
+	name := arborName(file)
+	if name == "" {
+		return 0, nil
+	}
+
+	calls := 0
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok || len(call.Args) != 5 {
+			return true
+		}
+		selector, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !deprecated[selector.Sel.Name] {
+			return true
+		}
+		pkg, ok := selector.X.(*ast.Ident)
+		// Identifiers declared in the file (e.g. a variable shadowing the import) have an object
+		if !ok || pkg.Name != name || pkg.Obj != nil {
+			return true
+		}
+		calls++
+
+		old := render(fset, call)
+		w, url, formatArg, tokenArg, r := call.Args[0], call.Args[1], call.Args[2], call.Args[3], call.Args[4]
+		args := []ast.Expr{w, r, url}
+		if !isString(formatArg, "RAW") {
+			args = append(args, option(name, "WithFormat", formatArg))
+		}
+		if !isString(tokenArg, "") {
+			args = append(args, option(name, "WithToken", tokenArg))
+		}
+		selector.Sel = ast.NewIdent("Proxy")
+		call.Args = args
+
+		if !*write {
+			fmt.Printf("%s: %s can be %s\n", fset.Position(call.Pos()), old, render(fset, call))
+		}
+		return true
+	})
+
+	if calls == 0 || !*write {
+		return calls, nil
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return calls, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return calls, err
+	}
+	return calls, ioutil.WriteFile(path, buf.Bytes(), info.Mode())
+}
+
+func option(pkg string, name string, arg ast.Expr) ast.Expr {
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: ast.NewIdent(pkg), Sel: ast.NewIdent(name)},
+		Args: []ast.Expr{arg},
+	}
+}
+
+func render(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, node)
+	return buf.String()
+}
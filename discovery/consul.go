@@ -0,0 +1,125 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consul resolves services from the healthy instances registered in Consul, using blocking queries to watch them
+type Consul struct {
+	//Address is the address of the Consul agent (e.g. "http://127.0.0.1:8500")
+	Address string
+	//Token is the ACL token sent to Consul (optional)
+	Token string
+	//Datacenter to resolve services in, the agent's if unset
+	Datacenter string
+	//Wait is how long a blocking query waits for a change, 5 minutes if unset
+	Wait time.Duration
+	//HTTPClient makes the requests, nil uses http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// NewConsul creates a resolver configured from the CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN environment variables
+func NewConsul() *Consul {
+	address := os.Getenv("CONSUL_HTTP_ADDR")
+	if address == "" {
+		address = "127.0.0.1:8500"
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return &Consul{Address: address, Token: os.Getenv("CONSUL_HTTP_TOKEN")}
+}
+
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+// Resolve returns the instances of service passing their health checks
+func (c *Consul) Resolve(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	query := neturl.Values{"passing": {"true"}}
+	if c.Datacenter != "" {
+		query.Set("dc", c.Datacenter)
+	}
+	if index > 0 {
+		wait := c.Wait
+		if wait <= 0 {
+			wait = 5 * time.Minute
+		}
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", strconv.FormatInt(int64(wait/time.Millisecond), 10)+"ms")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.Address, "/")+"/v1/health/service/"+neturl.PathEscape(service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul: %d resolving %s", resp.StatusCode, service)
+	}
+
+	var entries []consulEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	next, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: invalid X-Consul-Index %q", resp.Header.Get("X-Consul-Index"))
+	}
+	// Consul's index can go backwards, e.g. after a snapshot restore, which resets the watch
+	if next < index {
+		next = 0
+	}
+
+	instances := make([]Instance, 0, len(entries))
+	for _, entry := range entries {
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		instances = append(instances, Instance{
+			Address: net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
+			Weight:  entry.Service.Weights.Passing,
+		})
+	}
+	return instances, next, nil
+}
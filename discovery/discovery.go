@@ -0,0 +1,135 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package discovery resolves the instances of backend services from a registry such as Consul, etcd or Kubernetes
+//
+// Routes address a discovered service by the host it is registered under in Services, e.g.
+//
+//	discovery.Registry = discovery.NewConsul()
+//	discovery.Services["users"] = discovery.Service{Name: "users-api"}
+//
+// sends requests for "http://users/profile" to the instances of users-api, following them as they change.
+package discovery
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+// Instance is an instance of a service found in the registry
+type Instance struct {
+	//Address is the host and port of the instance
+	Address string
+	//Weight is the share of requests the instance gets under the proxy.Weighted policy
+	Weight int
+}
+
+// Resolver finds the instances of services in a registry
+type Resolver interface {
+	// Resolve returns the instances of service and the registry's index of them
+	//
+	// Passing the index of a previous call blocks until the instances change or
+	// the registry's wait elapses, an index of 0 returns immediately.
+	Resolve(ctx context.Context, service string, index uint64) ([]Instance, uint64, error)
+}
+
+// Service is a backend service whose instances are discovered
+type Service struct {
+	//Name is the name of the service in the registry
+	Name string
+	//Scheme is the scheme the instances are called with, "http" if unset
+	Scheme string
+	//Policy is the load balancing policy across the instances, see proxy.Pool
+	Policy string
+	//Registry overrides the package's Registry for the service, e.g. to resolve it with DNS
+	Registry Resolver
+}
+
+// Registry is where services are discovered unless they set their own
+var Registry Resolver
+
+// Services are the services to discover, keyed by the host routes use for them
+var Services = map[string]Service{}
+
+// RetryInterval is how long to wait before resolving a service again after the registry fails
+var RetryInterval = 5 * time.Second
+
+// Start creates a backend pool for each service and keeps its instances up to date until stop is called
+//
+// Call it before serving, the pools are created before it returns.
+func Start() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for host, service := range Services {
+		if service.Registry == nil {
+			service.Registry = Registry
+		}
+		if service.Registry == nil {
+			logger.Log(logger.ERR, "No registry to discover "+service.Name+" in")
+			continue
+		}
+		pool, exists := proxy.BackendPools[host]
+		if !exists {
+			pool = &proxy.Pool{Policy: service.Policy}
+			proxy.BackendPools[host] = pool
+		}
+		wg.Add(1)
+		go func(host string, service Service, pool *proxy.Pool) {
+			defer wg.Done()
+			watch(ctx, host, service, pool)
+		}(host, service, pool)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// watch follows the instances of a service until ctx is done
+func watch(ctx context.Context, host string, service Service, pool *proxy.Pool) {
+	scheme := service.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var index uint64
+	for {
+		instances, next, err := service.Registry.Resolve(ctx, service.Name, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Log(logger.ERR, "Could not discover instances of "+service.Name+": "+err.Error())
+			select {
+			case <-clock.After(RetryInterval):
+			case <-ctx.Done():
+				return
+			}
+			// Resolve from scratch in case the index is no longer valid
+			index = 0
+			continue
+		}
+
+		if index == 0 || next != index {
+			poolInstances := make([]proxy.Instance, len(instances))
+			for i, instance := range instances {
+				poolInstances[i] = proxy.Instance{URL: scheme + "://" + instance.Address, Weight: instance.Weight}
+			}
+			pool.SetInstances(poolInstances)
+			logger.Log(logger.INFO, "Discovered "+strconv.Itoa(len(instances))+" instances of "+service.Name+" for "+host)
+		}
+		index = next
+	}
+}
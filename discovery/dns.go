@@ -0,0 +1,118 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package discovery
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// DNS resolves services by looking up their names again every Refresh
+//
+// Services named like an SRV record ("_http._tcp.users.example.org") are resolved to the
+// targets of its records with the lowest priority, weighted by their weights. Other services
+// are "host:port" and resolved to the A and AAAA records of host, e.g. a headless service.
+type DNS struct {
+	//Resolver looks up the records, nil uses net.DefaultResolver
+	Resolver *net.Resolver
+	//Refresh is how often services are looked up again, 30 seconds if unset
+	Refresh time.Duration
+}
+
+// Resolve returns the addresses service currently resolves to
+//
+// The index is a hash of the addresses, so waiting callers are only woken when they change.
+func (d *DNS) Resolve(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	refresh := d.Refresh
+	if refresh <= 0 {
+		refresh = 30 * time.Second
+	}
+	for {
+		instances, err := d.lookup(ctx, service)
+		if err != nil {
+			return nil, 0, err
+		}
+		next := hashInstances(instances)
+		if next != index {
+			return instances, next, nil
+		}
+		select {
+		case <-clock.After(refresh):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+func (d *DNS) lookup(ctx context.Context, service string) ([]Instance, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	if strings.HasPrefix(service, "_") {
+		_, records, err := resolver.LookupSRV(ctx, "", "", service)
+		if err != nil {
+			return nil, err
+		}
+		// Records are sorted by priority, only the most preferred are used
+		var instances []Instance
+		for _, record := range records {
+			if record.Priority != records[0].Priority {
+				break
+			}
+			instances = append(instances, Instance{
+				Address: net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))),
+				Weight:  int(record.Weight),
+			})
+		}
+		return instances, nil
+	}
+
+	host, port, err := net.SplitHostPort(service)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]Instance, len(addresses))
+	for i, address := range addresses {
+		instances[i] = Instance{Address: net.JoinHostPort(address, port)}
+	}
+	return instances, nil
+}
+
+// hashInstances hashes instances regardless of their order, it is never 0
+func hashInstances(instances []Instance) uint64 {
+	keys := make([]string, len(instances))
+	for i, instance := range instances {
+		keys[i] = instance.Address + "|" + strconv.Itoa(instance.Weight)
+	}
+	sort.Strings(keys)
+	hash := fnv.New64a()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+	}
+	if sum := hash.Sum64(); sum != 0 {
+		return sum
+	}
+	return 1
+}
@@ -0,0 +1,179 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Etcd resolves services from keys in etcd, using the v3 JSON gateway and watching the keys for changes
+//
+// The instances of a service are the keys below Prefix + service + "/", whose values are either
+// "host:port" or JSON such as {"Addr": "host:port", "Weight": 2}, as written by etcd's endpoints manager.
+type Etcd struct {
+	//Endpoint is the address of an etcd member (e.g. "http://127.0.0.1:2379")
+	Endpoint string
+	//Prefix the service keys are below, "/services/" if unset
+	Prefix string
+	//Wait is how long a watch waits for a change, 5 minutes if unset
+	Wait time.Duration
+	//HTTPClient makes the requests, nil uses http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type etcdHeader struct {
+	Revision string `json:"revision"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []struct {
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Events   []json.RawMessage `json:"events"`
+		Canceled bool              `json:"canceled"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Resolve returns the instances of service registered in etcd
+func (e *Etcd) Resolve(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "/services/"
+	}
+	key := []byte(prefix + service + "/")
+	end := rangeEnd(key)
+
+	if index > 0 {
+		err := e.watch(ctx, key, end, index+1)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var resp etcdRangeResponse
+	err := e.post(ctx, "/v3/kv/range", map[string]interface{}{"key": key, "range_end": end}, func(body *json.Decoder) error {
+		return body.Decode(&resp)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	revision, err := strconv.ParseUint(resp.Header.Revision, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("etcd: invalid revision %q", resp.Header.Revision)
+	}
+
+	instances := make([]Instance, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var endpoint struct {
+			Addr   string
+			Weight int
+		}
+		if json.Unmarshal(kv.Value, &endpoint) != nil {
+			endpoint.Addr = strings.TrimSpace(string(kv.Value))
+		}
+		if endpoint.Addr != "" {
+			instances = append(instances, Instance{Address: endpoint.Addr, Weight: endpoint.Weight})
+		}
+	}
+	return instances, revision, nil
+}
+
+// watch blocks until a key in the range changes at or after revision, or the wait elapses
+func (e *Etcd) watch(ctx context.Context, key []byte, end []byte, revision uint64) error {
+	wait := e.Wait
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	request := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            key,
+			"range_end":      end,
+			"start_revision": strconv.FormatUint(revision, 10),
+		},
+	}
+	err := e.post(ctx, "/v3/watch", request, func(body *json.Decoder) error {
+		for {
+			var resp etcdWatchResponse
+			err := body.Decode(&resp)
+			if err != nil {
+				return err
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("etcd: %s", resp.Error.Message)
+			}
+			// Watches from a compacted revision are canceled, the range is read again instead
+			if len(resp.Result.Events) > 0 || resp.Result.Canceled {
+				return nil
+			}
+		}
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		// Nothing changed while waiting
+		return nil
+	}
+	return err
+}
+
+func (e *Etcd) post(ctx context.Context, path string, body interface{}, decode func(*json.Decoder) error) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(e.Endpoint, "/")+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd: %d from %s", resp.StatusCode, path)
+	}
+	return decode(json.NewDecoder(resp.Body))
+}
+
+// rangeEnd is the end of the range of keys starting with prefix
+func rangeEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// Every byte is 0xff, so the range ends with the last key
+	return []byte{0}
+}
@@ -0,0 +1,236 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the credentials of a pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// Kubernetes resolves services from their EndpointSlices, watching them for changes
+//
+// Services are named "name", "namespace/name" or either followed by ":port" to pick
+// a named port, the first port otherwise. Only endpoints which are ready are returned.
+type Kubernetes struct {
+	//Host is the address of the API server (e.g. "https://10.96.0.1:443")
+	Host string
+	//Namespace of services named without one
+	Namespace string
+	//TokenFile holds the bearer token, read for each request as it is rotated
+	TokenFile string
+	//Wait is how long a watch waits for a change, 5 minutes if unset
+	Wait time.Duration
+	//HTTPClient makes the requests, nil uses a client trusting the service account's CA
+	HTTPClient *http.Client
+
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
+}
+
+// NewKubernetes creates a resolver for a gateway running in the cluster, using its pod's service account
+func NewKubernetes() *Kubernetes {
+	namespace, err := ioutil.ReadFile(serviceAccountDir + "namespace")
+	if err != nil {
+		namespace = []byte("default")
+	}
+	return &Kubernetes{
+		Host:      "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")),
+		Namespace: strings.TrimSpace(string(namespace)),
+		TokenFile: serviceAccountDir + "token",
+	}
+}
+
+func (k *Kubernetes) httpClient() (*http.Client, error) {
+	if k.HTTPClient != nil {
+		return k.HTTPClient, nil
+	}
+	k.clientOnce.Do(func() {
+		pem, err := ioutil.ReadFile(serviceAccountDir + "ca.crt")
+		if err != nil {
+			k.clientErr = err
+			return
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			k.clientErr = errors.New("kubernetes: no certificates in " + serviceAccountDir + "ca.crt")
+			return
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		k.client = &http.Client{Transport: transport}
+	})
+	return k.client, k.clientErr
+}
+
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []endpointSlice `json:"items"`
+}
+
+type endpointSlice struct {
+	AddressType string `json:"addressType"`
+	Endpoints   []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	} `json:"ports"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Resolve returns the ready endpoints of service
+func (k *Kubernetes) Resolve(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	namespace, name, port := k.Namespace, service, ""
+	if i := strings.LastIndex(name, ":"); i != -1 {
+		name, port = name[:i], name[i+1:]
+	}
+	if i := strings.Index(name, "/"); i != -1 {
+		namespace, name = name[:i], name[i+1:]
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	query := neturl.Values{"labelSelector": {"kubernetes.io/service-name=" + name}}
+	path := "/apis/discovery.k8s.io/v1/namespaces/" + neturl.PathEscape(namespace) + "/endpointslices"
+
+	if index > 0 {
+		err := k.watch(ctx, path, query, index)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var list endpointSliceList
+	err := k.get(ctx, path, query, func(body *json.Decoder) error {
+		return body.Decode(&list)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	// Resource versions are opaque, one which is not a number can not be watched from and is polled instead
+	revision, _ := strconv.ParseUint(list.Metadata.ResourceVersion, 10, 64)
+
+	var instances []Instance
+	for _, slice := range list.Items {
+		if slice.AddressType != "IPv4" && slice.AddressType != "IPv6" || len(slice.Ports) == 0 {
+			continue
+		}
+		slicePort := -1
+		for _, p := range slice.Ports {
+			if port == "" || p.Name == port {
+				slicePort = p.Port
+				break
+			}
+		}
+		if slicePort == -1 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				instances = append(instances, Instance{Address: net.JoinHostPort(address, strconv.Itoa(slicePort)), Weight: 1})
+			}
+		}
+	}
+	return instances, revision, nil
+}
+
+// watch blocks until an EndpointSlice of the service changes after the resource version, or the wait elapses
+func (k *Kubernetes) watch(ctx context.Context, path string, query neturl.Values, resourceVersion uint64) error {
+	wait := k.Wait
+	if wait <= 0 {
+		wait = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait+10*time.Second)
+	defer cancel()
+
+	watchQuery := neturl.Values{}
+	for key, values := range query {
+		watchQuery[key] = values
+	}
+	watchQuery.Set("watch", "true")
+	watchQuery.Set("resourceVersion", strconv.FormatUint(resourceVersion, 10))
+	watchQuery.Set("timeoutSeconds", strconv.Itoa(int(wait/time.Second)))
+	watchQuery.Set("allowWatchBookmarks", "false")
+
+	err := k.get(ctx, path, watchQuery, func(body *json.Decoder) error {
+		var event watchEvent
+		err := body.Decode(&event)
+		if err != nil {
+			return err
+		}
+		// An ERROR event is usually 410 Gone for an expired resource version, the slices are listed again
+		return nil
+	})
+	// The API server ends the watch after timeoutSeconds without a change
+	if err != nil && (ctx.Err() != nil || errors.Is(err, io.EOF)) {
+		return nil
+	}
+	return err
+}
+
+func (k *Kubernetes) get(ctx context.Context, path string, query neturl.Values, decode func(*json.Decoder) error) error {
+	client, err := k.httpClient()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(k.Host, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if k.TokenFile != "" {
+		token, err := ioutil.ReadFile(k.TokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kubernetes: %d from %s", resp.StatusCode, path)
+	}
+	return decode(json.NewDecoder(resp.Body))
+}
@@ -0,0 +1,178 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package encryption encrypts request data arbor persists, such as cached responses, with
+// AES-256-GCM under a keyring which supports rotating keys
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// AtRest is the keyring persisted request data is encrypted with, nil stores it unencrypted
+var AtRest *Keyring
+
+// version identifies the format of sealed data
+const version = 1
+
+var (
+	// ErrUnknownKey is returned when data was sealed with a key which is not in the keyring
+	ErrUnknownKey = errors.New("encryption: data was sealed with an unknown key")
+	// ErrMalformed is returned when data is not sealed data or has been tampered with
+	ErrMalformed = errors.New("encryption: malformed or tampered data")
+)
+
+// Keyring holds the keys data is sealed with
+//
+// Data is sealed with the primary key and opened with whichever key sealed it, so a key is
+// rotated by adding a new primary and keeping the old key until its data has been resealed.
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring sealing with the key named primary, keys must be 32 bytes
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{primary: primary, aeads: make(map[string]cipher.AEAD)}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("encryption: invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption: key %s must be 32 bytes", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	if _, ok := k.aeads[primary]; !ok {
+		return nil, fmt.Errorf("encryption: primary key %s is not in the keyring", primary)
+	}
+	return k, nil
+}
+
+// ParseKeyring parses keys written as "id:base64key" separated by commas, the first is the primary
+//
+// It is meant for keys kept in the environment, e.g. ARBOR_ENCRYPTION_KEYS.
+func ParseKeyring(s string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	var primary string
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("encryption: keys must be written as id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %s is not base64: %v", parts[0], err)
+		}
+		if primary == "" {
+			primary = parts[0]
+		}
+		keys[parts[0]] = key
+	}
+	return NewKeyring(primary, keys)
+}
+
+// Seal encrypts plaintext with the primary key
+//
+// The context (e.g. the storage key) is authenticated but not stored, and must be given
+// again to open the data, so sealed records can not be swapped between keys.
+func (k *Keyring) Seal(plaintext []byte, context []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+	header := append([]byte{version, byte(len(k.primary))}, k.primary...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	additional := append(append([]byte(nil), header...), context...)
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, plaintext, additional), nil
+}
+
+// Open decrypts data sealed by any key in the keyring
+func (k *Keyring) Open(sealed []byte, context []byte) ([]byte, error) {
+	if len(sealed) < 2 || sealed[0] != version || len(sealed) < 2+int(sealed[1]) {
+		return nil, ErrMalformed
+	}
+	header := sealed[:2+int(sealed[1])]
+	aead, ok := k.aeads[string(header[2:])]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	rest := sealed[len(header):]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], append(append([]byte(nil), header...), context...))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+// Primary returns the ID of the key data is sealed with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// KeyIDs returns the IDs of the keys in the keyring, sorted, without the keys themselves
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.aeads))
+	for id := range k.aeads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// NeedsReseal reports whether data was sealed with a key other than the primary
+func (k *Keyring) NeedsReseal(sealed []byte) bool {
+	return len(sealed) < 2 || len(sealed) < 2+int(sealed[1]) || string(sealed[2:2+int(sealed[1])]) != k.primary
+}
+
+// Reseal decrypts data and encrypts it again with the primary key, for rotating keys
+func (k *Keyring) Reseal(sealed []byte, context []byte) ([]byte, error) {
+	plaintext, err := k.Open(sealed, context)
+	if err != nil {
+		return nil, err
+	}
+	return k.Seal(plaintext, context)
+}
+
+// SealAtRest seals data with AtRest, or returns it as is if encryption at rest is not configured
+func SealAtRest(data []byte, context []byte) ([]byte, error) {
+	if AtRest == nil {
+		return data, nil
+	}
+	return AtRest.Seal(data, context)
+}
+
+// OpenAtRest opens data sealed by SealAtRest
+func OpenAtRest(data []byte, context []byte) ([]byte, error) {
+	if AtRest == nil {
+		return data, nil
+	}
+	return AtRest.Open(data, context)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/arbor-dev/arbor"
 	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
 	"github.com/arbor-dev/arbor/proxy"
 	"github.com/arbor-dev/arbor/security"
 	"net/http"
@@ -18,6 +19,13 @@ var routes = arbor.RouteCollection{
 		Pattern: "/",
 		Handler: index,
 	},
+	//Prometheus metrics of the gateway
+	arbor.Route{
+		Name:    "Metrics",
+		Method:  "GET",
+		Pattern: "/metrics",
+		Handler: metrics.Handler,
+	},
 }
 
 //Handler for the Index Route
@@ -0,0 +1,198 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package features gates experimental behaviors so they can ship disabled and be enabled per deployment
+//
+// Behaviors register a gate with their default state, then check it each time they could apply:
+//
+//	features.Register("StreamingProxy", features.Spec{Stage: features.Alpha})
+//	...
+//	if features.Enabled("StreamingProxy") {
+//
+// Behaviors which apply to a request check EnabledFor with its context instead, so they leave protected routes alone.
+//
+// Deployments enable or disable gates with Set, Parse or the ARBOR_FEATURE_GATES environment variable,
+// e.g. ARBOR_FEATURE_GATES="StreamingProxy=true,CORSEngine=false".
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Stage is how mature the behavior behind a gate is
+type Stage string
+
+// Alpha behaviors are disabled by default and may change or be removed, Beta behaviors are
+// stable enough to be enabled by default, GA behaviors can no longer be disabled and
+// Deprecated behaviors are about to be removed
+const (
+	Alpha      Stage = "ALPHA"
+	Beta       Stage = "BETA"
+	GA         Stage = "GA"
+	Deprecated Stage = "DEPRECATED"
+)
+
+// Spec describes a feature gate
+type Spec struct {
+	//Default is whether the gate is enabled if the deployment does not set it
+	Default bool
+	//Stage is how mature the behavior behind the gate is
+	Stage Stage
+	//LockToDefault stops deployments from changing the gate, e.g. once it is GA
+	LockToDefault bool
+}
+
+// Gate is the state of a registered feature gate
+type Gate struct {
+	Name    string `json:"name"`
+	Stage   Stage  `json:"stage"`
+	Enabled bool   `json:"enabled"`
+}
+
+// EnvironmentVariable is read by FromEnvironment
+const EnvironmentVariable = "ARBOR_FEATURE_GATES"
+
+// ErrUnknownGate is returned when setting a gate which was not registered
+var ErrUnknownGate = errors.New("unknown feature gate")
+
+type gate struct {
+	spec    Spec
+	enabled bool
+	set     bool
+}
+
+var (
+	mutex sync.RWMutex
+	gates = map[string]*gate{}
+)
+
+// Register adds a feature gate, keeping the state of a gate which was already registered or set
+func Register(name string, spec Spec) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if g, exists := gates[name]; exists {
+		g.spec = spec
+		if !g.set || spec.LockToDefault {
+			g.enabled = spec.Default
+		}
+		return
+	}
+	gates[name] = &gate{spec: spec, enabled: spec.Default}
+	buildinfo.RegisterFeature("gate:"+name, func() bool { return Enabled(name) })
+}
+
+// Enabled reports whether the gate is enabled, gates which are not registered are disabled
+func Enabled(name string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	g, exists := gates[name]
+	return exists && g.enabled
+}
+
+// EnabledFor reports whether the gate is enabled for a request, Alpha and Beta gates are disabled for protected routes
+//
+// Behaviors which apply to requests check their gate with the request's context, so experimental
+// behaviors never reach routes marked Protected.
+func EnabledFor(ctx context.Context, name string) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	g, exists := gates[name]
+	if !exists || !g.enabled {
+		return false
+	}
+	return !services.Protected(ctx) || (g.spec.Stage != Alpha && g.spec.Stage != Beta)
+}
+
+// check returns the gate if it may be set to enabled, the caller must hold mutex
+func check(name string, enabled bool) (*gate, error) {
+	g, exists := gates[name]
+	if !exists {
+		return nil, fmt.Errorf("%w %s", ErrUnknownGate, name)
+	}
+	if g.spec.LockToDefault && enabled != g.spec.Default {
+		return nil, errors.New("feature gate " + name + " is locked to " + strconv.FormatBool(g.spec.Default))
+	}
+	return g, nil
+}
+
+// Set enables or disables a registered gate
+func Set(name string, enabled bool) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	g, err := check(name, enabled)
+	if err != nil {
+		return err
+	}
+	g.enabled = enabled
+	g.set = true
+	return nil
+}
+
+// Parse sets gates from a comma separated list of name=bool pairs
+//
+// No gates are changed if any of the pairs is invalid.
+func Parse(list string) error {
+	settings := map[string]bool{}
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("feature gate " + pair + " is not name=bool")
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return errors.New("feature gate " + pair + " is not name=bool")
+		}
+		settings[strings.TrimSpace(parts[0])] = enabled
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for name, enabled := range settings {
+		if _, err := check(name, enabled); err != nil {
+			return err
+		}
+	}
+	for name, enabled := range settings {
+		gates[name].enabled = enabled
+		gates[name].set = true
+	}
+	return nil
+}
+
+// FromEnvironment sets gates from the ARBOR_FEATURE_GATES environment variable
+func FromEnvironment() error {
+	return Parse(os.Getenv(EnvironmentVariable))
+}
+
+// All returns the state of every registered gate ordered by name
+func All() []Gate {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	all := make([]Gate, 0, len(gates))
+	for name, g := range gates {
+		all = append(all, Gate{Name: name, Stage: g.spec.Stage, Enabled: g.enabled})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
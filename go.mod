@@ -6,6 +6,6 @@ require (
 	github.com/gorilla/mux v0.0.0-20170922205414-3f19343c7d9c
 	github.com/kennygrant/sanitize v1.2.3
 	github.com/syndtr/goleveldb v0.0.0-20170725064836-b89cc31ef797
-	golang.org/x/net v0.0.0-20171004034648-a04bdaca5b32 // indirect
+	golang.org/x/net v0.0.0-20171004034648-a04bdaca5b32
 	gopkg.in/jarcoal/httpmock.v1 v1.0.0-20180719183105-8007e27cdb32
 )
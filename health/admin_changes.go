@@ -0,0 +1,55 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package health
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AdminToken is the bearer token callers send to change the gateway's state through administrative
+// endpoints, such as promoting migrations, when they do not present a certificate pinned by AdminPins
+//
+// Set AdminToken or AdminPins to allow changes, without either they are refused.
+var AdminToken string
+
+// AuthorizesChange reports whether the caller may change the gateway's state through an administrative endpoint
+//
+// The caller must present a pinned certificate or send AdminToken in its Authorization header. Requests
+// browsers send from other sites are refused, so a page can not make an admin's browser change the state.
+func AuthorizesChange(r *http.Request) bool {
+	if crossSite(r) {
+		return false
+	}
+	if len(AdminPins) > 0 && adminPinned(r) {
+		return true
+	}
+	if AdminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) == 1
+}
+
+// crossSite reports whether a browser sent the request from another site than the gateway's
+func crossSite(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	parsed, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(parsed.Host, r.Host)
+}
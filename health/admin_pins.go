@@ -0,0 +1,53 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package health
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+)
+
+// AdminPins are the SPKI pins of the client certificates which may reach administrative endpoints, nil to not require one
+//
+// A pin is the base64 SHA-256 of a certificate's public key (its SubjectPublicKeyInfo), as in
+// HPKP, e.g. from `openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64`.
+// When set, callers must also present a pinned certificate over TLS to be allowed by any
+// Exposure, so a leaked admin credential is of no use without the pinned key. Without a
+// server.TLSClientCAFile the certificate may be self-signed, the handshake proves the caller
+// holds its key. With one, the listener verifies every certificate it is presented, so pinned
+// certificates must be issued by one of its CAs too.
+var AdminPins []string
+
+// SPKIPin returns the pin of a certificate's public key
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// adminPinned reports whether the caller presented a certificate pinned by AdminPins, or no pins are required
+func adminPinned(r *http.Request) bool {
+	if len(AdminPins) == 0 {
+		return true
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false
+	}
+	pin := []byte(SPKIPin(r.TLS.PeerCertificates[0]))
+	for _, pinned := range AdminPins {
+		if subtle.ConstantTimeCompare(pin, []byte(pinned)) == 1 {
+			return true
+		}
+	}
+	return false
+}
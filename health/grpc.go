@@ -0,0 +1,137 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// grpcServingStatuses are the statuses of grpc.health.v1.HealthCheckResponse
+var grpcServingStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcTransport speaks HTTP/2 to gRPC backends, without TLS to http:// URLs
+var grpcTransport = func() *http.Transport {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Transport{Protocols: protocols, ForceAttemptHTTP2: true}
+}()
+
+// probeGRPC calls grpc.health.v1.Health/Check on a backend, it fails unless the backend reports SERVING
+func probeGRPC(ctx context.Context, backend Backend) error {
+	// HealthCheckRequest has one field, the service (1), in a length prefixed gRPC message
+	var message []byte
+	if backend.GRPCService != "" {
+		message = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(backend.GRPCService)))...)
+		message = append(message, backend.GRPCService...)
+	}
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(backend.HealthURL, "/")+"/grpc.health.v1.Health/Check", bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	var transport http.RoundTripper = grpcTransport
+	if ProbeTransport != nil {
+		transport = ProbeTransport
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check responded with %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+
+	// Servers which fail the call at once send the status in the headers rather than the trailers
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		message := resp.Trailer.Get("Grpc-Message")
+		if message == "" {
+			message = resp.Header.Get("Grpc-Message")
+		}
+		return fmt.Errorf("health check failed with gRPC status %s %s", status, message)
+	}
+
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+		return errors.New("health check response is not a gRPC message")
+	}
+	serving, err := grpcServingStatus(body[5:])
+	if err != nil {
+		return err
+	}
+	if serving != 1 {
+		name, known := grpcServingStatuses[serving]
+		if !known {
+			name = "in serving status " + strconv.FormatUint(serving, 10)
+		}
+		return errors.New("backend is " + name)
+	}
+	return nil
+}
+
+// grpcServingStatus reads the status field (1) of a HealthCheckResponse, UNKNOWN if it is not set
+func grpcServingStatus(message []byte) (uint64, error) {
+	var status uint64
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, errors.New("health check response is malformed")
+		}
+		message = message[n:]
+		switch tag & 7 {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, errors.New("health check response is malformed")
+			}
+			message = message[n:]
+			if tag>>3 == 1 {
+				status = value
+			}
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return 0, errors.New("health check response is malformed")
+			}
+			message = message[n+int(length):]
+		default:
+			return 0, errors.New("health check response is malformed")
+		}
+	}
+	return status, nil
+}
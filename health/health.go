@@ -0,0 +1,245 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package health reports whether arbor is alive and ready for traffic, aggregating the
+// checks of the dependencies registered with it
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// Status of a check
+const (
+	Up   = "up"
+	Down = "down"
+)
+
+// CheckTimeout is how long each check may take before it is reported down
+var CheckTimeout = 2 * time.Second
+
+// Exposure controls who may see health details and other administrative endpoints
+type Exposure int
+
+const (
+	// Hidden does not serve the details
+	Hidden Exposure = iota
+	// Local serves the details to callers on the loopback interface
+	Local
+	// Public serves the details to every caller
+	Public
+)
+
+// DetailsExposure is who may see the health details, which reveal the gateway's backends
+var DetailsExposure = Local
+
+// Check reports an error if a dependency is unhealthy
+type Check func(ctx context.Context) error
+
+type registeredCheck struct {
+	name     string
+	critical bool
+	check    Check
+}
+
+var (
+	registryMutex sync.Mutex
+	checks        []registeredCheck
+	details       = map[string]func() interface{}{}
+	draining      int32
+)
+
+// Register adds a check, critical checks which fail make arbor not ready
+func Register(name string, critical bool, check Check) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for i, c := range checks {
+		if c.name == name {
+			checks[i] = registeredCheck{name: name, critical: critical, check: check}
+			return
+		}
+	}
+	checks = append(checks, registeredCheck{name: name, critical: critical, check: check})
+}
+
+// Unregister removes a check
+func Unregister(name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for i, c := range checks {
+		if c.name == name {
+			checks = append(checks[:i], checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// RegisterDetail adds a section to the health details, such as the state of a subsystem
+func RegisterDetail(name string, detail func() interface{}) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	details[name] = detail
+}
+
+// SetDraining marks arbor as shutting down so it stops being ready
+func SetDraining(d bool) {
+	var v int32
+	if d {
+		v = 1
+	}
+	atomic.StoreInt32(&draining, v)
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Critical bool    `json:"critical"`
+	Error    string  `json:"error,omitempty"`
+	Latency  float64 `json:"latency_seconds"`
+}
+
+// Run runs every check concurrently and reports if all critical checks passed
+func Run(ctx context.Context) (bool, []Result) {
+	registryMutex.Lock()
+	registered := append([]registeredCheck(nil), checks...)
+	registryMutex.Unlock()
+
+	results := make([]Result, len(registered))
+	var wg sync.WaitGroup
+	for i, c := range registered {
+		wg.Add(1)
+		go func(i int, c registeredCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			start := clock.Now()
+			err := runCheck(checkCtx, c.check)
+			results[i] = Result{Name: c.name, Status: Up, Critical: c.critical, Latency: clock.Since(start).Seconds()}
+			if err != nil {
+				results[i].Status = Down
+				results[i].Error = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	ready := atomic.LoadInt32(&draining) == 0
+	for _, result := range results {
+		if result.Critical && result.Status == Down {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+// runCheck stops waiting for a check once its context is done
+func runCheck(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// LivenessHandler reports arbor is alive, it does not depend on any backend
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": Up})
+}
+
+// ReadinessHandler reports if arbor is ready for traffic, 503 Service Unavailable if a critical check fails
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, results := Run(r.Context())
+	status, code := Up, http.StatusOK
+	if !ready {
+		status, code = Down, http.StatusServiceUnavailable
+	}
+	// Check names and errors are details, which may not be exposed
+	body := map[string]interface{}{"status": status}
+	if DetailsExposure.Allows(r) {
+		body["checks"] = results
+		body["backends"] = BackendStatuses()
+	}
+	writeJSON(w, code, body)
+}
+
+// DetailsHandler reports the result of every check and the registered detail sections
+func DetailsHandler(w http.ResponseWriter, r *http.Request) {
+	if !DetailsExposure.Allows(r) {
+		apierror.Write(w, r, http.StatusNotFound, "", nil)
+		return
+	}
+	ready, results := Run(r.Context())
+	status := Up
+	if !ready {
+		status = Down
+	}
+	body := map[string]interface{}{
+		"status":   status,
+		"draining": atomic.LoadInt32(&draining) == 1,
+		"checks":   results,
+		"backends": BackendStatuses(),
+	}
+
+	registryMutex.Lock()
+	names := make([]string, 0, len(details))
+	for name := range details {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sections := make([]func() interface{}, len(names))
+	for i, name := range names {
+		sections[i] = details[name]
+	}
+	registryMutex.Unlock()
+	for i, name := range names {
+		body[name] = sections[i]()
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// Allows reports whether the caller may see what is exposed at this level
+//
+// Callers must also present a certificate pinned by AdminPins when it is set.
+func (e Exposure) Allows(r *http.Request) bool {
+	if e != Hidden && !adminPinned(r) {
+		return false
+	}
+	switch e {
+	case Public:
+		return true
+	case Local:
+		// A local proxy forwarding remote callers must not expose what is local to them
+		ip := clientip.FromRequest(r)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
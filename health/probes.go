@@ -0,0 +1,266 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/alerts"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// Backend is a backend service whose health URL is probed
+type Backend struct {
+	//Name identifies the backend in health reports
+	Name string
+	//HealthURL is probed with GET, any 2xx or 3xx response is healthy
+	HealthURL string
+	//Critical backends make arbor not ready while they are down
+	Critical bool
+	//GRPC probes HealthURL (e.g. "http://orders:50051") with the gRPC health checking protocol rather than GET,
+	//the backend is healthy while it reports SERVING
+	GRPC bool
+	//GRPCService is the service whose health a GRPC probe checks, empty checks the server as a whole
+	GRPCService string
+	//Owner is the team alerted when the backend goes down, the owners of the routes sending it requests if unset
+	Owner string
+}
+
+// Backends are the backend services probed while arbor runs
+var Backends []Backend
+
+// ProbeInterval is how often backends are probed
+var ProbeInterval = 10 * time.Second
+
+// UnhealthyThreshold is how many probes in a row must fail before a backend is marked down
+var UnhealthyThreshold = 3
+
+// HealthyThreshold is how many probes in a row must pass before a down backend is marked up
+var HealthyThreshold = 2
+
+// ProbeTransport carries probes, nil uses http.DefaultTransport
+var ProbeTransport http.RoundTripper
+
+// BackendStatus is the result of the latest probe of a backend
+type BackendStatus struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LastProbe time.Time `json:"last_probe"`
+	Since     time.Time `json:"since"`
+	Latency   float64   `json:"latency_seconds"`
+
+	host        string
+	consecutive int
+}
+
+// Healthy reports whether the backend serving host (e.g. "localhost:8000") may be sent requests
+//
+// Hosts which are not probed, or not probed yet, are assumed to be healthy.
+func Healthy(host string) bool {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+	for _, status := range statuses {
+		if status.host == host && status.Status == Down {
+			return false
+		}
+	}
+	return true
+}
+
+// Unknown is the status of a backend which has not been probed yet
+const Unknown = "unknown"
+
+var (
+	statusMutex sync.RWMutex
+	statuses    = map[string]*BackendStatus{}
+)
+
+// BackendStatuses returns the status of every probed backend
+func BackendStatuses() []BackendStatus {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+	all := make([]BackendStatus, 0, len(Backends))
+	for _, backend := range Backends {
+		if status, ok := statuses[backend.Name]; ok {
+			all = append(all, *status)
+		}
+	}
+	return all
+}
+
+func backendCheck(name string) Check {
+	return func(ctx context.Context) error {
+		statusMutex.RLock()
+		defer statusMutex.RUnlock()
+		status, ok := statuses[name]
+		if !ok || status.Status == Unknown {
+			return errors.New("not probed yet")
+		}
+		if status.Status == Down && status.Error != "" {
+			return errors.New(status.Error)
+		}
+		if status.Status == Down {
+			return errors.New("recovering")
+		}
+		return nil
+	}
+}
+
+// StartProbing probes Backends now and then every ProbeInterval until stop is called
+//
+// Each backend is registered as a check, so readiness reflects the latest probes.
+func StartProbing() (stop func()) {
+	backends := append([]Backend(nil), Backends...)
+	statusMutex.Lock()
+	for _, backend := range backends {
+		if _, ok := statuses[backend.Name]; !ok {
+			statuses[backend.Name] = &BackendStatus{Name: backend.Name, URL: backend.HealthURL, Status: Unknown, host: urlHost(backend.HealthURL)}
+		}
+		Register("backend:"+backend.Name, backend.Critical, backendCheck(backend.Name))
+	}
+	statusMutex.Unlock()
+
+	done := make(chan struct{})
+	if len(backends) > 0 {
+		go func() {
+			probeAll(backends)
+			ticker := clock.NewTicker(ProbeInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C():
+					probeAll(backends)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func probeAll(backends []Backend) {
+	var wg sync.WaitGroup
+	for _, backend := range backends {
+		wg.Add(1)
+		go func(backend Backend) {
+			defer wg.Done()
+			start := clock.Now()
+			err := probe(backend)
+			record(backend, err, start, clock.Since(start))
+		}(backend)
+	}
+	wg.Wait()
+}
+
+func probe(backend Backend) error {
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	defer cancel()
+	if backend.GRPC {
+		return probeGRPC(ctx, backend)
+	}
+	req, err := http.NewRequest(http.MethodGet, backend.HealthURL, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: ProbeTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func urlHost(rawurl string) string {
+	u, err := neturl.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// record stores the result of a probe, logging when the backend's status changes
+//
+// The first probe sets the status of a backend, after which it changes once
+// UnhealthyThreshold or HealthyThreshold probes in a row disagree with it.
+func record(backend Backend, err error, at time.Time, latency time.Duration) {
+	status := Up
+	message := ""
+	threshold := HealthyThreshold
+	if err != nil {
+		status = Down
+		message = err.Error()
+		threshold = UnhealthyThreshold
+	}
+
+	statusMutex.Lock()
+	current := statuses[backend.Name]
+	previous := current.Status
+	current.Error = message
+	current.LastProbe = at
+	current.Latency = latency.Seconds()
+	changed := false
+	if current.Status == status {
+		current.consecutive = 0
+	} else {
+		current.consecutive++
+		if current.Status == Unknown || current.consecutive >= threshold {
+			changed = true
+			current.Status = status
+			current.Since = at
+			current.consecutive = 0
+		}
+	}
+	statusMutex.Unlock()
+
+	if changed && status == Down {
+		logger.Log(logger.WARN, "Backend "+backend.Name+" is down: "+message)
+		alerts.Send(alerts.Alert{
+			Kind:    alerts.BackendDown,
+			Owner:   backend.Owner,
+			Backend: backend.Name,
+			Summary: "Backend " + backend.Name + " is down: " + message,
+		}, urlHost(backend.HealthURL))
+	} else if changed {
+		logger.Log(logger.INFO, "Backend "+backend.Name+" is up")
+		// Backends seen up on their first probe were never reported down
+		if previous == Down {
+			alerts.Send(alerts.Alert{
+				Kind:    alerts.BackendUp,
+				Owner:   backend.Owner,
+				Backend: backend.Name,
+				Summary: "Backend " + backend.Name + " is up",
+			}, urlHost(backend.HealthURL))
+		}
+	}
+}
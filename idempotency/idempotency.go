@@ -0,0 +1,126 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package idempotency deduplicates POST requests carrying an Idempotency-Key for routes which opt in with an IdempotencyPolicy
+//
+// The first request for a key is proxied and its response stored, retries of it within the
+// policy's TTL are answered with the stored response rather than reaching the service again.
+// A retry sent while the first request is in flight is rejected with 409 Conflict, and a
+// request reusing a key for a different request with 422 Unprocessable Entity.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/payload"
+	"github.com/arbor-dev/arbor/ratelimit"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// HeaderName is the header callers send their idempotency keys in
+var HeaderName = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed to retries
+var ReplayedHeader = "Idempotent-Replayed"
+
+// DefaultTTL is how long responses are replayed for when the route's policy does not set a TTL
+var DefaultTTL = 24 * time.Hour
+
+// InFlightTimeout is how long a key stays claimed by a request which has not been answered, e.g. as the gateway went down
+var InFlightTimeout = time.Minute
+
+// MaxKeyLength is the length of the longest key accepted
+var MaxKeyLength = 255
+
+// Entry is the request a key was claimed for and, once it was answered, its response
+type Entry struct {
+	//Fingerprint identifies the request, retries must be the same request
+	Fingerprint string
+	//Status is 0 while the request is in flight
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Expires time.Time
+}
+
+// InFlight reports whether the request the key was claimed for has not been answered yet
+func (e *Entry) InFlight() bool {
+	return e.Status == 0
+}
+
+// Store holds the requests keys were claimed for and their responses
+type Store interface {
+	// Claim stores pending under key unless the key is already claimed, returning the entry it is claimed by or nil
+	Claim(key string, pending *Entry) (*Entry, error)
+	// Set stores the response to the request which claimed key until it expires
+	Set(key string, entry *Entry) error
+	// Release drops key, so the request can be retried
+	Release(key string) error
+}
+
+// Responses is the store of responses, replace it with a RedisStore to deduplicate retries sent to other replicas
+var Responses Store = NewMemoryStore()
+
+// Policy returns the idempotency policy of the route r was routed to, or nil if it is not deduplicated
+func Policy(r *http.Request) *services.IdempotencyPolicy {
+	if r.Method != http.MethodPost {
+		return nil
+	}
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	return route.Idempotency
+}
+
+// TTL returns how long responses are replayed for under policy
+func TTL(policy *services.IdempotencyPolicy) time.Duration {
+	if policy.TTL > 0 {
+		return policy.TTL
+	}
+	return DefaultTTL
+}
+
+// Key is the key the caller's idempotency key is stored under
+//
+// Keys are scoped to the route and the caller's verified identity, as ratelimit.ByClient tells
+// callers apart, so callers can not replay each other's responses by guessing their keys. The
+// Authorization header can not be used, routes with a token replace it before keys are claimed.
+// The identity is hashed, as keys are kept in shared stores.
+func Key(r *http.Request, key string) string {
+	route, _ := services.RouteFromContext(r.Context())
+	caller := sha256.Sum256([]byte(ratelimit.ByClient(r)))
+	return route.Name + "\n" + hex.EncodeToString(caller[:]) + "\n" + key
+}
+
+// Fingerprint identifies the caller's request from its path and body, bodies with the same meaning share a fingerprint
+func Fingerprint(r *http.Request, body []byte) string {
+	return r.URL.RequestURI() + "\n" + payload.Hash(r.Header.Get("Content-Type"), body)
+}
+
+// Pending creates the entry claiming a key for a request in flight
+func Pending(fingerprint string) *Entry {
+	return &Entry{Fingerprint: fingerprint, Expires: clock.Now().Add(InFlightTimeout)}
+}
+
+// Answered creates the entry storing the response to the request with fingerprint for ttl
+func Answered(fingerprint string, status int, header http.Header, body []byte, ttl time.Duration) *Entry {
+	return &Entry{
+		Fingerprint: fingerprint,
+		Status:      status,
+		Header:      header.Clone(),
+		Body:        body,
+		Expires:     clock.Now().Add(ttl),
+	}
+}
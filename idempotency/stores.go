@@ -0,0 +1,166 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/redis"
+)
+
+// MemoryStore keeps responses in memory, for a single replica
+type MemoryStore struct {
+	mutex     sync.Mutex
+	entries   map[string]*Entry
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+// sweep drops the expired entries, at most once a minute
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.Expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Claim stores pending under key unless the key is already claimed, returning the entry it is claimed by or nil
+func (s *MemoryStore) Claim(key string, pending *Entry) (*Entry, error) {
+	now := clock.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sweep(now)
+	if entry, ok := s.entries[key]; ok && now.Before(entry.Expires) {
+		return entry, nil
+	}
+	s.entries[key] = pending
+	return nil, nil
+}
+
+// Set stores the response to the request which claimed key until it expires
+func (s *MemoryStore) Set(key string, entry *Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// Release drops key, so the request can be retried
+func (s *MemoryStore) Release(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// RedisStore keeps responses in Redis so retries sent to any replica are deduplicated
+//
+// Responses are encrypted with encryption.AtRest when it is configured.
+type RedisStore struct {
+	Client *redis.Client
+	//Prefix namespaces the responses in Redis
+	Prefix string
+}
+
+// key hashes keys, so the keys callers sent are not kept in Redis
+func (s *RedisStore) key(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	if s.Prefix == "" {
+		return "arbor:idempotency:" + hex.EncodeToString(sum[:])
+	}
+	return s.Prefix + hex.EncodeToString(sum[:])
+}
+
+// seal encodes entry to be stored under redisKey
+func seal(redisKey string, entry *Entry) (string, string, error) {
+	ttl := entry.Expires.Sub(clock.Now())
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", "", err
+	}
+	data, err = encryption.SealAtRest(data, []byte(redisKey))
+	if err != nil {
+		return "", "", err
+	}
+	return string(data), strconv.FormatInt(int64(ttl/time.Millisecond), 10), nil
+}
+
+// Claim stores pending under key unless the key is already claimed, returning the entry it is claimed by or nil
+func (s *RedisStore) Claim(key string, pending *Entry) (*Entry, error) {
+	redisKey := s.key(key)
+	data, ttl, err := seal(redisKey, pending)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := s.Client.Do("SET", redisKey, data, "NX", "PX", ttl)
+		if err != nil {
+			return nil, err
+		}
+		if reply != nil {
+			return nil, nil
+		}
+		stored, err := s.Client.String("GET", redisKey)
+		if err == redis.ErrNil {
+			// The claim expired or was released in between, claim it again
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		opened, err := encryption.OpenAtRest([]byte(stored), []byte(redisKey))
+		if err != nil {
+			return nil, err
+		}
+		entry := new(Entry)
+		err = json.Unmarshal(opened, entry)
+		if err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+}
+
+// Set stores the response to the request which claimed key, letting Redis expire it
+func (s *RedisStore) Set(key string, entry *Entry) error {
+	redisKey := s.key(key)
+	data, ttl, err := seal(redisKey, entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.Do("SET", redisKey, data, "PX", ttl)
+	return err
+}
+
+// Release drops key, so the request can be retried
+func (s *RedisStore) Release(key string) error {
+	_, err := s.Client.Do("DEL", s.key(key))
+	return err
+}
@@ -0,0 +1,237 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package jobs tracks long-running jobs started through routes with a JobPolicy
+//
+// Services answer requests starting a job with 202 Accepted and a Location header
+// pointing at the job's status. arbor answers the caller with a job of its own,
+// polls the status URL until the job finishes, and serves every job the same way
+// at /jobs/{id} whichever service runs it.
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/ratelimit"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/gorilla/mux"
+)
+
+// The states of a job
+const (
+	Pending   = "pending"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+// Job is a long-running job started through arbor
+type Job struct {
+	ID      string          `json:"id"`
+	Status  string          `json:"status"`
+	Created time.Time       `json:"created"`
+	Updated time.Time       `json:"updated"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+
+	//Owner is the client which started the job, only it may see the job
+	Owner string `json:"-"`
+}
+
+// Finished reports whether the job has succeeded or failed
+func (j *Job) Finished() bool {
+	return j.Status == Succeeded || j.Status == Failed
+}
+
+// Store keeps jobs
+type Store interface {
+	// Get returns the job with the ID, nil if there is none
+	Get(id string) (*Job, error)
+	// Set adds or replaces a job
+	Set(job *Job) error
+}
+
+// Jobs is where jobs are kept
+var Jobs Store = NewMemoryStore()
+
+// Path is where the server serves jobs, at Path/{id}, empty to not serve them
+var Path = "/jobs"
+
+// DefaultPollInterval is how often status URLs are polled for routes which do not set it
+var DefaultPollInterval = 2 * time.Second
+
+// DefaultTimeout is how long jobs may run for routes which do not set it
+var DefaultTimeout = time.Hour
+
+// Retention is how long finished jobs are kept
+var Retention = 24 * time.Hour
+
+// MaxResultSize is the largest status response kept as a job's result
+var MaxResultSize int64 = 1 << 20
+
+// states are the common names services use for each state
+var states = map[string]string{
+	"pending": Pending, "queued": Pending, "accepted": Pending, "created": Pending, "submitted": Pending,
+	"running": Running, "in_progress": Running, "inprogress": Running, "processing": Running, "started": Running,
+	"succeeded": Succeeded, "success": Succeeded, "successful": Succeeded, "completed": Succeeded, "complete": Succeeded, "done": Succeeded, "finished": Succeeded,
+	"failed": Failed, "failure": Failed, "error": Failed, "errored": Failed, "canceled": Failed, "cancelled": Failed, "aborted": Failed,
+}
+
+// normalize maps a service's state to arbor's, unknown states are taken to be running
+func normalize(policy services.JobPolicy, state string) string {
+	if mapped, ok := policy.States[state]; ok {
+		return mapped
+	}
+	if mapped, ok := states[strings.ToLower(state)]; ok {
+		return mapped
+	}
+	return Running
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Poller fetches the status of a job from its service
+type Poller func() (*http.Response, error)
+
+// Track creates a pending job for the caller of r and polls its status until it finishes
+func Track(r *http.Request, policy services.JobPolicy, poll Poller) (*Job, error) {
+	now := clock.Now()
+	job := &Job{
+		ID:      newID(),
+		Status:  Pending,
+		Created: now,
+		Updated: now,
+		Owner:   ratelimit.ByClient(r),
+	}
+	err := Jobs.Set(job)
+	if err != nil {
+		return nil, err
+	}
+	go follow(*job, policy, poll)
+	return job, nil
+}
+
+// follow polls a job's status until it finishes or times out
+func follow(job Job, policy services.JobPolicy, poll Poller) {
+	interval := policy.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	timeout := policy.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline := job.Created.Add(timeout)
+
+	for !job.Finished() {
+		<-clock.After(interval)
+		if !clock.Now().Before(deadline) {
+			job.Status = Failed
+			job.Error = "job timed out after " + timeout.String()
+		} else if !update(&job, policy, poll) {
+			continue
+		}
+		job.Updated = clock.Now()
+		err := Jobs.Set(&job)
+		if err != nil {
+			logger.Log(logger.ERR, "Could not save job "+job.ID+": "+err.Error())
+		}
+	}
+}
+
+// update polls the job's status once, reporting whether the job changed
+func update(job *Job, policy services.JobPolicy, poll Poller) bool {
+	resp, err := poll()
+	if err != nil {
+		// The service may be restarting, the job is failed if it stays unreachable until the timeout
+		logger.Log(logger.WARN, "Could not poll job "+job.ID+": "+err.Error())
+		return false
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResultSize+1))
+	if err != nil {
+		return false
+	}
+
+	status, result, message := job.Status, json.RawMessage(nil), ""
+	switch {
+	case resp.StatusCode == http.StatusSeeOther:
+		// Services which redirect to the job's result once it is done
+		status = Succeeded
+	case resp.StatusCode >= 500:
+		return false
+	case resp.StatusCode >= 400:
+		status = Failed
+		message = "status URL responded with " + strconv.Itoa(resp.StatusCode)
+	default:
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return false
+		}
+		field := policy.StatusField
+		if field == "" {
+			field = "status"
+		}
+		state, _ := fields[field].(string)
+		status = normalize(policy, state)
+		if status == Failed {
+			message, _ = fields["error"].(string)
+			if message == "" {
+				message = "job " + state
+			}
+		}
+	}
+	if status != Pending && status != Running && int64(len(body)) <= MaxResultSize && json.Valid(body) {
+		result = body
+	}
+
+	changed := status != job.Status || message != job.Error || string(result) != string(job.Result)
+	job.Status, job.Result, job.Error = status, result, message
+	return changed
+}
+
+// Handler serves the job at Path/{id} to the client which started it
+func Handler(w http.ResponseWriter, r *http.Request) {
+	job, err := Jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not read job: "+err.Error())
+		apierror.Write(w, r, http.StatusInternalServerError, "", nil)
+		return
+	}
+	// Jobs of other clients are not found rather than forbidden, so their IDs are not confirmed
+	if job == nil || job.Owner != ratelimit.ByClient(r) {
+		apierror.Write(w, r, http.StatusNotFound, "", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !job.Finished() {
+		w.Header().Set("Retry-After", "1")
+	}
+	json.NewEncoder(w).Encode(job)
+}
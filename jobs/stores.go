@@ -0,0 +1,63 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package jobs
+
+import (
+	"sync"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// MemoryStore keeps jobs in memory, so each replica only knows the jobs started through it
+type MemoryStore struct {
+	mutex sync.Mutex
+	jobs  map[string]Job
+	sets  int
+}
+
+// NewMemoryStore creates an empty in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+// sweepInterval is how many sets pass between removing expired jobs
+const sweepInterval = 256
+
+func expired(job Job) bool {
+	return job.Finished() && clock.Since(job.Updated) > Retention
+}
+
+// Get returns the job with the ID, nil if there is none
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, exists := s.jobs[id]
+	if !exists || expired(job) {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+// Set adds or replaces a job
+func (s *MemoryStore) Set(job *Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sets++
+	if s.sets%sweepInterval == 0 {
+		for id, stored := range s.jobs {
+			if expired(stored) {
+				delete(s.jobs, id)
+			}
+		}
+	}
+	s.jobs[job.ID] = *job
+	return nil
+}
@@ -0,0 +1,173 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Preset formats for the access log
+//
+// Formats are text/template strings evaluated against an AccessEntry.
+const (
+	//CommonLogFormat is the NCSA Common Log Format
+	CommonLogFormat = `{{.Host}} - {{.Username}} [{{.Timestamp}}] "{{.Request}}" {{.Status}} {{.Size}}`
+	//CombinedLogFormat is the NCSA Combined Log Format
+	CombinedLogFormat = CommonLogFormat + ` "{{.RefererOrDash}}" "{{.UserAgentOrDash}}"`
+	//ArborLogFormat is the Combined Log Format extended with request ID, latencies and bytes received
+	ArborLogFormat = CombinedLogFormat + ` {{.RequestID}} {{.Latency}} {{.UpstreamLatency}} {{.BytesReceived}}`
+)
+
+//AccessLogFormat is the format of access log lines, a preset or a custom template
+var AccessLogFormat = CombinedLogFormat
+
+//AccessLogOutput is where access log lines are written, nil disables the access log
+var AccessLogOutput io.Writer
+
+// AccessEntry describes a completed request for the access log
+type AccessEntry struct {
+	RemoteAddr      string
+	ClientIP        string
+	User            string
+	Method          string
+	URI             string
+	Proto           string
+	Referer         string
+	UserAgent       string
+	RequestID       string
+	Route           string
+	Time            time.Time
+	Status          int
+	BytesSent       int64
+	BytesReceived   int64
+	Latency         time.Duration
+	UpstreamLatency time.Duration
+}
+
+// Host is the client address without the port, resolved through the trusted proxies if known
+func (e *AccessEntry) Host() string {
+	if e.ClientIP != "" {
+		return e.ClientIP
+	}
+	for i := len(e.RemoteAddr) - 1; i >= 0; i-- {
+		if e.RemoteAddr[i] == ':' {
+			return e.RemoteAddr[:i]
+		}
+	}
+	return orDash(e.RemoteAddr)
+}
+
+// Username is the authenticated user or "-"
+func (e *AccessEntry) Username() string {
+	return orDash(e.User)
+}
+
+// Timestamp is the request time in Common Log Format
+func (e *AccessEntry) Timestamp() string {
+	return e.Time.Format("02/Jan/2006:15:04:05 -0700")
+}
+
+// Request is the request line
+func (e *AccessEntry) Request() string {
+	return e.Method + " " + e.URI + " " + e.Proto
+}
+
+// Size is the number of body bytes sent to the client or "-"
+func (e *AccessEntry) Size() string {
+	if e.BytesSent == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(e.BytesSent, 10)
+}
+
+// RefererOrDash is the Referer header or "-"
+func (e *AccessEntry) RefererOrDash() string {
+	return orDash(e.Referer)
+}
+
+// UserAgentOrDash is the User-Agent header or "-"
+func (e *AccessEntry) UserAgentOrDash() string {
+	return orDash(e.UserAgent)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type accessContextKey struct{}
+
+// NewAccessContext returns a copy of ctx carrying the access log entry for the request
+func NewAccessContext(ctx context.Context, e *AccessEntry) context.Context {
+	return context.WithValue(ctx, accessContextKey{}, e)
+}
+
+// AccessEntryFromContext returns the access log entry for the request, or nil
+//
+// Components handling the request use it to record details such as upstream latency.
+func AccessEntryFromContext(ctx context.Context) *AccessEntry {
+	e, _ := ctx.Value(accessContextKey{}).(*AccessEntry)
+	return e
+}
+
+var accessLogMutex sync.Mutex
+var accessLogFormat string
+var accessLogTemplate *template.Template
+
+// LogAccess writes an entry to the access log
+func LogAccess(e *AccessEntry) {
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	if AccessLogOutput == nil {
+		return
+	}
+	if accessLogTemplate == nil || accessLogFormat != AccessLogFormat {
+		t, err := template.New("access").Parse(AccessLogFormat)
+		if err != nil {
+			Log(ERR, "Invalid access log format: "+err.Error())
+			return
+		}
+		accessLogTemplate = t
+		accessLogFormat = AccessLogFormat
+	}
+	var line bytes.Buffer
+	err := accessLogTemplate.Execute(&line, e)
+	if err != nil {
+		Log(ERR, "Could not format access log entry: "+err.Error())
+		return
+	}
+	line.WriteByte('\n')
+	_, err = io.WriteString(AccessLogOutput, Sanitize(line.String()))
+	if err != nil {
+		Log(ERR, "Could not write access log entry: "+err.Error())
+	}
+}
+
+// OpenAccessLog directs the access log to the file at location, appending to it
+func OpenAccessLog(location string) error {
+	f, err := os.OpenFile(location, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	accessLogMutex.Lock()
+	AccessLogOutput = f
+	accessLogMutex.Unlock()
+	return nil
+}
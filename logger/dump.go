@@ -0,0 +1,68 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httputil"
+)
+
+// DumpTraffic logs every request sent to a backend and its response in full, for local development
+//
+// Dumps include credentials and personal data, so never turn it on in production.
+var DumpTraffic = false
+
+// DumpBackendRequest logs the request sent to a backend for the caller's request r, if DumpTraffic is on
+//
+// Without DumpTraffic, it is logged with its secrets redacted if LogBodies is on.
+func DumpBackendRequest(r *http.Request, req *http.Request, body []byte) {
+	if !DumpTraffic {
+		if LogBodies {
+			logRedactedRequest(r, req, body)
+		}
+		return
+	}
+	dump, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		LogForRequest(ERR, r, err.Error())
+		return
+	}
+	LogForRequest(DEBUG, r, "Backend request:\n\n"+string(dump)+prettyBody(body))
+}
+
+// DumpBackendResponse logs a backend's response to the caller's request r, if DumpTraffic is on
+//
+// Without DumpTraffic, it is logged with its secrets redacted if LogBodies is on.
+func DumpBackendResponse(r *http.Request, resp *http.Response, body []byte) {
+	if !DumpTraffic {
+		if LogBodies {
+			logRedactedResponse(DEBUG, r, "Backend response", resp, body)
+		}
+		return
+	}
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		LogForRequest(ERR, r, err.Error())
+		return
+	}
+	LogForRequest(DEBUG, r, "Backend response:\n\n"+string(dump)+prettyBody(body)+"\n")
+}
+
+// prettyBody indents JSON bodies so they are readable in the console
+func prettyBody(body []byte) string {
+	var indented bytes.Buffer
+	if json.Indent(&indented, body, "", "  ") == nil {
+		return indented.String()
+	}
+	return string(body)
+}
@@ -15,6 +15,8 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
+
+	"github.com/arbor-dev/arbor/requestid"
 )
 
 //Sev is an enum for Logger Severity
@@ -46,6 +48,7 @@ func Log(sev Sev, msg string) {
 	if !(LogLevel >= sev) && !(sev == FATAL) {
 		return
 	}
+	msg = Sanitize(msg)
 	if ColoredOutput {
 		switch sev {
 		case DEBUG:
@@ -81,27 +84,47 @@ func Log(sev Sev, msg string) {
 	}
 }
 
+//LogForRequest logs a message tagged with the ID of the request it concerns
+func LogForRequest(sev Sev, req *http.Request, msg string) {
+	id := requestid.FromRequest(req)
+	if id == "" {
+		Log(sev, msg)
+		return
+	}
+	Log(sev, "["+id+"] "+msg)
+}
+
 //LogReq is a helper to log requests
+//
+//Secrets are redacted and the body is only logged if LogBodies is on, unless DumpTraffic is on.
 func LogReq(sev Sev, req *http.Request) {
 	if !(LogLevel >= sev) && !(sev == FATAL) {
 		return
 	}
+	if !DumpTraffic {
+		logRedactedCallerRequest(sev, req)
+		return
+	}
 	rDump, err := httputil.DumpRequest(req, true)
 	if err != nil {
-		Log(ERR, err.Error())
+		LogForRequest(ERR, req, err.Error())
 		return
 	}
-	Log(sev, string("Request:\n\n")+string(rDump))
+	LogForRequest(sev, req, string("Request:\n\n")+string(rDump))
 }
 
 func LogResp(sev Sev, resp *http.Response) {
 	if !(LogLevel >= sev) && !(sev == FATAL) {
 		return
 	}
+	if !DumpTraffic {
+		logRedactedResponse(sev, resp.Request, "Response", resp, nil)
+		return
+	}
 	rDump, err := httputil.DumpResponse(resp, true)
 	if err != nil {
-		Log(ERR, err.Error())
+		LogForRequest(ERR, resp.Request, err.Error())
 		return
 	}
-	Log(sev, string("Response:\n\n")+string(rDump)+string('\n'))
+	LogForRequest(sev, resp.Request, string("Response:\n\n")+string(rDump)+string('\n'))
 }
@@ -0,0 +1,255 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// LogBodies logs the requests sent to backends and their responses at DEBUG level, with their secrets redacted
+//
+// Unlike DumpTraffic it is safe to turn on to troubleshoot production: the values of
+// RedactedHeaders, and of RedactedFields in JSON and form bodies and query strings, are
+// replaced with Redacted, and bodies are cut to MaxLoggedBody bytes.
+var LogBodies = false
+
+// MaxLoggedBody is the most bytes of each body LogBodies logs
+var MaxLoggedBody = 4096
+
+// RedactedFields are the names of the JSON fields, form fields and query parameters whose values are not logged
+//
+// Names match case-insensitively and at any depth of a JSON body.
+var RedactedFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "id_token",
+	"client_secret", "api_key", "apikey", "ssn", "credit_card", "card_number", "cvv"}
+
+// RedactedHeaders are the headers whose values are not logged
+var RedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Redacted replaces the values which are not logged
+const Redacted = "[REDACTED]"
+
+// logRedactedCallerRequest logs the caller's request r with its secrets redacted, and its body if LogBodies is on
+func logRedactedCallerRequest(sev Sev, r *http.Request) {
+	var body []byte
+	if LogBodies && r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		// The body is put back for the handlers after logging
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			LogForRequest(ERR, r, err.Error())
+			return
+		}
+	}
+	LogForRequest(sev, r, "Request:\n\n"+redactRequest(r, body))
+}
+
+// logRedactedRequest logs the request sent to a backend for the caller's request r, with its secrets redacted
+func logRedactedRequest(r *http.Request, req *http.Request, body []byte) {
+	if LogLevel < DEBUG {
+		return
+	}
+	LogForRequest(DEBUG, r, "Backend request:\n\n"+redactRequest(req, body))
+}
+
+// logRedactedResponse logs a response to the caller's request r, with its secrets redacted
+func logRedactedResponse(sev Sev, r *http.Request, title string, resp *http.Response, body []byte) {
+	if LogLevel < sev {
+		return
+	}
+	LogForRequest(sev, r, title+":\n\n"+resp.Proto+" "+resp.Status+"\n"+
+		redactHeader(resp.Header)+"\n"+redactBody(resp.Header.Get("Content-Type"), body)+"\n")
+}
+
+func redactRequest(req *http.Request, body []byte) string {
+	target := *req.URL
+	target.RawQuery = redactQuery(target.RawQuery)
+	return req.Method + " " + target.String() + " " + req.Proto + "\n" +
+		redactHeader(req.Header) + "\n" + redactBody(req.Header.Get("Content-Type"), body)
+}
+
+func redacted(name string) bool {
+	for _, field := range RedactedFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactHeader writes the header as it is sent, sorted by name and with the values of RedactedHeaders replaced
+func redactHeader(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines strings.Builder
+	for _, name := range names {
+		secret := false
+		for _, redactedHeader := range RedactedHeaders {
+			if strings.EqualFold(name, redactedHeader) {
+				secret = true
+			}
+		}
+		for _, value := range header[name] {
+			if secret {
+				value = Redacted
+			}
+			lines.WriteString(name + ": " + value + "\n")
+		}
+	}
+	return lines.String()
+}
+
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Redacted
+	}
+	for name := range query {
+		if redacted(name) {
+			query[name] = []string{Redacted}
+		}
+	}
+	return query.Encode()
+}
+
+// redactBody renders a body for the log, redacting JSON and form bodies and cutting it to MaxLoggedBody bytes
+//
+// Bodies which can not be redacted are only logged if they are text, so secrets in binary
+// formats are never logged.
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var rendered string
+	switch {
+	case json.Valid(body):
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		decoder.Decode(&document)
+		redactedBody, _ := json.Marshal(redactJSON(document))
+		rendered = string(redactedBody)
+	case mediaType == "application/x-www-form-urlencoded":
+		rendered = redactQuery(string(body))
+	case strings.HasPrefix(mediaType, "text/") && utf8.Valid(body):
+		rendered = string(body)
+	default:
+		return "<" + strconv.Itoa(len(body)) + " bytes of " + contentType + ">"
+	}
+	if MaxLoggedBody >= 0 && len(rendered) > MaxLoggedBody {
+		cut := MaxLoggedBody
+		// Cutting in the middle of a character would log invalid UTF-8
+		for cut > 0 && !utf8.RuneStart(rendered[cut]) {
+			cut--
+		}
+		rendered = rendered[:cut] + "... (" + strconv.Itoa(len(body)) + " bytes)"
+	}
+	return rendered
+}
+
+// redactJSON replaces the values of RedactedFields at any depth of a JSON document
+func redactJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if redacted(name) {
+				value[name] = Redacted
+			} else {
+				value[name] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+// RedactSecrets masks the secrets of every message before it is written to the log or the access log
+//
+// Sanitize masks credentials in Authorization style headers, bearer and basic tokens, URLs and
+// the query parameters and JSON fields named by RedactedFields, and matches of SecretPatterns.
+var RedactSecrets = true
+
+// SecretPatterns match further secrets which are masked in every message, e.g. API keys with a known prefix
+var SecretPatterns []*regexp.Regexp
+
+var (
+	credentialPattern = regexp.MustCompile(`(?i)\b(bearer|basic|digest|negotiate)\s+[A-Za-z0-9._~+/=-]+`)
+	userinfoPattern   = regexp.MustCompile(`(://[^/@:\s]*):[^/@\s]*@`)
+)
+
+var (
+	sanitizerMutex sync.Mutex
+	sanitizerKey   string
+	headerPattern  *regexp.Regexp
+	queryPattern   *regexp.Regexp
+	fieldPattern   *regexp.Regexp
+)
+
+// namePatterns compiles the patterns matching the values of RedactedHeaders and RedactedFields, once for each list
+func namePatterns() (*regexp.Regexp, *regexp.Regexp, *regexp.Regexp) {
+	sanitizerMutex.Lock()
+	defer sanitizerMutex.Unlock()
+	key := strings.Join(RedactedHeaders, "\n") + "\n\n" + strings.Join(RedactedFields, "\n")
+	if headerPattern == nil || key != sanitizerKey {
+		headers := make([]string, len(RedactedHeaders))
+		for i, header := range RedactedHeaders {
+			headers[i] = regexp.QuoteMeta(header)
+		}
+		fields := make([]string, len(RedactedFields))
+		for i, field := range RedactedFields {
+			fields[i] = regexp.QuoteMeta(field)
+		}
+		headerPattern = regexp.MustCompile(`(?im)^(\s*(?:` + strings.Join(headers, "|") + `):[ \t]*)\S.*$`)
+		queryPattern = regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(fields, "|") + `)=)[^&;#\s"'<>]*`)
+		fieldPattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(fields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+		sanitizerKey = key
+	}
+	return headerPattern, queryPattern, fieldPattern
+}
+
+// Sanitize masks the secrets of a message with Redacted, if RedactSecrets is on
+func Sanitize(msg string) string {
+	if !RedactSecrets {
+		return msg
+	}
+	headers, query, fields := namePatterns()
+	msg = headers.ReplaceAllString(msg, "${1}"+Redacted)
+	msg = credentialPattern.ReplaceAllString(msg, "${1} "+Redacted)
+	msg = userinfoPattern.ReplaceAllString(msg, "${1}:"+Redacted+"@")
+	msg = query.ReplaceAllString(msg, "${1}"+Redacted)
+	msg = fields.ReplaceAllString(msg, `${1}"`+Redacted+`"`)
+	for _, pattern := range SecretPatterns {
+		msg = pattern.ReplaceAllString(msg, Redacted)
+	}
+	return msg
+}
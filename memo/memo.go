@@ -0,0 +1,82 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package memo shares lookups between the stages of a request, so the same record is only fetched once per request
+//
+// Stages which need the same lookup fetch it through Fetch with the same key:
+//
+//	account, err := memo.Fetch(r.Context(), "account:"+id, func() (interface{}, error) {
+//		return accounts.Get(id)
+//	})
+//
+// The first stage fetches the record, the others get the result it fetched. Results are
+// dropped with the request, so they never outlive it.
+package memo
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey struct{}
+
+// entry is a lookup of the request, done is closed once it was fetched
+type entry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// memo holds the lookups of a request
+type memo struct {
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+// NewContext returns a copy of ctx carrying an empty memo for the request
+func NewContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, &memo{entries: map[string]*entry{}})
+}
+
+// Fetch returns the result of the lookup of key for the request of ctx, calling fetch if it was not looked up yet
+//
+// Stages looking up a key which is being fetched wait for its result, errors included.
+// Without a memo in ctx, fetch is always called.
+func Fetch(ctx context.Context, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	m, ok := ctx.Value(contextKey{}).(*memo)
+	if !ok {
+		return fetch()
+	}
+	m.mutex.Lock()
+	e, exists := m.entries[key]
+	if exists {
+		m.mutex.Unlock()
+		<-e.done
+		return e.value, e.err
+	}
+	e = &entry{done: make(chan struct{})}
+	m.entries[key] = e
+	m.mutex.Unlock()
+
+	defer close(e.done)
+	e.value, e.err = fetch()
+	return e.value, e.err
+}
+
+// Forget drops the result of the lookup of key for the request of ctx, e.g. once a stage changed the record
+func Forget(ctx context.Context, key string) {
+	m, ok := ctx.Value(contextKey{}).(*memo)
+	if !ok {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.entries, key)
+}
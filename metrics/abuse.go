@@ -8,9 +8,7 @@
 * this license in a file with the distribution.
 **/
 
-package server
+package metrics
 
-type jsonErr struct {
-	Code int    `json:"code"`
-	Text string `json:"text"`
-}
+// AbuseVerdicts counts the requests stopped by the abuse classifiers, by action (throttle, challenge or block)
+var AbuseVerdicts = NewCounter("arbor_abuse_verdicts_total", "Requests stopped by the abuse classifiers, by action.", "action")
@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// CertificateExpiry is the number of seconds until each served or monitored certificate expires, by file
+var CertificateExpiry = NewGauge("arbor_certificate_expiry_seconds", "Seconds until a served or monitored certificate expires.", "certificate")
@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// ConfigRollbacks counts the reloaded configurations which were not kept, by reason (invalid or errors)
+var ConfigRollbacks = NewCounter("arbor_config_rollbacks_total", "Reloaded configurations which were rolled back, by reason.", "reason")
@@ -0,0 +1,84 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Counter is a monotonically increasing metric partitioned by labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter
+//
+// It panics if the name or labels are invalid or the name is already registered.
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*series),
+		values: make(map[string]float64),
+	}
+	register(name, labels, c)
+	return c
+}
+
+// Inc increments the counter for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter for the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	checkLabelValues(c.name, c.labels, labelValues)
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: %s can not decrease", c.name))
+	}
+	key := seriesKey(labelValues)
+	c.mutex.Lock()
+	if _, exists := c.series[key]; !exists {
+		c.series[key] = &series{labelValues: append([]string(nil), labelValues...)}
+	}
+	c.values[key] += v
+	c.mutex.Unlock()
+}
+
+// Value returns the current value of the counter for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[seriesKey(labelValues)]
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, c.series[key].labelValues), formatFloat(c.values[key]))
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
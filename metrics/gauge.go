@@ -0,0 +1,90 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Gauge is a metric which may go up and down, partitioned by labels
+type Gauge struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+	values map[string]float64
+}
+
+// NewGauge creates and registers a gauge
+//
+// It panics if the name or labels are invalid or the name is already registered.
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*series),
+		values: make(map[string]float64),
+	}
+	register(name, labels, g)
+	return g
+}
+
+// Set sets the gauge for the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return v })
+}
+
+// Add adds v, which may be negative, to the gauge for the given label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.update(labelValues, func(old float64) float64 { return old + v })
+}
+
+// Delete removes the series for the given label values
+func (g *Gauge) Delete(labelValues ...string) {
+	checkLabelValues(g.name, g.labels, labelValues)
+	key := seriesKey(labelValues)
+	g.mutex.Lock()
+	delete(g.series, key)
+	delete(g.values, key)
+	g.mutex.Unlock()
+}
+
+func (g *Gauge) update(labelValues []string, f func(float64) float64) {
+	checkLabelValues(g.name, g.labels, labelValues)
+	key := seriesKey(labelValues)
+	g.mutex.Lock()
+	if _, exists := g.series[key]; !exists {
+		g.series[key] = &series{labelValues: append([]string(nil), labelValues...)}
+	}
+	g.values[key] = f(g.values[key])
+	g.mutex.Unlock()
+}
+
+// Value returns the current value of the gauge for the given label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.values[seriesKey(labelValues)]
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, key := range sortedKeys(g.series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, g.series[key].labelValues), formatFloat(g.values[key]))
+	}
+}
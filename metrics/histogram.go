@@ -0,0 +1,128 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Histogram counts observations into cumulative buckets partitioned by labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	buckets     []float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewHistogram creates and registers a histogram with the given bucket upper bounds
+//
+// DefaultBuckets are used if buckets is nil. It panics if the name or labels
+// are invalid or the name is already registered.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: sortedBuckets(buckets),
+		series:  make(map[string]*histogramSeries),
+	}
+	register(name, labels, h)
+	return h
+}
+
+func sortedBuckets(buckets []float64) []float64 {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return b
+}
+
+// sameBuckets reports whether two layouts are the same slice, layouts are never modified once made
+func sameBuckets(a []float64, b []float64) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Observe records v for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.observe(h.buckets, v, labelValues)
+}
+
+// observe records v, laying out the buckets of a new series with buckets
+//
+// A series laid out with other buckets starts over, as its counts can not be moved to them.
+func (h *Histogram) observe(buckets []float64, v float64, labelValues []string) {
+	checkLabelValues(h.name, h.labels, labelValues)
+	key := seriesKey(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, exists := h.series[key]
+	if !exists || !sameBuckets(s.buckets, buckets) {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			buckets:     buckets,
+			counts:      make([]uint64, len(buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range s.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations for the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, exists := h.series[seriesKey(labelValues)]; exists {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range s.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labelValues), s.count)
+	}
+}
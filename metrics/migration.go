@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// MigrationComparisons counts the responses of backends being migrated compared with their new backend's, by backend and result
+var MigrationComparisons = NewCounter("arbor_migration_comparisons_total", "Responses of backends being migrated compared with their new backend's, by result.", "backend", "result")
@@ -0,0 +1,143 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/services"
+)
+
+// RouteLabel is the label carrying the name of the route a metric was recorded on
+const RouteLabel = "route"
+
+// UnknownRoute is the route label for requests which did not match a route
+const UnknownRoute = "UNKNOWN"
+
+// RequestsTotal counts the requests served by arbor
+var RequestsTotal = NewCounter("arbor_requests_total", "Requests served by the gateway.", RouteLabel, "method", "code")
+
+// ClassLabel is the label carrying the latency class of a route
+const ClassLabel = "class"
+
+// LatencyClasses are the latency histogram buckets, in seconds, by route latency class
+//
+// Routes declare their class with LatencyClass, so long running job routes can use
+// coarser buckets than fast APIs. Routes without a known class use DefaultBuckets.
+// The classes are read by LoadLatencyClasses when routes are registered, edits after
+// that take effect with the next router.
+var LatencyClasses = map[string][]float64{
+	"fast": {.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	"slow": {.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+}
+
+// RequestDuration observes the time taken to serve each request
+var RequestDuration = NewHistogram("arbor_request_duration_seconds", "Time taken to serve requests.", nil, RouteLabel, ClassLabel)
+
+var classBucketsMutex sync.RWMutex
+var classBuckets = make(map[string][]float64)
+var defaultClassBuckets = sortedBuckets(nil)
+
+// LoadLatencyClasses lays out the buckets of LatencyClasses for the requests recorded from now on
+//
+// server.NewRouter and server.NewTrieRouter call it when they register routes. Series of a
+// class whose buckets changed start over with the new buckets.
+func LoadLatencyClasses() {
+	classBucketsMutex.Lock()
+	defer classBucketsMutex.Unlock()
+	buckets := make(map[string][]float64, len(LatencyClasses))
+	for class, layout := range LatencyClasses {
+		buckets[class] = sortedBuckets(layout)
+		// Unchanged classes keep their layout, so their series go on
+		if previous, ok := classBuckets[class]; ok && reflect.DeepEqual(previous, buckets[class]) {
+			buckets[class] = previous
+		}
+	}
+	classBuckets = buckets
+}
+
+// bucketsForClass returns the sorted buckets of a latency class
+func bucketsForClass(class string) []float64 {
+	classBucketsMutex.RLock()
+	defer classBucketsMutex.RUnlock()
+	if buckets, ok := classBuckets[class]; ok {
+		return buckets
+	}
+	return defaultClassBuckets
+}
+
+// RecordRequest records a completed request in the built in request metrics
+func RecordRequest(r *http.Request, status int, latency time.Duration) {
+	route := RouteName(r)
+	class := RouteClass(r)
+	RequestsTotal.Inc(route, r.Method, strconv.Itoa(status))
+	RequestDuration.observe(bucketsForClass(class), latency.Seconds(), []string{route, class})
+}
+
+// RouteClass returns the latency class of the route serving r
+func RouteClass(r *http.Request) string {
+	if route, ok := services.RouteFromContext(r.Context()); ok {
+		return route.LatencyClass
+	}
+	return ""
+}
+
+// RouteName returns the name of the route serving r
+func RouteName(r *http.Request) string {
+	if route, ok := services.RouteFromContext(r.Context()); ok {
+		return route.Name
+	}
+	return UnknownRoute
+}
+
+// RouteCounter is a custom counter labelled with the route of the request it is recorded for
+//
+// Middlewares and hooks use it to count events such as orders created alongside the request metrics.
+type RouteCounter struct {
+	*Counter
+}
+
+// NewRouteCounter creates and registers a counter labelled by route and the given labels
+func NewRouteCounter(name string, help string, labels ...string) *RouteCounter {
+	return &RouteCounter{NewCounter(name, help, append([]string{RouteLabel}, labels...)...)}
+}
+
+// IncFor increments the counter for the route serving r
+func (c *RouteCounter) IncFor(r *http.Request, labelValues ...string) {
+	c.AddFor(r, 1, labelValues...)
+}
+
+// AddFor adds v to the counter for the route serving r
+func (c *RouteCounter) AddFor(r *http.Request, v float64, labelValues ...string) {
+	c.Add(v, append([]string{RouteName(r)}, labelValues...)...)
+}
+
+// RouteHistogram is a custom histogram labelled with the route of the request it is recorded for
+type RouteHistogram struct {
+	*Histogram
+}
+
+// NewRouteHistogram creates and registers a histogram labelled by route and the given labels
+func NewRouteHistogram(name string, help string, buckets []float64, labels ...string) *RouteHistogram {
+	return &RouteHistogram{NewHistogram(name, help, buckets, append([]string{RouteLabel}, labels...)...)}
+}
+
+// ObserveFor records v for the route serving r
+func (h *RouteHistogram) ObserveFor(r *http.Request, v float64, labelValues ...string) {
+	h.Observe(v, append([]string{RouteName(r)}, labelValues...)...)
+}
+
+// RequestsShed counts the requests rejected by admission control, by reason
+var RequestsShed = NewCounter("arbor_requests_shed_total", "Requests rejected by admission control.", "reason")
@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// Sagas counts the composite writes fanned out to several backends, by outcome (committed, compensated or compensation_failed)
+var Sagas = NewCounter("arbor_sagas_total", "Composite writes fanned out to several backends, by outcome.", "outcome")
@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// ShadowRequests counts the requests mirrored to shadow backends, by backend and outcome (sent, failed or dropped)
+var ShadowRequests = NewCounter("arbor_shadow_requests_total", "Requests mirrored to shadow backends.", "backend", "outcome")
@@ -0,0 +1,15 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// SLABreaches counts the requests whose backend did not start responding within their route's latency SLA,
+// by route and outcome (retried or aborted)
+var SLABreaches = NewRouteCounter("arbor_sla_breaches_total", "Requests whose backend did not respond within the route's latency SLA.", "outcome")
@@ -0,0 +1,14 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// BackendThrottling counts the 429 Too Many Requests responses of backends arbor acted on, by backend and action (retried, surfaced or paused)
+var BackendThrottling = NewCounter("arbor_backend_throttling_total", "429 responses from backends arbor retried, surfaced or paused the backend for.", "backend", "action")
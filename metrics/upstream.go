@@ -0,0 +1,18 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package metrics
+
+// UpstreamDuration observes the time backends take to respond to arbor, by backend (host), method and code
+//
+// Unlike RequestDuration it is recorded per backend rather than per route, so several routes
+// served by one backend add up to its load. Requests the backend did not answer, such as
+// refused connections and timeouts, are recorded with the code "error".
+var UpstreamDuration = NewHistogram("arbor_upstream_duration_seconds", "Time taken by backends to respond to the gateway.", nil, "backend", "method", "code")
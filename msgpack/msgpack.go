@@ -0,0 +1,434 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package msgpack translates between MessagePack and JSON
+//
+// Maps become objects in the order of their entries, their keys must be strings or integers.
+// Binary values become base64 strings and timestamps RFC 3339 strings, other extension types
+// have no JSON translation. Translating JSON to MessagePack keeps the order of object members
+// and uses the smallest encoding of each value, integers become integers and other numbers
+// 64 bit floats.
+package msgpack
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"strconv"
+	"time"
+)
+
+// MediaType is the media type of MessagePack bodies
+const MediaType = "application/msgpack"
+
+// maxDepth bounds the nesting of arrays and maps, so deeply nested input can not exhaust the stack
+const maxDepth = 100
+
+// ErrMalformed is returned for bodies which are not MessagePack
+var ErrMalformed = errors.New("msgpack: malformed body")
+
+// ErrUnsupported is returned for MessagePack values JSON can not hold
+var ErrUnsupported = errors.New("msgpack: value has no JSON translation")
+
+var errTooDeep = errors.New("msgpack: body is nested too deeply")
+
+// IsMsgpack reports whether a content type is MessagePack
+func IsMsgpack(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == MediaType || mediaType == "application/x-msgpack" || mediaType == "application/vnd.msgpack"
+}
+
+// reader reads the values of a body in order
+type reader struct {
+	data []byte
+}
+
+func (r *reader) next(n uint64) ([]byte, error) {
+	if uint64(len(r.data)) < n {
+		return nil, ErrMalformed
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of size bytes
+func (r *reader) uint(size uint64) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// ToJSON translates a MessagePack body to JSON
+func ToJSON(body []byte) ([]byte, error) {
+	r := &reader{data: body}
+	var buf bytes.Buffer
+	if err := writeValue(&buf, r, 0); err != nil {
+		return nil, err
+	}
+	if len(r.data) > 0 {
+		return nil, ErrMalformed
+	}
+	return buf.Bytes(), nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Encode ends values with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+func writeFloat(buf *bytes.Buffer, f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrUnsupported
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	return nil
+}
+
+// writeValue writes the next value of r as JSON
+func writeValue(buf *bytes.Buffer, r *reader, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+	head, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	b := head[0]
+	switch {
+	case b <= 0x7f:
+		buf.WriteString(strconv.Itoa(int(b)))
+		return nil
+	case b >= 0xe0:
+		buf.WriteString(strconv.Itoa(int(int8(b))))
+		return nil
+	case b <= 0x8f:
+		return writeMap(buf, r, uint64(b&0x0f), depth)
+	case b <= 0x9f:
+		return writeArray(buf, r, uint64(b&0x0f), depth)
+	case b <= 0xbf:
+		return writeStr(buf, r, uint64(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		buf.WriteString("null")
+	case 0xc2:
+		buf.WriteString("false")
+	case 0xc3:
+		buf.WriteString("true")
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (b - 0xc4))
+		if err != nil {
+			return err
+		}
+		bin, err := r.next(n)
+		if err != nil {
+			return err
+		}
+		writeString(buf, base64.StdEncoding.EncodeToString(bin))
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.uint(1 << (b - 0xc7))
+		if err != nil {
+			return err
+		}
+		return writeExt(buf, r, n)
+	case 0xca:
+		v, err := r.uint(4)
+		if err != nil {
+			return err
+		}
+		return writeFloat(buf, float64(math.Float32frombits(uint32(v))), 32)
+	case 0xcb:
+		v, err := r.uint(8)
+		if err != nil {
+			return err
+		}
+		return writeFloat(buf, math.Float64frombits(v), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := r.uint(1 << (b - 0xcc))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatUint(v, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := uint64(1) << (b - 0xd0)
+		v, err := r.uint(size)
+		if err != nil {
+			return err
+		}
+		// Sign extend from the size read
+		shift := 64 - 8*size
+		buf.WriteString(strconv.FormatInt(int64(v<<shift)>>shift, 10))
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return writeExt(buf, r, 1<<(b-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (b - 0xd9))
+		if err != nil {
+			return err
+		}
+		return writeStr(buf, r, n)
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (b - 0xdc))
+		if err != nil {
+			return err
+		}
+		return writeArray(buf, r, n, depth)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (b - 0xde))
+		if err != nil {
+			return err
+		}
+		return writeMap(buf, r, n, depth)
+	default:
+		return ErrMalformed
+	}
+	return nil
+}
+
+func writeStr(buf *bytes.Buffer, r *reader, n uint64) error {
+	s, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	writeString(buf, string(s))
+	return nil
+}
+
+func writeArray(buf *bytes.Buffer, r *reader, n uint64, depth int) error {
+	// Every value takes at least a byte
+	if n > uint64(len(r.data)) {
+		return ErrMalformed
+	}
+	buf.WriteByte('[')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeValue(buf, r, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeMap(buf *bytes.Buffer, r *reader, n uint64, depth int) error {
+	if n > uint64(len(r.data)) {
+		return ErrMalformed
+	}
+	buf.WriteByte('{')
+	var key bytes.Buffer
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key.Reset()
+		if err := writeValue(&key, r, depth+1); err != nil {
+			return err
+		}
+		// Keys are strings in JSON, integer keys are written as their decimal text
+		switch k := key.Bytes(); {
+		case k[0] == '"':
+			buf.Write(k)
+		case k[0] == '-' || k[0] >= '0' && k[0] <= '9':
+			if bytes.ContainsAny(k, ".eE") {
+				return ErrUnsupported
+			}
+			buf.WriteByte('"')
+			buf.Write(k)
+			buf.WriteByte('"')
+		default:
+			return ErrUnsupported
+		}
+		buf.WriteByte(':')
+		if err := writeValue(buf, r, depth+1); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// timestampType is the extension type of timestamps
+const timestampType = -1
+
+// writeExt writes an extension value of n bytes, only timestamps have a JSON translation
+func writeExt(buf *bytes.Buffer, r *reader, n uint64) error {
+	extType, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	if int8(extType[0]) != timestampType {
+		return ErrUnsupported
+	}
+	var t time.Time
+	switch n {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		t = time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data)))
+	default:
+		return ErrMalformed
+	}
+	writeString(buf, t.UTC().Format(time.RFC3339Nano))
+	return nil
+}
+
+// FromJSON translates a JSON body to MessagePack
+func FromJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	encoded, err := appendValue(nil, decoder, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("msgpack: body is not a single JSON value")
+	}
+	return encoded, nil
+}
+
+// appendValue appends the next value of decoder, reading its tokens so object members keep their order
+func appendValue(buf []byte, decoder *json.Decoder, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		// Headers hold the number of items, so they are written after the items are counted
+		var items []byte
+		n := 0
+		for decoder.More() {
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				items = appendString(items, key.(string))
+			}
+			if items, err = appendValue(items, decoder, depth+1); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		if t == '{' {
+			buf = appendHeader(buf, n, 0x80, 0xde)
+		} else {
+			buf = appendHeader(buf, n, 0x90, 0xdc)
+		}
+		return append(buf, items...), nil
+	case string:
+		return appendString(buf, t), nil
+	case json.Number:
+		return appendNumber(buf, t), nil
+	case bool:
+		if t {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	}
+	return append(buf, 0xc0), nil
+}
+
+// appendHeader appends the header of an array or map of n items, fix being its fixarray or fixmap prefix
+func appendHeader(buf []byte, n int, fix byte, sized byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, sized), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, sized+1), uint32(n))
+}
+
+func appendString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendNumber(buf []byte, n json.Number) []byte {
+	if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+		return appendInt(buf, i)
+	}
+	if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return appendUint(buf, u)
+	}
+	f, _ := n.Float64()
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f))
+}
+
+func appendUint(buf []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(buf, byte(u))
+	case u <= math.MaxUint8:
+		return append(buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xcf), u)
+}
+
+func appendInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendUint(buf, uint64(i))
+	case i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+}
@@ -0,0 +1,209 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package negotiation chooses the format of a response from the caller's Accept header and translates bodies between formats
+//
+// Bodies are translated through JSON: from the service's format to JSON with its codec's
+// ToJSON, then to the chosen format with the other codec's FromJSON.
+package negotiation
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/arbor-dev/arbor/cbor"
+	"github.com/arbor-dev/arbor/msgpack"
+	"github.com/arbor-dev/arbor/protobuf"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/xmljson"
+)
+
+// Codec translates the bodies of a format to and from JSON, for the request the body belongs to
+type Codec struct {
+	ToJSON   func(r *http.Request, body []byte) ([]byte, error)
+	FromJSON func(r *http.Request, body []byte) ([]byte, error)
+}
+
+func identity(r *http.Request, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func xmlToJSON(r *http.Request, body []byte) ([]byte, error) {
+	return xmljson.ToJSON(body)
+}
+
+func xmlFromJSON(r *http.Request, body []byte) ([]byte, error) {
+	return xmljson.FromJSON(body)
+}
+
+func msgpackToJSON(r *http.Request, body []byte) ([]byte, error) {
+	return msgpack.ToJSON(body)
+}
+
+func msgpackFromJSON(r *http.Request, body []byte) ([]byte, error) {
+	return msgpack.FromJSON(body)
+}
+
+func cborToJSON(r *http.Request, body []byte) ([]byte, error) {
+	return cbor.ToJSON(body)
+}
+
+func cborFromJSON(r *http.Request, body []byte) ([]byte, error) {
+	return cbor.FromJSON(body)
+}
+
+// responseMessage returns the Response message type of the route serving r
+func responseMessage(r *http.Request) (*protobuf.Message, error) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || route.Protobuf == nil || route.Protobuf.Response == "" {
+		return nil, errors.New("negotiation: route has no protobuf response message")
+	}
+	set, err := protobuf.LoadDescriptorSet(route.Protobuf.DescriptorSet)
+	if err != nil {
+		return nil, err
+	}
+	message, ok := set.Message(route.Protobuf.Response)
+	if !ok {
+		return nil, errors.New("negotiation: descriptor set has no message " + route.Protobuf.Response)
+	}
+	return message, nil
+}
+
+func protobufToJSON(r *http.Request, body []byte) ([]byte, error) {
+	message, err := responseMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	return message.ToJSON(body)
+}
+
+func protobufFromJSON(r *http.Request, body []byte) ([]byte, error) {
+	message, err := responseMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	return message.FromJSON(body)
+}
+
+// Codecs are the formats bodies can be translated between, keyed by media type
+var Codecs = map[string]Codec{
+	"application/json": {ToJSON: identity, FromJSON: identity},
+	"application/xml":  {ToJSON: xmlToJSON, FromJSON: xmlFromJSON},
+	"text/xml":         {ToJSON: xmlToJSON, FromJSON: xmlFromJSON},
+	// Protobuf bodies are transcoded with the Response message of the route's ProtobufPolicy
+	protobuf.MediaType: {ToJSON: protobufToJSON, FromJSON: protobufFromJSON},
+	msgpack.MediaType:  {ToJSON: msgpackToJSON, FromJSON: msgpackFromJSON},
+	cbor.MediaType:     {ToJSON: cborToJSON, FromJSON: cborFromJSON},
+}
+
+// MediaType returns the media type of a Content-Type header, lower cased and without parameters
+func MediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// Formats returns the media types of Codecs, sorted
+func Formats() []string {
+	formats := make([]string, 0, len(Codecs))
+	for mediaType := range Codecs {
+		formats = append(formats, mediaType)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// acceptRange is a media range of an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// specificity ranks how closely a range matches mediaType, -1 if it does not
+func (a acceptRange) specificity(mediaType string) int {
+	switch {
+	case a.mediaType == mediaType:
+		return 2
+	case strings.HasSuffix(a.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a.mediaType, "*")):
+		return 1
+	case a.mediaType == "*/*":
+		return 0
+	}
+	return -1
+}
+
+func parseAccept(r *http.Request) []acceptRange {
+	var ranges []acceptRange
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+			ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+		}
+	}
+	return ranges
+}
+
+// Quality returns how much the caller accepts mediaType, from 0 (not at all) to 1, by the most specific range matching it (RFC 7231 5.3.2)
+func Quality(r *http.Request, mediaType string) float64 {
+	ranges := parseAccept(r)
+	if len(ranges) == 0 {
+		return 1
+	}
+	best, q := -1, 0.0
+	for _, a := range ranges {
+		if s := a.specificity(mediaType); s > best {
+			best, q = s, a.q
+		}
+	}
+	return q
+}
+
+// Choose returns the media type of available the caller accepts most, the earliest on ties, false if they accept none
+func Choose(r *http.Request, available []string) (string, bool) {
+	chosen, best := "", 0.0
+	for _, mediaType := range available {
+		if q := Quality(r, mediaType); q > best {
+			chosen, best = mediaType, q
+		}
+	}
+	return chosen, best > 0
+}
+
+// ErrUnsupported is returned when translating from or to a format which is not in Codecs
+var ErrUnsupported = errors.New("negotiation: format is not supported")
+
+// Translate translates a body from one format of Codecs to another
+func Translate(r *http.Request, body []byte, from string, to string) ([]byte, error) {
+	source, ok := Codecs[from]
+	target, supported := Codecs[to]
+	if !ok || !supported {
+		return nil, ErrUnsupported
+	}
+	json, err := source.ToJSON(r, body)
+	if err != nil {
+		return nil, err
+	}
+	return target.FromJSON(r, json)
+}
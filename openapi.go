@@ -0,0 +1,186 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package arbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/arbor-dev/arbor/openapi"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+var pathTemplateVariable = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// RoutesFromOpenAPI generates the routes of the operations in an OpenAPI 3 document (JSON)
+//
+// Each operation is proxied to the first server of the operation, its path or the document.
+// Routes are named by operationId, require the scopes of the operation's first security
+// requirement, validate JSON request bodies against their schema and use the JSON format
+// if the operation exchanges JSON. Their Docs come from the operation's summary,
+// description, tags, deprecation and x-arbor-owner, x-arbor-contact and x-arbor-sunset.
+func RoutesFromOpenAPI(data []byte) (RouteCollection, error) {
+	doc, err := openapi.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes RouteCollection
+	for _, path := range doc.SortedPaths() {
+		item := doc.Paths[path]
+		methods, operations := item.Operations()
+		for i, operation := range operations {
+			route, err := routeFromOperation(doc, path, item, methods[i], operation)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+func routeFromOperation(doc *openapi.Document, path string, item *openapi.PathItem, method string, operation *openapi.Operation) (Route, error) {
+	servers := operation.Servers
+	if len(servers) == 0 {
+		servers = item.Servers
+	}
+	if len(servers) == 0 {
+		servers = doc.Servers
+	}
+	if len(servers) == 0 {
+		return Route{}, fmt.Errorf("openapi: no server for %s %s", method, path)
+	}
+	backend := servers[0].ResolveURL()
+	if !strings.HasPrefix(backend, "http://") && !strings.HasPrefix(backend, "https://") {
+		return Route{}, fmt.Errorf("openapi: server %q for %s %s is not an absolute URL", backend, method, path)
+	}
+
+	name := operation.OperationID
+	if name == "" {
+		name = method + " " + path
+	}
+	format := "RAW"
+	if exchangesJSON(operation) {
+		format = "JSON"
+	}
+
+	route := Route{
+		Name:    name,
+		Method:  method,
+		Pattern: pattern(path, append(append([]openapi.Parameter(nil), item.Parameters...), operation.Parameters...)),
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			proxy.ProxyRequest(w, r, backend+r.URL.String(), format, "")
+		},
+		Scopes: scopes(doc, operation),
+	}
+	if operation.Summary != "" || operation.Description != "" || len(operation.Tags) > 0 || operation.Owner != "" || operation.Contact != "" || operation.Deprecated {
+		route.Docs = &RouteDocs{
+			Summary:     operation.Summary,
+			Description: operation.Description,
+			Tags:        operation.Tags,
+			Owner:       operation.Owner,
+			Contact:     operation.Contact,
+			Sunset:      operation.Sunset,
+		}
+		if operation.Deprecated {
+			route.Docs.Deprecated = "deprecated in the OpenAPI document"
+		}
+	}
+	if operation.RequestBody != nil {
+		for contentType, media := range operation.RequestBody.Content {
+			if isJSON(contentType) && len(media.Schema) > 0 {
+				route.Schema = bodySchema(doc, media.Schema)
+			}
+		}
+	}
+	return route, nil
+}
+
+// pattern converts a path template to a route pattern, restricting integer parameters to digits
+func pattern(path string, parameters []openapi.Parameter) string {
+	return pathTemplateVariable.ReplaceAllStringFunc(path, func(variable string) string {
+		name := variable[1 : len(variable)-1]
+		for _, parameter := range parameters {
+			if parameter.In != "path" || parameter.Name != name {
+				continue
+			}
+			var schema struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(parameter.Schema, &schema)
+			if schema.Type == "integer" {
+				return "{" + name + ":[0-9]+}"
+			}
+		}
+		return variable
+	})
+}
+
+// scopes are the scopes of the first security requirement, which route scopes can express
+func scopes(doc *openapi.Document, operation *openapi.Operation) []string {
+	requirements := doc.Security
+	if operation.Security != nil {
+		requirements = *operation.Security
+	}
+	if len(requirements) == 0 {
+		return nil
+	}
+	var all []string
+	for _, scheme := range requirements[0] {
+		all = append(all, scheme...)
+	}
+	return all
+}
+
+func isJSON(contentType string) bool {
+	contentType = strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+func exchangesJSON(operation *openapi.Operation) bool {
+	if operation.RequestBody != nil {
+		for contentType := range operation.RequestBody.Content {
+			if isJSON(contentType) {
+				return true
+			}
+		}
+	}
+	for _, response := range operation.Responses {
+		if response == nil {
+			continue
+		}
+		for contentType := range response.Content {
+			if isJSON(contentType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bodySchema wraps a body schema with the document's components so its references resolve
+func bodySchema(doc *openapi.Document, schema json.RawMessage) json.RawMessage {
+	if doc.Components == nil || len(doc.Components.Schemas) == 0 {
+		return schema
+	}
+	wrapped, err := json.Marshal(map[string]interface{}{
+		"allOf":      []json.RawMessage{schema},
+		"components": map[string]interface{}{"schemas": doc.Components.Schemas},
+	})
+	if err != nil {
+		return schema
+	}
+	return wrapped
+}
@@ -0,0 +1,128 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// BearerScheme is the name of the security scheme for routes requiring token scopes
+const BearerScheme = "bearerAuth"
+
+// APIKeyScheme is the name of the security scheme for arbor's client tokens and API keys
+const APIKeyScheme = "apiKeyAuth"
+
+// FromRoutes describes routes as an OpenAPI 3.1 document
+//
+// Routes requiring scopes list them under a bearer token scheme, and their roles
+// are listed in the x-arbor-roles extension. The routes' Docs describe the operations,
+// with their owner, contact and sunset in the x-arbor-owner, x-arbor-contact and
+// x-arbor-sunset extensions.
+func FromRoutes(routes services.RouteCollection, info Info) *Document {
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   make(map[string]*PathItem),
+		Components: &Components{SecuritySchemes: map[string]*SecurityScheme{
+			BearerScheme: {Type: "http", Scheme: "bearer"},
+		}},
+	}
+	if security.IsEnabled() {
+		doc.Components.SecuritySchemes[APIKeyScheme] = &SecurityScheme{Type: "apiKey", In: "header", Name: "Authorization"}
+		doc.Security = []SecurityRequirement{{APIKeyScheme: {}}}
+	}
+
+	for _, route := range routes {
+		path, parameters := pathTemplate(route.Pattern)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{Parameters: parameters}
+			doc.Paths[path] = item
+		}
+		operation := &Operation{
+			OperationID: route.Name,
+			Responses:   map[string]*Response{"default": {Description: "Response from the service"}},
+			Roles:       route.Roles,
+		}
+		if docs := route.Docs; docs != nil {
+			operation.Summary = docs.Summary
+			operation.Description = docs.Description
+			operation.Tags = docs.Tags
+			operation.Owner = docs.Owner
+			operation.Contact = docs.Contact
+			operation.Deprecated = docs.Deprecated != ""
+			operation.Sunset = docs.Sunset
+		}
+		if len(route.Scopes) > 0 {
+			requirements := []SecurityRequirement{{BearerScheme: route.Scopes}}
+			operation.Security = &requirements
+		}
+		if len(route.Schema) > 0 {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]*MediaType{"application/json": {Schema: route.Schema}},
+			}
+		}
+		item.SetOperation(route.Method, operation)
+	}
+	return doc
+}
+
+// pathTemplate converts a route pattern to an OpenAPI path template and its parameters
+//
+// Variables restricted by a regular expression are described as strings with that pattern.
+func pathTemplate(pattern string) (string, []Parameter) {
+	var path strings.Builder
+	var parameters []Parameter
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			path.WriteString(pattern)
+			break
+		}
+		// Braces may nest within the variable's regular expression
+		depth, end := 0, -1
+		for i := start; i < len(pattern) && end < 0; i++ {
+			switch pattern[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			path.WriteString(pattern)
+			break
+		}
+		path.WriteString(pattern[:start])
+		variable := pattern[start+1 : end]
+		name, expression := variable, ""
+		if i := strings.IndexByte(variable, ':'); i >= 0 {
+			name, expression = variable[:i], variable[i+1:]
+		}
+		schema := map[string]string{"type": "string"}
+		if expression != "" {
+			schema["pattern"] = "^" + expression + "$"
+		}
+		encoded, _ := json.Marshal(schema)
+		parameters = append(parameters, Parameter{Name: name, In: "path", Required: true, Schema: encoded})
+		path.WriteString("{" + name + "}")
+		pattern = pattern[end+1:]
+	}
+	return path.String(), parameters
+}
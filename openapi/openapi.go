@@ -0,0 +1,210 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package openapi reads and writes the parts of OpenAPI 3 documents arbor uses to describe routes
+//
+// Documents are JSON, convert YAML specs with a tool such as yq first.
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Document is an OpenAPI 3 document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components *Components           `json:"components,omitempty"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API, whose variables are replaced by their defaults
+type Server struct {
+	URL         string                    `json:"url"`
+	Description string                    `json:"description,omitempty"`
+	Variables   map[string]ServerVariable `json:"variables,omitempty"`
+}
+
+// ServerVariable is a variable in a server URL
+type ServerVariable struct {
+	Default string   `json:"default"`
+	Enum    []string `json:"enum,omitempty"`
+}
+
+// PathItem holds the operations on a path
+type PathItem struct {
+	Summary    string      `json:"summary,omitempty"`
+	Servers    []Server    `json:"servers,omitempty"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+	Get        *Operation  `json:"get,omitempty"`
+	Put        *Operation  `json:"put,omitempty"`
+	Post       *Operation  `json:"post,omitempty"`
+	Delete     *Operation  `json:"delete,omitempty"`
+	Options    *Operation  `json:"options,omitempty"`
+	Head       *Operation  `json:"head,omitempty"`
+	Patch      *Operation  `json:"patch,omitempty"`
+}
+
+// Operations returns the operations on the path by method, in a stable order
+func (p *PathItem) Operations() ([]string, []*Operation) {
+	all := []struct {
+		method    string
+		operation *Operation
+	}{
+		{http.MethodGet, p.Get}, {http.MethodPut, p.Put}, {http.MethodPost, p.Post}, {http.MethodDelete, p.Delete},
+		{http.MethodOptions, p.Options}, {http.MethodHead, p.Head}, {http.MethodPatch, p.Patch},
+	}
+	var methods []string
+	var operations []*Operation
+	for _, o := range all {
+		if o.operation != nil {
+			methods = append(methods, o.method)
+			operations = append(operations, o.operation)
+		}
+	}
+	return methods, operations
+}
+
+// SetOperation sets the operation for a method, reporting false for methods OpenAPI does not describe
+func (p *PathItem) SetOperation(method string, operation *Operation) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		p.Get = operation
+	case http.MethodPut:
+		p.Put = operation
+	case http.MethodPost:
+		p.Post = operation
+	case http.MethodDelete:
+		p.Delete = operation
+	case http.MethodOptions:
+		p.Options = operation
+	case http.MethodHead:
+		p.Head = operation
+	case http.MethodPatch:
+		p.Patch = operation
+	default:
+		return false
+	}
+	return true
+}
+
+// Operation is a method on a path
+type Operation struct {
+	OperationID string                 `json:"operationId,omitempty"`
+	Summary     string                 `json:"summary,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Deprecated  bool                   `json:"deprecated,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]SecurityRequirement `json:"security,omitempty"`
+	Servers     []Server               `json:"servers,omitempty"`
+	//Roles are the roles allowed to call the operation, an arbor extension
+	Roles []string `json:"x-arbor-roles,omitempty"`
+	//Owner and Contact are the team owning the operation and how to reach them, arbor extensions
+	Owner   string `json:"x-arbor-owner,omitempty"`
+	Contact string `json:"x-arbor-contact,omitempty"`
+	//Sunset is the date a deprecated operation will be removed on, an arbor extension
+	Sunset string `json:"x-arbor-sunset,omitempty"`
+}
+
+// Parameter is a parameter of an operation
+type Parameter struct {
+	Name     string          `json:"name"`
+	In       string          `json:"in"`
+	Required bool            `json:"required,omitempty"`
+	Schema   json.RawMessage `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes a body of one content type
+type MediaType struct {
+	Schema json.RawMessage `json:"schema,omitempty"`
+}
+
+// Components holds definitions referenced from the rest of the document
+type Components struct {
+	Schemas         map[string]json.RawMessage `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme is a way of authenticating to the API
+type SecurityScheme struct {
+	Type             string      `json:"type"`
+	Description      string      `json:"description,omitempty"`
+	Name             string      `json:"name,omitempty"`
+	In               string      `json:"in,omitempty"`
+	Scheme           string      `json:"scheme,omitempty"`
+	BearerFormat     string      `json:"bearerFormat,omitempty"`
+	Flows            interface{} `json:"flows,omitempty"`
+	OpenIDConnectURL string      `json:"openIdConnectUrl,omitempty"`
+}
+
+// SecurityRequirement maps the names of security schemes to the scopes they must grant
+//
+// An operation's requirements are alternatives, all schemes in one requirement are needed.
+type SecurityRequirement map[string][]string
+
+// Parse reads an OpenAPI 3 document
+func Parse(data []byte) (*Document, error) {
+	doc := new(Document)
+	err := json.Unmarshal(data, doc)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, errors.New("openapi: only OpenAPI 3 documents are supported")
+	}
+	return doc, nil
+}
+
+// ResolveURL replaces the variables in a server URL with their defaults
+func (s Server) ResolveURL() string {
+	url := s.URL
+	for name, variable := range s.Variables {
+		url = strings.Replace(url, "{"+name+"}", variable.Default, -1)
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// SortedPaths returns the document's paths in a stable order
+func (d *Document) SortedPaths() []string {
+	paths := make([]string, 0, len(d.Paths))
+	for path := range d.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
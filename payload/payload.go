@@ -0,0 +1,158 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package payload hashes request and response bodies so semantically identical payloads hash the same
+//
+// JSON and form bodies are canonicalized before hashing: keys are sorted, insignificant
+// whitespace and number formatting are normalized, and IgnoredFields are left out.
+package payload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IgnoredFields are fields which do not change the meaning of a payload, such as timestamps and nonces
+//
+// Plain names match the field at any depth, names starting with / are JSON Pointers to one field.
+var IgnoredFields []string
+
+// Hash returns the hex SHA-256 of the canonical form of a body
+func Hash(contentType string, body []byte) string {
+	canonical, _ := Canonicalize(contentType, body)
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// Canonicalize returns the canonical form of a body and whether any ignored fields were left out
+//
+// Bodies which are not JSON or form encoded, or fail to parse, are returned as they are.
+func Canonicalize(contentType string, body []byte) ([]byte, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return canonicalJSON(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		return canonicalForm(body)
+	default:
+		return body, false
+	}
+}
+
+func ignored(name string, pointer string) bool {
+	for _, field := range IgnoredFields {
+		if strings.HasPrefix(field, "/") {
+			if field == pointer {
+				return true
+			}
+		} else if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func canonicalJSON(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return body, false
+	}
+	var canonical bytes.Buffer
+	removed := writeJSON(&canonical, v, "")
+	return canonical.Bytes(), removed
+}
+
+// writeJSON writes v with sorted keys and normalized numbers, leaving out ignored fields
+func writeJSON(buf *bytes.Buffer, v interface{}, pointer string) bool {
+	removed := false
+	switch value := v.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		buf.WriteByte('{')
+		first := true
+		for _, name := range names {
+			fieldPointer := pointer + "/" + strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+			if ignored(name, fieldPointer) {
+				removed = true
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			key, _ := json.Marshal(name)
+			buf.Write(key)
+			buf.WriteByte(':')
+			removed = writeJSON(buf, value[name], fieldPointer) || removed
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			removed = writeJSON(buf, item, pointer+"/"+strconv.Itoa(i)) || removed
+		}
+		buf.WriteByte(']')
+	case json.Number:
+		buf.WriteString(canonicalNumber(value))
+	default:
+		encoded, _ := json.Marshal(value)
+		buf.Write(encoded)
+	}
+	return removed
+}
+
+// canonicalNumber writes numbers which are equal (e.g. 1, 1.0 and 1e0) the same way
+func canonicalNumber(n json.Number) string {
+	s := n.String()
+	// Huge exponents are left as written rather than expanded
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		if exponent, err := strconv.Atoi(s[i+1:]); err != nil || exponent > 1000 || exponent < -1000 {
+			return s
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return s
+	}
+	return r.RatString()
+}
+
+func canonicalForm(body []byte) ([]byte, bool) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return body, false
+	}
+	removed := false
+	for name := range values {
+		if ignored(name, "/"+name) {
+			delete(values, name)
+			removed = true
+		}
+	}
+	// Encode sorts by key, values keep their order as it may be significant
+	return []byte(values.Encode()), removed
+}
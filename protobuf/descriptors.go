@@ -0,0 +1,315 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package protobuf transcodes protocol buffers to and from JSON with the messages of a descriptor set
+//
+// Descriptor sets are built with protoc, e.g.
+//
+//	protoc --include_imports --descriptor_set_out=orders.pb orders.proto
+//
+// JSON follows the proto3 JSON mapping: fields are named by their JSON name (lowerCamelCase),
+// 64 bit integers are strings, bytes are base64, enums are named and maps are objects. Well
+// known types are transcoded as the messages they are, e.g. a Timestamp as its seconds and nanos.
+package protobuf
+
+import (
+	"errors"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// MediaType is the media type of protocol buffers
+const MediaType = "application/x-protobuf"
+
+// IsProtobuf reports whether a content type is protocol buffers
+func IsProtobuf(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == MediaType || mediaType == "application/protobuf" || mediaType == "application/vnd.google.protobuf"
+}
+
+// Types of fields (FieldDescriptorProto.Type)
+const (
+	typeDouble   = 1
+	typeFloat    = 2
+	typeInt64    = 3
+	typeUint64   = 4
+	typeInt32    = 5
+	typeFixed64  = 6
+	typeFixed32  = 7
+	typeBool     = 8
+	typeString   = 9
+	typeGroup    = 10
+	typeMessage  = 11
+	typeBytes    = 12
+	typeUint32   = 13
+	typeEnum     = 14
+	typeSfixed32 = 15
+	typeSfixed64 = 16
+	typeSint32   = 17
+	typeSint64   = 18
+)
+
+const labelRepeated = 3
+
+// Field is a field of a message
+type Field struct {
+	Name     string
+	JSONName string
+	Number   int32
+	Type     int32
+	Repeated bool
+	//TypeName is the full name of the field's message or enum type
+	TypeName string
+}
+
+// Message is a message type of a descriptor set
+type Message struct {
+	Name   string
+	Fields []*Field
+	//MapEntry marks the messages protoc generates for the entries of map fields
+	MapEntry bool
+
+	set      *DescriptorSet
+	byNumber map[int32]*Field
+	byName   map[string]*Field
+}
+
+// Enum is an enum type of a descriptor set
+type Enum struct {
+	Name    string
+	names   map[int32]string
+	numbers map[string]int32
+}
+
+// DescriptorSet holds the message and enum types of a FileDescriptorSet
+type DescriptorSet struct {
+	messages map[string]*Message
+	enums    map[string]*Enum
+}
+
+// Message returns the message type with a full name, e.g. "orders.v1.Order"
+func (d *DescriptorSet) Message(name string) (*Message, bool) {
+	m, ok := d.messages[strings.TrimPrefix(name, ".")]
+	return m, ok
+}
+
+// ParseDescriptorSet parses a FileDescriptorSet, as written by protoc --descriptor_set_out
+func ParseDescriptorSet(data []byte) (*DescriptorSet, error) {
+	d := &DescriptorSet{messages: map[string]*Message{}, enums: map[string]*Enum{}}
+	err := eachField(data, func(number int32, wire int, value uint64, bytes []byte) error {
+		if number == 1 && wire == wireBytes {
+			return d.parseFile(bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DescriptorSet) parseFile(data []byte) error {
+	var pkg string
+	var messages, enums [][]byte
+	err := eachField(data, func(number int32, wire int, value uint64, bytes []byte) error {
+		switch {
+		case number == 2 && wire == wireBytes:
+			pkg = string(bytes)
+		case number == 4 && wire == wireBytes:
+			messages = append(messages, bytes)
+		case number == 5 && wire == wireBytes:
+			enums = append(enums, bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if err := d.parseMessage(pkg, message); err != nil {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err := d.parseEnum(pkg, enum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func qualify(scope string, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func (d *DescriptorSet) parseMessage(scope string, data []byte) error {
+	m := &Message{set: d, byNumber: map[int32]*Field{}, byName: map[string]*Field{}}
+	var nested, enums [][]byte
+	err := eachField(data, func(number int32, wire int, value uint64, bytes []byte) error {
+		switch {
+		case number == 1 && wire == wireBytes:
+			m.Name = string(bytes)
+		case number == 2 && wire == wireBytes:
+			field, err := parseField(bytes)
+			if err != nil {
+				return err
+			}
+			m.Fields = append(m.Fields, field)
+		case number == 3 && wire == wireBytes:
+			nested = append(nested, bytes)
+		case number == 4 && wire == wireBytes:
+			enums = append(enums, bytes)
+		case number == 7 && wire == wireBytes:
+			// MessageOptions.map_entry
+			return eachField(bytes, func(number int32, wire int, value uint64, bytes []byte) error {
+				if number == 7 && wire == wireVarint {
+					m.MapEntry = value != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	m.Name = qualify(scope, m.Name)
+	for _, field := range m.Fields {
+		m.byNumber[field.Number] = field
+		m.byName[field.Name] = field
+		m.byName[field.JSONName] = field
+	}
+	d.messages[m.Name] = m
+	for _, message := range nested {
+		if err := d.parseMessage(m.Name, message); err != nil {
+			return err
+		}
+	}
+	for _, enum := range enums {
+		if err := d.parseEnum(m.Name, enum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseField(data []byte) (*Field, error) {
+	field := &Field{}
+	err := eachField(data, func(number int32, wire int, value uint64, bytes []byte) error {
+		switch {
+		case number == 1 && wire == wireBytes:
+			field.Name = string(bytes)
+		case number == 3 && wire == wireVarint:
+			field.Number = int32(value)
+		case number == 4 && wire == wireVarint:
+			field.Repeated = value == labelRepeated
+		case number == 5 && wire == wireVarint:
+			field.Type = int32(value)
+		case number == 6 && wire == wireBytes:
+			field.TypeName = strings.TrimPrefix(string(bytes), ".")
+		case number == 10 && wire == wireBytes:
+			field.JSONName = string(bytes)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if field.Type == typeGroup {
+		return nil, errors.New("protobuf: field " + field.Name + " is a group, which is not supported")
+	}
+	if field.JSONName == "" {
+		field.JSONName = jsonName(field.Name)
+	}
+	return field, nil
+}
+
+// jsonName converts a field name to lowerCamelCase, as protoc does
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (d *DescriptorSet) parseEnum(scope string, data []byte) error {
+	e := &Enum{names: map[int32]string{}, numbers: map[string]int32{}}
+	err := eachField(data, func(number int32, wire int, value uint64, bytes []byte) error {
+		switch {
+		case number == 1 && wire == wireBytes:
+			e.Name = string(bytes)
+		case number == 2 && wire == wireBytes:
+			var name string
+			var enumNumber int32
+			err := eachField(bytes, func(number int32, wire int, value uint64, bytes []byte) error {
+				switch {
+				case number == 1 && wire == wireBytes:
+					name = string(bytes)
+				case number == 2 && wire == wireVarint:
+					enumNumber = int32(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if _, exists := e.names[enumNumber]; !exists {
+				e.names[enumNumber] = name
+			}
+			e.numbers[name] = enumNumber
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	e.Name = qualify(scope, e.Name)
+	d.enums[e.Name] = e
+	return nil
+}
+
+var (
+	setsMutex sync.Mutex
+	sets      = map[string]*DescriptorSet{}
+)
+
+// LoadDescriptorSet reads the descriptor set in a file, which is read once and then kept
+func LoadDescriptorSet(file string) (*DescriptorSet, error) {
+	setsMutex.Lock()
+	defer setsMutex.Unlock()
+	if set, ok := sets[file]; ok {
+		return set, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	set, err := ParseDescriptorSet(data)
+	if err != nil {
+		return nil, err
+	}
+	sets[file] = set
+	return set, nil
+}
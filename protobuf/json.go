@@ -0,0 +1,589 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package protobuf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// maxDepth bounds the nesting of messages, so deeply nested input can not exhaust the stack
+const maxDepth = 100
+
+var errTooDeep = errors.New("protobuf: messages are nested too deeply")
+
+// value is a value of a field as it is on the wire
+type value struct {
+	wire  int
+	value uint64
+	bytes []byte
+}
+
+// packable reports whether repeated values of a type may be packed into one length delimited field
+func packable(fieldType int32) bool {
+	return wireType(fieldType) != wireBytes
+}
+
+// ToJSON transcodes a message of this type to JSON
+func (m *Message) ToJSON(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := m.writeJSON(&buf, data, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m *Message) writeJSON(buf *bytes.Buffer, data []byte, depth int) error {
+	if depth > maxDepth {
+		return errTooDeep
+	}
+	values := map[int32][]value{}
+	err := eachField(data, func(number int32, wire int, raw uint64, bytes []byte) error {
+		field, known := m.byNumber[number]
+		if !known {
+			// Fields the descriptor does not know of are left out, as newer services may send them
+			return nil
+		}
+		if field.Repeated && wire == wireBytes && packable(field.Type) {
+			unpacked, err := unpack(field.Type, bytes)
+			if err != nil {
+				return err
+			}
+			values[number] = append(values[number], unpacked...)
+			return nil
+		}
+		if wire != wireType(field.Type) {
+			return ErrMalformed
+		}
+		if field.Repeated {
+			values[number] = append(values[number], value{wire, raw, bytes})
+		} else {
+			values[number] = []value{{wire, raw, bytes}}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	buf.WriteByte('{')
+	first := true
+	for _, field := range m.Fields {
+		fieldValues, present := values[field.Number]
+		if !present {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeString(buf, field.JSONName)
+		buf.WriteByte(':')
+		if entry := m.mapEntry(field); entry != nil {
+			if err := entry.writeMap(buf, fieldValues, depth); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.Repeated {
+			if err := m.writeValue(buf, field, fieldValues[0], depth); err != nil {
+				return err
+			}
+			continue
+		}
+		buf.WriteByte('[')
+		for i, v := range fieldValues {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := m.writeValue(buf, field, v, depth); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// mapEntry returns the entry type of a map field, nil if the field is not a map
+func (m *Message) mapEntry(field *Field) *Message {
+	if !field.Repeated || field.Type != typeMessage {
+		return nil
+	}
+	entry, ok := m.set.Message(field.TypeName)
+	if !ok || !entry.MapEntry || entry.byNumber[1] == nil || entry.byNumber[2] == nil {
+		return nil
+	}
+	return entry
+}
+
+// writeMap writes the entries of a map field as an object
+func (m *Message) writeMap(buf *bytes.Buffer, entries []value, depth int) error {
+	keyField, valueField := m.byNumber[1], m.byNumber[2]
+	buf.WriteByte('{')
+	for i, entry := range entries {
+		key, val := value{wire: wireType(keyField.Type)}, value{wire: wireType(valueField.Type)}
+		hasValue := false
+		err := eachField(entry.bytes, func(number int32, wire int, raw uint64, bytes []byte) error {
+			switch number {
+			case 1:
+				key = value{wire, raw, bytes}
+			case 2:
+				val, hasValue = value{wire, raw, bytes}, true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		var keyJSON bytes.Buffer
+		if err := m.writeValue(&keyJSON, keyField, key, depth); err != nil {
+			return err
+		}
+		// Keys are always strings in JSON
+		if keyJSON.Len() > 0 && keyJSON.Bytes()[0] == '"' {
+			buf.Write(keyJSON.Bytes())
+		} else {
+			writeString(buf, keyJSON.String())
+		}
+		buf.WriteByte(':')
+		if !hasValue && valueField.Type == typeMessage {
+			buf.WriteString("{}")
+			continue
+		}
+		if err := m.writeValue(buf, valueField, val, depth); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// unpack splits packed repeated values
+func unpack(fieldType int32, data []byte) ([]value, error) {
+	var values []value
+	wire := wireType(fieldType)
+	for len(data) > 0 {
+		switch wire {
+		case wireVarint:
+			v, n := readVarint(data)
+			if n == 0 {
+				return nil, ErrMalformed
+			}
+			values, data = append(values, value{wire: wire, value: v}), data[n:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, ErrMalformed
+			}
+			values, data = append(values, value{wire: wire, value: uint64(binary.LittleEndian.Uint32(data))}), data[4:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, ErrMalformed
+			}
+			values, data = append(values, value{wire: wire, value: binary.LittleEndian.Uint64(data)}), data[8:]
+		}
+	}
+	return values, nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	encoded, _ := json.Marshal(s)
+	buf.Write(encoded)
+}
+
+func writeFloat(buf *bytes.Buffer, f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		buf.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		buf.WriteString(`"-Infinity"`)
+	default:
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+	}
+}
+
+// writeValue writes a value of field as JSON
+func (m *Message) writeValue(buf *bytes.Buffer, field *Field, v value, depth int) error {
+	switch field.Type {
+	case typeDouble:
+		writeFloat(buf, math.Float64frombits(v.value), 64)
+	case typeFloat:
+		writeFloat(buf, float64(math.Float32frombits(uint32(v.value))), 32)
+	case typeInt64, typeSfixed64:
+		// 64 bit integers are strings, as JSON numbers lose their precision
+		writeString(buf, strconv.FormatInt(int64(v.value), 10))
+	case typeSint64:
+		writeString(buf, strconv.FormatInt(unzigzag(v.value), 10))
+	case typeUint64, typeFixed64:
+		writeString(buf, strconv.FormatUint(v.value, 10))
+	case typeInt32, typeSfixed32:
+		buf.WriteString(strconv.FormatInt(int64(int32(v.value)), 10))
+	case typeSint32:
+		buf.WriteString(strconv.FormatInt(int64(int32(unzigzag(v.value))), 10))
+	case typeUint32, typeFixed32:
+		buf.WriteString(strconv.FormatUint(uint64(uint32(v.value)), 10))
+	case typeBool:
+		buf.WriteString(strconv.FormatBool(v.value != 0))
+	case typeString:
+		writeString(buf, string(v.bytes))
+	case typeBytes:
+		writeString(buf, base64.StdEncoding.EncodeToString(v.bytes))
+	case typeEnum:
+		number := int32(v.value)
+		if enum, ok := m.set.enums[field.TypeName]; ok {
+			if name, named := enum.names[number]; named {
+				writeString(buf, name)
+				return nil
+			}
+		}
+		buf.WriteString(strconv.FormatInt(int64(number), 10))
+	case typeMessage:
+		message, ok := m.set.Message(field.TypeName)
+		if !ok {
+			return errors.New("protobuf: unknown message type " + field.TypeName)
+		}
+		return message.writeJSON(buf, v.bytes, depth+1)
+	default:
+		return errors.New("protobuf: field " + field.Name + " has an unsupported type")
+	}
+	return nil
+}
+
+// FromJSON transcodes JSON to a message of this type
+func (m *Message) FromJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var object interface{}
+	if err := decoder.Decode(&object); err != nil || decoder.More() {
+		return nil, errors.New("protobuf: body is not JSON")
+	}
+	return m.encode(object, 0)
+}
+
+// encode writes a JSON object as a message of this type
+func (m *Message) encode(v interface{}, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("protobuf: " + m.Name + " must be a JSON object")
+	}
+	for name := range object {
+		if _, known := m.byName[name]; !known {
+			return nil, errors.New("protobuf: " + m.Name + " has no field " + name)
+		}
+	}
+
+	var buf []byte
+	for _, field := range m.Fields {
+		fieldValue, present := object[field.JSONName]
+		if !present {
+			fieldValue = object[field.Name]
+		}
+		if fieldValue == nil {
+			continue
+		}
+		var err error
+		if entry := m.mapEntry(field); entry != nil {
+			buf, err = entry.encodeMap(buf, field, fieldValue, depth)
+		} else if field.Repeated {
+			buf, err = m.encodeRepeated(buf, field, fieldValue, depth)
+		} else {
+			buf, err = m.appendField(buf, field, fieldValue, depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+func (m *Message) encodeRepeated(buf []byte, field *Field, v interface{}, depth int) ([]byte, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, errors.New("protobuf: " + field.Name + " must be a JSON array")
+	}
+	if !packable(field.Type) {
+		for _, item := range items {
+			var err error
+			if buf, err = m.appendField(buf, field, item, depth); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	// Repeated numbers are packed, as proto3 does by default
+	var packed []byte
+	for _, item := range items {
+		var err error
+		if packed, err = m.appendScalar(packed, field, item); err != nil {
+			return nil, err
+		}
+	}
+	return appendBytes(buf, field.Number, packed), nil
+}
+
+// encodeMap writes a JSON object as the entries of a map field, sorted by key
+func (m *Message) encodeMap(buf []byte, field *Field, v interface{}, depth int) ([]byte, error) {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("protobuf: " + field.Name + " must be a JSON object")
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	keyField, valueField := m.byNumber[1], m.byNumber[2]
+	for _, key := range keys {
+		var keyValue interface{} = key
+		if keyField.Type == typeBool {
+			parsed, err := strconv.ParseBool(key)
+			if err != nil {
+				return nil, errors.New("protobuf: " + field.Name + " has a key which is not a bool")
+			}
+			keyValue = parsed
+		}
+		entry, err := m.appendField(nil, keyField, keyValue, depth)
+		if err != nil {
+			return nil, err
+		}
+		if object[key] != nil {
+			if entry, err = m.appendField(entry, valueField, object[key], depth); err != nil {
+				return nil, err
+			}
+		}
+		buf = appendBytes(buf, field.Number, entry)
+	}
+	return buf, nil
+}
+
+// appendField writes a value of field with its tag
+func (m *Message) appendField(buf []byte, field *Field, v interface{}, depth int) ([]byte, error) {
+	switch field.Type {
+	case typeString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("protobuf: " + field.Name + " must be a string")
+		}
+		return appendBytes(buf, field.Number, []byte(s)), nil
+	case typeBytes:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("protobuf: " + field.Name + " must be a base64 string")
+		}
+		decoded, err := decodeBase64(s)
+		if err != nil {
+			return nil, errors.New("protobuf: " + field.Name + " must be a base64 string")
+		}
+		return appendBytes(buf, field.Number, decoded), nil
+	case typeMessage:
+		message, ok := m.set.Message(field.TypeName)
+		if !ok {
+			return nil, errors.New("protobuf: unknown message type " + field.TypeName)
+		}
+		encoded, err := message.encode(v, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(buf, field.Number, encoded), nil
+	}
+	buf = appendTag(buf, field.Number, wireType(field.Type))
+	return m.appendScalar(buf, field, v)
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, errors.New("protobuf: invalid base64")
+}
+
+// number returns the text of a JSON number, or of a number written as a string
+func number(field *Field, v interface{}) (string, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), nil
+	case string:
+		return n, nil
+	}
+	return "", errors.New("protobuf: " + field.Name + " must be a number")
+}
+
+func parseInt(field *Field, v interface{}, bits int) (int64, error) {
+	s, err := number(field, v)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(s, 10, bits)
+	if err != nil {
+		// Integers may be written with an exponent, e.g. 1e3
+		f, floatErr := strconv.ParseFloat(s, 64)
+		if floatErr != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, errors.New("protobuf: " + field.Name + " must be an integer")
+		}
+		i = int64(f)
+		if bits == 32 && (i < math.MinInt32 || i > math.MaxInt32) {
+			return 0, errors.New("protobuf: " + field.Name + " must be an integer")
+		}
+	}
+	return i, nil
+}
+
+func parseUint(field *Field, v interface{}, bits int) (uint64, error) {
+	s, err := number(field, v)
+	if err != nil {
+		return 0, err
+	}
+	u, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		f, floatErr := strconv.ParseFloat(s, 64)
+		if floatErr != nil || f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, errors.New("protobuf: " + field.Name + " must be an unsigned integer")
+		}
+		u = uint64(f)
+		if bits == 32 && u > math.MaxUint32 {
+			return 0, errors.New("protobuf: " + field.Name + " must be an unsigned integer")
+		}
+	}
+	return u, nil
+}
+
+func parseFloat(field *Field, v interface{}, bits int) (float64, error) {
+	s, err := number(field, v)
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+	f, err := strconv.ParseFloat(s, bits)
+	if err != nil {
+		return 0, errors.New("protobuf: " + field.Name + " must be a number")
+	}
+	return f, nil
+}
+
+// appendScalar writes a number, bool or enum value of field without its tag
+func (m *Message) appendScalar(buf []byte, field *Field, v interface{}) ([]byte, error) {
+	switch field.Type {
+	case typeDouble:
+		f, err := parseFloat(field, v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(f)), nil
+	case typeFloat:
+		f, err := parseFloat(field, v, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, math.Float32bits(float32(f))), nil
+	case typeInt64, typeInt32:
+		bits := 64
+		if field.Type == typeInt32 {
+			bits = 32
+		}
+		i, err := parseInt(field, v, bits)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(buf, uint64(i)), nil
+	case typeSint64, typeSint32:
+		bits := 64
+		if field.Type == typeSint32 {
+			bits = 32
+		}
+		i, err := parseInt(field, v, bits)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(buf, zigzag(i)), nil
+	case typeUint64, typeUint32:
+		bits := 64
+		if field.Type == typeUint32 {
+			bits = 32
+		}
+		u, err := parseUint(field, v, bits)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(buf, u), nil
+	case typeFixed64:
+		u, err := parseUint(field, v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, u), nil
+	case typeSfixed64:
+		i, err := parseInt(field, v, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(buf, uint64(i)), nil
+	case typeFixed32:
+		u, err := parseUint(field, v, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, uint32(u)), nil
+	case typeSfixed32:
+		i, err := parseInt(field, v, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(buf, uint32(int32(i))), nil
+	case typeBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("protobuf: " + field.Name + " must be a bool")
+		}
+		if b {
+			return appendVarint(buf, 1), nil
+		}
+		return appendVarint(buf, 0), nil
+	case typeEnum:
+		if name, ok := v.(string); ok {
+			if enum, known := m.set.enums[field.TypeName]; known {
+				if n, named := enum.numbers[name]; named {
+					return appendVarint(buf, uint64(int64(n))), nil
+				}
+			}
+			return nil, errors.New("protobuf: " + field.Name + " has no value " + name)
+		}
+		i, err := parseInt(field, v, 32)
+		if err != nil {
+			return nil, err
+		}
+		return appendVarint(buf, uint64(i)), nil
+	}
+	return nil, errors.New("protobuf: field " + field.Name + " has an unsupported type")
+}
@@ -0,0 +1,124 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ErrMalformed is returned for data which is not a valid protocol buffer
+var ErrMalformed = errors.New("protobuf: malformed message")
+
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		value |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// eachField calls fn with each field of a message as it is on the wire
+//
+// value holds varints and fixed width numbers, bytes holds length delimited fields.
+func eachField(data []byte, fn func(number int32, wire int, value uint64, bytes []byte) error) error {
+	for len(data) > 0 {
+		tag, n := readVarint(data)
+		if n == 0 || tag>>3 == 0 || tag>>3 > 1<<29-1 {
+			return ErrMalformed
+		}
+		data = data[n:]
+		number, wire := int32(tag>>3), int(tag&7)
+		var value uint64
+		var bytes []byte
+		switch wire {
+		case wireVarint:
+			value, n = readVarint(data)
+			if n == 0 {
+				return ErrMalformed
+			}
+		case wireFixed64:
+			if len(data) < 8 {
+				return ErrMalformed
+			}
+			value, n = binary.LittleEndian.Uint64(data), 8
+		case wireFixed32:
+			if len(data) < 4 {
+				return ErrMalformed
+			}
+			value, n = uint64(binary.LittleEndian.Uint32(data)), 4
+		case wireBytes:
+			length, size := readVarint(data)
+			if size == 0 || uint64(len(data)-size) < length {
+				return ErrMalformed
+			}
+			bytes, n = data[size:size+int(length)], size+int(length)
+		default:
+			return errors.New("protobuf: wire type " + strconv.Itoa(wire) + " is not supported")
+		}
+		data = data[n:]
+		if err := fn(number, wire, value, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendVarint(buf []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buf = append(buf, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buf, byte(value))
+}
+
+func appendTag(buf []byte, number int32, wire int) []byte {
+	return appendVarint(buf, uint64(number)<<3|uint64(wire))
+}
+
+func appendBytes(buf []byte, number int32, bytes []byte) []byte {
+	buf = appendTag(buf, number, wireBytes)
+	buf = appendVarint(buf, uint64(len(bytes)))
+	return append(buf, bytes...)
+}
+
+// wireType is how values of a field's type are written, when they are not packed
+func wireType(fieldType int32) int {
+	switch fieldType {
+	case typeDouble, typeFixed64, typeSfixed64:
+		return wireFixed64
+	case typeFloat, typeFixed32, typeSfixed32:
+		return wireFixed32
+	case typeString, typeBytes, typeMessage:
+		return wireBytes
+	}
+	return wireVarint
+}
+
+func zigzag(value int64) uint64 {
+	return uint64(value<<1) ^ uint64(value>>63)
+}
+
+func unzigzag(value uint64) int64 {
+	return int64(value>>1) ^ -int64(value&1)
+}
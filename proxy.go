@@ -17,8 +17,10 @@ import (
 // Pass a authorization token (optional).
 //
 // Will call the service and return the result to the client.
+//
+// Deprecated: use Proxy(w, r, url, WithFormat(format), WithToken(token)), arbormigrate rewrites calls to it.
 func DELETE(w http.ResponseWriter, url string, format string, token string, r *http.Request) {
-	proxy.DELETE(w, r, url, format, token)
+	proxy.Proxy(w, r, url, proxy.WithFormat(format), proxy.WithToken(token))
 }
 
 // GET provides a proxy GET request allowing authorized clients to make GET requests of the microservices
@@ -32,8 +34,10 @@ func DELETE(w http.ResponseWriter, url string, format string, token string, r *h
 // Pass a authorization token (optional).
 //
 // Will call the service and return the result to the client.
+//
+// Deprecated: use Proxy(w, r, url, WithFormat(format), WithToken(token)), arbormigrate rewrites calls to it.
 func GET(w http.ResponseWriter, url string, format string, token string, r *http.Request) {
-	proxy.GET(w, r, url, format, token)
+	proxy.Proxy(w, r, url, proxy.WithFormat(format), proxy.WithToken(token))
 }
 
 // PATCH provides a proxy PATCH request allowing authorized clients to make PATCH requests of the microservices
@@ -47,8 +51,10 @@ func GET(w http.ResponseWriter, url string, format string, token string, r *http
 // Pass a authorization token (optional).
 //
 // Will call the service and return the result to the client.
+//
+// Deprecated: use Proxy(w, r, url, WithFormat(format), WithToken(token)), arbormigrate rewrites calls to it.
 func PATCH(w http.ResponseWriter, url string, format string, token string, r *http.Request) {
-	proxy.PATCH(w, r, url, format, token)
+	proxy.Proxy(w, r, url, proxy.WithFormat(format), proxy.WithToken(token))
 }
 
 // POST provides a proxy POST request allowing authorized clients to make POST requests of the microservices
@@ -62,8 +68,10 @@ func PATCH(w http.ResponseWriter, url string, format string, token string, r *ht
 // Pass a authorization token (optional).
 //
 // Will call the service and return the result to the client.
+//
+// Deprecated: use Proxy(w, r, url, WithFormat(format), WithToken(token)), arbormigrate rewrites calls to it.
 func POST(w http.ResponseWriter, url string, format string, token string, r *http.Request) {
-	proxy.POST(w, r, url, format, token)
+	proxy.Proxy(w, r, url, proxy.WithFormat(format), proxy.WithToken(token))
 }
 
 // PUT provides a proxy PUT request allowing authorized clients to make PUT requests of the microservices
@@ -77,6 +85,187 @@ func POST(w http.ResponseWriter, url string, format string, token string, r *htt
 // Pass a authorization token (optional).
 //
 // Will call the service and return the result to the client.
+//
+// Deprecated: use Proxy(w, r, url, WithFormat(format), WithToken(token)), arbormigrate rewrites calls to it.
 func PUT(w http.ResponseWriter, url string, format string, token string, r *http.Request) {
-	proxy.PUT(w, r, url, format, token)
+	proxy.Proxy(w, r, url, proxy.WithFormat(format), proxy.WithToken(token))
+}
+
+// ProxyOption configures how Proxy proxies a request
+type ProxyOption = proxy.Option
+
+// Proxy proxies the caller's request to the target url of the backend service, whatever its method
+//
+// Pass options to set the format of the service (RAW by default) and the authorization token sent to it.
+func Proxy(w http.ResponseWriter, r *http.Request, url string, opts ...ProxyOption) {
+	proxy.Proxy(w, r, url, opts...)
+}
+
+// WithFormat sets the format of the service, "JSON", "XML", "PROTOBUF", "MSGPACK", "CBOR" or "RAW" (the default)
+//
+// The bodies of XML services are translated from and to JSON for callers, see xmljson.
+// Callers sending XML, or preferring it in their Accept header, get it as it is.
+//
+// The bodies of PROTOBUF services are sent as they are, or transcoded from and to JSON for
+// callers sending or preferring it if the route has a ProtobufPolicy.
+//
+// The bodies of MSGPACK and CBOR services are sent as they are, or translated to JSON for the
+// service and back for callers not preferring JSON if the route has TranslateToJSON.
+func WithFormat(format string) ProxyOption {
+	return proxy.WithFormat(format)
+}
+
+// WithToken sets the authorization token sent to the service
+func WithToken(token string) ProxyOption {
+	return proxy.WithToken(token)
+}
+
+// ListAggregation merges the sorted lists of several services into one list clients page through with a cursor
+type ListAggregation = proxy.ListAggregation
+
+// ListSource is a backend list endpoint whose items are merged into an aggregated list
+type ListSource = proxy.ListSource
+
+// What AggregateList does when a source fails, see ListAggregation.OnFailure
+const (
+	FailRequest        = proxy.FailRequest
+	PartialResults     = proxy.PartialResults
+	SubstituteDefaults = proxy.SubstituteDefaults
+)
+
+// AggregateList serves a page of a list merged from several services
+//
+// Pass the aggregation describing the services' list endpoints and how they are sorted.
+//
+// Pass a authorization token (optional).
+//
+// Clients page with the limit and cursor query parameters, following next_cursor until it is omitted.
+func AggregateList(w http.ResponseWriter, r *http.Request, aggregation ListAggregation, token string) {
+	proxy.AggregateList(w, r, aggregation, token)
+}
+
+// Composition fans a route out to several backend calls made in parallel, merging their responses into one document
+type Composition = proxy.Composition
+
+// CompositionCall is a backend call whose JSON response is placed in a field of the composed document
+type CompositionCall = proxy.CompositionCall
+
+// Compose serves one JSON document composed of the responses of several backend calls made in parallel
+//
+// Pass the composition describing the calls and the field each response is placed in.
+//
+// Pass a authorization token (optional).
+//
+// A call which fails is replaced by {"error": {"status": ..., "message": ...}}, unless it is required.
+func Compose(w http.ResponseWriter, r *http.Request, composition Composition, token string) {
+	proxy.Compose(w, r, composition, token)
+}
+
+// Saga fans a composite write out to several backends, undoing the writes which succeeded if any fails
+type Saga = proxy.Saga
+
+// SagaStep is a backend write of a saga, with the request undoing it
+type SagaStep = proxy.SagaStep
+
+// Compensation is the backend request undoing a step of a saga
+type Compensation = proxy.Compensation
+
+// SagaOutcome is the structured outcome of a saga reported to the caller
+type SagaOutcome = proxy.SagaOutcome
+
+// StepOutcome is the outcome of a step of a saga
+type StepOutcome = proxy.StepOutcome
+
+// Outcomes of a saga, see SagaOutcome.Outcome
+const (
+	SagaCommitted          = proxy.SagaCommitted
+	SagaCompensated        = proxy.SagaCompensated
+	SagaCompensationFailed = proxy.SagaCompensationFailed
+)
+
+// RunSaga sends the writes of a composite write route to several backends, compensating them on partial failure
+//
+// Pass the saga describing the writes and the requests undoing them.
+//
+// Pass a authorization token (optional).
+//
+// If a write fails, the writes which succeeded are undone and the error's details hold the outcome of every step.
+func RunSaga(w http.ResponseWriter, r *http.Request, saga Saga, token string) {
+	proxy.RunSaga(w, r, saga, token)
+}
+
+// LongPoll serves a backend's event stream (Server-Sent Events or WebSocket) to clients which poll for its events
+type LongPoll = proxy.LongPoll
+
+// PolledEvent is an event of a backend stream returned by a poll
+type PolledEvent = proxy.PolledEvent
+
+// PollResponse is the response to a poll of a backend stream
+type PollResponse = proxy.PollResponse
+
+// ServeLongPoll serves clients stuck on networks which drop long-lived streams the events of a backend stream
+//
+// Pass the long poll describing the backend's stream.
+//
+// Pass a authorization token (optional).
+//
+// The first poll subscribes, then clients poll with the subscription and cursor of the previous response.
+func ServeLongPoll(w http.ResponseWriter, r *http.Request, poll LongPoll, token string) {
+	proxy.ServeLongPoll(w, r, poll, token)
+}
+
+// StreamEvent is an event of a streamed response, a line of NDJSON or a Server-Sent Event
+type StreamEvent = proxy.StreamEvent
+
+// StreamTransform maps an event of a streamed response as it arrives, returning false to drop it
+type StreamTransform = proxy.StreamTransform
+
+// StreamTransformation proxies a backend's NDJSON or Server-Sent Events stream, transforming each event as it arrives
+type StreamTransformation = proxy.StreamTransformation
+
+// FilterJSON keeps the events whose data is a JSON object keep accepts
+func FilterJSON(keep func(r *http.Request, data map[string]interface{}) bool) StreamTransform {
+	return proxy.FilterJSON(keep)
+}
+
+// MapJSON replaces the data of each event with what mapping returns for its JSON object, e.g. to redact or enrich it
+func MapJSON(mapping func(r *http.Request, data map[string]interface{}) map[string]interface{}) StreamTransform {
+	return proxy.MapJSON(mapping)
+}
+
+// TransformStream proxies a backend's NDJSON or Server-Sent Events stream, filtering and mapping each event without buffering the stream
+//
+// Pass the transformation describing the backend's stream and the transforms applied to its events.
+//
+// Pass a authorization token (optional).
+//
+// Responses which are not streams, errors included, are proxied unchanged.
+func TransformStream(w http.ResponseWriter, r *http.Request, transformation StreamTransformation, token string) {
+	proxy.TransformStream(w, r, transformation, token)
+}
+
+// Use appends middlewares to the chain every proxied request passes through, in order
+//
+// The chain starts with the built-in middlewares: abuse, bodysize, csrf, preprocessing (sanitization and
+// client authorization), clientcert, scopes, roles, ratelimit, preconditions, decompression and schema. Routes skip middlewares
+// of the chain by name and add their own with their Middlewares.
+//
+// Call it before starting the server.
+func Use(middlewares ...Middleware) {
+	proxy.Use(middlewares...)
+}
+
+// Stages of a route's Pipeline which are not middlewares, see Route.Pipeline
+const (
+	CacheStage = proxy.CacheStage
+	ProxyStage = proxy.ProxyStage
+)
+
+// DefineStages makes middlewares available to the pipelines of routes by name, without adding them to the chain
+//
+// A route's Pipeline lists the stages its requests pass through in order, e.g.
+// {"schema", "scopes", "enrich", "cache", "proxy", "strip-headers"}, where enrich and
+// strip-headers are defined stages. Call it before starting the server.
+func DefineStages(middlewares ...Middleware) {
+	proxy.DefineStages(middlewares...)
 }
@@ -0,0 +1,385 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/requestid"
+)
+
+// ListSource is a backend list endpoint whose items are merged into an aggregated list
+type ListSource struct {
+	//URL is the list endpoint, which must return its items sorted by the aggregation's SortField
+	URL string
+	//ItemsField is the field of the response holding the items, empty if the response is an array
+	ItemsField string
+	//Name identifies the source in warnings, its position in Sources if unset
+	Name string
+	//Default are the items merged in place of the source's first page if it fails under SubstituteDefaults
+	Default []json.RawMessage
+}
+
+// What AggregateList does when a source fails
+const (
+	//FailRequest fails the whole request with 502 Bad Gateway
+	FailRequest = "fail"
+	//PartialResults returns the items of the other sources with a warning for each failed source
+	PartialResults = "partial"
+	//SubstituteDefaults merges the failed source's Default items as if it had returned them
+	SubstituteDefaults = "substitute"
+)
+
+// ListAggregation merges the sorted lists of several services into one list clients page through with a cursor
+//
+// Each page fetches up to a page of items from every source at the offsets the cursor records,
+// merges them by SortField and returns the first page of the result. The next cursor records how
+// many items of each source have been returned, so no item is skipped or repeated.
+type ListAggregation struct {
+	Sources []ListSource
+	//SortField is the field of the items the sources sort by
+	SortField string
+	//Descending is true if the sources sort from the largest value
+	Descending bool
+	//OffsetParam and LimitParam are the query parameters of the sources, "offset" and "limit" if unset
+	OffsetParam string
+	LimitParam  string
+	//DefaultLimit and MaxLimit bound the page size clients ask for with the limit parameter, 20 and 100 if unset
+	DefaultLimit int
+	MaxLimit     int
+	//MaxParallelism is the most sources fetched at once, 0 fetches them all at once
+	MaxParallelism int
+	//OnFailure is FailRequest (the default), PartialResults or SubstituteDefaults
+	OnFailure string
+}
+
+// AggregatedList is a page of an aggregated list
+type AggregatedList struct {
+	Items      []json.RawMessage `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	Warnings   []ListWarning     `json:"warnings,omitempty"`
+}
+
+// ListWarning reports a source missing from a page of an aggregated list
+type ListWarning struct {
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+// listCursor is the position of a client in an aggregated list, the offset consumed from each source
+type listCursor struct {
+	Offsets []int `json:"o"`
+}
+
+func encodeCursor(offsets []int) string {
+	data, _ := json.Marshal(listCursor{Offsets: offsets})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, sources int) ([]int, error) {
+	if cursor == "" {
+		return make([]int, sources), nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var decoded listCursor
+	if json.Unmarshal(data, &decoded) != nil || len(decoded.Offsets) != sources {
+		return nil, errors.New("invalid cursor")
+	}
+	for _, offset := range decoded.Offsets {
+		if offset < 0 {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	return decoded.Offsets, nil
+}
+
+// listItem is an item of a source with the value it is sorted by
+type listItem struct {
+	raw    json.RawMessage
+	key    interface{}
+	source int
+}
+
+// sortsBefore orders sort values, numbers before strings and other values by their encoding
+func sortsBefore(a interface{}, b interface{}) bool {
+	af, aNumber := a.(float64)
+	bf, bNumber := b.(float64)
+	if aNumber && bNumber {
+		return af < bf
+	}
+	if aNumber != bNumber {
+		return aNumber
+	}
+	as, aString := a.(string)
+	bs, bString := b.(string)
+	if aString && bString {
+		return as < bs
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// AggregateList serves a page of the aggregated list, passing token (optional) to the sources
+//
+// Clients page with the "limit" and "cursor" query parameters, following next_cursor until it is omitted.
+func AggregateList(w http.ResponseWriter, r *http.Request, aggregation ListAggregation, token string) {
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+	middlewares := ProxyMiddlewaresFactory("JSON", token)
+	for _, requestMiddleware := range middlewares.RequestMiddlewares {
+		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Nothing is cached, so the stages after the cache lookup always run
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	limit := aggregation.DefaultLimit
+	if limit <= 0 {
+		limit = 20
+	}
+	maxLimit := aggregation.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = 100
+	}
+	if requested := r.URL.Query().Get("limit"); requested != "" {
+		n, err := strconv.Atoi(requested)
+		if err != nil || n <= 0 {
+			apierror.Write(w, r, http.StatusBadRequest, "limit must be a positive integer", nil)
+			return
+		}
+		limit = n
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offsets, err := decodeCursor(r.URL.Query().Get("cursor"), len(aggregation.Sources))
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid cursor", nil)
+		return
+	}
+
+	pages := make([][]listItem, len(aggregation.Sources))
+	errs := make([]error, len(aggregation.Sources))
+	parallelism := aggregation.MaxParallelism
+	if parallelism <= 0 || parallelism > len(aggregation.Sources) {
+		parallelism = len(aggregation.Sources)
+	}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i := range aggregation.Sources {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			pages[i], errs[i] = fetchList(r, aggregation, i, offsets[i], limit)
+		}(i)
+	}
+	wg.Wait()
+
+	var warnings []ListWarning
+	failed := make([]bool, len(aggregation.Sources))
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		source := aggregation.Sources[i]
+		logger.LogForRequest(logger.ERR, r, "Could not fetch list from "+source.URL+": "+err.Error())
+		switch aggregation.OnFailure {
+		case PartialResults:
+			failed[i] = true
+			name := source.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			warnings = append(warnings, ListWarning{Source: name, Message: "source unavailable, its items are missing"})
+		case SubstituteDefaults:
+			pages[i] = nil
+			if offsets[i] == 0 {
+				pages[i], err = listItems(source.Default, aggregation.SortField, i, limit)
+			}
+			if err != nil {
+				apierror.Write(w, r, http.StatusBadGateway, "", nil)
+				return
+			}
+		default:
+			apierror.Write(w, r, http.StatusBadGateway, "", nil)
+			return
+		}
+	}
+
+	var merged []listItem
+	for _, page := range pages {
+		merged = append(merged, page...)
+	}
+	// Ties keep the order of the sources, so every page of the same cursor is the same
+	sort.SliceStable(merged, func(i, j int) bool {
+		if aggregation.Descending {
+			return sortsBefore(merged[j].key, merged[i].key)
+		}
+		return sortsBefore(merged[i].key, merged[j].key)
+	})
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+
+	list := AggregatedList{Items: make([]json.RawMessage, 0, len(merged)), Warnings: warnings}
+	next := append([]int(nil), offsets...)
+	for _, item := range merged {
+		list.Items = append(list.Items, item.raw)
+		next[item.source]++
+	}
+	// A source which filled its page may have more items, a failed one is tried again on the next page
+	for i, page := range pages {
+		if len(page) == limit || next[i]-offsets[i] < len(page) || (failed[i] && len(merged) > 0) {
+			list.NextCursor = encodeCursor(next)
+			break
+		}
+	}
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(list)
+	w.Header().Set("Content-Type", "application/json")
+	respond(w, r, http.StatusOK, body.Bytes(), middlewares, tracker)
+}
+
+// fetchList fetches up to limit items of a source starting at offset
+func fetchList(r *http.Request, aggregation ListAggregation, source int, offset int, limit int) ([]listItem, error) {
+	offsetParam, limitParam := aggregation.OffsetParam, aggregation.LimitParam
+	if offsetParam == "" {
+		offsetParam = "offset"
+	}
+	if limitParam == "" {
+		limitParam = "limit"
+	}
+	u, err := neturl.Parse(aggregation.Sources[source].URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set(offsetParam, strconv.Itoa(offset))
+	query.Set(limitParam, strconv.Itoa(limit))
+	u.RawQuery = query.Encode()
+
+	body, err := fetchJSON(r, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []json.RawMessage
+	if field := aggregation.Sources[source].ItemsField; field != "" {
+		var object map[string]json.RawMessage
+		err = json.Unmarshal(body, &object)
+		if err == nil {
+			err = json.Unmarshal(object[field], &raw)
+		}
+	} else {
+		err = json.Unmarshal(body, &raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listItems(raw, aggregation.SortField, source, limit)
+}
+
+// backendStatusError is the status a backend answered a fetch with instead of a successful one
+type backendStatusError int
+
+func (e backendStatusError) Error() string {
+	return "responded with " + strconv.Itoa(int(e))
+}
+
+// fetchJSON gets the body of a backend's successful response to a GET of url for the caller's request r
+//
+// A 204 No Content response is read as null, a 206 Partial Content response is not the whole document and fails.
+func fetchJSON(r *http.Request, url string) ([]byte, error) {
+	return callBackend(r, http.MethodGet, url, nil)
+}
+
+// callBackend sends body (optional) to url with method for the caller's request r, returning the body of a successful response
+func callBackend(r *http.Request, method string, url string, body []byte) ([]byte, error) {
+	observeBackend(r, url)
+	var reqBody io.Reader = http.NoBody
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range r.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	// The body is decoded here, so the transport negotiates the encoding rather than the caller
+	req.Header.Del("Accept-Encoding")
+	if !setCredentials(r, req) {
+		return nil, errors.New("could not get credentials")
+	}
+	client := &http.Client{
+		Transport: transport(),
+		Timeout:   time.Duration(constants.Timeout) * time.Second,
+	}
+	resp, err := client.Do(req.WithContext(r.Context()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || resp.StatusCode == http.StatusPartialContent {
+		return nil, backendStatusError(resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return []byte("null"), nil
+	}
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, constants.MaxFileUploadSize+1))
+	if err == nil && len(responseBody) > constants.MaxFileUploadSize {
+		return nil, errors.New("response is too large")
+	}
+	return responseBody, err
+}
+
+// listItems reads the sort values of up to limit items of a source
+func listItems(raw []json.RawMessage, sortField string, source int, limit int) ([]listItem, error) {
+	if len(raw) > limit {
+		raw = raw[:limit]
+	}
+	items := make([]listItem, len(raw))
+	for i, item := range raw {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(item, &fields); err != nil {
+			return nil, err
+		}
+		items[i] = listItem{raw: item, key: fields[sortField], source: source}
+	}
+	return items, nil
+}
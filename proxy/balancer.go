@@ -0,0 +1,305 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	neturl "net/url"
+	"sync"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/ratelimit"
+)
+
+// Load balancing policies of a Pool
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+	Weighted         = "weighted"
+)
+
+// Session affinity of a Pool
+const (
+	//CookieAffinity keeps clients on the instance named by an affinity cookie arbor issues
+	CookieAffinity = "cookie"
+	//HeaderAffinity consistently hashes clients onto instances by a request header, e.g. a session ID
+	HeaderAffinity = "header"
+	//IPAffinity consistently hashes clients onto instances by their IP address
+	IPAffinity = "ip"
+)
+
+// Instance is one of the instances of a backend service
+type Instance struct {
+	//URL is the base URL of the instance, e.g. "http://10.0.0.1:8000"
+	URL string
+	//Weight is the share of requests the instance gets under the Weighted policy, 1 if unset
+	Weight int
+}
+
+// Pool balances requests across the instances of a backend service
+//
+// Instances whose host health probes found down, or which are paused for throttling, are skipped.
+// Clients with affinity go to the same instance while it is up, and are balanced by the Policy otherwise.
+type Pool struct {
+	//Policy is RoundRobin (the default), LeastConnections or Weighted
+	Policy    string
+	Instances []Instance
+	//Affinity keeps each client on one instance: CookieAffinity, HeaderAffinity or IPAffinity (optional)
+	Affinity string
+	//AffinityKey is the name of the affinity cookie (default "arbor_affinity_" and an ID of the pool) or of the hashed header
+	AffinityKey string
+
+	mutex    sync.Mutex
+	next     int
+	inFlight map[string]int
+	current  map[string]int
+}
+
+// BackendPools are the backend services with several instances, keyed by the host routes use for them
+//
+// A route proxying to "http://users/profile" with a pool for "users" is sent to one of its instances.
+var BackendPools = map[string]*Pool{}
+
+// SetInstances replaces the instances of the pool while it is in use, e.g. when they are discovered
+func (p *Pool) SetInstances(instances []Instance) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.Instances = instances
+	// Forget the weighted round robin state of removed instances
+	for url := range p.current {
+		found := false
+		for _, instance := range instances {
+			found = found || instance.URL == url
+		}
+		if !found {
+			delete(p.current, url)
+		}
+	}
+}
+
+func (p *Pool) instances() []Instance {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.Instances
+}
+
+// pick chooses the instance for a request with the affinity key from instances, -1 if every instance is down
+func (p *Pool) pick(instances []Instance, bases []*neturl.URL, key string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.inFlight == nil {
+		p.inFlight = map[string]int{}
+		p.current = map[string]int{}
+	}
+
+	healthy := make([]bool, len(instances))
+	for i, base := range bases {
+		healthy[i] = base != nil && available(base.Host)
+	}
+	weight := func(i int) int {
+		if instances[i].Weight > 0 {
+			return instances[i].Weight
+		}
+		return 1
+	}
+
+	chosen := -1
+	if key != "" {
+		chosen = p.affine(instances, healthy, weight, key)
+	}
+	switch {
+	case chosen != -1:
+		// The client sticks to its instance
+	case p.Policy == LeastConnections:
+		// Start after the last pick so ties rotate between instances
+		for n := 0; n < len(instances); n++ {
+			i := (p.next + n) % len(instances)
+			if healthy[i] && (chosen == -1 || p.inFlight[instances[i].URL] < p.inFlight[instances[chosen].URL]) {
+				chosen = i
+			}
+		}
+	case p.Policy == Weighted:
+		// Smooth weighted round robin spreads each instance's share evenly over time
+		total := 0
+		for i := range instances {
+			if !healthy[i] {
+				continue
+			}
+			p.current[instances[i].URL] += weight(i)
+			total += weight(i)
+			if chosen == -1 || p.current[instances[i].URL] > p.current[instances[chosen].URL] {
+				chosen = i
+			}
+		}
+		if chosen != -1 {
+			p.current[instances[chosen].URL] -= total
+		}
+	default:
+		for n := 0; n < len(instances); n++ {
+			i := (p.next + n) % len(instances)
+			if healthy[i] {
+				chosen = i
+				break
+			}
+		}
+	}
+	if chosen != -1 {
+		p.next = (chosen + 1) % len(instances)
+		p.inFlight[instances[chosen].URL]++
+	}
+	return chosen
+}
+
+func (p *Pool) done(url string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.inFlight[url]--
+	if p.inFlight[url] <= 0 {
+		delete(p.inFlight, url)
+	}
+}
+
+// balance sends url to an instance of its backend's pool, if it has one
+//
+// The returned done must be called once the instance has responded. If the pool
+// has no instance which is up the request fails fast with 503 Service Unavailable and ok is false.
+func balance(w http.ResponseWriter, r *http.Request, url string) (balancedURL string, done func(), ok bool) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url, func() {}, true
+	}
+	pool, exists := BackendPools[u.Host]
+	if !exists {
+		return url, func() {}, true
+	}
+	instances := pool.instances()
+	bases := instanceBases(r, u, instances)
+
+	key := pool.affinityKey(r, u.Host)
+	i := pool.pick(instances, bases, key)
+	if i == -1 {
+		logger.LogForRequest(logger.WARN, r, "Failing request fast, no instance of "+u.Host+" is up")
+		metrics.RequestsShed.Inc("unhealthy")
+		w.Header().Set("Retry-After", "1")
+		apierror.Write(w, r, http.StatusServiceUnavailable, "", nil)
+		return "", nil, false
+	}
+	instanceURL := instances[i].URL
+	// Clients without a cookie, or whose instance went down, are given one for their new instance
+	if pool.Affinity == CookieAffinity && key != instanceID(instanceURL) {
+		http.SetCookie(w, &http.Cookie{Name: pool.cookieName(u.Host), Value: instanceID(instanceURL), Path: "/", HttpOnly: true})
+	}
+	return rebase(u, bases[i]), func() { pool.done(instanceURL) }, true
+}
+
+// balanceAgain sends url to another instance of its backend's pool than the one previousURL went to
+//
+// ok is false if the backend has no pool or no other instance is up.
+func balanceAgain(r *http.Request, url string, previousURL string) (balancedURL string, done func(), ok bool) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return "", nil, false
+	}
+	pool, exists := BackendPools[u.Host]
+	if !exists {
+		return "", nil, false
+	}
+	instances := pool.instances()
+	bases := instanceBases(r, u, instances)
+	for i, base := range bases {
+		// Instances without a base are never picked
+		if base != nil && rebase(u, base) == previousURL {
+			bases[i] = nil
+		}
+	}
+
+	i := pool.pick(instances, bases, "")
+	if i == -1 {
+		return "", nil, false
+	}
+	instanceURL := instances[i].URL
+	return rebase(u, bases[i]), func() { pool.done(instanceURL) }, true
+}
+
+// instanceBases parses the URLs of instances, leaving invalid ones nil
+func instanceBases(r *http.Request, u *neturl.URL, instances []Instance) []*neturl.URL {
+	bases := make([]*neturl.URL, len(instances))
+	for i, instance := range instances {
+		base, err := neturl.Parse(instance.URL)
+		if err != nil {
+			logger.LogForRequest(logger.ERR, r, "Invalid instance URL "+instance.URL+" for "+u.Host+": "+err.Error())
+			continue
+		}
+		bases[i] = base
+	}
+	return bases
+}
+
+// affinityKey identifies the client of r for the pool's affinity, empty if it has none
+func (p *Pool) affinityKey(r *http.Request, host string) string {
+	switch p.Affinity {
+	case CookieAffinity:
+		if cookie, err := r.Cookie(p.cookieName(host)); err == nil {
+			return cookie.Value
+		}
+	case HeaderAffinity:
+		return r.Header.Get(p.AffinityKey)
+	case IPAffinity:
+		return ratelimit.ByClientIP(r)
+	}
+	return ""
+}
+
+func (p *Pool) cookieName(host string) string {
+	if p.AffinityKey != "" {
+		return p.AffinityKey
+	}
+	return "arbor_affinity_" + instanceID(host)[:8]
+}
+
+// affine chooses the instance the affinity key sticks to, -1 if it is down
+func (p *Pool) affine(instances []Instance, healthy []bool, weight func(int) int, key string) int {
+	if p.Affinity == CookieAffinity {
+		for i, instance := range instances {
+			if healthy[i] && instanceID(instance.URL) == key {
+				return i
+			}
+		}
+		return -1
+	}
+	// Rendezvous hashing only moves the clients of an instance which goes down or away
+	chosen, best := -1, 0.0
+	for i, instance := range instances {
+		if !healthy[i] {
+			continue
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(key + "\n" + instance.URL))
+		uniform := (float64(hash.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(weight(i)) / math.Log(uniform)
+		if chosen == -1 || score > best {
+			chosen, best = i, score
+		}
+	}
+	return chosen
+}
+
+// instanceID names an instance in affinity cookies without revealing its URL
+func instanceID(url string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(url))
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
@@ -0,0 +1,91 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/cbor"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/msgpack"
+	"github.com/arbor-dev/arbor/negotiation"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// binaryFormat is a binary format callers speak, which is translated to and from JSON for
+// routes with TranslateToJSON
+type binaryFormat struct {
+	mediaType string
+	is        func(contentType string) bool
+	toJSON    func(body []byte) ([]byte, error)
+	fromJSON  func(body []byte) ([]byte, error)
+}
+
+// binaryFormats are the binary formats by the name passed to WithFormat
+var binaryFormats = map[string]binaryFormat{
+	"MSGPACK": {msgpack.MediaType, msgpack.IsMsgpack, msgpack.ToJSON, msgpack.FromJSON},
+	"CBOR":    {cbor.MediaType, cbor.IsCBOR, cbor.ToJSON, cbor.FromJSON},
+}
+
+// translatesToJSON reports whether the route serving r translates binary bodies to JSON
+func translatesToJSON(r *http.Request) bool {
+	route, routed := services.RouteFromContext(r.Context())
+	return routed && route.TranslateToJSON
+}
+
+// translateRequestBody translates the caller's binary body to JSON if the route translates to JSON,
+// bodies are otherwise sent as they are
+func (f binaryFormat) translateRequestBody(r *http.Request, body []byte) ([]byte, bool) {
+	if len(body) == 0 || !f.is(r.Header.Get("Content-Type")) || !translatesToJSON(r) {
+		return body, true
+	}
+	translated, err := f.toJSON(body)
+	if err != nil {
+		logger.LogForRequest(logger.DEBUG, r, "Could not translate request body to JSON: "+err.Error())
+		return nil, false
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return translated, true
+}
+
+// translateResponseBody translates the JSON response of a route translating to JSON to the binary
+// format, unless the caller prefers JSON, other responses are sent as they are
+func (f binaryFormat) translateResponseBody(header http.Header, r *http.Request, body []byte) ([]byte, bool) {
+	header.Add("Vary", "Accept")
+	if len(body) == 0 {
+		return body, true
+	}
+	contentType := negotiation.MediaType(header.Get("Content-Type"))
+	if !translatesToJSON(r) || !transform.IsJSON(contentType) {
+		if contentType == "" || contentType == "application/octet-stream" {
+			// Services often leave the type of their binary bodies unset or generic, callers need it to decode them
+			header.Set("Content-Type", f.mediaType)
+		}
+		return body, true
+	}
+	if negotiation.Quality(r, "application/json") > negotiation.Quality(r, f.mediaType) {
+		return body, true
+	}
+	// Compressed bodies can not be translated, callers get them as they are
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return body, true
+	}
+	translated, err := f.fromJSON(body)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Could not translate response body from JSON: "+err.Error())
+		return nil, false
+	}
+	header.Set("Content-Type", f.mediaType)
+	header.Del("Content-Length")
+	weakenETag(header)
+	return translated, true
+}
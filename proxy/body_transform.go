@@ -0,0 +1,60 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// transformRequestBody applies the route's Request mappings to the JSON body sent to the service
+//
+// Bodies which are not JSON are sent as they are, for the service to reject.
+func transformRequestBody(r *http.Request, body []byte) []byte {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || route.Transform == nil || len(route.Transform.Request) == 0 || len(body) == 0 || !transform.IsJSON(r.Header.Get("Content-Type")) {
+		return body
+	}
+	transformed, err := transform.Apply(body, route.Transform.Request)
+	if err != nil {
+		logger.LogForRequest(logger.DEBUG, r, "Could not transform request body: "+err.Error())
+		return body
+	}
+	return transformed
+}
+
+// transformResponseBody applies the route's Response mappings to the JSON body the service responded with
+func transformResponseBody(r *http.Request, header http.Header, body []byte) []byte {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || route.Transform == nil || len(route.Transform.Response) == 0 || len(body) == 0 || !transform.IsJSON(header.Get("Content-Type")) {
+		return body
+	}
+	// Compressed bodies are passed on as they are rather than decoded here
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return body
+	}
+	transformed, err := transform.Apply(body, route.Transform.Response)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Could not transform response body: "+err.Error())
+		return body
+	}
+	// The service's validators and length describe the body it sent
+	header.Del("Content-Length")
+	header.Del("ETag")
+	header.Del("Content-MD5")
+	header.Del("Digest")
+	header.Del("Content-Digest")
+	return transformed
+}
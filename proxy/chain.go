@@ -0,0 +1,232 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/services"
+)
+
+var (
+	chainMutex sync.RWMutex
+	// chain starts with the built-in middlewares, which routes skip by name like any other
+	chain = []services.Middleware{
+		{Name: "abuse", Handler: middleware.AbuseMiddleware},
+		{Name: "bodysize", Handler: middleware.BodySizeMiddleware},
+		{Name: "csrf", Handler: middleware.CSRFMiddleware},
+		{Name: "preprocessing", Handler: middleware.PreprocessingMiddleware},
+		{Name: "clientcert", Handler: middleware.ClientCertificateMiddleware},
+		{Name: "scopes", Handler: middleware.ScopesMiddleware},
+		{Name: "roles", Handler: middleware.RolesMiddleware},
+		{Name: "ratelimit", Handler: middleware.RateLimitMiddleware},
+		{Name: "preconditions", Handler: middleware.PreconditionsMiddleware},
+		{Name: "decompression", Handler: middleware.DecompressionMiddleware},
+		{Name: "schema", Handler: middleware.SchemaMiddleware},
+	}
+	// optionalStages are the built-in middlewares a route's Pipeline only runs if it names them,
+	// the rest of the chain guards the gateway and runs for every route
+	optionalStages = map[string]bool{"preconditions": true, "decompression": true, "schema": true}
+)
+
+// Use appends middlewares to the chain every proxied request passes through, in order
+//
+// The chain starts with the built-in middlewares: abuse, bodysize, csrf, preprocessing (sanitization and
+// client authorization), clientcert, scopes, roles, ratelimit, preconditions, decompression and schema. Routes skip middlewares
+// of the chain by name and add their own with their Middlewares.
+func Use(middlewares ...services.Middleware) {
+	chainMutex.Lock()
+	defer chainMutex.Unlock()
+	chain = append(chain[:len(chain):len(chain)], middlewares...)
+}
+
+// Chain returns the middlewares of the chain, in the order they run
+func Chain() []services.Middleware {
+	chainMutex.RLock()
+	defer chainMutex.RUnlock()
+	return append([]services.Middleware(nil), chain...)
+}
+
+// Names of the stages of a route's Pipeline which are not middlewares
+const (
+	//CacheStage is where the response cache is looked up, the stages after it only run for requests it misses
+	CacheStage = "cache"
+	//ProxyStage is where the request is proxied, the stages after it run on every response before it is sent
+	ProxyStage = "proxy"
+)
+
+var (
+	stagesMutex sync.RWMutex
+	stages      = map[string]services.Middleware{}
+)
+
+// DefineStages makes middlewares available to the pipelines of routes by name, without adding them to the chain
+func DefineStages(middlewares ...services.Middleware) {
+	stagesMutex.Lock()
+	defer stagesMutex.Unlock()
+	for _, m := range middlewares {
+		stages[m.Name] = m
+	}
+}
+
+// ValidatePipeline returns an error if the route's Pipeline names a stage which is not defined, or
+// places a middleware of the chain guarding the gateway after the cache lookup, where cached
+// responses would be served without it
+func ValidatePipeline(route services.Route) error {
+	r := (&http.Request{}).WithContext(services.NewContext(context.Background(), route))
+	return buildPipeline(r).err
+}
+
+// stagePipeline is the stages a request passes through, split around the cache lookup and the proxying
+type stagePipeline struct {
+	beforeCache []services.Middleware
+	afterCache  []services.Middleware
+	response    []services.Middleware
+	err         error
+}
+
+type pipelineKey struct{}
+
+// withPipeline returns r carrying the pipeline of the route serving it, so its stages are only looked up once
+func withPipeline(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), pipelineKey{}, buildPipeline(r)))
+}
+
+// pipeline returns the pipeline of the route serving the request
+func pipeline(r *http.Request) *stagePipeline {
+	if p, ok := r.Context().Value(pipelineKey{}).(*stagePipeline); ok {
+		return p
+	}
+	return buildPipeline(r)
+}
+
+// buildPipeline splits the stages the caller's request passes through around the cache lookup and the proxying
+//
+// Routes without a Pipeline pass through the chain, with their overrides, before the cache
+// lookup. The stages of a Pipeline are looked up by name among the route's own middlewares,
+// the stages defined with DefineStages and the chain, in that order. The middlewares of the
+// chain guarding the gateway (all but preconditions, decompression and schema) which the
+// Pipeline does not name still run first, unless the route skips them.
+func buildPipeline(r *http.Request) *stagePipeline {
+	middlewares := Chain()
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok {
+		return &stagePipeline{beforeCache: middlewares}
+	}
+	var skip []string
+	if route.Middlewares != nil {
+		skip = route.Middlewares.Skip
+	}
+	if route.Pipeline == nil {
+		kept := middlewares[:0]
+		for _, m := range middlewares {
+			if !contains(m.Name, skip) {
+				kept = append(kept, m)
+			}
+		}
+		if route.Middlewares != nil {
+			kept = append(kept, route.Middlewares.Use...)
+		}
+		return &stagePipeline{beforeCache: kept}
+	}
+
+	p := &stagePipeline{}
+	byName := make(map[string]services.Middleware, len(middlewares))
+	guarding := make(map[string]bool, len(middlewares))
+	for _, m := range middlewares {
+		byName[m.Name] = m
+		guarding[m.Name] = !optionalStages[m.Name]
+		if guarding[m.Name] && !contains(m.Name, route.Pipeline) && !contains(m.Name, skip) {
+			p.beforeCache = append(p.beforeCache, m)
+		}
+	}
+	stagesMutex.RLock()
+	for name, m := range stages {
+		byName[name] = m
+	}
+	stagesMutex.RUnlock()
+	if route.Middlewares != nil {
+		for _, m := range route.Middlewares.Use {
+			byName[m.Name] = m
+		}
+	}
+
+	current := &p.beforeCache
+	for _, name := range route.Pipeline {
+		switch name {
+		case CacheStage:
+			current = &p.afterCache
+		case ProxyStage:
+			current = &p.response
+		default:
+			m, exists := byName[name]
+			if !exists {
+				return &stagePipeline{err: errors.New("route " + route.Name + " has unknown pipeline stage " + name)}
+			}
+			if guarding[name] && current != &p.beforeCache {
+				return &stagePipeline{err: errors.New("route " + route.Name + " runs pipeline stage " + name + " after the cache, cached responses would skip it")}
+			}
+			*current = append(*current, m)
+		}
+	}
+	return p
+}
+
+// runStages runs stages on the caller's request, false if one of them responded
+func runStages(w http.ResponseWriter, r *http.Request, stages []services.Middleware) bool {
+	tracker := &responseTracker{ResponseWriter: w}
+	for _, m := range stages {
+		m.Handler.ServeHTTP(tracker, r)
+		if tracker.responded {
+			return false
+		}
+	}
+	return true
+}
+
+// chainMiddleware runs the stages of the route serving the request which come before the cache lookup
+var chainMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	p := pipeline(r)
+	if p.err != nil {
+		logger.LogForRequest(logger.ERR, r, p.err.Error())
+		apierror.Write(w, r, http.StatusInternalServerError, "", nil)
+		return
+	}
+	runStages(w, r, p.beforeCache)
+})
+
+// RunChain runs the middleware chain on a request the gateway serves itself, false if one of them responded
+//
+// Handlers which depend on who the caller is (e.g. the owner of a job) see them authenticated the
+// same way as on the routes they proxy.
+func RunChain(w http.ResponseWriter, r *http.Request) bool {
+	tracker := &responseTracker{ResponseWriter: w}
+	chainMiddleware.ServeHTTP(tracker, r)
+	return !tracker.responded
+}
+
+// cacheMissed runs the stages of the route serving the request which come after the cache lookup, false if one of them responded
+func cacheMissed(w http.ResponseWriter, r *http.Request) bool {
+	p := pipeline(r)
+	return p.err != nil || runStages(w, r, p.afterCache)
+}
+
+// responseStages runs the stages of the route serving the request which come after the proxying, false if one of them responded
+func responseStages(w http.ResponseWriter, r *http.Request) bool {
+	p := pipeline(r)
+	return p.err != nil || runStages(w, r, p.response)
+}
@@ -0,0 +1,135 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/requestid"
+)
+
+// CompositionCall is a backend call whose JSON response is placed in a field of the composed document
+type CompositionCall struct {
+	//Field is the field of the document holding the response
+	Field string
+	//URL is the backend endpoint, GET with the caller's headers
+	//
+	//{name} placeholders are replaced with the route's variables, e.g. "http://orders/users/{id}/orders".
+	URL string
+	//Required fails the whole request with 502 Bad Gateway if the call fails, other calls are replaced by an error placeholder
+	Required bool
+}
+
+// errInvalidJSON is the error of a call whose response is not JSON, which can not be placed in the document
+var errInvalidJSON = errors.New("response is not JSON")
+
+// Composition fans a route out to several backend calls made in parallel, merging their responses into one document
+type Composition struct {
+	Calls []CompositionCall
+	//MaxParallelism is the most calls made at once, 0 makes them all at once
+	MaxParallelism int
+}
+
+// CallError is the placeholder of a call which failed, in place of its response as {"error": {...}}
+type CallError struct {
+	//Status is the status the backend responded with, 0 if it did not respond
+	Status  int    `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+// Compose serves the document composed of the responses of the composition's calls, passing token (optional) to the backends
+//
+// Each call's response is placed in its field, or {"error": {"status": ..., "message": ...}} if the call failed.
+func Compose(w http.ResponseWriter, r *http.Request, composition Composition, token string) {
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+	middlewares := ProxyMiddlewaresFactory("JSON", token)
+	for _, requestMiddleware := range middlewares.RequestMiddlewares {
+		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Nothing is cached, so the stages after the cache lookup always run
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	calls := composition.Calls
+	responses := make([][]byte, len(calls))
+	errs := make([]error, len(calls))
+	parallelism := composition.MaxParallelism
+	if parallelism <= 0 || parallelism > len(calls) {
+		parallelism = len(calls)
+	}
+	slots := make(chan struct{}, parallelism)
+	vars := mux.Vars(r)
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			responses[i], errs[i] = fetchJSON(r, expandURL(calls[i].URL, vars))
+			if errs[i] == nil && !json.Valid(responses[i]) {
+				errs[i] = errInvalidJSON
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	document := make(map[string]json.RawMessage, len(calls))
+	for i, call := range calls {
+		if errs[i] == nil {
+			document[call.Field] = responses[i]
+			continue
+		}
+		logger.LogForRequest(logger.ERR, r, "Composed call to "+call.URL+" failed: "+errs[i].Error())
+		if call.Required {
+			apierror.Write(w, r, http.StatusBadGateway, "A required backend call failed", map[string]interface{}{"field": call.Field})
+			return
+		}
+		// The cause is logged rather than returned, as it may describe the backend's internals
+		callError := CallError{Message: "backend unavailable"}
+		if status, ok := errs[i].(backendStatusError); ok {
+			callError.Status = int(status)
+			callError.Message = "backend responded with " + http.StatusText(int(status))
+		}
+		placeholder, _ := json.Marshal(map[string]CallError{"error": callError})
+		document[call.Field] = placeholder
+	}
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(document)
+	w.Header().Set("Content-Type", "application/json")
+	respond(w, r, http.StatusOK, body.Bytes(), middlewares, tracker)
+}
+
+// expandURL replaces the {name} placeholders of url with the escaped route variables
+func expandURL(url string, vars map[string]string) string {
+	for name, value := range vars {
+		url = strings.Replace(url, "{"+name+"}", neturl.PathEscape(value), -1)
+	}
+	return url
+}
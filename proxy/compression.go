@@ -0,0 +1,181 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compression controls if responses are compressed for callers which accept gzip or deflate
+var Compression = true
+
+// CompressionMinSize is the size in bytes of the smallest response body which is compressed
+var CompressionMinSize = 1024
+
+// CompressibleTypes are the MIME types which are compressed, entries ending in / match a whole top level type
+var CompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/x-www-form-urlencoded",
+	"image/svg+xml",
+}
+
+// compressors are the encodings arbor can produce, in order of preference
+//
+// Brotli responses from backends are passed through but arbor does not produce them.
+var compressors = []struct {
+	name   string
+	writer func(io.Writer) io.WriteCloser
+	reader func(io.Reader) (io.ReadCloser, error)
+}{
+	{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }},
+	{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }, zlib.NewReader},
+}
+
+// BackendRequestCompression are the backends, keyed by host (e.g. "localhost:8000"), which accept
+// gzip encoded request bodies, so bodies of at least CompressionMinSize are compressed when forwarded to them
+var BackendRequestCompression = map[string]bool{}
+
+// encodeRequestBody compresses the body of a request being forwarded to a backend which accepts it
+func encodeRequestBody(req *http.Request, body []byte) {
+	if !BackendRequestCompression[req.URL.Host] || len(body) < CompressionMinSize || req.Header.Get("Content-Encoding") != "" {
+		return
+	}
+	var encoded bytes.Buffer
+	writer := gzip.NewWriter(&encoded)
+	writer.Write(body)
+	if writer.Close() != nil || encoded.Len() >= len(body) {
+		return
+	}
+	compressed := encoded.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	req.ContentLength = int64(len(compressed))
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Del("Content-Length")
+}
+
+// acceptedEncodings parses Accept-Encoding into the q-value of each encoding
+func acceptedEncodings(r *http.Request) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			fields := strings.Split(part, ";")
+			name := strings.ToLower(strings.TrimSpace(fields[0]))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range fields[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+						q = parsed
+					}
+				}
+			}
+			accepted[name] = q
+		}
+	}
+	return accepted
+}
+
+func accepts(accepted map[string]float64, encoding string) bool {
+	if q, ok := accepted[encoding]; ok {
+		return q > 0
+	}
+	q, ok := accepted["*"]
+	return ok && q > 0
+}
+
+func compressible(header http.Header) bool {
+	contentType := header.Get("Content-Type")
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, allowed := range CompressibleTypes {
+		if contentType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeBody compresses body for the caller if it accepts an encoding arbor produces, updating the headers to match
+//
+// Bodies the backend already compressed are passed through, unless the caller does not accept
+// their encoding and arbor can decompress them.
+func encodeBody(header http.Header, r *http.Request, status int, body []byte) []byte {
+	if !Compression || r.Method == http.MethodHead || status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		return body
+	}
+	header.Add("Vary", "Accept-Encoding")
+	accepted := acceptedEncodings(r)
+
+	if encoding := strings.ToLower(header.Get("Content-Encoding")); encoding != "" && encoding != "identity" {
+		if accepts(accepted, encoding) {
+			return body
+		}
+		for _, c := range compressors {
+			if c.name != encoding {
+				continue
+			}
+			reader, err := c.reader(bytes.NewReader(body))
+			if err != nil {
+				return body
+			}
+			decoded, err := ioutil.ReadAll(reader)
+			if err != nil {
+				return body
+			}
+			header.Del("Content-Encoding")
+			header.Set("Content-Length", strconv.Itoa(len(decoded)))
+			return decoded
+		}
+		return body
+	}
+
+	if len(body) < CompressionMinSize || header.Get("Content-Range") != "" || !compressible(header) ||
+		strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") {
+		return body
+	}
+	for _, c := range compressors {
+		if !accepts(accepted, c.name) {
+			continue
+		}
+		var encoded bytes.Buffer
+		writer := c.writer(&encoded)
+		writer.Write(body)
+		if writer.Close() != nil || encoded.Len() >= len(body) {
+			return body
+		}
+		header.Set("Content-Encoding", c.name)
+		header.Set("Content-Length", strconv.Itoa(encoded.Len()))
+		// The compressed representation is no longer byte for byte the one the ETag names
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		return encoded.Bytes()
+	}
+	return body
+}
@@ -0,0 +1,131 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// ConcurrencyLimit caps the number of requests in flight to a backend service
+type ConcurrencyLimit struct {
+	//MaxInFlight is the most requests proxied to the backend at once, 0 is unlimited
+	MaxInFlight int
+	//QueueTimeout is how long excess requests wait for a slot before being shed, 0 sheds them immediately
+	QueueTimeout time.Duration
+}
+
+// BackendConcurrency is the concurrency limit of each backend service, keyed by host (e.g. "localhost:8000")
+var BackendConcurrency = map[string]ConcurrencyLimit{}
+
+// DefaultConcurrencyLimit is the concurrency limit of backends not in BackendConcurrency
+var DefaultConcurrencyLimit ConcurrencyLimit
+
+// inFlight is a semaphore with a slot for each request allowed to a backend at once
+type inFlight struct {
+	slots  chan struct{}
+	queued int64
+}
+
+var (
+	inFlightMutex  sync.Mutex
+	inFlightByHost = map[string]*inFlight{}
+)
+
+func concurrencyLimit(host string) ConcurrencyLimit {
+	if limit, ok := BackendConcurrency[host]; ok {
+		return limit
+	}
+	return DefaultConcurrencyLimit
+}
+
+// semaphore returns the semaphore of host, replacing it if its limit has changed
+func semaphore(host string, limit ConcurrencyLimit) *inFlight {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	sem, ok := inFlightByHost[host]
+	if !ok || cap(sem.slots) != limit.MaxInFlight {
+		sem = &inFlight{slots: make(chan struct{}, limit.MaxInFlight)}
+		inFlightByHost[host] = sem
+	}
+	return sem
+}
+
+// BackendLoad is the number of requests in flight to and queued for a backend with a concurrency limit
+type BackendLoad struct {
+	InFlight    int `json:"in_flight"`
+	Queued      int `json:"queued"`
+	MaxInFlight int `json:"max_in_flight"`
+}
+
+// BackendLoads returns the load of each backend with a concurrency limit, keyed by host
+func BackendLoads() map[string]BackendLoad {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	loads := make(map[string]BackendLoad, len(inFlightByHost))
+	for host, sem := range inFlightByHost {
+		loads[host] = BackendLoad{
+			InFlight:    len(sem.slots),
+			Queued:      int(atomic.LoadInt64(&sem.queued)),
+			MaxInFlight: cap(sem.slots),
+		}
+	}
+	return loads
+}
+
+// acquireBackend takes a slot to proxy r to url, queuing up to the backend's QueueTimeout
+//
+// The returned release must be called once the backend has responded. If no slot is
+// free in time the request is shed with 503 Service Unavailable and ok is false.
+func acquireBackend(w http.ResponseWriter, r *http.Request, url string) (release func(), ok bool) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return func() {}, true
+	}
+	limit := concurrencyLimit(u.Host)
+	if limit.MaxInFlight <= 0 {
+		return func() {}, true
+	}
+	sem := semaphore(u.Host, limit)
+	release = func() { <-sem.slots }
+
+	select {
+	case sem.slots <- struct{}{}:
+		return release, true
+	default:
+	}
+	if limit.QueueTimeout > 0 {
+		atomic.AddInt64(&sem.queued, 1)
+		select {
+		case sem.slots <- struct{}{}:
+			atomic.AddInt64(&sem.queued, -1)
+			return release, true
+		case <-clock.After(limit.QueueTimeout):
+		case <-r.Context().Done():
+		}
+		atomic.AddInt64(&sem.queued, -1)
+	}
+
+	logger.LogForRequest(logger.WARN, r, "Shedding request, "+strconv.Itoa(limit.MaxInFlight)+" requests already in flight to "+u.Host)
+	metrics.RequestsShed.Inc("concurrency")
+	w.Header().Set("Retry-After", "1")
+	apierror.Write(w, r, http.StatusServiceUnavailable, "", nil)
+	return nil, false
+}
@@ -13,5 +13,8 @@ var Timeout int64 = 10
 // ClientAuthorizationHeaderField is the header to use for token authorization
 var ClientAuthorizationHeaderField = "Authorization"
 
+// RequestIDHeaderField is the header used to correlate a request across arbor and the services
+var RequestIDHeaderField = "X-Request-ID"
+
 // AccessControlAllowHeaders is the headers allowed by CORS
-var AccessControlAllowHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization"
+var AccessControlAllowHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Request-ID"
@@ -0,0 +1,87 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieRewrite rewrites the attributes of the cookies a backend sets, so they are sent back to it through arbor
+type CookieRewrite struct {
+	//Domains replace cookie domains, keyed by the backend's domain (e.g. "products.internal"); "" removes the domain, scoping the cookie to arbor's host
+	Domains map[string]string
+	//Paths replace the prefix of cookie paths, keyed by the backend's prefix (e.g. {"/": "/products/"})
+	Paths map[string]string
+	//Secure marks every cookie Secure, for backends served over plain HTTP behind arbor's TLS
+	Secure bool
+	//SameSite replaces every cookie's SameSite attribute, the default mode leaves it (None also marks the cookie Secure)
+	SameSite http.SameSite
+}
+
+// BackendCookieRewrites are the rewrites of the cookies each backend sets, keyed by host (e.g. "localhost:8000")
+var BackendCookieRewrites = map[string]CookieRewrite{}
+
+// rewriteCookies rewrites the Set-Cookie headers of a backend's response
+func rewriteCookies(req *http.Request, header http.Header) {
+	rewrite, ok := BackendCookieRewrites[req.URL.Host]
+	if !ok {
+		return
+	}
+	lines := header.Values("Set-Cookie")
+	rewritten := make([]string, len(lines))
+	for i, line := range lines {
+		rewritten[i] = line
+		cookie, err := http.ParseSetCookie(line)
+		if err != nil {
+			continue
+		}
+		rewrite.apply(cookie)
+		if value := cookie.String(); value != "" {
+			rewritten[i] = value
+		}
+	}
+	if len(rewritten) > 0 {
+		header["Set-Cookie"] = rewritten
+	}
+}
+
+func (c CookieRewrite) apply(cookie *http.Cookie) {
+	if cookie.Domain != "" {
+		if domain, ok := c.Domains[strings.ToLower(cookie.Domain)]; ok {
+			cookie.Domain = domain
+		}
+	}
+
+	path := cookie.Path
+	if path == "" {
+		path = "/"
+	}
+	prefix := ""
+	for backendPrefix := range c.Paths {
+		if len(backendPrefix) > len(prefix) && strings.HasPrefix(path, backendPrefix) {
+			prefix = backendPrefix
+		}
+	}
+	if prefix != "" {
+		cookie.Path = c.Paths[prefix] + strings.TrimPrefix(path, prefix)
+	}
+
+	if c.Secure {
+		cookie.Secure = true
+	}
+	if c.SameSite != http.SameSiteDefaultMode {
+		cookie.SameSite = c.SameSite
+		if c.SameSite == http.SameSiteNoneMode {
+			cookie.Secure = true
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/aws"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/vault"
+)
+
+// BackendCredentials are the Vault credentials sent to each backend, keyed by host (e.g. "localhost:8000")
+//
+// They override any header of the same name from the caller or the route's token.
+var BackendCredentials = map[string][]*vault.Credential{}
+
+// BackendTokens are the sources of the bearer tokens sent to each backend, keyed by host
+//
+// Sources include OAuth2 client credentials, Google ID tokens and Azure managed identities. The
+// token is sent in the Authorization header, overriding the caller's.
+var BackendTokens = map[string]security.TokenSource{}
+
+// BackendAWSSigners sign the requests forwarded to each AWS-hosted backend with Signature Version 4, keyed by host
+//
+// Requests are signed after all other credentials are added, replacing the Authorization header.
+var BackendAWSSigners = map[string]*aws.Signer{}
+
+// setCredentials adds the backend's credentials to a request being forwarded to it
+func setCredentials(r *http.Request, req *http.Request) bool {
+	for _, credential := range BackendCredentials[req.URL.Host] {
+		value, err := credential.Value()
+		if err != nil {
+			logger.LogForRequest(logger.ERR, r, "Could not get Vault credential "+credential.Path+": "+err.Error())
+			return false
+		}
+		req.Header.Set(credential.Header, value)
+	}
+	if source, ok := BackendTokens[req.URL.Host]; ok {
+		token, err := source.Token()
+		if err != nil {
+			logger.LogForRequest(logger.ERR, r, "Could not acquire token for "+req.URL.Host+": "+err.Error())
+			return false
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if signer, ok := BackendAWSSigners[req.URL.Host]; ok {
+		if err := signer.Sign(req); err != nil {
+			logger.LogForRequest(logger.ERR, r, "Could not sign request to "+req.URL.Host+": "+err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// rejectedCredentials discards the token of a backend which responded 401 Unauthorized, e.g. as it was revoked
+func rejectedCredentials(req *http.Request, resp *http.Response) {
+	if source, ok := BackendTokens[req.URL.Host]; ok && resp.StatusCode == http.StatusUnauthorized {
+		source.Invalidate()
+	}
+}
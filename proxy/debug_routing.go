@@ -0,0 +1,117 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// DebugRouteKey signs debug route tokens, nil disables debug routing
+//
+// A debug route token sends its holder's requests for one backend to another URL,
+// e.g. a developer's tunnel, while everyone else keeps reaching the backend.
+var DebugRouteKey []byte
+
+// DebugRouteHeader carries debug route tokens, it is not forwarded to backends
+var DebugRouteHeader = "X-Arbor-Debug-Route"
+
+// debugRoute is the content of a debug route token
+type debugRoute struct {
+	Developer string `json:"dev"`
+	Backend   string `json:"backend"`
+	Target    string `json:"target"`
+	Expires   int64  `json:"exp"`
+}
+
+func signDebugRoute(payload string) string {
+	mac := hmac.New(sha256.New, DebugRouteKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueDebugRoute creates a token routing the developer's requests for backend (a host, e.g. "localhost:8000") to target for ttl
+func IssueDebugRoute(developer string, backend string, target string, ttl time.Duration) (string, error) {
+	if len(DebugRouteKey) == 0 {
+		return "", errors.New("debug routing is disabled, DebugRouteKey is not set")
+	}
+	if _, err := neturl.Parse(target); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(debugRoute{
+		Developer: developer,
+		Backend:   backend,
+		Target:    target,
+		Expires:   clock.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signDebugRoute(payload), nil
+}
+
+// parseDebugRoute verifies a debug route token
+func parseDebugRoute(token string) (debugRoute, error) {
+	var route debugRoute
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signDebugRoute(parts[0]))) {
+		return route, errors.New("invalid signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return route, err
+	}
+	err = json.Unmarshal(data, &route)
+	if err != nil {
+		return route, err
+	}
+	if clock.Now().Unix() >= route.Expires {
+		return route, errors.New("token expired")
+	}
+	return route, nil
+}
+
+// routeForDebugging returns url rebased onto the target of the caller's debug route token, if it has one for url's backend
+func routeForDebugging(r *http.Request, url string) (string, bool) {
+	token := r.Header.Get(DebugRouteHeader)
+	if token == "" || len(DebugRouteKey) == 0 {
+		return url, false
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url, false
+	}
+	route, err := parseDebugRoute(token)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Ignoring debug route token: "+err.Error())
+		return url, false
+	}
+	if route.Backend != u.Host {
+		return url, false
+	}
+	target, err := neturl.Parse(route.Target)
+	if err != nil {
+		return url, false
+	}
+	logger.LogForRequest(logger.INFO, r, "Routing "+route.Developer+"'s request for "+u.Host+" to "+target.Host)
+	return rebase(u, target), true
+}
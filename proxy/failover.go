@@ -0,0 +1,76 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// BackendFallbacks are the alternate URLs (e.g. "http://localhost:8001") requests are rerouted to
+// while a backend is down, keyed by host (e.g. "localhost:8000")
+var BackendFallbacks = map[string]string{}
+
+// healthyBackend returns url, or url rerouted to the backend's fallback if health probes found it down or it is paused
+//
+// If neither is available the request fails fast with 503 Service Unavailable (429 Too Many Requests
+// if the backend is paused) and ok is false.
+func healthyBackend(w http.ResponseWriter, r *http.Request, url string) (healthyURL string, ok bool) {
+	u, err := neturl.Parse(url)
+	if err != nil || available(u.Host) {
+		return url, true
+	}
+	if fallback, exists := BackendFallbacks[u.Host]; exists {
+		f, err := neturl.Parse(fallback)
+		if err == nil && available(f.Host) {
+			logger.LogForRequest(logger.INFO, r, "Backend "+u.Host+" is unavailable, rerouting to "+f.Host)
+			return rebase(u, f), true
+		}
+	}
+
+	if remaining := paused(u.Host); remaining > 0 && health.Healthy(u.Host) {
+		logger.LogForRequest(logger.WARN, r, "Failing request fast, backend "+u.Host+" is paused")
+		metrics.RequestsShed.Inc("throttled")
+		w.Header().Set("Retry-After", strconv.Itoa(int((remaining+time.Second-1)/time.Second)))
+		apierror.Write(w, r, http.StatusTooManyRequests, "", nil)
+		return "", false
+	}
+
+	logger.LogForRequest(logger.WARN, r, "Failing request fast, backend "+u.Host+" is down")
+	metrics.RequestsShed.Inc("unhealthy")
+	w.Header().Set("Retry-After", "1")
+	apierror.Write(w, r, http.StatusServiceUnavailable, "", nil)
+	return "", false
+}
+
+// available reports if the backend at host is up and not paused
+func available(host string) bool {
+	return health.Healthy(host) && paused(host) == 0
+}
+
+// rebase moves url onto base, keeping its path below base's path and its query
+func rebase(url *neturl.URL, base *neturl.URL) string {
+	rebased := *url
+	rebased.Scheme = base.Scheme
+	rebased.Host = base.Host
+	rebased.Path = base.Path + url.Path
+	if url.RawPath != "" {
+		rebased.RawPath = base.EscapedPath() + url.RawPath
+	}
+	return rebased.String()
+}
@@ -0,0 +1,144 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// The kinds of Fault
+const (
+	//FaultTimeout holds the request until the backend timeout (or Delay) and fails it as if the backend never answered
+	FaultTimeout = "timeout"
+	//FaultConnection fails the request as if the backend refused the connection
+	FaultConnection = "connection"
+	//FaultStatus answers with Status and Body
+	FaultStatus = "status"
+	//FaultMalformedJSON answers 200 OK with a truncated JSON body
+	FaultMalformedJSON = "malformed_json"
+)
+
+// Fault is a canned backend failure
+type Fault struct {
+	//Kind is FaultTimeout, FaultConnection, FaultStatus or FaultMalformedJSON
+	Kind string
+	//Status is the status FaultStatus answers with, 500 if unset
+	Status int
+	//Body is the body FaultStatus answers with
+	Body string
+	//Delay is how long to wait before failing, the backend timeout for FaultTimeout
+	Delay time.Duration
+}
+
+// FaultRule injects a fault in place of the backend's reply to matching requests
+//
+// Requests match if they carry Header (with Value, if set) and their path contains PathMarker, if set.
+type FaultRule struct {
+	Header     string
+	Value      string
+	PathMarker string
+	Fault      Fault
+}
+
+// FaultInjection enables FaultRules, it is meant for staging so client teams can test their error handling
+var FaultInjection = false
+
+// FaultRules are checked in order, the first matching rule's fault is injected
+var FaultRules []FaultRule
+
+func (rule FaultRule) matches(r *http.Request) bool {
+	if rule.Header == "" && rule.PathMarker == "" {
+		return false
+	}
+	if rule.Header != "" {
+		values, ok := r.Header[http.CanonicalHeaderKey(rule.Header)]
+		if !ok || (rule.Value != "" && !contains(rule.Value, values)) {
+			return false
+		}
+	}
+	return rule.PathMarker == "" || strings.Contains(r.URL.Path, rule.PathMarker)
+}
+
+// send sends req to the backend, unless a fault rule matches the caller's request r
+//
+// Faults are never injected in the requests of protected routes.
+func send(client *http.Client, req *http.Request, r *http.Request) (*http.Response, error) {
+	if !FaultInjection || services.Protected(r.Context()) {
+		return client.Do(req)
+	}
+	for _, rule := range FaultRules {
+		if rule.matches(r) {
+			logger.LogForRequest(logger.WARN, r, "Injecting "+rule.Fault.Kind+" fault in place of "+req.URL.Host)
+			return inject(rule.Fault, req, r)
+		}
+	}
+	return client.Do(req)
+}
+
+func inject(fault Fault, req *http.Request, r *http.Request) (*http.Response, error) {
+	delay := fault.Delay
+	if fault.Kind == FaultTimeout && delay <= 0 {
+		delay = time.Duration(constants.Timeout) * time.Second
+	}
+	if delay > 0 {
+		select {
+		case <-clock.After(delay):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	response := func(status int, contentType string, body string) *http.Response {
+		header := http.Header{}
+		if contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		return &http.Response{
+			Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}
+	}
+
+	switch fault.Kind {
+	case FaultTimeout:
+		return nil, errors.New("injected fault: backend timed out")
+	case FaultStatus:
+		status := fault.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		return response(status, "", fault.Body), nil
+	case FaultMalformedJSON:
+		return response(http.StatusOK, "application/json", `{"data": [{"id": 1, "name": "trunc`), nil
+	default:
+		return nil, errors.New("injected fault: connection refused")
+	}
+}
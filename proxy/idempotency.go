@@ -0,0 +1,111 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/idempotency"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// idempotentRequest is a request which claimed its Idempotency-Key
+type idempotentRequest struct {
+	key         string
+	fingerprint string
+	ttl         time.Duration
+	stored      bool
+}
+
+// claimIdempotencyKey claims the caller's Idempotency-Key for their request, or answers a retry of it
+//
+// The returned request is nil for requests which are not deduplicated. ok is false if the
+// caller was answered, with the stored response or an error.
+func claimIdempotencyKey(w http.ResponseWriter, r *http.Request, requestBody []byte, proxyMiddlewares MiddlewareSet, tracker *responseTracker) (request *idempotentRequest, ok bool) {
+	policy := idempotency.Policy(r)
+	if policy == nil {
+		return nil, true
+	}
+	key := strings.TrimSpace(r.Header.Get(idempotency.HeaderName))
+	if key == "" {
+		if policy.Required {
+			apierror.Write(w, r, http.StatusBadRequest, idempotency.HeaderName+" header is required", nil)
+			return nil, false
+		}
+		return nil, true
+	}
+	if len(key) > idempotency.MaxKeyLength {
+		apierror.Write(w, r, http.StatusBadRequest, idempotency.HeaderName+" is too long",
+			map[string]interface{}{"max_length": idempotency.MaxKeyLength})
+		return nil, false
+	}
+
+	request = &idempotentRequest{
+		key:         idempotency.Key(r, key),
+		fingerprint: idempotency.Fingerprint(r, requestBody),
+		ttl:         idempotency.TTL(policy),
+	}
+	entry, err := idempotency.Responses.Claim(request.key, idempotency.Pending(request.fingerprint))
+	if err != nil {
+		// Requests are let through rather than failed when the store is down
+		logger.LogForRequest(logger.ERR, r, "Could not claim idempotency key: "+err.Error())
+		return nil, true
+	}
+	if entry == nil {
+		return request, true
+	}
+
+	if entry.Fingerprint != request.fingerprint {
+		apierror.Write(w, r, http.StatusUnprocessableEntity, idempotency.HeaderName+" was already used for another request", nil)
+		return nil, false
+	}
+	if entry.InFlight() {
+		w.Header().Set("Retry-After", "1")
+		apierror.Write(w, r, http.StatusConflict, "A request with this "+idempotency.HeaderName+" is in flight", nil)
+		return nil, false
+	}
+	for k, vs := range entry.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set(idempotency.ReplayedHeader, "true")
+	respond(w, r, entry.Status, entry.Body, proxyMiddlewares, tracker)
+	return nil, false
+}
+
+// store keeps the service's response to the request to replay it to retries
+//
+// Server errors are not stored, the key is released instead so the request can be retried.
+func (i *idempotentRequest) store(r *http.Request, status int, header http.Header, body []byte) {
+	if i == nil || status >= 500 {
+		return
+	}
+	err := idempotency.Responses.Set(i.key, idempotency.Answered(i.fingerprint, status, header, body, i.ttl))
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not store idempotent response: "+err.Error())
+		return
+	}
+	i.stored = true
+}
+
+// release drops the key unless the response was stored, so the caller can retry a request which was not answered
+func (i *idempotentRequest) release(r *http.Request) {
+	if i == nil || i.stored {
+		return
+	}
+	if err := idempotency.Responses.Release(i.key); err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not release idempotency key: "+err.Error())
+	}
+}
@@ -0,0 +1,109 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// BackendChecksumVerification are the backends whose responses are verified against the checksums they send,
+// keyed by host (e.g. "localhost:8000")
+//
+// Content-MD5, Digest and Content-Digest headers are checked against the body before it is forwarded, and
+// responses which do not match are rejected with 502 Bad Gateway. Responses without a checksum are forwarded.
+var BackendChecksumVerification = map[string]bool{}
+
+// ResponseDigest is the algorithm of the Digest (RFC 3230) and Content-Digest (RFC 9530) headers attached to
+// responses, "sha-256" or "sha-512", none are attached if empty
+//
+// The digests are of the body as it is sent, after compression, and replace any the backend sent.
+var ResponseDigest = ""
+
+// checksumAlgorithms are the algorithms checksums are verified with, by their lower case name in Digest and Content-Digest
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// verifyChecksums reports whether the body of the backend's response to req matches every checksum sent with it
+func verifyChecksums(r *http.Request, req *http.Request, resp *http.Response, body []byte) bool {
+	if !BackendChecksumVerification[req.URL.Host] {
+		return true
+	}
+	// The checksums are of the encoded body, which the transport has already decoded
+	if resp.Uncompressed {
+		logger.LogForRequest(logger.DEBUG, r, "Not verifying checksums of a response the transport decompressed")
+		return true
+	}
+
+	checksums := map[string][]string{}
+	if md5sum := resp.Header.Get("Content-MD5"); md5sum != "" {
+		checksums["md5"] = append(checksums["md5"], md5sum)
+	}
+	for _, header := range []string{"Digest", "Content-Digest"} {
+		for _, value := range resp.Header[header] {
+			for _, digest := range strings.Split(value, ",") {
+				parts := strings.SplitN(strings.TrimSpace(digest), "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				algorithm := strings.ToLower(parts[0])
+				// Content-Digest wraps the value as a structured field byte sequence
+				checksums[algorithm] = append(checksums[algorithm], strings.Trim(parts[1], ":"))
+			}
+		}
+	}
+
+	for algorithm, values := range checksums {
+		newHash, supported := checksumAlgorithms[algorithm]
+		if !supported {
+			continue
+		}
+		h := newHash()
+		h.Write(body)
+		sum := h.Sum(nil)
+		for _, value := range values {
+			expected, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || !bytes.Equal(expected, sum) {
+				logger.LogForRequest(logger.ERR, r, "Response from "+req.URL.Host+" does not match its "+algorithm+" checksum")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setDigests attaches the digests of the body the caller is sent, if ResponseDigest is set
+//
+// Responses without a body, including to HEAD requests, have nothing to digest.
+func setDigests(header http.Header, r *http.Request, status int, body []byte) {
+	newHash, supported := checksumAlgorithms[ResponseDigest]
+	if !supported || r.Method == http.MethodHead || status == http.StatusNotModified || status == http.StatusNoContent {
+		return
+	}
+	h := newHash()
+	h.Write(body)
+	sum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	header.Set("Digest", strings.ToUpper(ResponseDigest)+"="+sum)
+	header.Set("Content-Digest", ResponseDigest+"=:"+sum+":")
+}
@@ -0,0 +1,72 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/jobs"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// startJob answers a 202 Accepted from a job route with a job tracked by arbor
+//
+// It reports false, leaving the service's response to be passed through, if
+// the service did not say where the job's status is or it could not be tracked.
+func startJob(w http.ResponseWriter, r *http.Request, req *http.Request, resp *http.Response, policy services.JobPolicy, client *http.Client, proxyMiddlewares MiddlewareSet, tracker *responseTracker, idempotent *idempotentRequest) bool {
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return false
+	}
+	statusURL, err := req.URL.Parse(location)
+	// The status is polled with the caller's credentials, so it must stay on the service
+	if err != nil || statusURL.Host != req.URL.Host {
+		logger.LogForRequest(logger.WARN, r, "Not tracking job, its status URL "+location+" is not on "+req.URL.Host)
+		return false
+	}
+
+	header := req.Header.Clone()
+	header.Del("Content-Type")
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	poll := func() (*http.Response, error) {
+		pollReq, err := http.NewRequest(http.MethodGet, statusURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		pollReq.Header = header.Clone()
+		setCredentials(r, pollReq)
+		return client.Do(pollReq)
+	}
+
+	job, err := jobs.Track(r, policy, poll)
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not track job: "+err.Error())
+		return false
+	}
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(job)
+	accepted := http.Header{}
+	accepted.Set("Content-Type", "application/json")
+	accepted.Set("Cache-Control", "no-store")
+	accepted.Set("Location", jobs.Path+"/"+job.ID)
+	// Retries are answered with this job rather than starting another
+	idempotent.store(r, http.StatusAccepted, accepted, body.Bytes())
+	for k, vs := range accepted {
+		w.Header()[k] = vs
+	}
+	respond(w, r, http.StatusAccepted, body.Bytes(), proxyMiddlewares, tracker)
+	return true
+}
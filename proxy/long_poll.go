@@ -0,0 +1,389 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/security"
+)
+
+// LongPoll serves a backend's event stream to clients which poll for its events, e.g. on networks which drop long-lived streams
+//
+// The first poll subscribes to the stream: arbor opens it to the backend and buffers its events
+// until the client polls for them. Every poll returns the events buffered after the client's cursor,
+// waiting up to Wait for one to arrive.
+type LongPoll struct {
+	//URL is the backend's stream, an http(s) URL serving Server-Sent Events or a ws(s) URL serving WebSocket messages
+	URL string
+	//Wait is the longest a poll waits for an event, 25 seconds if unset
+	Wait time.Duration
+	//Idle is how long a subscription which is not polled keeps its stream open, a minute if unset; it must exceed Wait
+	Idle time.Duration
+	//BufferSize is the most events buffered for a subscription, the oldest are dropped first; 1000 if unset
+	BufferSize int
+}
+
+// PolledEvent is an event of a backend stream returned by a poll
+type PolledEvent struct {
+	//Seq numbers the events of a subscription from 1, a gap means events were dropped from a full buffer
+	Seq  int64  `json:"seq"`
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	//Data is the event's JSON data, or its data as a string if it is not JSON
+	Data json.RawMessage `json:"data"`
+}
+
+// PollResponse is the response to a poll of a backend stream
+//
+// Clients poll again with ?subscription=<subscription>&cursor=<cursor>. Events up to the
+// cursor are dropped from the buffer, so a poll whose response was lost can be repeated.
+type PollResponse struct {
+	Subscription string        `json:"subscription"`
+	Cursor       int64         `json:"cursor"`
+	Events       []PolledEvent `json:"events"`
+	//Closed is true once the backend closed the stream and every event was returned
+	Closed bool `json:"closed,omitempty"`
+}
+
+// eventStream is a backend stream read one event at a time
+type eventStream interface {
+	//Next blocks until the stream's next event, returning io.EOF once the backend closed the stream
+	Next() (id string, eventType string, data string, err error)
+	Close() error
+}
+
+// pollSubscription buffers the events of a stream between the polls of a client
+type pollSubscription struct {
+	mutex sync.Mutex
+	//subject is the caller who subscribed, only they may poll the subscription
+	subject string
+	events  []PolledEvent
+	seq     int64
+	closed  bool
+	//arrived is closed, and replaced, when an event arrives or the stream closes
+	arrived chan struct{}
+	polled  time.Time
+}
+
+var (
+	pollMutex         sync.Mutex
+	pollSubscriptions = map[string]*pollSubscription{}
+)
+
+// ServeLongPoll serves a poll of the backend stream of poll, passing token (optional) to the backend
+func ServeLongPoll(w http.ResponseWriter, r *http.Request, poll LongPoll, token string) {
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+	middlewares := ProxyMiddlewaresFactory("JSON", token)
+	for _, requestMiddleware := range middlewares.RequestMiddlewares {
+		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Nothing is cached, so the stages after the cache lookup always run
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	wait, idle, bufferSize := poll.Wait, poll.Idle, poll.BufferSize
+	if wait <= 0 {
+		wait = 25 * time.Second
+	}
+	if idle <= 0 {
+		idle = time.Minute
+	}
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+	cursor, err := strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	if r.URL.Query().Get("cursor") == "" {
+		cursor, err = 0, nil
+	}
+	if err != nil || cursor < 0 {
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid cursor", nil)
+		return
+	}
+	subject := ""
+	if claims, ok := security.ClaimsFromContext(r.Context()); ok {
+		subject = claims.Subject()
+	}
+
+	id := r.URL.Query().Get("subscription")
+	var subscription *pollSubscription
+	if id == "" {
+		url := expandURL(poll.URL, mux.Vars(r))
+		stream, err := openEventStream(r, url)
+		if err != nil {
+			logger.LogForRequest(logger.ERR, r, "Could not open stream "+url+": "+err.Error())
+			apierror.Write(w, r, http.StatusBadGateway, "Could not open the backend stream", nil)
+			return
+		}
+		id, subscription = subscribe(stream, subject, idle, bufferSize)
+	} else {
+		pollMutex.Lock()
+		subscription = pollSubscriptions[id]
+		pollMutex.Unlock()
+		// Other callers' subscriptions are not revealed to exist
+		if subscription == nil || subscription.subject != subject {
+			apierror.Write(w, r, http.StatusNotFound, "Unknown or expired subscription", nil)
+			return
+		}
+	}
+
+	response := PollResponse{Subscription: id, Cursor: cursor, Events: []PolledEvent{}}
+	response.Events, response.Closed = subscription.wait(r.Context(), cursor, wait)
+	if len(response.Events) > 0 {
+		response.Cursor = response.Events[len(response.Events)-1].Seq
+	}
+	if response.Closed {
+		pollMutex.Lock()
+		delete(pollSubscriptions, id)
+		pollMutex.Unlock()
+	}
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	respond(w, r, http.StatusOK, body, middlewares, tracker)
+}
+
+// subscribe buffers the events of stream for the caller subject until it closes or is not polled for idle
+func subscribe(stream eventStream, subject string, idle time.Duration, bufferSize int) (string, *pollSubscription) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	subscription := &pollSubscription{subject: subject, arrived: make(chan struct{}), polled: clock.Now()}
+	pollMutex.Lock()
+	pollSubscriptions[id] = subscription
+	pollMutex.Unlock()
+
+	go subscription.buffer(stream, bufferSize)
+	go func() {
+		for {
+			<-clock.After(idle)
+			subscription.mutex.Lock()
+			expired := clock.Since(subscription.polled) >= idle
+			subscription.mutex.Unlock()
+			if expired {
+				pollMutex.Lock()
+				delete(pollSubscriptions, id)
+				pollMutex.Unlock()
+				stream.Close()
+				return
+			}
+		}
+	}()
+	return id, subscription
+}
+
+// buffer reads the events of stream into the subscription until the stream closes
+func (s *pollSubscription) buffer(stream eventStream, bufferSize int) {
+	defer stream.Close()
+	for {
+		id, eventType, data, err := stream.Next()
+		s.mutex.Lock()
+		if err != nil {
+			if err != io.EOF {
+				logger.Log(logger.WARN, "Polled stream failed: "+err.Error())
+			}
+			s.closed = true
+		} else {
+			s.seq++
+			event := PolledEvent{Seq: s.seq, ID: id, Type: eventType, Data: json.RawMessage(data)}
+			if !json.Valid(event.Data) {
+				event.Data, _ = json.Marshal(data)
+			}
+			s.events = append(s.events, event)
+			if len(s.events) > bufferSize {
+				s.events = s.events[len(s.events)-bufferSize:]
+			}
+		}
+		close(s.arrived)
+		s.arrived = make(chan struct{})
+		s.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait returns the events buffered after cursor, waiting up to wait for one to arrive, and if the stream closed after them
+func (s *pollSubscription) wait(ctx context.Context, cursor int64, wait time.Duration) ([]PolledEvent, bool) {
+	deadline := clock.After(wait)
+	for {
+		s.mutex.Lock()
+		s.polled = clock.Now()
+		// Events up to the cursor reached the client, so they are not returned again
+		received := 0
+		for received < len(s.events) && s.events[received].Seq <= cursor {
+			received++
+		}
+		s.events = s.events[received:]
+		events := append([]PolledEvent{}, s.events...)
+		closed := s.closed && len(events) == 0
+		arrived := s.arrived
+		s.mutex.Unlock()
+		if len(events) > 0 || closed {
+			return events, closed
+		}
+		select {
+		case <-arrived:
+		case <-deadline:
+			return events, false
+		case <-ctx.Done():
+			return events, false
+		}
+	}
+}
+
+// openEventStream opens the backend stream at url for the caller's request r
+func openEventStream(r *http.Request, url string) (eventStream, error) {
+	observeBackend(r, url)
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range r.Header {
+		switch strings.ToLower(k) {
+		case "connection", "upgrade", "keep-alive", "te", "trailer", "transfer-encoding", "content-length", "content-type", "accept-encoding":
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(k), "sec-websocket-") {
+			continue
+		}
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if !setCredentials(r, req) {
+		return nil, errors.New("could not get credentials")
+	}
+
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		origin := "http://" + u.Host
+		if u.Scheme == "wss" {
+			origin = "https://" + u.Host
+		}
+		config, err := websocket.NewConfig(url, origin)
+		if err != nil {
+			return nil, err
+		}
+		config.Header = req.Header
+		config.TlsConfig = BackendTLSConfig()
+		config.Dialer = &net.Dialer{Timeout: time.Duration(constants.Timeout) * time.Second}
+		conn, err := websocket.DialConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		conn.MaxPayloadBytes = constants.MaxFileUploadSize
+		return webSocketStream{conn}, nil
+	}
+
+	// The stream outlives the poll which opened it, so it is only cancelled by closing it
+	ctx, cancel := context.WithCancel(context.Background())
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := (&http.Client{Transport: transport()}).Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, backendStatusError(resp.StatusCode)
+	}
+	return &serverSentEventStream{body: resp.Body, reader: bufio.NewReader(resp.Body), cancel: cancel}, nil
+}
+
+// webSocketStream reads the messages of a WebSocket as events
+type webSocketStream struct {
+	conn *websocket.Conn
+}
+
+func (s webSocketStream) Next() (string, string, string, error) {
+	var message string
+	err := websocket.Message.Receive(s.conn, &message)
+	return "", "", message, err
+}
+
+func (s webSocketStream) Close() error {
+	return s.conn.Close()
+}
+
+// serverSentEventStream reads the events of a text/event-stream response
+type serverSentEventStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	cancel context.CancelFunc
+}
+
+func (s *serverSentEventStream) Next() (string, string, string, error) {
+	var id, eventType string
+	var data []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return "", "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// A blank line dispatches the event, unless it had no data
+			if data != nil {
+				return id, eventType, strings.Join(data, "\n"), nil
+			}
+			eventType = ""
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			eventType = value
+		case "id":
+			id = value
+		}
+	}
+}
+
+func (s *serverSentEventStream) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
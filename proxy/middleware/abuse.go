@@ -0,0 +1,53 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/arbor-dev/arbor/abuse"
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// AbuseMiddleware is the middleware which stops the requests abuse.Classifiers classify as abusive
+//
+// Throttled callers are rejected with 429 Too Many Requests and a Retry-After header,
+// challenged callers are redirected to abuse.ChallengeURL with 303 See Other, and blocked
+// callers are rejected with 403 Forbidden.
+var AbuseMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	verdict := abuse.Classify(r)
+	if verdict.Action == abuse.Allow {
+		return
+	}
+	metrics.AbuseVerdicts.Inc(verdict.Action)
+	logger.LogForRequest(logger.WARN, r, "Stopped request from "+clientip.Address(r)+" ("+verdict.Action+"): "+verdict.Reason)
+	audit.RecordRequest(r, audit.AuthorizationDenied, "", verdict.Reason, map[string]interface{}{"action": verdict.Action})
+	switch {
+	case verdict.Action == abuse.Throttle:
+		w.Header().Set("Retry-After", seconds(verdict.RetryAfter))
+		apierror.Write(w, r, http.StatusTooManyRequests, "Too many requests", nil)
+	case verdict.Action == abuse.Challenge && abuse.ChallengeURL != "":
+		separator := "?"
+		if strings.Contains(abuse.ChallengeURL, "?") {
+			separator = "&"
+		}
+		w.Header().Set("Location", abuse.ChallengeURL+separator+"return="+neturl.QueryEscape(r.URL.RequestURI()))
+		w.WriteHeader(http.StatusSeeOther)
+	default:
+		apierror.Write(w, r, http.StatusForbidden, "Forbidden", nil)
+	}
+})
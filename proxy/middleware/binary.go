@@ -0,0 +1,50 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/cbor"
+	"github.com/arbor-dev/arbor/msgpack"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// binaryValidator checks request bodies sent in a binary format, which callers may also send as
+// JSON if the route translates its bodies to JSON
+func binaryValidator(mediaType string, is func(contentType string) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r, MaxBodySize(r))
+		if !ok || len(body) == 0 {
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		if is(contentType) {
+			return
+		}
+		if route, routed := services.RouteFromContext(r.Context()); routed && route.TranslateToJSON && transform.IsJSON(contentType) {
+			return
+		}
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Body must be "+mediaType, nil)
+	})
+}
+
+// MsgpackRequestMiddlewares is the set of middlewares for validating the request to a MessagePack service
+var MsgpackRequestMiddlewares = []http.Handler{
+	binaryValidator(msgpack.MediaType, msgpack.IsMsgpack),
+}
+
+// CBORRequestMiddlewares is the set of middlewares for validating the request to a CBOR service
+var CBORRequestMiddlewares = []http.Handler{
+	binaryValidator(cbor.MediaType, cbor.IsCBOR),
+}
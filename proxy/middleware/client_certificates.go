@@ -0,0 +1,35 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/security"
+)
+
+// ClientCertificateMiddleware is the middleware which authenticates callers by their verified TLS client certificate
+//
+// The certificate's identity and its security.CertificateRoles are available to the
+// middlewares which follow through security.ClaimsFromContext. Callers already
+// authenticated with a token or API key keep their claims.
+var ClientCertificateMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return
+	}
+	if _, authenticated := security.ClaimsFromContext(r.Context()); authenticated {
+		return
+	}
+	claims := security.CertificateClaims(r.TLS.VerifiedChains[0][0])
+	audit.RecordRequest(r, audit.AuthenticationSucceeded, claims.Subject(), "", map[string]interface{}{"credential": "client certificate"})
+	setContext(r, security.NewClaimsContext(r.Context(), claims))
+})
@@ -0,0 +1,24 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// setContext replaces the context of r in place
+//
+// Middlewares share the request they are passed, so values a middleware adds
+// to the context must be visible to the middlewares that run after it.
+func setContext(r *http.Request, ctx context.Context) {
+	*r = *r.WithContext(ctx)
+}
@@ -1,15 +1,50 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
 	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/services"
 )
 
 // CORSMiddleware is the middleware for handling CORS
 var CORSMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r* http.Request) {
 	origin := r.Header.Get("Origin")
+	if policy, ok := AccessControlPolicyFromContext(r.Context()); ok {
+		origin = AllowedOrigin(policy, origin)
+	}
 	w.Header().Set("Access-Control-Allow-Origin", origin)
 	w.Header().Set("Access-Control-Allow-Methods", r.Method)
 	w.Header().Set("Access-Control-Allow-Headers", constants.AccessControlAllowHeaders)
+	if route, ok := services.RouteFromContext(r.Context()); ok && len(route.ExposeHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(route.ExposeHeaders, ", "))
+	}
 })
+
+type accessControlContextKey struct{}
+
+// NewAccessControlContext returns a copy of ctx carrying the CORS policy of the virtual host serving the request
+func NewAccessControlContext(ctx context.Context, policy string) context.Context {
+	return context.WithValue(ctx, accessControlContextKey{}, policy)
+}
+
+// AccessControlPolicyFromContext returns the CORS policy of the virtual host serving the request, if it has one
+func AccessControlPolicyFromContext(ctx context.Context) (string, bool) {
+	policy, ok := ctx.Value(accessControlContextKey{}).(string)
+	return policy, ok
+}
+
+// AllowedOrigin returns the Access-Control-Allow-Origin for origin under a policy of "*" or comma separated origins
+func AllowedOrigin(policy string, origin string) string {
+	if policy == "*" {
+		return policy
+	}
+	for _, allowed := range strings.Split(policy, ",") {
+		if strings.TrimSpace(allowed) == origin {
+			return origin
+		}
+	}
+	return ""
+}
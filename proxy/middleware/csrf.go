@@ -0,0 +1,58 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// CSRFMiddleware is the middleware which protects browser-facing routes from cross-site request forgery
+//
+// POST, PUT, PATCH and DELETE requests to routes flagged BrowserFacing must carry the token
+// of their security.CSRFCookieName cookie in the security.CSRFHeaderName header, others are
+// rejected with 403 Forbidden. Browsers without the cookie are given one on other requests.
+var CSRFMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || !route.BrowserFacing {
+		return
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if !security.ValidCSRFToken(r) {
+			logger.LogForRequest(logger.WARN, r, "Rejected request to "+route.Name+" without a valid CSRF token")
+			audit.RecordRequest(r, audit.AuthorizationDenied, "", "invalid CSRF token", nil)
+			apierror.Write(w, r, http.StatusForbidden, "Invalid CSRF token", nil)
+		}
+		return
+	}
+	if _, err := r.Cookie(security.CSRFCookieName); err == nil {
+		return
+	}
+	token, err := security.NewCSRFToken()
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not create a CSRF token: "+err.Error())
+		return
+	}
+	// Scripts of the page read the cookie to send the token back, so it is not HttpOnly
+	http.SetCookie(w, &http.Cookie{
+		Name:     security.CSRFCookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+})
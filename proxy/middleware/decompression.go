@@ -0,0 +1,70 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/arbor-dev/arbor/apierror"
+)
+
+// DecompressionMiddleware is the middleware which decompresses gzip and deflate encoded request bodies
+//
+// Bodies are decompressed before they are validated, and may decompress to at most
+// the route's MaxBodySize bytes. Other encodings are rejected with 415 Unsupported Media Type.
+var DecompressionMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return
+	}
+
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(r.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(r.Body)
+	default:
+		w.Header().Set("Accept-Encoding", "gzip, deflate")
+		apierror.Write(w, r, http.StatusUnsupportedMediaType, "Unsupported content encoding", nil)
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Malformed compressed body", nil)
+		return
+	}
+
+	// Reading one byte past the limit detects bodies which decompress too far
+	limit := MaxBodySize(r)
+	body, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	reader.Close()
+	r.Body.Close()
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Malformed compressed body", nil)
+		return
+	}
+	if int64(len(body)) > limit {
+		apierror.Write(w, r, http.StatusRequestEntityTooLarge, "Decompressed body is too large", map[string]interface{}{"limit": limit})
+		return
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+})
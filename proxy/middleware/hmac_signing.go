@@ -0,0 +1,44 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/security"
+)
+
+// HMACMiddlewareFactory is the factory for generating the middleware which verifies HMAC signed requests
+//
+// Unsigned or incorrectly signed requests are rejected with 401 Unauthorized. The
+// signing key ID is available to the middlewares which follow as the sub claim.
+var HMACMiddlewareFactory = func(verifier *security.HMACVerifier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r, MaxBodySize(r))
+		if !ok {
+			return
+		}
+		keyID, err := verifier.Verify(r, body)
+		if err != nil {
+			logger.LogForRequest(logger.WARN, r, "Rejected signature from "+r.RemoteAddr+": "+err.Error())
+			audit.RecordRequest(r, audit.AuthenticationFailed, "", err.Error(), map[string]interface{}{"credential": "signature"})
+			apierror.Write(w, r, http.StatusUnauthorized, "Invalid request signature", nil)
+			return
+		}
+		audit.RecordRequest(r, audit.AuthenticationSucceeded, keyID, "", map[string]interface{}{"credential": "signature"})
+		if _, authenticated := security.ClaimsFromContext(r.Context()); !authenticated {
+			setContext(r, security.NewClaimsContext(r.Context(), security.Claims{"sub": keyID}))
+		}
+	})
+}
@@ -2,39 +2,31 @@ package middleware
 
 import (
 	"net/http"
-	"bytes"
-	"io"
-	"io/ioutil"
 	"encoding/json"
 
-	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/apierror"
 )
 
 // JSONErrorHandler is the handler for writing errors into the response sent to the caller
 var JSONErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r* http.Request) {
-	w.WriteHeader(500)
+	apierror.Write(w, r, http.StatusInternalServerError, "", nil)
 })
 
 // A handler which validates the request body for valid json
 var jsonValidator = http.HandlerFunc(func(w http.ResponseWriter, r* http.Request) {
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, constants.MaxRequestSize))
+	body, ok := readBody(w, r, MaxBodySizeFor(r, "JSON"))
 
-	r.Body.Close()
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-
-	if err != nil {
-		JSONErrorHandler.ServeHTTP(w, r)
+	if !ok {
+		return
 	}
 
 	if len(body) == 0 {
 		return
 	}
 
-	var jsonBody interface{}
-	err = json.Unmarshal(body, &jsonBody)
-
-	if err != nil {
-		JSONErrorHandler.ServeHTTP(w, r)
+	// Only the syntax is checked, values such as 1e999 are left for the service to interpret
+	if !json.Valid(body) {
+		apierror.Write(w, r, http.StatusBadRequest, "Body is not valid JSON", nil)
 	}
 })
 
@@ -0,0 +1,122 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/memo"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// bearerToken returns the bearer token from the authorization header of r
+func bearerToken(r *http.Request) string {
+	authorization := r.Header.Get(constants.ClientAuthorizationHeaderField)
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// JWTMiddlewareFactory is the factory for generating the middleware which verifies the caller's bearer JWT
+//
+// Callers without a valid token are rejected with 401 Unauthorized. The verified claims
+// are available to the middlewares which follow through security.ClaimsFromContext.
+var JWTMiddlewareFactory = func(verifier *security.JWTVerifier) http.Handler {
+	return bearerAuthentication(fmt.Sprintf("jwt %p", verifier), verifier.Verify)
+}
+
+// IntrospectionMiddlewareFactory is the factory for generating the middleware which validates the caller's opaque bearer token
+//
+// Tokens are checked with the introspector's authorization server; callers without an
+// active token are rejected with 401 Unauthorized. The token's claims are available to
+// the middlewares which follow through security.ClaimsFromContext.
+var IntrospectionMiddlewareFactory = func(introspector *security.TokenIntrospector) http.Handler {
+	return bearerAuthentication(fmt.Sprintf("introspection %p", introspector), introspector.Introspect)
+}
+
+// bearerAuthentication authenticates the caller's bearer token with validate
+//
+// Stages of a request authenticating the same token with the same validator share its result
+// through the request's memo, so a token is introspected at most once per request.
+func bearerAuthentication(validator string, validate func(token string) (security.Claims, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			audit.RecordRequest(r, audit.AuthenticationFailed, "", "missing bearer token", nil)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="arbor"`)
+			apierror.Write(w, r, http.StatusUnauthorized, "Missing bearer token", nil)
+			return
+		}
+		validated, err := memo.Fetch(r.Context(), validator+" "+token, func() (interface{}, error) {
+			return validate(token)
+		})
+		claims, _ := validated.(security.Claims)
+		if err != nil {
+			logger.LogForRequest(logger.WARN, r, "Rejected token from "+r.RemoteAddr+": "+err.Error())
+			audit.RecordRequest(r, audit.AuthenticationFailed, "", err.Error(), map[string]interface{}{"credential": "bearer"})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="arbor", error="invalid_token"`)
+			apierror.Write(w, r, http.StatusUnauthorized, "Invalid bearer token", nil)
+			return
+		}
+		audit.RecordRequest(r, audit.AuthenticationSucceeded, claims.Subject(), "", map[string]interface{}{"credential": "bearer"})
+		if entry := logger.AccessEntryFromContext(r.Context()); entry != nil {
+			entry.User = claims.Subject()
+		}
+		setContext(r, security.NewClaimsContext(r.Context(), claims))
+	})
+}
+
+// ScopesMiddleware is the middleware which enforces the scopes required by the route being proxied
+//
+// Callers whose token does not grant every scope listed in the route's Scopes are
+// rejected with 403 Forbidden. Routes without Scopes are not affected.
+var ScopesMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || len(route.Scopes) == 0 {
+		return
+	}
+	claims, authenticated := security.ClaimsFromContext(r.Context())
+	if !authenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="arbor"`)
+		apierror.Write(w, r, http.StatusUnauthorized, "Missing bearer token", nil)
+		return
+	}
+	if !claims.HasScopes(route.Scopes) {
+		logger.LogForRequest(logger.WARN, r, "Insufficient scope for "+route.Name+" from "+r.RemoteAddr)
+		audit.RecordRequest(r, audit.AuthorizationDenied, claims.Subject(), "insufficient scope", map[string]interface{}{"scopes": route.Scopes})
+		w.Header().Set("WWW-Authenticate", `Bearer realm="arbor", error="insufficient_scope", scope="`+strings.Join(route.Scopes, " ")+`"`)
+		apierror.Write(w, r, http.StatusForbidden, "Insufficient scope", map[string]interface{}{"scopes": route.Scopes})
+	}
+})
+
+// ClaimHeadersMiddlewareFactory is the factory for generating the middleware which forwards verified claims to services as headers
+//
+// headers maps claim names to the header they are injected into. Headers of the
+// same name sent by the caller are always removed so they can not be spoofed.
+var ClaimHeadersMiddlewareFactory = func(headers map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ := security.ClaimsFromContext(r.Context())
+		for claim, header := range headers {
+			r.Header.Del(header)
+			if value := claims.Value(claim); value != "" {
+				r.Header.Set(header, value)
+			}
+		}
+	})
+}
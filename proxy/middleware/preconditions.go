@@ -0,0 +1,39 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// PreconditionsMiddleware is the middleware which requires writes to routes with RequirePreconditions to be conditional
+//
+// PUT, PATCH and DELETE requests without If-Match or If-Unmodified-Since are rejected with
+// 428 Precondition Required, the headers of the others are passed to the service to check.
+var PreconditionsMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || !route.RequirePreconditions {
+		return
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return
+	}
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+		apierror.Write(w, r, http.StatusPreconditionRequired, "Request must be conditional", map[string]interface{}{
+			"headers": []string{"If-Match", "If-Unmodified-Since"},
+		})
+	}
+})
@@ -5,10 +5,8 @@ import (
 )
 
 // PreprocessingMiddleware is the middleware which performs basic preprocessing including sanitization and authorization
+//
+// Requests which fail preprocessing have already been rejected with the reason.
 var PreprocessingMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r* http.Request) {
-	err := requestPreprocessing(w, r)
-
-	if err != nil {
-		w.WriteHeader(500)
-	}
+	requestPreprocessing(w, r)
 })
@@ -0,0 +1,42 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/protobuf"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// protobufValidator checks request bodies for protobuf services, which callers send as protobuf,
+// or as JSON if the route has a Request message to transcode it to
+var protobufValidator = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, MaxBodySize(r))
+	if !ok || len(body) == 0 {
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if protobuf.IsProtobuf(contentType) {
+		return
+	}
+	if route, routed := services.RouteFromContext(r.Context()); routed && route.Protobuf != nil && route.Protobuf.Request != "" && transform.IsJSON(contentType) {
+		return
+	}
+	apierror.Write(w, r, http.StatusUnsupportedMediaType, "Body must be "+protobuf.MediaType, nil)
+})
+
+// ProtobufRequestMiddlewares is the set of middlewares for validating the request to a protobuf service
+var ProtobufRequestMiddlewares = []http.Handler{
+	protobufValidator,
+}
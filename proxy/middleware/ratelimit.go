@@ -0,0 +1,50 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/ratelimit"
+)
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// RateLimitMiddleware is the middleware which limits the rate clients may call the route being proxied
+//
+// Limits come from the route's RateLimit or ratelimit.DefaultLimit. Responses carry
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, and clients over
+// their limit are rejected with 429 Too Many Requests and a Retry-After header.
+var RateLimitMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	res, err := ratelimit.Take(r)
+	if err != nil {
+		// Failing open keeps the gateway up if the shared store is unreachable
+		logger.LogForRequest(logger.ERR, r, "Could not check rate limit: "+err.Error())
+		return
+	}
+	if res.Limit == 0 {
+		return
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+	if !res.Allowed {
+		w.Header().Set("Retry-After", seconds(res.RetryAfter))
+		apierror.Write(w, r, http.StatusTooManyRequests, "Rate limit exceeded", nil)
+	}
+})
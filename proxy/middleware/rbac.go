@@ -0,0 +1,47 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// RolesMiddleware is the middleware which enforces the roles allowed to use the route being proxied
+//
+// The caller's roles come from the claims of their token or API key. Callers with
+// none of the route's Roles are rejected with 403 Forbidden and a JSON error body.
+// Routes without Roles are not affected.
+var RolesMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || len(route.Roles) == 0 {
+		return
+	}
+	claims, authenticated := security.ClaimsFromContext(r.Context())
+	if !authenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="arbor"`)
+		apierror.Write(w, r, http.StatusUnauthorized, "Authentication required", nil)
+		return
+	}
+	if !claims.HasAnyRole(route.Roles) {
+		logger.LogForRequest(logger.WARN, r, "Denied "+claims.Subject()+" access to "+route.Name+": missing role")
+		audit.RecordRequest(r, audit.AuthorizationDenied, claims.Subject(), "missing role", map[string]interface{}{"required_roles": route.Roles})
+		apierror.Write(w, r, http.StatusForbidden, "Forbidden", map[string]interface{}{
+			"route":          route.Name,
+			"required_roles": route.Roles,
+		})
+	}
+})
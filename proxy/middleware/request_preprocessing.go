@@ -14,23 +14,59 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
 	"github.com/arbor-dev/arbor/logger"
 	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
 	"github.com/arbor-dev/arbor/proxy/constants"
 )
 
-func verifyAuthorization(authorization string, remoteAddr string) bool {
+func verifyAuthorization(r *http.Request) bool {
+	if security.IsEnabled() && security.APIKeys != nil {
+		return verifyAPIKey(r)
+	}
 	//IsAuthorizedClient Handles empty token
-	auth, err := security.IsAuthorizedClient(authorization)
+	auth, err := security.IsAuthorizedClient(r.Header.Get(constants.ClientAuthorizationHeaderField))
 	if err != nil {
-		logger.Log(logger.WARN, "Attempted unauthorized access from "+remoteAddr)
+		logger.LogForRequest(logger.WARN, r, "Attempted unauthorized access from "+r.RemoteAddr)
+		audit.RecordRequest(r, audit.AuthenticationFailed, "", err.Error(), map[string]interface{}{"credential": "client token"})
 		return false
 	}
 	return auth
 }
 
-func sanitizeRequest(r *http.Request) {
-	security.SanitizeRequest(r)
+func verifyAPIKey(r *http.Request) bool {
+	secret := bearerToken(r)
+	if secret == "" {
+		secret = r.Header.Get(constants.ClientAuthorizationHeaderField)
+	}
+	route, _ := services.RouteFromContext(r.Context())
+	key, err := security.AuthorizeAPIKey(security.APIKeys, secret, route.Name, r.Method)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Attempted unauthorized access from "+r.RemoteAddr+": "+err.Error())
+		if err == security.ErrKeyNotPermitted {
+			audit.RecordRequest(r, audit.AuthorizationDenied, key.Client, err.Error(), map[string]interface{}{"credential": "api key"})
+		} else {
+			audit.RecordRequest(r, audit.AuthenticationFailed, "", err.Error(), map[string]interface{}{"credential": "api key"})
+		}
+		return false
+	}
+	ctx := security.NewAPIKeyContext(r.Context(), key)
+	// The key's scopes apply unless the caller was already authenticated by a token
+	if _, authenticated := security.ClaimsFromContext(ctx); !authenticated {
+		ctx = security.NewClaimsContext(ctx, key.Claims())
+	}
+	setContext(r, ctx)
+	audit.RecordRequest(r, audit.AuthenticationSucceeded, key.Client, "", map[string]interface{}{"credential": "api key"})
+	if entry := logger.AccessEntryFromContext(r.Context()); entry != nil {
+		entry.User = key.Client
+	}
+	return true
+}
+
+func sanitizeRequest(r *http.Request) error {
+	return security.SanitizeRequest(r)
 }
 
 type preprocessingError struct {
@@ -44,9 +80,16 @@ func (e *preprocessingError) Error() string {
 
 func requestPreprocessing(w http.ResponseWriter, r *http.Request) error {
 	logger.LogReq(logger.DEBUG, r)
-	sanitizeRequest(r)
-	if !verifyAuthorization(r.Header.Get(constants.ClientAuthorizationHeaderField), r.RemoteAddr) {
-		w.WriteHeader(http.StatusForbidden)
+	if err := sanitizeRequest(r); err != nil {
+		if err == security.ErrBodyTooLarge {
+			WriteTooLarge(w, r, security.MaxSize)
+		} else {
+			apierror.Write(w, r, http.StatusBadRequest, "Could not read request body", nil)
+		}
+		return err
+	}
+	if !verifyAuthorization(r) {
+		apierror.Write(w, r, http.StatusForbidden, "Client not authorized", nil)
 		return &preprocessingError{-1, "Client Not Authorized"}
 	}
 	return nil
@@ -0,0 +1,72 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/schema"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// MaxSchemaErrors is the most field errors returned to the caller for an invalid body
+var MaxSchemaErrors = 50
+
+// compiledSchemas caches route schemas by their source
+var compiledSchemas sync.Map
+
+func routeSchema(route services.Route) (*schema.Schema, error) {
+	if compiled, ok := compiledSchemas.Load(string(route.Schema)); ok {
+		return compiled.(*schema.Schema), nil
+	}
+	compiled, err := schema.Compile(route.Schema)
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.Store(string(route.Schema), compiled)
+	return compiled, nil
+}
+
+// SchemaMiddleware is the middleware which validates request bodies against the route's JSON Schema
+//
+// Invalid bodies are rejected with 400 Bad Request, listing the field level errors.
+var SchemaMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || len(route.Schema) == 0 {
+		return
+	}
+	compiled, err := routeSchema(route)
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Invalid schema for route "+route.Name+": "+err.Error())
+		apierror.Write(w, r, http.StatusInternalServerError, "Invalid route schema", nil)
+		return
+	}
+
+	body, ok := readBody(w, r, MaxBodySize(r))
+	if !ok {
+		return
+	}
+
+	fieldErrors, err := compiled.ValidateJSON(body)
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Request body is not valid JSON", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if len(fieldErrors) > 0 {
+		if len(fieldErrors) > MaxSchemaErrors {
+			fieldErrors = fieldErrors[:MaxSchemaErrors]
+		}
+		apierror.Write(w, r, http.StatusBadRequest, "Request body does not match the schema", map[string]interface{}{"fields": fieldErrors})
+	}
+})
@@ -0,0 +1,81 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// MaxBodySize is the largest request body the route serving r accepts, its MaxBodySize or constants.MaxFileUploadSize if unset
+func MaxBodySize(r *http.Request) int64 {
+	return MaxBodySizeFor(r, "RAW")
+}
+
+// MaxBodySizeFor is the largest request body the route serving r accepts for a service of format
+//
+// Routes without a MaxBodySize accept constants.MaxRequestSize for JSON and XML services, and
+// constants.MaxFileUploadSize for the others, which take file and binary uploads.
+func MaxBodySizeFor(r *http.Request, format string) int64 {
+	if route, ok := services.RouteFromContext(r.Context()); ok && route.MaxBodySize > 0 {
+		return route.MaxBodySize
+	}
+	if format == "JSON" || format == "XML" {
+		return constants.MaxRequestSize
+	}
+	return constants.MaxFileUploadSize
+}
+
+// WriteTooLarge rejects a request whose body is larger than limit with 413 Payload Too Large
+func WriteTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	apierror.Write(w, r, http.StatusRequestEntityTooLarge, "Request body is too large", map[string]interface{}{"limit": limit})
+}
+
+// BodySizeMiddleware is the middleware which rejects request bodies larger than the route accepts
+//
+// The body is read once here, so the middlewares after it and the service see it whole rather than truncated.
+var BodySizeMiddleware = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	limit := MaxBodySize(r)
+	if r.ContentLength > limit {
+		WriteTooLarge(w, r, limit)
+		return
+	}
+	readBody(w, r, limit)
+})
+
+// readBody reads the request body whole and puts it back for the middlewares after, ok is false if
+// it was rejected with 413 Payload Too Large for being larger than limit
+//
+// Bodies are never truncated to the limit, a partial body would reach the service as corrupt data.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) (body []byte, ok bool) {
+	if r.Body == nil {
+		return nil, true
+	}
+	// Reading one byte past the limit detects bodies sent without a length
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Could not read request body", nil)
+		return nil, false
+	}
+	if int64(len(body)) > limit {
+		WriteTooLarge(w, r, limit)
+		return nil, false
+	}
+	return body, true
+}
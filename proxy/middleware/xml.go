@@ -0,0 +1,41 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/xmljson"
+)
+
+// xmlValidator checks request bodies for XML services, which callers send as JSON or as XML
+var xmlValidator = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, MaxBodySizeFor(r, "XML"))
+	if !ok || len(body) == 0 {
+		return
+	}
+	if xmljson.IsXML(r.Header.Get("Content-Type")) {
+		if !xmljson.Valid(body) {
+			apierror.Write(w, r, http.StatusBadRequest, "Body is not valid XML", nil)
+		}
+		return
+	}
+	if !json.Valid(body) {
+		apierror.Write(w, r, http.StatusBadRequest, "Body is not valid JSON", nil)
+	}
+})
+
+// XMLRequestMiddlewares is the set of middlewares for validating the request to an XML service
+var XMLRequestMiddlewares = []http.Handler{
+	xmlValidator,
+}
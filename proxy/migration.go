@@ -0,0 +1,242 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/random"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Migration serves a backend's requests while comparing its responses with those of the backend replacing it
+//
+// A sample of the requests is also sent to the new backend in the background, and its
+// responses are compared with those served. Once their parity is good enough the new backend
+// is promoted with PromoteMigration and serves the requests in place of the old one.
+type Migration struct {
+	//Backend is the URL of the new backend (e.g. "http://localhost:9000"), requests keep their path and query
+	Backend string
+	//Rate is the fraction of requests compared, from 0 to 1
+	Rate float64
+	//Methods are the methods compared, GET and HEAD if empty as comparing repeats the side effects of a request
+	Methods []string
+	//IgnoredFields are the JSON fields left out of comparisons at any depth, e.g. timestamps or generated IDs
+	IgnoredFields []string
+}
+
+// BackendMigrations are the migrations of backends, keyed by the host of the old backend (e.g. "localhost:8000")
+var BackendMigrations = map[string]Migration{}
+
+// Results of comparing the responses of the old and new backend of a migration
+const (
+	MigrationMatch          = "match"
+	MigrationStatusMismatch = "status_mismatch"
+	MigrationBodyMismatch   = "body_mismatch"
+	MigrationFailed         = "failed"
+)
+
+// MigrationStatus is the progress of the migration of a backend
+type MigrationStatus struct {
+	//Backend is the host of the old backend
+	Backend string `json:"backend"`
+	//Target is the URL of the new backend
+	Target   string `json:"target"`
+	Promoted bool   `json:"promoted"`
+	//Compared is how many responses were compared, and Matched how many of them matched
+	Compared int64 `json:"compared"`
+	Matched  int64 `json:"matched"`
+	//Parity is the share of the compared responses which matched
+	Parity float64 `json:"parity"`
+}
+
+// ErrNoMigration is returned when promoting a backend which is not being migrated
+var ErrNoMigration = errors.New("backend is not being migrated")
+
+type migrationProgress struct {
+	promoted bool
+	compared int64
+	matched  int64
+}
+
+var (
+	migrationsMutex sync.Mutex
+	migrations      = map[string]*migrationProgress{}
+)
+
+// progress returns the progress of the migration of the backend at host, the caller must hold migrationsMutex
+func progress(host string) *migrationProgress {
+	p, exists := migrations[host]
+	if !exists {
+		p = &migrationProgress{}
+		migrations[host] = p
+	}
+	return p
+}
+
+// PromoteMigration makes the new backend of the migration of the backend at host serve its requests
+//
+// Promotions last until arbor restarts, the configuration should be changed to name the new backend.
+func PromoteMigration(host string) error {
+	if _, exists := BackendMigrations[host]; !exists {
+		return ErrNoMigration
+	}
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	progress(host).promoted = true
+	return nil
+}
+
+// Migrations returns the progress of each migration, ordered by the host of the old backend
+func Migrations() []MigrationStatus {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	statuses := make([]MigrationStatus, 0, len(BackendMigrations))
+	for host, migration := range BackendMigrations {
+		p := progress(host)
+		status := MigrationStatus{Backend: host, Target: migration.Backend, Promoted: p.promoted, Compared: p.compared, Matched: p.matched}
+		if p.compared > 0 {
+			status.Parity = float64(p.matched) / float64(p.compared)
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Backend < statuses[j].Backend })
+	return statuses
+}
+
+// migrated returns url rebased onto the new backend of its migration, if the new backend was promoted
+func migrated(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	migration, exists := BackendMigrations[u.Host]
+	if !exists {
+		return url
+	}
+	migrationsMutex.Lock()
+	promoted := progress(u.Host).promoted
+	migrationsMutex.Unlock()
+	base, err := neturl.Parse(migration.Backend)
+	if !promoted || err != nil {
+		return url
+	}
+	return rebase(u, base)
+}
+
+// compareMigration sends a copy of the caller's request r for url to the new backend of its migration, if it is sampled,
+// and compares the response with the old backend's
+//
+// The copy is sent in the background and counts towards ShadowConcurrency. The requests of protected routes are never copied.
+func compareMigration(r *http.Request, url string, body []byte, status int, responseBody []byte) {
+	u, err := neturl.Parse(url)
+	if err != nil || services.Protected(r.Context()) {
+		return
+	}
+	migration, exists := BackendMigrations[u.Host]
+	methods := migration.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead}
+	}
+	if !exists || !contains(r.Method, methods) || !random.Sample(migration.Rate) {
+		return
+	}
+	base, err := neturl.Parse(migration.Backend)
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Invalid migration backend "+migration.Backend+": "+err.Error())
+		return
+	}
+	if atomic.AddInt32(&shadowsInFlight, 1) > ShadowConcurrency {
+		atomic.AddInt32(&shadowsInFlight, -1)
+		return
+	}
+	req, err := shadowCopy(r, rebase(u, base), body)
+	if err != nil {
+		atomic.AddInt32(&shadowsInFlight, -1)
+		countComparison(r, u.Host, MigrationFailed)
+		return
+	}
+
+	go func() {
+		defer atomic.AddInt32(&shadowsInFlight, -1)
+		resp, err := shadowClient().Do(req)
+		if err != nil {
+			logger.LogForRequest(logger.DEBUG, r, "Migration request to "+base.Host+" failed: "+err.Error())
+			countComparison(r, u.Host, MigrationFailed)
+			return
+		}
+		candidate, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case err != nil:
+			countComparison(r, u.Host, MigrationFailed)
+		case resp.StatusCode != status:
+			countComparison(r, u.Host, MigrationStatusMismatch)
+		case !sameBody(responseBody, candidate, migration.IgnoredFields):
+			countComparison(r, u.Host, MigrationBodyMismatch)
+		default:
+			countComparison(r, u.Host, MigrationMatch)
+		}
+	}()
+}
+
+func countComparison(r *http.Request, host string, result string) {
+	metrics.MigrationComparisons.Inc(host, result)
+	if result != MigrationMatch {
+		logger.LogForRequest(logger.DEBUG, r, "Migration of "+host+" differed: "+result)
+	}
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	p := progress(host)
+	p.compared++
+	if result == MigrationMatch {
+		p.matched++
+	}
+}
+
+// sameBody compares two bodies, as documents without the ignored fields if both are JSON
+func sameBody(a []byte, b []byte, ignored []string) bool {
+	if !json.Valid(a) || !json.Valid(b) {
+		return bytes.Equal(a, b)
+	}
+	var documentA, documentB interface{}
+	json.Unmarshal(a, &documentA)
+	json.Unmarshal(b, &documentB)
+	return reflect.DeepEqual(withoutFields(documentA, ignored), withoutFields(documentB, ignored))
+}
+
+func withoutFields(value interface{}, fields []string) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, field := range fields {
+			delete(value, field)
+		}
+		for name, field := range value {
+			value[name] = withoutFields(field, fields)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = withoutFields(item, fields)
+		}
+	}
+	return value
+}
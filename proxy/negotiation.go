@@ -0,0 +1,79 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/negotiation"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// negotiateResponseBody translates the response to the format the caller accepts, by the route's NegotiationPolicy
+//
+// ok is false if the caller was answered 406 Not Acceptable instead.
+func negotiateResponseBody(w http.ResponseWriter, r *http.Request, status int, body []byte) ([]byte, bool) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || route.Negotiation == nil || len(body) == 0 {
+		return body, true
+	}
+	policy := route.Negotiation
+	header := w.Header()
+	header.Add("Vary", "Accept")
+	served := negotiation.MediaType(header.Get("Content-Type"))
+	if served == "" || negotiation.Quality(r, served) > 0 {
+		return body, true
+	}
+
+	formats := policy.Formats
+	if len(formats) == 0 {
+		formats = negotiation.Formats()
+	}
+	// Only successful responses are refused, errors are better sent in any format than not at all
+	notAcceptable := func() ([]byte, bool) {
+		if !policy.Strict || status < 200 || status >= 300 {
+			return body, true
+		}
+		apierror.Write(w, r, http.StatusNotAcceptable, "None of the accepted formats are available",
+			map[string]interface{}{"available": append([]string{served}, formats...)})
+		return nil, false
+	}
+	if _, ok := negotiation.Codecs[served]; !ok {
+		return notAcceptable()
+	}
+	// Compressed bodies can not be translated
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return notAcceptable()
+	}
+	chosen, ok := negotiation.Choose(r, formats)
+	if !ok {
+		return notAcceptable()
+	}
+	translated, err := negotiation.Translate(r, body, served, chosen)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Could not translate response from "+served+" to "+chosen+": "+err.Error())
+		return notAcceptable()
+	}
+	header.Set("Content-Type", chosen)
+	header.Del("Content-Length")
+	weakenETag(header)
+	return translated, true
+}
+
+// weakenETag marks the service's ETag as weak, as it described another representation of the response
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
@@ -0,0 +1,62 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+)
+
+// Option configures how Proxy proxies a request
+type Option func(*options)
+
+type options struct {
+	format      string
+	token       string
+	middlewares *MiddlewareSet
+}
+
+// WithFormat sets the format of the service, "JSON", "XML", "PROTOBUF", "MSGPACK", "CBOR" or "RAW" (the default)
+//
+// The bodies of XML services are translated from and to JSON for callers, see xmljson.
+// Callers sending XML, or preferring it in their Accept header, get it as it is.
+//
+// The bodies of PROTOBUF services are sent as they are, or transcoded from and to JSON for
+// callers sending or preferring it if the route has a ProtobufPolicy.
+//
+// The bodies of MSGPACK and CBOR services are sent as they are, or translated to JSON for the
+// service and back for callers not preferring JSON if the route has TranslateToJSON.
+func WithFormat(format string) Option {
+	return func(o *options) { o.format = format }
+}
+
+// WithToken sets the authorization token sent to the service
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// WithMiddlewares replaces the middlewares built from the format and token
+func WithMiddlewares(middlewares MiddlewareSet) Option {
+	return func(o *options) { o.middlewares = &middlewares }
+}
+
+// Proxy proxies the caller's request to url, whatever its method
+func Proxy(w http.ResponseWriter, r *http.Request, url string, opts ...Option) {
+	o := options{format: "RAW"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	middlewares := o.middlewares
+	if middlewares == nil {
+		set := ProxyMiddlewaresFactory(o.format, o.token)
+		middlewares = &set
+	}
+	ProxyRequestWithMiddlewares(w, r, url, *middlewares)
+}
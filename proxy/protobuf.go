@@ -0,0 +1,97 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/negotiation"
+	"github.com/arbor-dev/arbor/protobuf"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// routeMessage returns the message type of the route serving r named by message, false if it has none
+func routeMessage(r *http.Request, message func(*services.ProtobufPolicy) string) (*protobuf.Message, bool) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || route.Protobuf == nil || message(route.Protobuf) == "" {
+		return nil, false
+	}
+	set, err := protobuf.LoadDescriptorSet(route.Protobuf.DescriptorSet)
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not load descriptor set "+route.Protobuf.DescriptorSet+": "+err.Error())
+		return nil, false
+	}
+	return set.Message(message(route.Protobuf))
+}
+
+func requestMessage(policy *services.ProtobufPolicy) string {
+	return policy.Request
+}
+
+func responseMessage(policy *services.ProtobufPolicy) string {
+	return policy.Response
+}
+
+// transcodeRequestBody transcodes the caller's JSON body to the route's Request message, protobuf bodies are sent as they are
+func transcodeRequestBody(r *http.Request, body []byte) ([]byte, bool) {
+	if len(body) == 0 || !transform.IsJSON(r.Header.Get("Content-Type")) {
+		return body, true
+	}
+	message, ok := routeMessage(r, requestMessage)
+	if !ok {
+		return body, true
+	}
+	transcoded, err := message.FromJSON(body)
+	if err != nil {
+		logger.LogForRequest(logger.DEBUG, r, "Could not transcode request body: "+err.Error())
+		return nil, false
+	}
+	r.Header.Set("Content-Type", protobuf.MediaType)
+	return transcoded, true
+}
+
+// transcodeResponseBody transcodes a protobuf service's response to JSON for callers preferring JSON,
+// if the route has a Response message, others get it as it is
+func transcodeResponseBody(header http.Header, r *http.Request, body []byte) ([]byte, bool) {
+	header.Add("Vary", "Accept")
+	if len(body) == 0 {
+		return body, true
+	}
+	switch contentType := negotiation.MediaType(header.Get("Content-Type")); {
+	case contentType == "" || contentType == "application/octet-stream":
+		// Services often leave the type of their protobuf bodies unset or generic, callers need it to decode them
+		header.Set("Content-Type", protobuf.MediaType)
+	case !protobuf.IsProtobuf(contentType):
+		return body, true
+	}
+	if negotiation.Quality(r, "application/json") <= negotiation.Quality(r, protobuf.MediaType) {
+		return body, true
+	}
+	// Compressed bodies can not be transcoded, callers get them as they are
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return body, true
+	}
+	message, ok := routeMessage(r, responseMessage)
+	if !ok {
+		return body, true
+	}
+	transcoded, err := message.ToJSON(body)
+	if err != nil {
+		logger.LogForRequest(logger.WARN, r, "Could not transcode response body: "+err.Error())
+		return nil, false
+	}
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	weakenETag(header)
+	return transcoded, true
+}
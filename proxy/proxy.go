@@ -31,26 +31,43 @@ func PATCH(w http.ResponseWriter, r *http.Request, url string, format string, to
 }
 
 // ProxyRequest proxies the caller's request based on the url, format, and token
+//
+// Deprecated: use Proxy with WithFormat and WithToken.
 func ProxyRequest(w http.ResponseWriter, r* http.Request, url string, format string, token string) {
-	middlewares := ProxyMiddlewaresFactory(format, token)
-
-	ProxyRequestWithMiddlewares(w, r, url, middlewares)
+	Proxy(w, r, url, WithFormat(format), WithToken(token))
 }
 
 // ProxyMiddlewaresFactory a set of middlewares based on the provided format and token
 func ProxyMiddlewaresFactory(format string, token string) MiddlewareSet {
 	middlewares := ProxyMiddlewares
+	// Copy the defaults so appending never writes into the shared slices
+	middlewares.RequestMiddlewares = append([]http.Handler(nil), ProxyMiddlewares.RequestMiddlewares...)
+	middlewares.ResponseMiddlewares = append([]http.Handler(nil), ProxyMiddlewares.ResponseMiddlewares...)
 
-	middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.PreprocessingMiddleware)
+	middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, chainMiddleware)
 	middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.TokenMiddlewareFactory(token))
 
 	middlewares.ResponseMiddlewares = append(middlewares.ResponseMiddlewares, middleware.CORSMiddleware)
 
+	middlewares.Format = format
+
 	switch format {
 	case "JSON":
 		middlewares.ErrorHandler = middleware.JSONErrorHandler
 		middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.JSONRequestMiddlewares...)
 		middlewares.ResponseMiddlewares = append(middlewares.ResponseMiddlewares, middleware.JSONResponseMiddlewares...)
+	case "XML":
+		middlewares.ErrorHandler = middleware.JSONErrorHandler
+		middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.XMLRequestMiddlewares...)
+	case "PROTOBUF":
+		middlewares.ErrorHandler = middleware.JSONErrorHandler
+		middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.ProtobufRequestMiddlewares...)
+	case "MSGPACK":
+		middlewares.ErrorHandler = middleware.JSONErrorHandler
+		middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.MsgpackRequestMiddlewares...)
+	case "CBOR":
+		middlewares.ErrorHandler = middleware.JSONErrorHandler
+		middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, middleware.CBORRequestMiddlewares...)
 	case "RAW":
 		fallthrough
 	default:
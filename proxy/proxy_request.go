@@ -6,8 +6,16 @@ import (
 	"io"
 	"time"
 	"bytes"
+	"strconv"
 
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/cache"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
 	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/services"
 )
 
 // MiddlewareSet contains the error handler and middlewares to use when proxying a request
@@ -15,21 +23,94 @@ type MiddlewareSet struct {
 	ErrorHandler        http.Handler
 	RequestMiddlewares  []http.Handler
 	ResponseMiddlewares []http.Handler
+	// Format is the format of the service, see WithFormat
+	Format              string
+}
+
+// responseTracker records if a middleware has already responded to the caller
+type responseTracker struct {
+	http.ResponseWriter
+	responded bool
+}
+
+func (t *responseTracker) WriteHeader(code int) {
+	t.responded = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *responseTracker) Write(b []byte) (int, error) {
+	t.responded = true
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *responseTracker) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 // ProxyRequestWithMiddlewares proxies the provided request using the given middlewares
+//
+// A middleware which writes a response (e.g. to reject the request) stops the request from being proxied.
 func ProxyRequestWithMiddlewares(w http.ResponseWriter, r *http.Request, url string, proxyMiddlewares MiddlewareSet) {
+	// Requests not routed through the arbor router still need an ID to forward
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+
 	for _, requestMiddleware := range proxyMiddlewares.RequestMiddlewares {
 		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
 	}
 
-	requestBody, err := ioutil.ReadAll(io.LimitReader(r.Body, constants.MaxFileUploadSize))
+	observeBackend(r, url)
+
+	routedURL, debugging := routeForDebugging(r, url)
+	if !debugging {
+		routedURL = migrated(routeByHeaders(w, r, url))
+	}
+
+	policy := cache.Policy(r)
+	// Responses from a developer's instance are neither served from nor stored in the cache
+	if debugging {
+		policy = nil
+	}
+	var cacheKey string
+	if policy != nil {
+		cacheKey = cache.Key(r, policy, routedURL)
+		if !cache.Bypass(r) {
+			entry, err := cache.Responses.Get(cacheKey)
+			if err != nil {
+				logger.LogForRequest(logger.ERR, r, "Could not read response cache: "+err.Error())
+			}
+			if entry != nil {
+				serveCached(w, r, entry, proxyMiddlewares, tracker)
+				return
+			}
+		}
+	}
+
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	limit := middleware.MaxBodySizeFor(r, proxyMiddlewares.Format)
+	requestBody, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
 
 	if err != nil {
 		proxyMiddlewares.ErrorHandler.ServeHTTP(w, r)
 		return
 	}
 
+	if int64(len(requestBody)) > limit {
+		middleware.WriteTooLarge(w, r, limit)
+		return
+	}
+
 	err = r.Body.Close()
 
 	if err != nil {
@@ -37,33 +118,101 @@ func ProxyRequestWithMiddlewares(w http.ResponseWriter, r *http.Request, url str
 		return
 	}
 
-	req, err := http.NewRequest(r.Method, url, bytes.NewBuffer(requestBody))
+	requestBody = transformRequestBody(r, requestBody)
+	requestBody, ok := translateRequestBody(r, proxyMiddlewares.Format, requestBody)
+	if !ok {
+		apierror.Write(w, r, http.StatusBadRequest, "Body can not be translated to the service's format", nil)
+		return
+	}
 
-	if err != nil {
-		proxyMiddlewares.ErrorHandler.ServeHTTP(w, r)
+	idempotent, ok := claimIdempotencyKey(w, r, requestBody, proxyMiddlewares, tracker)
+	if !ok {
 		return
 	}
+	defer idempotent.release(r)
 
-	for k, vs := range r.Header {
-		req.Header[k] = make([]string, len(vs))
-		copy(req.Header[k], vs)
+	if RecordingMode == Replay {
+		if recording := replay(r, routedURL, requestBody); recording != nil {
+			for k, vs := range recording.Header {
+				for _, v := range vs {
+					w.Header().Add(k, v)
+				}
+			}
+			respond(w, r, recording.Status, recording.Body, proxyMiddlewares, tracker)
+			return
+		}
+	}
+
+	// Writes to a resource wait for the earlier ones to finish, rather than interleaving with them
+	serialized, ok := serializeWrite(r)
+	if !ok {
+		return
+	}
+	defer serialized()
+
+	mirror(r, routedURL, requestBody)
+
+	url, finished, ok := balance(w, r, routedURL)
+	if !ok {
+		return
+	}
+	defer finished()
+
+	url, ok = healthyBackend(w, r, url)
+	if !ok {
+		return
+	}
+
+	req, ok := backendRequest(r, url, requestBody)
+	if !ok {
+		proxyMiddlewares.ErrorHandler.ServeHTTP(w, r)
+		return
 	}
 
 	client := &http.Client{
+		Transport: transport(),
 		Timeout: time.Duration(constants.Timeout) * time.Second,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
-	resp, err := client.Do(req)
+	release, ok := acquireBackend(w, r, url)
+	if !ok {
+		return
+	}
+	defer release()
+
+	upstreamStart := clock.Now()
+	resp, err := sendWithinSLA(client, req, r)
+	if err == errSLAExceeded {
+		var retried func()
+		resp, retried, err = retryWithinSLA(w, r, client, routedURL, url, requestBody)
+		defer retried()
+	}
+
+	if entry := logger.AccessEntryFromContext(r.Context()); entry != nil {
+		entry.UpstreamLatency = clock.Since(upstreamStart)
+	}
+
+	if tracker.responded {
+		return
+	}
+
+	if err == errSLAExceeded {
+		logger.LogForRequest(logger.WARN, r, "Aborting request, "+url+" did not respond within the route's SLA")
+		apierror.Write(w, r, http.StatusGatewayTimeout, "", nil)
+		return
+	}
 
 	if err != nil {
 		proxyMiddlewares.ErrorHandler.ServeHTTP(w, r)
 		return
 	}
 
+	resp = throttled(r, client, req, url, requestBody, resp)
 	defer resp.Body.Close()
+	rejectedCredentials(req, resp)
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
 
@@ -72,22 +221,136 @@ func ProxyRequestWithMiddlewares(w http.ResponseWriter, r *http.Request, url str
 		return
 	}
 
+	logger.DumpBackendResponse(r, resp, responseBody)
+
+	if !verifyChecksums(r, req, resp, responseBody) {
+		apierror.Write(w, r, http.StatusBadGateway, "", nil)
+		return
+	}
+
+	if RecordingMode == Record {
+		record(r, routedURL, requestBody, resp, responseBody)
+	}
+
+	compareMigration(r, routedURL, requestBody, resp.StatusCode, responseBody)
+
+	if route, ok := services.RouteFromContext(r.Context()); ok && route.Job != nil && resp.StatusCode == http.StatusAccepted {
+		if startJob(w, r, req, resp, *route.Job, client, proxyMiddlewares, tracker, idempotent) {
+			return
+		}
+	}
+
+	responseBody = transformResponseBody(r, resp.Header, responseBody)
+	rewriteURLHeaders(resp.Header, r, routedURL, url)
+	rewriteCookies(req, resp.Header)
+
+	if policy != nil {
+		if ttl := cache.TTL(r, policy, resp.StatusCode, resp.Header, len(responseBody)); ttl > 0 {
+			entry := cache.NewEntry(resp.StatusCode, resp.Header, responseBody, ttl)
+			err = cache.Responses.Set(cacheKey, entry)
+			if err != nil {
+				logger.LogForRequest(logger.ERR, r, "Could not write response cache: "+err.Error())
+			}
+			serveCached(w, r, entry, proxyMiddlewares, tracker)
+			return
+		}
+	}
+
+	idempotent.store(r, resp.StatusCode, resp.Header, responseBody)
+
 	for k, vs := range resp.Header {
 		for _, v := range vs {
 			w.Header().Add(k, v)
 		}
 	}
 
+	respond(w, r, resp.StatusCode, responseBody, proxyMiddlewares, tracker)
+}
+
+// backendRequest creates the request sent to the backend at url for the caller's request r
+func backendRequest(r *http.Request, url string, requestBody []byte) (*http.Request, bool) {
+	req, err := http.NewRequest(r.Method, url, bytes.NewBuffer(requestBody))
+
+	if err != nil {
+		return nil, false
+	}
+
+	for k, vs := range r.Header {
+		req.Header[k] = make([]string, len(vs))
+		copy(req.Header[k], vs)
+	}
+
+	req.Header.Del(DebugRouteHeader)
+
+	encodeRequestBody(req, requestBody)
+
+	// Credentials are set last, as signatures cover the encoded body
+	if !setCredentials(r, req) {
+		return nil, false
+	}
+
+	logger.DumpBackendRequest(r, req, requestBody)
+	return req, true
+}
+
+// serveCached responds with a cached response, or 304 Not Modified without a body if the caller already has it
+func serveCached(w http.ResponseWriter, r *http.Request, entry *cache.Entry, proxyMiddlewares MiddlewareSet, tracker *responseTracker) {
+	for k, vs := range entry.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("Age", strconv.Itoa(int(clock.Since(entry.Stored)/time.Second)))
+
+	if cache.NotModified(r, entry) {
+		respond(w, r, http.StatusNotModified, nil, proxyMiddlewares, tracker)
+		return
+	}
+	respond(w, r, entry.Status, entry.Body, proxyMiddlewares, tracker)
+}
+
+// respond runs the response middlewares and then writes the response to the caller
+func respond(w http.ResponseWriter, r *http.Request, status int, body []byte, proxyMiddlewares MiddlewareSet, tracker *responseTracker) {
 	for _, responseMiddleware := range proxyMiddlewares.ResponseMiddlewares {
 		responseMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	if !responseStages(w, r) {
+		return
+	}
+
+	body, ok := translateResponseBody(w.Header(), r, proxyMiddlewares.Format, body)
+	if !ok {
+		apierror.Write(w, r, http.StatusBadGateway, "", nil)
+		return
+	}
+	body, ok = negotiateResponseBody(w, r, status, body)
+	if !ok {
+		return
 	}
+	body = encodeBody(w.Header(), r, status, body)
+	setDigests(w.Header(), r, status, body)
+
+	w.WriteHeader(status)
 
-	w.WriteHeader(resp.StatusCode)
+	if !bodyAllowed(r, status) {
+		return
+	}
 
-	_, err = w.Write(responseBody)
+	_, err := w.Write(body)
 
 	if err != nil {
 		proxyMiddlewares.ErrorHandler.ServeHTTP(w, r)
 		return
 	}
 }
+
+// bodyAllowed reports if a response of status to the caller's request r has a body, 1xx, 204 and 304 responses never do
+func bodyAllowed(r *http.Request, status int) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,123 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/payload"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Recording modes
+const (
+	//RecordingOff proxies to the backends without recording
+	RecordingOff = ""
+	//Record saves every backend response to RecordingDirectory
+	Record = "record"
+	//Replay serves the recorded response of a request instead of calling the backend, calling it only if there is none
+	Replay = "replay"
+)
+
+// RecordingMode records backend responses during a live session and replays them when the backends are offline
+//
+// It is meant for local development, recordings hold whatever the backends answered, including personal data.
+// They are encrypted with encryption.AtRest when it is configured.
+var RecordingMode = RecordingOff
+
+// RecordingDirectory is where recordings are kept, one JSON file per request
+var RecordingDirectory = "recordings"
+
+// Recording is a backend's response to a request
+type Recording struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	Recorded time.Time   `json:"recorded"`
+}
+
+// recordingFile is the file of the recording of a request for url, keyed by its method, URL and body hash
+//
+// The URL is the service's, not the instance's which answered, so any instance's recording is replayed.
+func recordingFile(r *http.Request, url string, body []byte) string {
+	sum := sha256.Sum256([]byte(r.Method + "\n" + url + "\n" + payload.Hash(r.Header.Get("Content-Type"), body)))
+	return filepath.Join(RecordingDirectory, hex.EncodeToString(sum[:])+".json")
+}
+
+// replay returns the recorded response to a request, nil if there is none or the route is protected
+func replay(r *http.Request, url string, body []byte) *Recording {
+	if services.Protected(r.Context()) {
+		return nil
+	}
+	file := recordingFile(r, url, body)
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		data, err = encryption.OpenAtRest(data, []byte(filepath.Base(file)))
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.LogForRequest(logger.ERR, r, "Could not read recording: "+err.Error())
+		}
+		logger.LogForRequest(logger.DEBUG, r, "No recording of "+r.Method+" "+url+", calling the backend")
+		return nil
+	}
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not read recording: "+err.Error())
+		return nil
+	}
+	return &recording
+}
+
+// record saves a backend's response to a request for url, unless the route is protected
+func record(r *http.Request, url string, body []byte, resp *http.Response, responseBody []byte) {
+	if services.Protected(r.Context()) {
+		return
+	}
+	data, err := json.MarshalIndent(Recording{
+		Method:   r.Method,
+		URL:      url,
+		Status:   resp.StatusCode,
+		Header:   resp.Header,
+		Body:     responseBody,
+		Recorded: clock.Now(),
+	}, "", "  ")
+	file := recordingFile(r, url, body)
+	if err == nil {
+		// The file name is the context, so a recording can not be swapped for another request's
+		data, err = encryption.SealAtRest(data, []byte(filepath.Base(file)))
+	}
+	if err == nil {
+		err = os.MkdirAll(RecordingDirectory, 0700)
+	}
+	if err == nil {
+		// Write then rename so a concurrent replay never reads half a recording
+		err = ioutil.WriteFile(file+".tmp", data, 0600)
+		if err == nil {
+			err = os.Rename(file+".tmp", file)
+		}
+	}
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Could not record response: "+err.Error())
+	}
+}
@@ -0,0 +1,145 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// PublicURL is the URL callers reach arbor at (e.g. "https://api.example.org"), empty uses the scheme and host of each request
+var PublicURL = ""
+
+// URLRewrites rewrite the URLs of backends' Location, Content-Location and Link headers, keyed by the internal base URL they start with
+//
+// e.g. {"http://products.internal:8000/v2/": "https://api.example.org/products/"}. Of the bases a
+// URL starts with, the longest is replaced. Location and Content-Location URLs no base matches
+// are still pointed at arbor if they are on the host of the route's backend.
+var URLRewrites = map[string]string{}
+
+var linkURL = regexp.MustCompile(`<[^>]*>`)
+
+// rewriteURLHeaders points the URL headers of a backend's response at arbor rather than the backend
+func rewriteURLHeaders(header http.Header, r *http.Request, routedURL string, instanceURL string) {
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if rewritten, ok := rewriteURL(value); ok {
+			header.Set(name, rewritten)
+		} else if rewritten, ok := pointAtGateway(value, r, routedURL, instanceURL); ok {
+			header.Set(name, rewritten)
+		}
+	}
+
+	links := header.Values("Link")
+	if len(URLRewrites) == 0 || len(links) == 0 {
+		return
+	}
+	rewrittenLinks := make([]string, len(links))
+	for i, link := range links {
+		rewrittenLinks[i] = linkURL.ReplaceAllStringFunc(link, func(target string) string {
+			if rewritten, ok := rewriteURL(target[1 : len(target)-1]); ok {
+				return "<" + rewritten + ">"
+			}
+			return target
+		})
+	}
+	header["Link"] = rewrittenLinks
+}
+
+// rewriteURL replaces the longest of URLRewrites' bases which url starts with
+func rewriteURL(url string) (string, bool) {
+	base := ""
+	for internal := range URLRewrites {
+		if len(internal) > len(base) && strings.HasPrefix(url, internal) {
+			base = internal
+		}
+	}
+	if base == "" {
+		return url, false
+	}
+	return URLRewrites[base] + strings.TrimPrefix(url, base), true
+}
+
+// pointAtGateway points a URL of a backend's response at arbor, if it is on the backend's host
+//
+// Backends address themselves by their internal address, which callers can not reach. URLs
+// on the host of the route's backend (or the instance which responded) are moved onto PublicURL,
+// and paths below the backend URL the route proxies to are moved below the route's path.
+// URLs on other hosts, such as a login page, are left alone.
+func pointAtGateway(location string, r *http.Request, routedURL string, instanceURL string) (string, bool) {
+	target, err := neturl.Parse(location)
+	if err != nil {
+		return location, false
+	}
+	backend, err := neturl.Parse(routedURL)
+	if err != nil {
+		return location, false
+	}
+
+	if target.Host != "" {
+		instance, err := neturl.Parse(instanceURL)
+		if target.Host != backend.Host && (err != nil || target.Host != instance.Host) {
+			return location, false
+		}
+		public := publicURL(r)
+		target.Scheme = public.Scheme
+		target.Host = public.Host
+		target.Path = moveBelow(target.Path, backend.Path, r.URL.Path, public.Path)
+	} else if strings.HasPrefix(target.Path, "/") {
+		target.Path = moveBelow(target.Path, backend.Path, r.URL.Path, "")
+	} else {
+		// Paths relative to the request resolve the same through arbor
+		return location, false
+	}
+	target.RawPath = ""
+	return target.String(), true
+}
+
+// publicURL is the URL the caller reached arbor at
+func publicURL(r *http.Request) *neturl.URL {
+	if PublicURL != "" {
+		if public, err := neturl.Parse(PublicURL); err == nil {
+			public.Path = strings.TrimSuffix(public.Path, "/")
+			return public
+		}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return &neturl.URL{Scheme: scheme, Host: r.Host}
+}
+
+// moveBelow moves path from below the backend's prefix to below the route's, under base
+//
+// The prefixes are what remains of backendPath and routePath once the segments they end
+// with in common are removed, e.g. "/api/v2" and "" for "/api/v2/products" and "/products".
+func moveBelow(path string, backendPath string, routePath string, base string) string {
+	backendSegments := strings.Split(backendPath, "/")
+	routeSegments := strings.Split(routePath, "/")
+	for len(backendSegments) > 1 && len(routeSegments) > 1 &&
+		backendSegments[len(backendSegments)-1] == routeSegments[len(routeSegments)-1] {
+		backendSegments = backendSegments[:len(backendSegments)-1]
+		routeSegments = routeSegments[:len(routeSegments)-1]
+	}
+	backendPrefix := strings.Join(backendSegments, "/")
+	routePrefix := strings.Join(routeSegments, "/")
+
+	if path == backendPrefix || strings.HasPrefix(path, backendPrefix+"/") {
+		path = routePrefix + strings.TrimPrefix(path, backendPrefix)
+	}
+	return base + path
+}
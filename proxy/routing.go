@@ -0,0 +1,70 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	neturl "net/url"
+)
+
+// HeaderRule sends requests carrying a header to another backend
+type HeaderRule struct {
+	//Header is the request header the rule matches on, e.g. "X-API-Version"
+	Header string
+	//Value the header must have, any value if empty
+	Value string
+	//Backend is the base URL matching requests are sent to instead, e.g. "http://localhost:8002"
+	Backend string
+}
+
+// BackendHeaderRules are the header rules of each backend, keyed by host (e.g. "localhost:8000")
+//
+// The rules are evaluated in order and the first match decides the backend,
+// requests matching no rule go to the backend the route names, the default.
+var BackendHeaderRules = map[string][]HeaderRule{}
+
+func (rule HeaderRule) matches(r *http.Request) bool {
+	values := r.Header.Values(rule.Header)
+	if rule.Value == "" {
+		return len(values) > 0
+	}
+	return contains(rule.Value, values)
+}
+
+// routeByHeaders returns url rebased onto the backend of the first header rule r matches
+//
+// Responses vary by the headers the rules match on, which is added to the caller's Vary header.
+func routeByHeaders(w http.ResponseWriter, r *http.Request, url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	rules := BackendHeaderRules[u.Host]
+	varied := map[string]bool{}
+	for _, rule := range rules {
+		header := http.CanonicalHeaderKey(rule.Header)
+		if !varied[header] {
+			varied[header] = true
+			w.Header().Add("Vary", header)
+		}
+	}
+	for _, rule := range rules {
+		if !rule.matches(r) {
+			continue
+		}
+		backend, err := neturl.Parse(rule.Backend)
+		if err != nil {
+			continue
+		}
+		return rebase(u, backend)
+	}
+	return url
+}
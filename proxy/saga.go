@@ -0,0 +1,316 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/requestid"
+)
+
+// Outcomes of a Saga, and of each of its steps
+const (
+	//SagaCommitted is a saga whose steps all succeeded
+	SagaCommitted = "committed"
+	//SagaCompensated is a saga which failed and whose steps which succeeded were undone
+	SagaCompensated = "compensated"
+	//SagaCompensationFailed is a saga which failed and whose steps were not all undone, leaving the backends inconsistent
+	SagaCompensationFailed = "compensation_failed"
+
+	//StepSucceeded is a step the backend accepted
+	StepSucceeded = "succeeded"
+	//StepFailed is a step the backend rejected or did not answer
+	StepFailed = "failed"
+	//StepSkipped is a step not sent as an earlier step had failed
+	StepSkipped = "skipped"
+	//StepCompensated is a step which succeeded and was undone
+	StepCompensated = "compensated"
+	//StepCompensationFailed is a step which succeeded and could not be undone
+	StepCompensationFailed = "compensation_failed"
+)
+
+// DefaultCompensationAttempts is how many times a compensation is sent before it is given up on, for sagas which do not say
+const DefaultCompensationAttempts = 3
+
+// SagaStep is a backend write of a saga, with the request undoing it
+type SagaStep struct {
+	//Name identifies the step in the outcome
+	Name string
+	//Method is the method of the write, POST if unset
+	Method string
+	//URL is the backend endpoint, {name} placeholders are replaced with the route's variables
+	URL string
+	//BodyField is the field of the caller's JSON body sent as the step's body, empty sends the whole body
+	BodyField string
+	//Compensation undoes the step once it succeeded, if a later step fails (optional)
+	Compensation *Compensation
+}
+
+// Compensation is the backend request undoing a step of a saga
+//
+// {name} placeholders of its URL are replaced with the route's variables, and the others with
+// the fields of the step's JSON response, e.g. "http://orders/orders/{id}" for the created order.
+// The step's response is the body of POST, PUT and PATCH compensations.
+type Compensation struct {
+	//Method is the method of the request, DELETE if unset
+	Method string
+	URL    string
+}
+
+// Saga fans a composite write out to several backends, undoing the writes which succeeded if any fails
+//
+// There is no distributed transaction: other callers may see the writes of a saga before they are
+// compensated, and compensations must be safe to send more than once.
+type Saga struct {
+	Steps []SagaStep
+	//Sequential sends the steps one after another, in order, rather than in parallel
+	Sequential bool
+	//MaxParallelism is the most steps sent at once, 0 sends them all at once
+	MaxParallelism int
+	//CompensationAttempts is how many times a compensation is sent before it is given up on, DefaultCompensationAttempts if unset
+	CompensationAttempts int
+}
+
+// SagaOutcome is the structured outcome of a saga reported to the caller
+type SagaOutcome struct {
+	Outcome string        `json:"outcome"`
+	Steps   []StepOutcome `json:"steps"`
+}
+
+// StepOutcome is the outcome of a step of a saga
+type StepOutcome struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	//Response is the backend's response to the step, if it succeeded
+	Response json.RawMessage `json:"response,omitempty"`
+	//Error describes why the step failed
+	Error *CallError `json:"error,omitempty"`
+}
+
+var responseField = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// RunSaga sends the saga's steps, passing token (optional) to the backends, and reports the outcome
+//
+// If every step succeeds, the outcome is the response with each step's response. Otherwise the
+// compensations of the steps which succeeded are sent in reverse order, and the caller is
+// answered with an error whose details hold the outcome: the status of a failed step which
+// rejected the request as the caller's fault (4xx), 502 Bad Gateway if none did.
+func RunSaga(w http.ResponseWriter, r *http.Request, saga Saga, token string) {
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+	middlewares := ProxyMiddlewaresFactory("JSON", token)
+	for _, requestMiddleware := range middlewares.RequestMiddlewares {
+		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Nothing is cached, so the stages after the cache lookup always run
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	limit := middleware.MaxBodySize(r)
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		middlewares.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	if int64(len(body)) > limit {
+		middleware.WriteTooLarge(w, r, limit)
+		return
+	}
+	var fields map[string]json.RawMessage
+	for _, step := range saga.Steps {
+		if step.BodyField != "" && fields == nil {
+			if json.Unmarshal(body, &fields) != nil || fields == nil {
+				apierror.Write(w, r, http.StatusBadRequest, "The body must be a JSON object", nil)
+				return
+			}
+		}
+	}
+
+	steps := saga.Steps
+	outcome := SagaOutcome{Outcome: SagaCommitted, Steps: make([]StepOutcome, len(steps))}
+	errs := make([]error, len(steps))
+	vars := mux.Vars(r)
+
+	parallelism := saga.MaxParallelism
+	if saga.Sequential {
+		parallelism = 1
+	}
+	if parallelism <= 0 || parallelism > len(steps) {
+		parallelism = len(steps)
+	}
+	slots := make(chan struct{}, parallelism)
+	var failedMutex sync.Mutex
+	failed := false
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		outcome.Steps[i] = StepOutcome{Name: step.Name, Status: StepSkipped}
+		slots <- struct{}{}
+		failedMutex.Lock()
+		stop := failed
+		failedMutex.Unlock()
+		// Steps not sent yet are skipped once one failed, as they would only be undone
+		if stop {
+			<-slots
+			continue
+		}
+		wg.Add(1)
+		go func(i int, step SagaStep) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			stepBody := body
+			if step.BodyField != "" {
+				stepBody = []byte(fields[step.BodyField])
+				if len(stepBody) == 0 {
+					stepBody = []byte("null")
+				}
+			}
+			method := step.Method
+			if method == "" {
+				method = http.MethodPost
+			}
+			response, err := callBackend(r, method, expandURL(step.URL, vars), stepBody)
+			// The write was made even if its response can not be reported, e.g. 201 Created without a body
+			if err == nil && !json.Valid(response) {
+				response = nil
+			}
+			if err != nil {
+				errs[i] = err
+				failedMutex.Lock()
+				failed = true
+				failedMutex.Unlock()
+				return
+			}
+			outcome.Steps[i].Status = StepSucceeded
+			outcome.Steps[i].Response = response
+		}(i, step)
+	}
+	wg.Wait()
+
+	if !failed {
+		metrics.Sagas.Inc(SagaCommitted)
+		var document bytes.Buffer
+		json.NewEncoder(&document).Encode(outcome)
+		w.Header().Set("Content-Type", "application/json")
+		respond(w, r, http.StatusOK, document.Bytes(), middlewares, tracker)
+		return
+	}
+
+	status := http.StatusBadGateway
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		logger.LogForRequest(logger.ERR, r, "Saga step "+steps[i].Name+" to "+steps[i].URL+" failed: "+err.Error())
+		// The cause is logged rather than returned, as it may describe the backend's internals
+		callError := &CallError{Message: "backend unavailable"}
+		if backendStatus, ok := err.(backendStatusError); ok {
+			callError.Status = int(backendStatus)
+			callError.Message = "backend responded with " + http.StatusText(int(backendStatus))
+			if status == http.StatusBadGateway && backendStatus >= 400 && backendStatus < 500 {
+				status = int(backendStatus)
+			}
+		}
+		outcome.Steps[i].Status = StepFailed
+		outcome.Steps[i].Error = callError
+	}
+
+	outcome.Outcome = SagaCompensated
+	for i := len(steps) - 1; i >= 0; i-- {
+		if outcome.Steps[i].Status != StepSucceeded || steps[i].Compensation == nil {
+			continue
+		}
+		if err := compensate(r, saga, steps[i], outcome.Steps[i].Response, vars); err != nil {
+			logger.LogForRequest(logger.ERR, r, "Could not compensate saga step "+steps[i].Name+": "+err.Error())
+			outcome.Steps[i].Status = StepCompensationFailed
+			outcome.Outcome = SagaCompensationFailed
+			continue
+		}
+		outcome.Steps[i].Status = StepCompensated
+	}
+	// Responses of undone writes describe resources which no longer exist
+	for i := range outcome.Steps {
+		if outcome.Steps[i].Status != StepSucceeded {
+			outcome.Steps[i].Response = nil
+		}
+	}
+
+	metrics.Sagas.Inc(outcome.Outcome)
+	message := "A backend write failed, the writes which succeeded were undone"
+	if outcome.Outcome == SagaCompensationFailed {
+		message = "A backend write failed and the writes which succeeded could not all be undone"
+	}
+	apierror.Write(w, r, status, message, map[string]interface{}{"outcome": outcome.Outcome, "steps": outcome.Steps})
+}
+
+// compensate sends the compensation of a step which succeeded with response, until it succeeds or the attempts run out
+func compensate(r *http.Request, saga Saga, step SagaStep, response json.RawMessage, vars map[string]string) error {
+	method := step.Compensation.Method
+	if method == "" {
+		method = http.MethodDelete
+	}
+	url := expandResponseFields(expandURL(step.Compensation.URL, vars), response)
+	var body []byte
+	if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		body = response
+	}
+	attempts := saga.CompensationAttempts
+	if attempts <= 0 {
+		attempts = DefaultCompensationAttempts
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if _, err = callBackend(r, method, url, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// expandResponseFields replaces the {name} placeholders of url with the escaped fields of a JSON response
+func expandResponseFields(url string, response json.RawMessage) string {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	if decoder.Decode(&fields) != nil {
+		return url
+	}
+	return responseField.ReplaceAllStringFunc(url, func(placeholder string) string {
+		switch value := fields[placeholder[1:len(placeholder)-1]].(type) {
+		case string:
+			return neturl.PathEscape(value)
+		case json.Number:
+			return value.String()
+		case bool:
+			return fmt.Sprint(value)
+		}
+		return placeholder
+	})
+}
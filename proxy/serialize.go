@@ -0,0 +1,95 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/services"
+)
+
+// writeQueue holds the writes to one resource waiting for the write in flight, in the order they arrived
+type writeQueue struct {
+	waiting []chan struct{}
+}
+
+var writeQueuesMutex sync.Mutex
+var writeQueues = map[string]*writeQueue{}
+
+// isWrite reports if the method of a request modifies the resource
+func isWrite(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// serializeWrite waits until the writes to the same resource which arrived before r have been forwarded
+//
+// The returned release must be called once the backend has responded. ok is false if the
+// caller went away while waiting.
+func serializeWrite(r *http.Request) (release func(), ok bool) {
+	route, routed := services.RouteFromContext(r.Context())
+	if !routed || route.SerializeWritesBy == "" || !isWrite(r.Method) {
+		return func() {}, true
+	}
+	resource, exists := mux.Vars(r)[route.SerializeWritesBy]
+	if !exists {
+		return func() {}, true
+	}
+	key := route.Name + "\n" + resource
+
+	writeQueuesMutex.Lock()
+	queue, busy := writeQueues[key]
+	if !busy {
+		writeQueues[key] = &writeQueue{}
+		writeQueuesMutex.Unlock()
+		return func() { releaseWrite(key) }, true
+	}
+	turn := make(chan struct{})
+	queue.waiting = append(queue.waiting, turn)
+	writeQueuesMutex.Unlock()
+
+	select {
+	case <-turn:
+		return func() { releaseWrite(key) }, true
+	case <-r.Context().Done():
+		writeQueuesMutex.Lock()
+		handedOver := true
+		for i, waiting := range queue.waiting {
+			if waiting == turn {
+				queue.waiting = append(queue.waiting[:i], queue.waiting[i+1:]...)
+				handedOver = false
+				break
+			}
+		}
+		writeQueuesMutex.Unlock()
+		// A turn handed over as the caller went away is passed on
+		if handedOver {
+			releaseWrite(key)
+		}
+		return nil, false
+	}
+}
+
+// releaseWrite hands the resource over to the next write waiting for it
+func releaseWrite(key string) {
+	writeQueuesMutex.Lock()
+	defer writeQueuesMutex.Unlock()
+	queue := writeQueues[key]
+	if len(queue.waiting) == 0 {
+		delete(writeQueues, key)
+		return
+	}
+	next := queue.waiting[0]
+	queue.waiting = queue.waiting[1:]
+	close(next)
+}
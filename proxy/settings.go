@@ -12,6 +12,8 @@ package proxy
 
 import (
 	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
 )
 
 // AccessControlPolicy is the default Access control policy
@@ -20,7 +22,7 @@ var AccessControlPolicy = "*"
 // ProxyMiddlewares is the default error handler and middlewares to use when proxying a request
 var ProxyMiddlewares = MiddlewareSet{
 	ErrorHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(500)
+		apierror.Write(w, r, http.StatusInternalServerError, "", nil)
 	}),
 	RequestMiddlewares: nil,
 	ResponseMiddlewares: nil,
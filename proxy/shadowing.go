@@ -0,0 +1,127 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/random"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Shadow mirrors a sample of a backend's requests to another backend, discarding its responses
+type Shadow struct {
+	//Backend is the URL requests are mirrored to (e.g. "http://localhost:9000"), keeping their path and query
+	Backend string
+	//Rate is the fraction of requests mirrored, from 0 to 1
+	Rate float64
+	//Methods are the methods mirrored, all if empty
+	//
+	//Mirroring a request which is not idempotent repeats its side effects on the shadow backend's data.
+	Methods []string
+}
+
+// BackendShadows are the backends requests are mirrored to, keyed by the host of the backend they are proxied to
+var BackendShadows = map[string]Shadow{}
+
+// ShadowConcurrency is the most mirrored requests in flight, others are dropped so shadowing never builds up
+var ShadowConcurrency int32 = 64
+
+// ShadowHeader marks mirrored requests, so shadow backends can tell them apart
+const ShadowHeader = "X-Arbor-Shadow"
+
+var shadowsInFlight int32
+
+// mirror sends a copy of the caller's request r for url to the backend's shadow, if it has one and the request is sampled
+//
+// The copy is sent in the background, and the shadow's response or failure never reaches the caller.
+// The requests of protected routes are never mirrored.
+func mirror(r *http.Request, url string, body []byte) {
+	if services.Protected(r.Context()) {
+		return
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return
+	}
+	shadow, exists := BackendShadows[u.Host]
+	if !exists || (len(shadow.Methods) > 0 && !contains(r.Method, shadow.Methods)) || !random.Sample(shadow.Rate) {
+		return
+	}
+	base, err := neturl.Parse(shadow.Backend)
+	if err != nil {
+		logger.LogForRequest(logger.ERR, r, "Invalid shadow backend "+shadow.Backend+": "+err.Error())
+		return
+	}
+	if atomic.AddInt32(&shadowsInFlight, 1) > ShadowConcurrency {
+		atomic.AddInt32(&shadowsInFlight, -1)
+		metrics.ShadowRequests.Inc(base.Host, "dropped")
+		return
+	}
+
+	req, err := shadowCopy(r, rebase(u, base), body)
+	if err != nil {
+		atomic.AddInt32(&shadowsInFlight, -1)
+		metrics.ShadowRequests.Inc(base.Host, "failed")
+		return
+	}
+
+	go func() {
+		defer atomic.AddInt32(&shadowsInFlight, -1)
+		resp, err := shadowClient().Do(req)
+		if err != nil {
+			logger.LogForRequest(logger.DEBUG, r, "Shadow request to "+base.Host+" failed: "+err.Error())
+			metrics.ShadowRequests.Inc(base.Host, "failed")
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		metrics.ShadowRequests.Inc(base.Host, "sent")
+	}()
+}
+
+// shadowCopy copies the caller's request r to be sent to url in the background, marked with ShadowHeader
+func shadowCopy(r *http.Request, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(r.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range r.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	req.Header.Del(DebugRouteHeader)
+	req.Header.Set(ShadowHeader, "true")
+	if !setCredentials(r, req) {
+		return nil, errors.New("could not authenticate to " + req.URL.Host)
+	}
+	return req, nil
+}
+
+// shadowClient sends the copies of requests, without following redirects
+func shadowClient() *http.Client {
+	return &http.Client{
+		Transport: transport(),
+		Timeout:   time.Duration(constants.Timeout) * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,117 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// errSLAExceeded is returned for requests the backend did not start responding to within the route's SLA
+var errSLAExceeded = errors.New("backend did not respond within the route's latency SLA")
+
+// cancelOnClose releases the context of a request once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// sendWithinSLA sends req, aborting it if the backend has not sent its response headers within the route's SLA
+//
+// Only the wait for the headers is bounded, the body may take as long as the client's timeout allows.
+func sendWithinSLA(client *http.Client, req *http.Request, r *http.Request) (*http.Response, error) {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok || route.SLA == nil || route.SLA.Timeout <= 0 {
+		return send(client, req, r)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	var exceeded int32
+	responded := make(chan struct{})
+	go func() {
+		select {
+		case <-clock.After(route.SLA.Timeout):
+			atomic.StoreInt32(&exceeded, 1)
+			cancel()
+		case <-responded:
+		}
+	}()
+	resp, err := send(client, req.WithContext(ctx), r)
+	close(responded)
+
+	if atomic.LoadInt32(&exceeded) == 1 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errSLAExceeded
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryWithinSLA retries a request which exceeded its route's SLA on another instance of its backend, if the route allows it
+//
+// The returned done must be called once the response has been read. If the retry is shed, a response has
+// already been written to the caller.
+func retryWithinSLA(w http.ResponseWriter, r *http.Request, client *http.Client, url string, failedURL string, body []byte) (resp *http.Response, done func(), err error) {
+	done = func() {}
+	route, _ := services.RouteFromContext(r.Context())
+	if !route.SLA.Retry {
+		metrics.SLABreaches.IncFor(r, "aborted")
+		return nil, done, errSLAExceeded
+	}
+	retryURL, finished, ok := balanceAgain(r, url, failedURL)
+	if !ok {
+		metrics.SLABreaches.IncFor(r, "aborted")
+		return nil, done, errSLAExceeded
+	}
+	metrics.SLABreaches.IncFor(r, "retried")
+	logger.LogForRequest(logger.WARN, r, "Backend did not respond within the route's SLA, retrying on "+retryURL)
+
+	req, ok := backendRequest(r, retryURL, body)
+	if !ok {
+		finished()
+		return nil, done, errors.New("could not create the retried request")
+	}
+	release, ok := acquireBackend(w, r, retryURL)
+	if !ok {
+		finished()
+		return nil, done, errors.New("retried request was shed")
+	}
+	done = func() {
+		release()
+		finished()
+	}
+	resp, err = sendWithinSLA(client, req, r)
+	if err == errSLAExceeded {
+		metrics.SLABreaches.IncFor(r, "aborted")
+	}
+	return resp, done, err
+}
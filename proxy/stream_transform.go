@@ -0,0 +1,247 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/requestid"
+)
+
+// StreamEvent is an event of a streamed response, a line of NDJSON or a Server-Sent Event
+type StreamEvent struct {
+	//ID and Type are the event's id and event fields, empty for NDJSON
+	ID   string
+	Type string
+	//Data is the line of NDJSON or the event's data
+	Data []byte
+}
+
+// StreamTransform maps an event of a streamed response as it arrives, returning false to drop it
+type StreamTransform func(r *http.Request, event StreamEvent) (StreamEvent, bool)
+
+// StreamTransformation proxies a backend's NDJSON or Server-Sent Events stream, transforming each event as it arrives
+//
+// Events are sent to the caller one at a time, so the stream is never buffered whole.
+// Responses which are not streams, errors included, are proxied unchanged.
+type StreamTransformation struct {
+	//URL is the backend's stream, the route's variables replace its {name} placeholders
+	URL string
+	//Transforms are applied to each event in order, until one drops it
+	Transforms []StreamTransform
+}
+
+// FilterJSON keeps the events whose data is a JSON object keep accepts
+//
+// Events whose data is not a JSON object are dropped.
+func FilterJSON(keep func(r *http.Request, data map[string]interface{}) bool) StreamTransform {
+	return func(r *http.Request, event StreamEvent) (StreamEvent, bool) {
+		var data map[string]interface{}
+		if err := json.Unmarshal(event.Data, &data); err != nil || data == nil {
+			return event, false
+		}
+		return event, keep(r, data)
+	}
+}
+
+// MapJSON replaces the data of each event with what mapping returns for its JSON object, e.g. to redact or enrich it
+//
+// Events whose data is not a JSON object, or which mapping returns nil for, are dropped,
+// so a redaction never lets through an event it could not read.
+func MapJSON(mapping func(r *http.Request, data map[string]interface{}) map[string]interface{}) StreamTransform {
+	return func(r *http.Request, event StreamEvent) (StreamEvent, bool) {
+		var data map[string]interface{}
+		if err := json.Unmarshal(event.Data, &data); err != nil || data == nil {
+			return event, false
+		}
+		mapped := mapping(r, data)
+		if mapped == nil {
+			return event, false
+		}
+		var err error
+		event.Data, err = json.Marshal(mapped)
+		return event, err == nil
+	}
+}
+
+// TransformStream proxies the backend stream of the transformation, passing token (optional) to the backend
+func TransformStream(w http.ResponseWriter, r *http.Request, transformation StreamTransformation, token string) {
+	r, _ = requestid.Ensure(r)
+	r = withPipeline(r)
+	tracker := &responseTracker{ResponseWriter: w}
+	w = tracker
+	middlewares := ProxyMiddlewaresFactory("RAW", token)
+	for _, requestMiddleware := range middlewares.RequestMiddlewares {
+		requestMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Streams are never cached, so the stages after the cache lookup always run
+	if !cacheMissed(w, r) {
+		return
+	}
+
+	limit := middleware.MaxBodySize(r)
+	requestBody, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		middlewares.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	if int64(len(requestBody)) > limit {
+		middleware.WriteTooLarge(w, r, limit)
+		return
+	}
+
+	url := expandURL(transformation.URL, mux.Vars(r))
+	observeBackend(r, url)
+	req, ok := backendRequest(r, url, requestBody)
+	if !ok {
+		middlewares.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	// Events are read here, so the transport negotiates the encoding rather than the caller
+	req.Header.Del("Accept-Encoding")
+	// The stream lasts as long as the backend sends it, so only the caller leaving cuts it short
+	client := &http.Client{
+		Transport: transport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req.WithContext(r.Context()))
+	if err != nil {
+		middlewares.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	defer resp.Body.Close()
+
+	var stream eventStream
+	var format func(StreamEvent) []byte
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode == http.StatusOK {
+		switch mediaType {
+		case "text/event-stream":
+			stream = &serverSentEventStream{body: resp.Body, reader: bufio.NewReader(resp.Body), cancel: func() {}}
+			format = formatServerSentEvent
+		case "application/x-ndjson", "application/jsonl":
+			stream = jsonLinesStream{bufio.NewReader(resp.Body)}
+			format = func(event StreamEvent) []byte {
+				return append(event.Data, '\n')
+			}
+		}
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	if stream == nil {
+		responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, constants.MaxFileUploadSize))
+		if err != nil {
+			middlewares.ErrorHandler.ServeHTTP(w, r)
+			return
+		}
+		respond(w, r, resp.StatusCode, responseBody, middlewares, tracker)
+		return
+	}
+
+	for _, responseMiddleware := range middlewares.ResponseMiddlewares {
+		responseMiddleware.ServeHTTP(w, r)
+		if tracker.responded {
+			return
+		}
+	}
+	// Transformed events have other lengths and digests than the backend's
+	w.Header().Del("Content-Length")
+	w.Header().Del("Digest")
+	w.Header().Del("Content-Digest")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		id, eventType, data, err := stream.Next()
+		if err != nil {
+			if err != io.EOF && r.Context().Err() == nil {
+				logger.LogForRequest(logger.WARN, r, "Stream from "+url+" failed: "+err.Error())
+			}
+			return
+		}
+		event, keep := StreamEvent{ID: id, Type: eventType, Data: []byte(data)}, true
+		for _, transform := range transformation.Transforms {
+			if event, keep = transform(r, event); !keep {
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+		if _, err := w.Write(format(event)); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// formatServerSentEvent writes an event in the text/event-stream format
+func formatServerSentEvent(event StreamEvent) []byte {
+	var b bytes.Buffer
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Type != "" {
+		b.WriteString("event: " + event.Type + "\n")
+	}
+	for _, line := range strings.Split(string(event.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// jsonLinesStream reads the lines of an NDJSON response as events
+type jsonLinesStream struct {
+	reader *bufio.Reader
+}
+
+func (s jsonLinesStream) Next() (string, string, string, error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		// The last line may end without a newline
+		if line != "" {
+			return "", "", line, nil
+		}
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+}
+
+func (s jsonLinesStream) Close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// Actions arbor takes when a backend responds 429 Too Many Requests
+const (
+	//SurfaceThrottling passes the response, with its Retry-After, to the caller
+	SurfaceThrottling = "surface"
+	//RetryThrottled waits for the Retry-After interval and sends the request once more
+	RetryThrottled = "retry"
+	//PauseThrottled surfaces the response and sends no more requests to the backend for the Retry-After interval
+	PauseThrottled = "pause"
+)
+
+// DefaultThrottlingMaxWait is the longest Retry-After interval honoured for backends whose Throttling does not say
+const DefaultThrottlingMaxWait = 10 * time.Second
+
+// Throttling is how arbor handles a backend's 429 Too Many Requests responses
+type Throttling struct {
+	//Action is SurfaceThrottling (the default), RetryThrottled or PauseThrottled
+	Action string
+	//MaxWait bounds the Retry-After interval, longer intervals are surfaced rather than retried and pauses are cut to it
+	MaxWait time.Duration
+}
+
+// BackendThrottling is how each backend's 429 Too Many Requests responses are handled, keyed by host (e.g. "localhost:8000")
+//
+// Paused instances of a pool are skipped, while requests to other paused backends are
+// rerouted to their fallback or rejected with 429 Too Many Requests.
+var BackendThrottling = map[string]Throttling{}
+
+var pausedMutex sync.Mutex
+var pausedUntil = map[string]time.Time{}
+
+// paused returns how much longer the backend at host is paused for, zero if it is not
+func paused(host string) time.Duration {
+	pausedMutex.Lock()
+	defer pausedMutex.Unlock()
+	until, ok := pausedUntil[host]
+	if !ok {
+		return 0
+	}
+	remaining := until.Sub(clock.Now())
+	if remaining <= 0 {
+		delete(pausedUntil, host)
+		return 0
+	}
+	return remaining
+}
+
+func pause(host string, d time.Duration) {
+	pausedMutex.Lock()
+	defer pausedMutex.Unlock()
+	until := clock.Now().Add(d)
+	if until.After(pausedUntil[host]) {
+		pausedUntil[host] = until
+	}
+}
+
+// retryAfter parses the delay-seconds or HTTP-date of a Retry-After header, false if it has none
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(clock.Now()); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// throttled handles a backend's 429 Too Many Requests response to req as the backend's Throttling says
+//
+// The response returned replaces resp, it is the response to the retried request if there was one.
+func throttled(r *http.Request, client *http.Client, req *http.Request, url string, body []byte, resp *http.Response) *http.Response {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return resp
+	}
+	throttling, ok := BackendThrottling[req.URL.Host]
+	if !ok || throttling.Action == "" || throttling.Action == SurfaceThrottling {
+		return resp
+	}
+	wait, ok := retryAfter(resp.Header)
+	if !ok {
+		return resp
+	}
+	maxWait := throttling.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultThrottlingMaxWait
+	}
+
+	switch throttling.Action {
+	case PauseThrottled:
+		if wait > maxWait {
+			wait = maxWait
+		}
+		logger.LogForRequest(logger.WARN, r, "Backend "+req.URL.Host+" is throttling requests, pausing it for "+wait.String())
+		metrics.BackendThrottling.Inc(req.URL.Host, "paused")
+		pause(req.URL.Host, wait)
+		return resp
+	case RetryThrottled:
+		if wait > maxWait {
+			metrics.BackendThrottling.Inc(req.URL.Host, "surfaced")
+			return resp
+		}
+		select {
+		case <-clock.After(wait):
+		case <-r.Context().Done():
+			return resp
+		}
+		retry, ok := backendRequest(r, url, body)
+		if !ok {
+			return resp
+		}
+		logger.LogForRequest(logger.INFO, r, "Backend "+req.URL.Host+" throttled the request, retrying after "+wait.String())
+		metrics.BackendThrottling.Inc(req.URL.Host, "retried")
+		retried, err := send(client, retry.WithContext(r.Context()), r)
+		if err != nil {
+			return resp
+		}
+		resp.Body.Close()
+		return retried
+	}
+	return resp
+}
@@ -0,0 +1,165 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/arbor-dev/arbor/alerts"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Kinds of the links between backends in the topology
+const (
+	//InstanceLink links a pool to one of its instances
+	InstanceLink = "instance"
+	//SplitLink links a backend to the backend a header rule sends matching requests to
+	SplitLink = "split"
+	//FallbackLink links a backend to the backend requests are rerouted to while it is down
+	FallbackLink = "fallback"
+	//ShadowLink links a backend to the backend its requests are mirrored to
+	ShadowLink = "shadow"
+	//MigrationLink links a backend to the backend replacing it
+	MigrationLink = "migration"
+)
+
+// BackendLink is a link between two backends of the topology, e.g. a pool and one of its instances
+type BackendLink struct {
+	//From and To are the hosts of the backends (e.g. "localhost:8000")
+	From string `json:"from"`
+	To   string `json:"to"`
+	//Kind is InstanceLink, SplitLink, FallbackLink, ShadowLink or MigrationLink
+	Kind string `json:"kind"`
+	//Detail qualifies the link, e.g. the header a split matches on or the share of requests mirrored
+	Detail string `json:"detail,omitempty"`
+}
+
+var (
+	routeBackendsMutex sync.Mutex
+	routeBackends      = map[string]map[string]bool{}
+)
+
+// observeBackend records that the route serving the caller's request r sends requests to the backend at url
+//
+// Handlers name their backends in code, so the backends of a route are only known once it has sent them a request.
+func observeBackend(r *http.Request, url string) {
+	route, ok := services.RouteFromContext(r.Context())
+	if !ok {
+		return
+	}
+	u, err := neturl.Parse(url)
+	if err != nil || u.Host == "" {
+		return
+	}
+	alerts.ObserveBackend(route.Name, u.Host)
+	routeBackendsMutex.Lock()
+	defer routeBackendsMutex.Unlock()
+	if routeBackends[route.Name] == nil {
+		routeBackends[route.Name] = map[string]bool{}
+	}
+	routeBackends[route.Name][u.Host] = true
+}
+
+// RouteBackends returns the hosts of the backends each route has sent requests to, keyed by route name
+func RouteBackends() map[string][]string {
+	routeBackendsMutex.Lock()
+	defer routeBackendsMutex.Unlock()
+	backends := make(map[string][]string, len(routeBackends))
+	for route, hosts := range routeBackends {
+		for host := range hosts {
+			backends[route] = append(backends[route], host)
+		}
+		sort.Strings(backends[route])
+	}
+	return backends
+}
+
+// BackendLinks returns the links between backends configured by pools, header rules, fallbacks, shadows and migrations
+func BackendLinks() []BackendLink {
+	var links []BackendLink
+	for host, pool := range BackendPools {
+		for _, instance := range pool.instances() {
+			detail := ""
+			if pool.Policy == Weighted {
+				weight := instance.Weight
+				if weight <= 0 {
+					weight = 1
+				}
+				detail = "weight " + strconv.Itoa(weight)
+			}
+			links = append(links, BackendLink{From: host, To: urlHost(instance.URL), Kind: InstanceLink, Detail: detail})
+		}
+	}
+	for host, rules := range BackendHeaderRules {
+		for _, rule := range rules {
+			detail := rule.Header
+			if rule.Value != "" {
+				detail += ": " + rule.Value
+			}
+			links = append(links, BackendLink{From: host, To: urlHost(rule.Backend), Kind: SplitLink, Detail: detail})
+		}
+	}
+	for host, fallback := range BackendFallbacks {
+		links = append(links, BackendLink{From: host, To: urlHost(fallback), Kind: FallbackLink})
+	}
+	for host, shadow := range BackendShadows {
+		detail := strconv.FormatFloat(shadow.Rate*100, 'f', -1, 64) + "%"
+		links = append(links, BackendLink{From: host, To: urlHost(shadow.Backend), Kind: ShadowLink, Detail: detail})
+	}
+	for _, status := range Migrations() {
+		detail := ""
+		if status.Promoted {
+			detail = "promoted"
+		}
+		links = append(links, BackendLink{From: status.Backend, To: urlHost(status.Target), Kind: MigrationLink, Detail: detail})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].From != links[j].From {
+			return links[i].From < links[j].From
+		}
+		if links[i].Kind != links[j].Kind {
+			return links[i].Kind < links[j].Kind
+		}
+		return links[i].To < links[j].To
+	})
+	return links
+}
+
+// RouteStages returns the names of the stages the requests of route pass through, in order
+func RouteStages(route services.Route) []string {
+	if route.Pipeline != nil {
+		return append([]string(nil), route.Pipeline...)
+	}
+	var names []string
+	for _, m := range Chain() {
+		if route.Middlewares == nil || !contains(m.Name, route.Middlewares.Skip) {
+			names = append(names, m.Name)
+		}
+	}
+	if route.Middlewares != nil {
+		for _, m := range route.Middlewares.Use {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+func urlHost(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil || u.Host == "" {
+		return url
+	}
+	return u.Host
+}
@@ -0,0 +1,263 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/spiffe"
+)
+
+// Transport carries requests to backends, nil uses a transport created by NewTransport
+//
+// Programs which replaced http.DefaultTransport (e.g. with a mock) keep having it used when Transport is nil.
+//
+// Warm connections are kept in its idle pool, so it should allow at least
+// PrewarmConnections idle connections per host (see NewTransport).
+var Transport http.RoundTripper
+
+// stockTransport is http.DefaultTransport as the standard library set it
+var stockTransport = http.DefaultTransport
+
+var (
+	defaultTransportMutex sync.Mutex
+	defaultTransport      *http.Transport
+	defaultSettings       transportSettings
+)
+
+// transportSettings are the settings the default transport was created with
+type transportSettings struct {
+	minVersion       uint16
+	cipherSuites     string
+	sessionCacheSize int
+	identity         *spiffe.Source
+	maxIdlePerHost   int
+}
+
+func currentTransportSettings() transportSettings {
+	return transportSettings{
+		minVersion:       BackendTLSMinVersion,
+		cipherSuites:     fmt.Sprint(BackendTLSCipherSuites),
+		sessionCacheSize: BackendTLSSessionCacheSize,
+		identity:         WorkloadIdentity,
+		maxIdlePerHost:   maxIdlePerHost(),
+	}
+}
+
+// maxIdlePerHost is the number of idle connections the default transport keeps to each backend,
+// enough for the warm connections
+func maxIdlePerHost() int {
+	if PrewarmConnections > http.DefaultMaxIdleConnsPerHost {
+		return PrewarmConnections
+	}
+	return http.DefaultMaxIdleConnsPerHost
+}
+
+// NewTransport creates a transport suited to proxying, which keeps maxIdlePerHost idle connections to each backend
+// and connects with BackendTLSConfig, so reconnecting to a backend can resume its TLS session
+func NewTransport(maxIdlePerHost int) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          1024,
+		MaxIdleConnsPerHost:   maxIdlePerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       BackendTLSConfig(),
+	}
+}
+
+// BackendTLSMinVersion is the oldest TLS version arbor accepts from backends
+var BackendTLSMinVersion uint16 = tls.VersionTLS12
+
+// BackendTLSCipherSuites are the cipher suites offered to backends for TLS 1.2, nil uses Go's defaults
+var BackendTLSCipherSuites []uint16
+
+// BackendTLSSessionCacheSize is the number of backend TLS sessions kept for resumption, 0 uses the default size and -1 disables resumption
+var BackendTLSSessionCacheSize = 0
+
+// BackendTLSConfig creates the TLS configuration used by NewTransport to connect to backends
+func BackendTLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:   BackendTLSMinVersion,
+		CipherSuites: BackendTLSCipherSuites,
+	}
+	if BackendTLSSessionCacheSize >= 0 {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(BackendTLSSessionCacheSize)
+	}
+	if WorkloadIdentity != nil {
+		config.GetClientCertificate = WorkloadIdentity.GetClientCertificate
+		// Backends are verified by SPIFFE ID against the trust bundle rather than by host name
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = WorkloadIdentity.VerifyConnection(authorizeBackend)
+	}
+	return config
+}
+
+// WorkloadIdentity is arbor's SPIFFE identity, when set backends are connected to with mutual TLS using SVIDs
+var WorkloadIdentity *spiffe.Source
+
+// BackendSPIFFEIDs are the SPIFFE IDs each backend may present, keyed by host name without a port
+//
+// Backends which are not listed may present any ID in arbor's trust domain.
+var BackendSPIFFEIDs = map[string][]string{}
+
+// authorizeBackend checks a backend presented a SPIFFE ID it is allowed to
+func authorizeBackend(state tls.ConnectionState, id spiffe.ID) error {
+	allowed, listed := BackendSPIFFEIDs[state.ServerName]
+	if !listed {
+		own, err := WorkloadIdentity.ID()
+		if err != nil {
+			return err
+		}
+		if id.TrustDomain != own.TrustDomain {
+			return fmt.Errorf("backend %s presented %s from a foreign trust domain", state.ServerName, id)
+		}
+		return nil
+	}
+	for _, allowedID := range allowed {
+		if id.String() == allowedID {
+			return nil
+		}
+	}
+	return fmt.Errorf("backend %s presented unexpected SPIFFE ID %s", state.ServerName, id)
+}
+
+// transport is the transport requests to backends are sent with, recording their latency per backend
+func transport() http.RoundTripper {
+	return measuredTransport{baseTransport()}
+}
+
+// baseTransport is Transport, or the default transport when it is nil
+//
+// The default transport is created on first use and again when the backend TLS settings or
+// PrewarmConnections change.
+func baseTransport() http.RoundTripper {
+	if Transport != nil {
+		return Transport
+	}
+	if http.DefaultTransport != stockTransport {
+		return http.DefaultTransport
+	}
+	defaultTransportMutex.Lock()
+	defer defaultTransportMutex.Unlock()
+	settings := currentTransportSettings()
+	if defaultTransport == nil || settings != defaultSettings {
+		if defaultTransport != nil {
+			defaultTransport.CloseIdleConnections()
+		}
+		defaultTransport = NewTransport(settings.maxIdlePerHost)
+		defaultSettings = settings
+	}
+	return defaultTransport
+}
+
+// measuredTransport records the time each backend takes to respond in metrics.UpstreamDuration
+type measuredTransport struct {
+	http.RoundTripper
+}
+
+func (t measuredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := clock.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.UpstreamDuration.Observe(clock.Since(start).Seconds(), req.URL.Host, req.Method, code)
+	return resp, err
+}
+
+// PrewarmBackends are the base URLs of the backends to keep warm connections to (e.g. "http://localhost:8000")
+var PrewarmBackends []string
+
+// PrewarmConnections is the number of warm connections kept to each of PrewarmBackends
+var PrewarmConnections = 0
+
+// PrewarmInterval is how often connections are rewarmed so they do not idle out, 0 only warms them once
+var PrewarmInterval = time.Duration(0)
+
+// Prewarm opens PrewarmConnections connections to each of PrewarmBackends, leaving them idle in Transport
+//
+// Call it again after changing the backends to warm the new ones.
+func Prewarm() {
+	if PrewarmConnections <= 0 {
+		return
+	}
+	// Warming connections is not load of the backends, so it is not measured
+	client := &http.Client{
+		Transport: baseTransport(),
+		Timeout:   time.Duration(constants.Timeout) * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var wg sync.WaitGroup
+	for _, backend := range PrewarmBackends {
+		// Concurrent requests each need their own connection
+		for i := 0; i < PrewarmConnections; i++ {
+			wg.Add(1)
+			go func(backend string) {
+				defer wg.Done()
+				resp, err := client.Head(backend)
+				if err != nil {
+					logger.Log(logger.WARN, "Could not prewarm connection to "+backend+": "+err.Error())
+					return
+				}
+				// The connection is only reused once the body has been read
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}(backend)
+		}
+	}
+	wg.Wait()
+}
+
+// StartPrewarming warms connections now and then every PrewarmInterval until stop is called
+func StartPrewarming() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		Prewarm()
+		if PrewarmInterval <= 0 {
+			return
+		}
+		ticker := clock.NewTicker(PrewarmInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				Prewarm()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
@@ -0,0 +1,100 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package proxy
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arbor-dev/arbor/xmljson"
+)
+
+// wantsXML reports whether the caller prefers XML to JSON by their Accept header, to pass XML services' responses through
+func wantsXML(r *http.Request) bool {
+	xmlQ, jsonQ := 0.0, 0.0
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+			switch {
+			case xmljson.IsXML(mediaType) && q > xmlQ:
+				xmlQ = q
+			case (mediaType == "application/json" || mediaType == "*/*" || mediaType == "application/*") && q > jsonQ:
+				jsonQ = q
+			}
+		}
+	}
+	return xmlQ > jsonQ
+}
+
+// translateRequestBody translates the caller's JSON body to XML for an XML service, XML bodies are sent as they are
+//
+// The bodies of PROTOBUF services are transcoded instead, see transcodeRequestBody, and those of
+// MSGPACK and CBOR services translated by their binaryFormat.
+func translateRequestBody(r *http.Request, format string, body []byte) ([]byte, bool) {
+	if format == "PROTOBUF" {
+		return transcodeRequestBody(r, body)
+	}
+	if binary, ok := binaryFormats[format]; ok {
+		return binary.translateRequestBody(r, body)
+	}
+	if format != "XML" || len(body) == 0 || xmljson.IsXML(r.Header.Get("Content-Type")) {
+		return body, true
+	}
+	translated, err := xmljson.FromJSON(body)
+	if err != nil {
+		return nil, false
+	}
+	r.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	return translated, true
+}
+
+// translateResponseBody translates an XML service's response to JSON, unless the caller asked for XML
+//
+// The responses of PROTOBUF services are transcoded instead, see transcodeResponseBody, and those of
+// MSGPACK and CBOR services translated by their binaryFormat.
+func translateResponseBody(header http.Header, r *http.Request, format string, body []byte) ([]byte, bool) {
+	if format == "PROTOBUF" {
+		return transcodeResponseBody(header, r, body)
+	}
+	if binary, ok := binaryFormats[format]; ok {
+		return binary.translateResponseBody(header, r, body)
+	}
+	if format != "XML" {
+		return body, true
+	}
+	header.Add("Vary", "Accept")
+	if len(body) == 0 || !xmljson.IsXML(header.Get("Content-Type")) || wantsXML(r) {
+		return body, true
+	}
+	// Compressed bodies can not be translated, callers get them as they are
+	if encoding := header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return body, true
+	}
+	translated, err := xmljson.ToJSON(body)
+	if err != nil {
+		return nil, false
+	}
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	weakenETag(header)
+	return translated, true
+}
@@ -0,0 +1,77 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package random is the source of randomness for arbor's backend selection, retry jitter and sampling
+//
+// It is not suitable for secrets. Tests seed it to make those decisions reproducible.
+package random
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var mutex sync.Mutex
+var source = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Seed makes the sequence of random values deterministic and returns a function restoring the previous source
+func Seed(seed int64) (restore func()) {
+	mutex.Lock()
+	previous := source
+	source = rand.New(rand.NewSource(seed))
+	mutex.Unlock()
+	return func() {
+		mutex.Lock()
+		source = previous
+		mutex.Unlock()
+	}
+}
+
+// Intn returns a random int in [0,n)
+func Intn(n int) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return source.Intn(n)
+}
+
+// Int63n returns a random int64 in [0,n)
+func Int63n(n int64) int64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return source.Int63n(n)
+}
+
+// Float64 returns a random float64 in [0.0,1.0)
+func Float64() float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return source.Float64()
+}
+
+// Sample reports if an event should be sampled at the given rate in [0.0,1.0]
+func Sample(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return Float64() < rate
+}
+
+// Jitter returns d adjusted by a random amount of up to fraction of d in either direction
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 || fraction <= 0 {
+		return d
+	}
+	spread := float64(d) * fraction
+	return d + time.Duration((Float64()*2-1)*spread)
+}
@@ -0,0 +1,138 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package ratelimit limits the rate clients may call routes at using token buckets
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	// Allowed is whether the request may proceed
+	Allowed bool
+	// Limit is the size of the bucket
+	Limit int
+	// Remaining is the number of requests left in the bucket
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a request will be allowed, if it was not
+	RetryAfter time.Duration
+}
+
+// Store holds the token buckets of all clients
+type Store interface {
+	// Take removes a token from the bucket for key, filled according to limit
+	Take(key string, limit services.RateLimit) (Result, error)
+}
+
+// KeyFunc identifies the client making a request
+type KeyFunc func(r *http.Request) string
+
+// DefaultLimit is the limit for routes without their own RateLimit, nil leaves them unlimited
+var DefaultLimit *services.RateLimit
+
+// Buckets is the store of token buckets, replace it with a RedisStore to share limits between replicas
+var Buckets Store = NewMemoryStore()
+
+// Key identifies the client a request is counted against
+var Key KeyFunc = ByClient
+
+// ByClientIP identifies clients by their IP address, resolved through clientip.TrustedProxies
+func ByClientIP(r *http.Request) string {
+	return "ip:" + clientip.Address(r)
+}
+
+// ByAPIKey identifies clients by the API key they were authorized with, falling back to their IP address
+//
+// Only verified keys are counted apart, so callers can not escape their limit by sending made up keys.
+func ByAPIKey(r *http.Request) string {
+	if key, ok := security.APIKeyFromContext(r.Context()); ok {
+		return "key:" + key.Hash
+	}
+	return ByClientIP(r)
+}
+
+// BySubject identifies clients by the subject of their verified token, falling back to their IP address
+func BySubject(r *http.Request) string {
+	if claims, ok := security.ClaimsFromContext(r.Context()); ok && claims.Subject() != "" {
+		return "sub:" + claims.Subject()
+	}
+	return ByClientIP(r)
+}
+
+// ByClient identifies clients by token subject, then API key, then IP address
+func ByClient(r *http.Request) string {
+	if claims, ok := security.ClaimsFromContext(r.Context()); ok && claims.Subject() != "" {
+		return "sub:" + claims.Subject()
+	}
+	return ByAPIKey(r)
+}
+
+// LimitFor returns the limit applying to a request, or nil if it is unlimited
+func LimitFor(r *http.Request) *services.RateLimit {
+	if route, ok := services.RouteFromContext(r.Context()); ok && route.RateLimit != nil {
+		return route.RateLimit
+	}
+	return DefaultLimit
+}
+
+// Take counts a request against its client's limit for the route
+//
+// Requests without a limit are always allowed with a zero Result.
+func Take(r *http.Request) (Result, error) {
+	limit := LimitFor(r)
+	if limit == nil || limit.Requests <= 0 || limit.Per <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	route, _ := services.RouteFromContext(r.Context())
+	return Buckets.Take(route.Name+"|"+Key(r), *limit)
+}
+
+// bucket parameters of a limit
+func burst(limit services.RateLimit) float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return float64(limit.Requests)
+}
+
+// tokens per nanosecond
+func rate(limit services.RateLimit) float64 {
+	return float64(limit.Requests) / float64(limit.Per)
+}
+
+// result describes a bucket holding tokens after a take
+func result(allowed bool, tokens float64, limit services.RateLimit) Result {
+	capacity := burst(limit)
+	res := Result{
+		Allowed:   allowed,
+		Limit:     int(capacity),
+		Remaining: int(tokens),
+		Reset:     until(capacity-tokens, limit),
+	}
+	if !allowed {
+		res.RetryAfter = until(1-tokens, limit)
+	}
+	return res
+}
+
+// until is the time taken to refill tokens, rounded to the millisecond
+func until(tokens float64, limit services.RateLimit) time.Duration {
+	return time.Duration(math.Round(tokens/rate(limit)/float64(time.Millisecond))) * time.Millisecond
+}
@@ -0,0 +1,132 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/redis"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// MemoryStore keeps token buckets in memory, limiting each replica separately
+type MemoryStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryStore creates an empty in memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// sweepInterval is how many takes pass between removing full buckets
+const sweepInterval = 1024
+
+// Take removes a token from the bucket for key
+func (s *MemoryStore) Take(key string, limit services.RateLimit) (Result, error) {
+	now := clock.Now()
+	capacity := burst(limit)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.takes++
+	if s.takes%sweepInterval == 0 {
+		for k, b := range s.buckets {
+			if !now.Before(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	b, exists := s.buckets[key]
+	if !exists {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.last))*rate(limit))
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(until(capacity-b.tokens, limit))
+	return result(allowed, b.tokens, limit), nil
+}
+
+// takeScript atomically refills and takes from a bucket stored as a hash
+const takeScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1]) or capacity
+local last = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+// RedisStore keeps token buckets in Redis so all replicas share the limits
+type RedisStore struct {
+	Client *redis.Client
+	//Prefix namespaces the buckets in Redis
+	Prefix string
+}
+
+// Take removes a token from the bucket for key
+func (s *RedisStore) Take(key string, limit services.RateLimit) (Result, error) {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "arbor:ratelimit:"
+	}
+	// Times are in milliseconds in Redis
+	perMillisecond := rate(limit) * float64(time.Millisecond)
+	now := clock.Now().UnixNano() / int64(time.Millisecond)
+	reply, err := s.Client.Do("EVAL", takeScript, "1", prefix+key,
+		strconv.FormatFloat(burst(limit), 'f', -1, 64),
+		strconv.FormatFloat(perMillisecond, 'g', -1, 64),
+		strconv.FormatInt(now, 10))
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tokensReply, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensReply, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(allowed == 1, tokens, limit), nil
+}
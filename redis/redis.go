@@ -0,0 +1,289 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package redis is a minimal Redis client used by arbor's shared stores
+//
+// It speaks the RESP protocol directly so arbor does not need a Redis dependency.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil is returned when a reply is the Redis nil value
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply from the server
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// DefaultTimeout bounds dialing and each command when the client does not specify
+const DefaultTimeout = 5 * time.Second
+
+// Client is a pool of connections to a Redis server
+type Client struct {
+	//Addr is the host:port of the server
+	Addr string
+	//Password authenticates the connection, if set
+	Password string
+	//DB is the database selected on connect
+	DB int
+	//Timeout bounds dialing and each command
+	Timeout time.Duration
+	//MaxIdle is the number of idle connections kept open
+	MaxIdle int
+
+	mutex sync.Mutex
+	idle  []*conn
+}
+
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *Client) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) get() (*conn, error) {
+	c.mutex.Lock()
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mutex.Unlock()
+		return cn, nil
+	}
+	c.mutex.Unlock()
+
+	nc, err := net.DialTimeout("tcp", c.Addr, c.timeout())
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, reader: bufio.NewReader(nc)}
+	if c.Password != "" {
+		if _, err = c.do(cn, "AUTH", c.Password); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	if c.DB != 0 {
+		if _, err = c.do(cn, "SELECT", strconv.Itoa(c.DB)); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) put(cn *conn) {
+	maxIdle := c.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = 4
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.idle) >= maxIdle {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// Do sends a command and returns its reply
+//
+// Replies are string, int64, []interface{} or nil; error replies are returned as Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(cn, args...)
+	if _, isReplyErr := err.(Error); err != nil && !isReplyErr {
+		// The connection is in an unknown state
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+func (c *Client) do(cn *conn, args ...string) (interface{}, error) {
+	cn.SetDeadline(time.Now().Add(c.timeout()))
+	_, err := cn.Write(encodeCommand(args))
+	if err != nil {
+		return nil, err
+	}
+	return readReply(cn.reader)
+}
+
+// Close closes the idle connections of the client
+func (c *Client) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+}
+
+func encodeCommand(args []string) []byte {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(len(arg)), 10)
+		b = append(b, "\r\n"...)
+		b = append(b, arg...)
+		b = append(b, "\r\n"...)
+	}
+	return b
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", payload)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: malformed array length %q", payload)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i], err = readReply(r)
+			if _, isReplyErr := err.(Error); err != nil && !isReplyErr {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// String sends a command expecting a string reply
+func (c *Client) String(args ...string) (string, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return "", err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return "", ErrNil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %T", reply)
+}
+
+// Int sends a command expecting an integer reply
+func (c *Client) Int(args ...string) (int64, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return 0, err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return 0, ErrNil
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %T", reply)
+}
+
+// Strings sends a command expecting an array of strings reply
+func (c *Client) Strings(args ...string) ([]string, error) {
+	reply, err := c.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T", reply)
+	}
+	strs := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs, nil
+}
+
+// Scan returns all keys matching pattern, iterating with SCAN
+func (c *Client) Scan(pattern string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.Do("SCAN", cursor, "MATCH", pattern, "COUNT", "100")
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply")
+		}
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]interface{})
+		for _, k := range batch {
+			if s, ok := k.(string); ok {
+				keys = append(keys, s)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
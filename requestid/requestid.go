@@ -0,0 +1,107 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package requestid assigns every request passing through arbor a correlation
+// key which is logged, returned to the client and forwarded to the services.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/proxy/constants"
+)
+
+// MaxLength is the longest incoming request ID that will be honored
+const MaxLength = 128
+
+// Entropy is where the random bytes of generated IDs are read from
+var Entropy io.Reader = rand.Reader
+
+// generated counts the IDs generated without entropy, keeping those of the same instant apart
+var generated uint64
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx or "" if there is none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// FromRequest returns the request ID of r
+//
+// The ID assigned by arbor is preferred, falling back to the ID header sent with the request.
+func FromRequest(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if id := FromContext(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get(constants.RequestIDHeaderField)
+}
+
+// Generate creates a new random request ID
+//
+// Should Entropy fail the ID is made of the time and a counter instead, so requests are never left
+// without one. The logger package imports this one, so the failure is logged in its format with log.
+func Generate() string {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(Entropy, b); err != nil {
+		log.Println("[ERROR]: Could not generate a random request ID, using the time instead: " + err.Error())
+		return fmt.Sprintf("%016x%016x", clock.Now().UnixNano(), atomic.AddUint64(&generated, 1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// IsValid reports if an ID supplied by a client is safe to honor
+//
+// IDs are written to logs and headers, so only short printable tokens are accepted.
+func IsValid(id string) bool {
+	if len(id) == 0 || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Ensure assigns r a request ID, honoring a valid incoming one
+//
+// The ID is set on the request header so it is forwarded to services, and
+// the returned request carries it in its context.
+func Ensure(r *http.Request) (*http.Request, string) {
+	id := FromContext(r.Context())
+	if id == "" {
+		id = r.Header.Get(constants.RequestIDHeaderField)
+		if !IsValid(id) {
+			id = Generate()
+		}
+		r = r.WithContext(NewContext(r.Context(), id))
+	}
+	r.Header.Set(constants.RequestIDHeaderField, id)
+	return r, id
+}
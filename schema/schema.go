@@ -0,0 +1,583 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package schema validates JSON documents against JSON Schema
+//
+// It supports the validation keywords of draft 7 and 2020-12 except format, and
+// $ref to definitions within the same schema.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is a violation of the schema at a field, given as a JSON Pointer
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// Schema is a compiled JSON Schema
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile parses a JSON Schema document
+func Compile(data []byte) (*Schema, error) {
+	root, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	err = s.compilePatterns(root)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decode parses JSON keeping numbers exact
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	err := decoder.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("schema: unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// compilePatterns compiles every pattern in the schema up front so invalid ones are reported by Compile
+func (s *Schema) compilePatterns(node interface{}) error {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			if pattern, ok := value.(string); ok && key == "pattern" {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Errorf("schema: invalid pattern %q: %v", pattern, err)
+				}
+				s.patterns[pattern] = re
+			}
+			if key == "patternProperties" {
+				if properties, ok := value.(map[string]interface{}); ok {
+					for pattern := range properties {
+						re, err := regexp.Compile(pattern)
+						if err != nil {
+							return fmt.Errorf("schema: invalid pattern %q: %v", pattern, err)
+						}
+						s.patterns[pattern] = re
+					}
+				}
+			}
+			if err := s.compilePatterns(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, value := range n {
+			if err := s.compilePatterns(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateJSON parses a JSON document and validates it
+func (s *Schema) ValidateJSON(data []byte) ([]FieldError, error) {
+	v, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(v), nil
+}
+
+// Validate validates a value decoded with json.Decoder.UseNumber, returning every violation
+func (s *Schema) Validate(v interface{}) []FieldError {
+	var errs []FieldError
+	s.validate(s.root, v, "", &errs, 0)
+	return errs
+}
+
+// maxDepth bounds $ref recursion
+const maxDepth = 64
+
+func (s *Schema) validate(node interface{}, v interface{}, field string, errs *[]FieldError, depth int) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxDepth {
+		fail("schema is too deeply nested")
+		return
+	}
+
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			fail("is not allowed")
+		}
+		return
+	case map[string]interface{}:
+	default:
+		return
+	}
+	schema := node.(map[string]interface{})
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			fail("%v", err)
+		} else {
+			s.validate(target, v, field, errs, depth+1)
+		}
+	}
+
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch t := t.(type) {
+		case string:
+			types = []string{t}
+		case []interface{}:
+			for _, name := range t {
+				if name, ok := name.(string); ok {
+					types = append(types, name)
+				}
+			}
+		}
+		matched := false
+		for _, name := range types {
+			if hasType(v, name) {
+				matched = true
+			}
+		}
+		if !matched {
+			fail("must be of type %s, got %s", strings.Join(types, " or "), typeOf(v))
+			// The other keywords describe a value of the right type
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if equal(v, candidate) {
+				found = true
+			}
+		}
+		if !found {
+			fail("must be one of %s", encode(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !equal(v, constant) {
+		fail("must be %s", encode(constant))
+	}
+
+	switch value := v.(type) {
+	case json.Number:
+		s.validateNumber(schema, value, fail)
+	case string:
+		length := utf8.RuneCountInString(value)
+		if min, ok := integer(schema["minLength"]); ok && length < min {
+			fail("must be at least %d characters", min)
+		}
+		if max, ok := integer(schema["maxLength"]); ok && length > max {
+			fail("must be at most %d characters", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+			fail("must match %s", pattern)
+		}
+	case []interface{}:
+		s.validateArray(schema, value, field, errs, depth, fail)
+	case map[string]interface{}:
+		s.validateObject(schema, value, field, errs, depth, fail)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			s.validate(sub, v, field, errs, depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if s.matching(anyOf, v, depth) == 0 {
+			fail("must match at least one of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if matches := s.matching(oneOf, v, depth); matches != 1 {
+			fail("must match exactly one of the allowed schemas, matched %d", matches)
+		}
+	}
+	if not, ok := schema["not"]; ok && s.valid(not, v, depth) {
+		fail("must not match the disallowed schema")
+	}
+	if cond, ok := schema["if"]; ok {
+		if s.valid(cond, v, depth) {
+			if then, ok := schema["then"]; ok {
+				s.validate(then, v, field, errs, depth+1)
+			}
+		} else if otherwise, ok := schema["else"]; ok {
+			s.validate(otherwise, v, field, errs, depth+1)
+		}
+	}
+}
+
+func (s *Schema) valid(node interface{}, v interface{}, depth int) bool {
+	var errs []FieldError
+	s.validate(node, v, "", &errs, depth+1)
+	return len(errs) == 0
+}
+
+func (s *Schema) matching(nodes []interface{}, v interface{}, depth int) int {
+	matches := 0
+	for _, node := range nodes {
+		if s.valid(node, v, depth) {
+			matches++
+		}
+	}
+	return matches
+}
+
+func (s *Schema) validateNumber(schema map[string]interface{}, value json.Number, fail func(string, ...interface{})) {
+	n, ok := rat(value)
+	if !ok {
+		fail("is out of the range which can be validated")
+		return
+	}
+	bound := func(keyword string) (*big.Rat, bool) {
+		number, ok := schema[keyword].(json.Number)
+		if !ok {
+			return nil, false
+		}
+		return rat(number)
+	}
+	if min, ok := bound("minimum"); ok && n.Cmp(min) < 0 {
+		fail("must be at least %s", min.RatString())
+	}
+	if max, ok := bound("maximum"); ok && n.Cmp(max) > 0 {
+		fail("must be at most %s", max.RatString())
+	}
+	if min, ok := bound("exclusiveMinimum"); ok && n.Cmp(min) <= 0 {
+		fail("must be greater than %s", min.RatString())
+	}
+	if max, ok := bound("exclusiveMaximum"); ok && n.Cmp(max) >= 0 {
+		fail("must be less than %s", max.RatString())
+	}
+	if multiple, ok := bound("multipleOf"); ok && multiple.Sign() > 0 {
+		if !new(big.Rat).Quo(n, multiple).IsInt() {
+			fail("must be a multiple of %s", multiple.RatString())
+		}
+	}
+}
+
+func (s *Schema) validateArray(schema map[string]interface{}, value []interface{}, field string, errs *[]FieldError, depth int, fail func(string, ...interface{})) {
+	if min, ok := integer(schema["minItems"]); ok && len(value) < min {
+		fail("must have at least %d items", min)
+	}
+	if max, ok := integer(schema["maxItems"]); ok && len(value) > max {
+		fail("must have at most %d items", max)
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		seen := make(map[string]int, len(value))
+		for i, item := range value {
+			key := canonical(item)
+			if first, ok := seen[key]; ok {
+				fail("must have unique items, %d and %d are equal", first, i)
+				break
+			}
+			seen[key] = i
+		}
+	}
+
+	// prefixItems (2020-12) or an array of items (draft 7) validate items by position
+	prefix, _ := schema["prefixItems"].([]interface{})
+	rest, hasRest := schema["items"]
+	if positional, ok := rest.([]interface{}); ok {
+		prefix = positional
+		rest, hasRest = schema["additionalItems"]
+	}
+	for i, item := range value {
+		itemField := field + "/" + strconv.Itoa(i)
+		if i < len(prefix) {
+			s.validate(prefix[i], item, itemField, errs, depth+1)
+		} else if hasRest {
+			s.validate(rest, item, itemField, errs, depth+1)
+		}
+	}
+	if contains, ok := schema["contains"]; ok {
+		found := false
+		for _, item := range value {
+			if s.valid(contains, item, depth) {
+				found = true
+			}
+		}
+		if !found {
+			fail("must contain a matching item")
+		}
+	}
+}
+
+func (s *Schema) validateObject(schema map[string]interface{}, value map[string]interface{}, field string, errs *[]FieldError, depth int, fail func(string, ...interface{})) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := value[name]; !present {
+					*errs = append(*errs, FieldError{Field: field + "/" + escape(name), Message: "is required"})
+				}
+			}
+		}
+	}
+	if min, ok := integer(schema["minProperties"]); ok && len(value) < min {
+		fail("must have at least %d properties", min)
+	}
+	if max, ok := integer(schema["maxProperties"]); ok && len(value) > max {
+		fail("must have at most %d properties", max)
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	patternProperties, _ := schema["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	// Errors are reported in a stable order
+	sort.Strings(names)
+	for _, name := range names {
+		propertyField := field + "/" + escape(name)
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			s.validate(sub, value[name], propertyField, errs, depth+1)
+		}
+		for pattern, sub := range patternProperties {
+			if s.patterns[pattern].MatchString(name) {
+				matched = true
+				s.validate(sub, value[name], propertyField, errs, depth+1)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				*errs = append(*errs, FieldError{Field: propertyField, Message: "is not allowed"})
+			} else {
+				s.validate(additional, value[name], propertyField, errs, depth+1)
+			}
+		}
+		if propertyNames, ok := schema["propertyNames"]; ok && !s.valid(propertyNames, name, depth) {
+			*errs = append(*errs, FieldError{Field: propertyField, Message: "is not an allowed property name"})
+		}
+	}
+
+	if dependent, ok := schema["dependentRequired"].(map[string]interface{}); ok {
+		for name, requires := range dependent {
+			if _, present := value[name]; !present {
+				continue
+			}
+			required, _ := requires.([]interface{})
+			for _, other := range required {
+				if other, ok := other.(string); ok {
+					if _, present := value[other]; !present {
+						*errs = append(*errs, FieldError{Field: field + "/" + escape(other), Message: "is required when " + name + " is present"})
+					}
+				}
+			}
+		}
+	}
+}
+
+// resolve finds the target of a $ref within the schema
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("schema: only local references are supported, got %s", ref)
+	}
+	node := s.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return node, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			next, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("schema: unresolvable reference %s", ref)
+			}
+			node = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("schema: unresolvable reference %s", ref)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("schema: unresolvable reference %s", ref)
+		}
+	}
+	return node, nil
+}
+
+// escape escapes a property name for use in a JSON Pointer
+func escape(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
+
+// maxExponent bounds the exponents compared exactly, as big.Rat expands them in full
+const maxExponent = 1000
+
+// rat converts a JSON number to an exact rational
+func rat(number json.Number) (*big.Rat, bool) {
+	s := number.String()
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(s[i+1:])
+		if err != nil || exponent > maxExponent || exponent < -maxExponent {
+			return nil, false
+		}
+	}
+	return new(big.Rat).SetString(s)
+}
+
+func integer(v interface{}) (int, bool) {
+	number, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	n, err := number.Int64()
+	return int(n), err == nil
+}
+
+func hasType(v interface{}, name string) bool {
+	switch name {
+	case "integer":
+		number, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		n, ok := rat(number)
+		return ok && n.IsInt()
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	default:
+		return typeOf(v) == name
+	}
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+// equal compares JSON values, treating numbers by value
+func equal(a interface{}, b interface{}) bool {
+	an, aNumber := a.(json.Number)
+	bn, bNumber := b.(json.Number)
+	if aNumber && bNumber {
+		ar, aok := rat(an)
+		br, bok := rat(bn)
+		return aok && bok && ar.Cmp(br) == 0
+	}
+	switch av := a.(type) {
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !equal(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k := range av {
+			if !equal(av[k], bv[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// canonical encodes a value so that equal values have equal encodings
+func canonical(v interface{}) string {
+	switch value := v.(type) {
+	case json.Number:
+		if n, ok := rat(value); ok {
+			return "n" + n.RatString()
+		}
+		return "n" + value.String()
+	case []interface{}:
+		parts := make([]string, len(value))
+		for i, item := range value {
+			parts[i] = canonical(item)
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case map[string]interface{}:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = strconv.Quote(name) + ":" + canonical(value[name])
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	default:
+		return encode(v)
+	}
+}
+
+func encode(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
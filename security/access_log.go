@@ -14,8 +14,8 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"time"
 
+	"github.com/arbor-dev/arbor/clock"
 	"github.com/arbor-dev/arbor/logger"
 )
 
@@ -45,7 +45,7 @@ func (l *accessLogger) open(accessLogLocation string) {
 }
 
 func (l *accessLogger) log(name string, token string) error {
-	t := time.Now().Local()
+	t := clock.Now().Local()
 	str := fmt.Sprintf("%s %s %s\n", t.Format("2006-01-02 15:04:05 +0800"), name, token)
 	_, err := (*l.accessLog).WriteString(str)
 	err = (*l.accessLog).Sync()
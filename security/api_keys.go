@@ -0,0 +1,194 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// Errors returned when authorizing an API key
+var (
+	ErrKeyNotFound     = errors.New("no such API key")
+	ErrKeyExpired      = errors.New("API key is expired")
+	ErrKeyNotPermitted = errors.New("API key is not permitted to use this route")
+)
+
+// APIKeys is the store of API keys used to authorize clients, if set
+//
+// When set, it replaces the client registry for authorizing tokens. Keys may be
+// added, rotated and revoked in the store while arbor is running.
+var APIKeys KeyStore
+
+// APIKey is an API key issued to a client
+//
+// Only the hash of the key is stored. Empty Routes or Methods allow all routes or methods.
+type APIKey struct {
+	Hash    string    `json:"hash"`
+	Client  string    `json:"client"`
+	Routes  []string  `json:"routes,omitempty"`
+	Methods []string  `json:"methods,omitempty"`
+	Scopes  []string  `json:"scopes,omitempty"`
+	Roles   []string  `json:"roles,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Expired reports if the key has passed its expiry
+func (k APIKey) Expired() bool {
+	return !k.Expires.IsZero() && !clock.Now().Before(k.Expires)
+}
+
+// Allows reports if the key may be used for a method of a route
+func (k APIKey) Allows(route string, method string) bool {
+	return (len(k.Routes) == 0 || contains(k.Routes, route)) &&
+		(len(k.Methods) == 0 || containsFold(k.Methods, method))
+}
+
+// Claims describes the key's client, scopes and roles as token claims
+func (k APIKey) Claims() Claims {
+	claims := Claims{"sub": k.Client, "scope": strings.Join(k.Scopes, " ")}
+	claims.set(RolesClaim, k.Roles)
+	if !k.Expires.IsZero() {
+		claims["exp"] = float64(k.Expires.Unix())
+	}
+	return claims
+}
+
+// KeyStore stores API keys by their hash
+type KeyStore interface {
+	// Get returns the key with the hash, or ErrKeyNotFound
+	Get(hash string) (APIKey, error)
+	// Put adds or replaces a key
+	Put(key APIKey) error
+	// Delete removes the key with the hash, or returns ErrKeyNotFound
+	Delete(hash string) error
+	// List returns all keys
+	List() ([]APIKey, error)
+}
+
+// HashAPIKey returns the hash a key is stored under
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueAPIKey generates a new key with the permissions of template, adds it to store and returns the secret
+//
+// The secret is only available here, the store keeps its hash.
+func IssueAPIKey(store KeyStore, template APIKey) (string, error) {
+	secret, err := issueAPIKey(store, template)
+	if err == nil {
+		audit.Record(audit.Event{Type: audit.ConfigurationChanged, Subject: template.Client, Reason: "API key issued",
+			Details: map[string]interface{}{"key": HashAPIKey(secret)}})
+	}
+	return secret, err
+}
+
+func issueAPIKey(store KeyStore, template APIKey) (string, error) {
+	secret, err := generateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+	template.Hash = HashAPIKey(secret)
+	err = store.Put(template)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// RotateAPIKey issues a replacement for the key with the hash and revokes the old key
+//
+// A grace period keeps the old key valid for the given time so clients can switch over, or until it
+// expires if that is sooner.
+func RotateAPIKey(store KeyStore, hash string, grace time.Duration) (string, error) {
+	old, err := store.Get(hash)
+	if err != nil {
+		return "", err
+	}
+	replacement := old
+	secret, err := issueAPIKey(store, replacement)
+	if err != nil {
+		return "", err
+	}
+	if grace > 0 {
+		// The grace period never keeps the old key valid for longer than it was issued for
+		if expires := clock.Now().Add(grace); old.Expires.IsZero() || expires.Before(old.Expires) {
+			old.Expires = expires
+		}
+		err = store.Put(old)
+	} else {
+		err = store.Delete(hash)
+	}
+	if err == nil {
+		audit.Record(audit.Event{Type: audit.CredentialRotated, Subject: old.Client, Reason: "API key rotated",
+			Details: map[string]interface{}{"key": HashAPIKey(secret), "replaced": hash, "grace": grace.String()}})
+	}
+	return secret, err
+}
+
+// AuthorizeAPIKey checks that a key presented by a client may be used for a method of a route
+//
+// The key is returned along with ErrKeyNotPermitted, so the refused client is known.
+func AuthorizeAPIKey(store KeyStore, secret string, route string, method string) (APIKey, error) {
+	if secret == "" {
+		return APIKey{}, ErrKeyNotFound
+	}
+	key, err := store.Get(HashAPIKey(secret))
+	if err != nil {
+		return APIKey{}, err
+	}
+	if key.Expired() {
+		return APIKey{}, ErrKeyExpired
+	}
+	if !key.Allows(route, method) {
+		return key, ErrKeyNotPermitted
+	}
+	return key, nil
+}
+
+type apiKeyContextKey struct{}
+
+// NewAPIKeyContext returns a copy of ctx carrying the API key the caller was authorized with
+func NewAPIKeyContext(ctx context.Context, key APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key the caller was authorized with, if the caller was authorized by one
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return key, ok
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+	return false
+}
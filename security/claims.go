@@ -0,0 +1,172 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims are the verified claims of a caller's token
+type Claims map[string]interface{}
+
+// String returns a string claim or "" if it is missing or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim holding a list of strings
+//
+// Both JSON arrays and space separated strings (as used by the OAuth2 scope claim) are accepted.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case int64:
+		return time.Unix(v, 0), true
+	}
+	return time.Time{}, false
+}
+
+// Subject is the sub claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Issuer is the iss claim
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+// Audience is the aud claim
+func (c Claims) Audience() []string {
+	if aud, ok := c["aud"].(string); ok {
+		return []string{aud}
+	}
+	return c.Strings("aud")
+}
+
+// Value formats a claim for use in a header
+func (c Claims) Value(name string) string {
+	switch v := c[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%v", int64(v))
+	case []interface{}:
+		return strings.Join(c.Strings(name), ",")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// Scopes returns the scopes granted by the claims, from the scope or scp claim
+func (c Claims) Scopes() []string {
+	if scopes := c.Strings("scope"); len(scopes) > 0 {
+		return scopes
+	}
+	return c.Strings("scp")
+}
+
+// HasScopes reports if the claims grant all of the required scopes
+func (c Claims) HasScopes(required []string) bool {
+	granted := make(map[string]bool)
+	for _, scope := range c.Scopes() {
+		granted[scope] = true
+	}
+	for _, scope := range required {
+		if !granted[scope] {
+			return false
+		}
+	}
+	return true
+}
+
+// RolesClaim is the claim holding the caller's roles
+//
+// Nested claims are addressed with dots, e.g. "realm_access.roles".
+var RolesClaim = "roles"
+
+// Roles returns the caller's roles from the RolesClaim
+func (c Claims) Roles() []string {
+	path := strings.Split(RolesClaim, ".")
+	claims := c
+	for _, name := range path[:len(path)-1] {
+		nested, ok := claims[name].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		claims = Claims(nested)
+	}
+	return claims.Strings(path[len(path)-1])
+}
+
+// set sets a claim addressed with dots, creating nested claims as needed
+func (c Claims) set(name string, value interface{}) {
+	path := strings.Split(name, ".")
+	claims := map[string]interface{}(c)
+	for _, name := range path[:len(path)-1] {
+		nested, ok := claims[name].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			claims[name] = nested
+		}
+		claims = nested
+	}
+	claims[path[len(path)-1]] = value
+}
+
+// HasAnyRole reports if the caller has at least one of the roles
+func (c Claims) HasAnyRole(roles []string) bool {
+	for _, role := range c.Roles() {
+		if contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+type claimsContextKey struct{}
+
+// NewClaimsContext returns a copy of ctx carrying the caller's verified claims
+func NewClaimsContext(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the caller's verified claims, if the caller was authenticated by a token
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(Claims)
+	return claims, ok
+}
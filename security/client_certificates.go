@@ -0,0 +1,56 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import "crypto/x509"
+
+// CertificateRoles maps the identities of client certificates to their roles
+//
+// An identity is the certificate's common name or one of its DNS, URI or email subject
+// alternative names, e.g. "partner.example.com" or "spiffe://example.com/billing". A
+// certificate gets the roles of all of its identities.
+var CertificateRoles = map[string][]string{}
+
+// CertificateIdentities returns the identities of a client certificate, its common name first
+func CertificateIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return append(identities, cert.EmailAddresses...)
+}
+
+// CertificateClaims describes the client of a verified certificate and its roles as token claims
+//
+// The subject is the certificate's first identity.
+func CertificateClaims(cert *x509.Certificate) Claims {
+	identities := CertificateIdentities(cert)
+	claims := Claims{}
+	if len(identities) > 0 {
+		claims["sub"] = identities[0]
+	}
+	var roles []string
+	granted := make(map[string]bool)
+	for _, identity := range identities {
+		for _, role := range CertificateRoles[identity] {
+			if !granted[role] {
+				granted[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+	claims.set(RolesClaim, roles)
+	return claims
+}
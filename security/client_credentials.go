@@ -0,0 +1,95 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ClientCredentials acquires access tokens for arbor with the OAuth2 client credentials grant (RFC 6749 §4.4)
+//
+// Tokens are cached and acquired again before they expire.
+type ClientCredentials struct {
+	//TokenURL is the token endpoint of the authorization server
+	TokenURL string
+	//ClientID and ClientSecret authenticate arbor to the authorization server
+	ClientID     string
+	ClientSecret string
+	//Scopes are the scopes requested for the token (optional)
+	Scopes []string
+	//Audience is the backend the token is requested for, for servers which require it (optional)
+	Audience string
+	//RefreshBefore is how long before expiry a token is replaced, zero is a third of its lifetime
+	RefreshBefore time.Duration
+
+	tokenCache
+}
+
+// Token returns the current access token, acquiring a new one if it is due
+func (c *ClientCredentials) Token() (string, error) {
+	return c.get(c.TokenURL, c.RefreshBefore, c.acquire)
+}
+
+func (c *ClientCredentials) acquire() (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	if c.Audience != "" {
+		form.Set("audience", c.Audience)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint responded with %d", resp.StatusCode)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, MB)).Decode(&response)
+	if err != nil {
+		return "", 0, err
+	}
+	if response.AccessToken == "" {
+		return "", 0, errors.New("token endpoint did not issue an access token")
+	}
+	if response.TokenType != "" && !strings.EqualFold(response.TokenType, "bearer") {
+		return "", 0, errors.New("token endpoint issued an unsupported " + response.TokenType + " token")
+	}
+	lifetime := time.Duration(response.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = DefaultTokenLifetime
+	}
+	return response.AccessToken, lifetime, nil
+}
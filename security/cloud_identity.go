@@ -0,0 +1,160 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// GoogleIDToken provides Google-signed ID tokens of the service account arbor runs as, for backends on Cloud Run,
+// Cloud Functions or behind Identity-Aware Proxy
+//
+// Tokens are fetched from the metadata server of the Compute Engine, GKE or Cloud Run instance
+// arbor runs on, cached and fetched again before they expire.
+type GoogleIDToken struct {
+	//Audience is the backend the token is for, e.g. the Cloud Run service URL or the IAP client ID
+	Audience string
+	//Endpoint is the address of the metadata server, empty is "http://metadata.google.internal"
+	Endpoint string
+
+	tokenCache
+}
+
+// Token returns the current ID token, fetching a new one if it is due
+func (g *GoogleIDToken) Token() (string, error) {
+	return g.get("the Google metadata server", 0, g.fetch)
+}
+
+func (g *GoogleIDToken) fetch() (string, time.Duration, error) {
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "http://metadata.google.internal"
+	}
+	query := url.Values{"audience": {g.Audience}, "format": {"full"}}
+	body, err := getMetadata(endpoint+"/computeMetadata/v1/instance/service-accounts/default/identity?"+query.Encode(),
+		http.Header{"Metadata-Flavor": {"Google"}})
+	if err != nil {
+		return "", 0, err
+	}
+	token := strings.TrimSpace(string(body))
+	if token == "" {
+		return "", 0, errors.New("metadata server did not issue an ID token")
+	}
+
+	// The token comes from the metadata server, so its expiry is read without verifying it
+	lifetime := DefaultTokenLifetime
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		var claims Claims
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil && json.Unmarshal(payload, &claims) == nil {
+			if exp, ok := claims.Time("exp"); ok && exp.After(clock.Now()) {
+				lifetime = exp.Sub(clock.Now())
+			}
+		}
+	}
+	return token, lifetime, nil
+}
+
+// AzureManagedIdentity provides Azure AD access tokens of the managed identity arbor runs as
+//
+// Tokens are fetched from the identity endpoint of App Service or Container Apps if
+// IDENTITY_ENDPOINT is set, and from the instance metadata service of the VM otherwise.
+type AzureManagedIdentity struct {
+	//Resource is the application ID URI of the backend the token is for, e.g. "api://products"
+	Resource string
+	//ClientID selects a user-assigned identity, empty uses the system-assigned one
+	ClientID string
+	//Endpoint is the address of the instance metadata service, empty is "http://169.254.169.254"
+	Endpoint string
+
+	tokenCache
+}
+
+// Token returns the current access token, fetching a new one if it is due
+func (a *AzureManagedIdentity) Token() (string, error) {
+	return a.get("the Azure managed identity endpoint", 0, a.fetch)
+}
+
+func (a *AzureManagedIdentity) fetch() (string, time.Duration, error) {
+	query := url.Values{"resource": {a.Resource}}
+	if a.ClientID != "" {
+		query.Set("client_id", a.ClientID)
+	}
+	var endpoint string
+	var header http.Header
+	if identityEndpoint := os.Getenv("IDENTITY_ENDPOINT"); identityEndpoint != "" {
+		query.Set("api-version", "2019-08-01")
+		endpoint = identityEndpoint
+		header = http.Header{"X-Identity-Header": {os.Getenv("IDENTITY_HEADER")}}
+	} else {
+		query.Set("api-version", "2018-02-01")
+		endpoint = a.Endpoint
+		if endpoint == "" {
+			endpoint = "http://169.254.169.254"
+		}
+		endpoint += "/metadata/identity/oauth2/token"
+		header = http.Header{"Metadata": {"true"}}
+	}
+
+	body, err := getMetadata(endpoint+"?"+query.Encode(), header)
+	if err != nil {
+		return "", 0, err
+	}
+	var response struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", 0, err
+	}
+	if response.AccessToken == "" {
+		return "", 0, errors.New("managed identity endpoint did not issue an access token")
+	}
+	lifetime := DefaultTokenLifetime
+	if expiresOn, err := strconv.ParseInt(response.ExpiresOn.String(), 10, 64); err == nil {
+		if expires := time.Unix(expiresOn, 0); expires.After(clock.Now()) {
+			lifetime = expires.Sub(clock.Now())
+		}
+	}
+	return response.AccessToken, lifetime, nil
+}
+
+// getMetadata gets a document from the metadata service of the instance arbor runs on
+func getMetadata(url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service responded with %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, MB))
+}
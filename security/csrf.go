@@ -0,0 +1,40 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// CSRFCookieName is the cookie holding a browser's CSRF token
+//
+// Browser-facing routes use the double submit cookie pattern: scripts read the token from
+// the cookie and send it back in the CSRFHeaderName header, which other sites can not do.
+var CSRFCookieName = "csrf_token"
+
+// CSRFHeaderName is the header state-changing requests of browsers carry the CSRF token in
+var CSRFHeaderName = "X-CSRF-Token"
+
+// NewCSRFToken creates the CSRF token of a browser
+func NewCSRFToken() (string, error) {
+	return generateRandomString(32)
+}
+
+// ValidCSRFToken reports if the request carries the token of its CSRF cookie in the CSRF header
+func ValidCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeaderName)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
@@ -0,0 +1,129 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// Errors returned when verifying a signed request
+var (
+	ErrMissingSignature  = errors.New("request is not signed")
+	ErrInvalidTimestamp  = errors.New("signature timestamp is invalid")
+	ErrSignatureSkew     = errors.New("signature timestamp is outside the allowed skew")
+	ErrUnsupportedDigest = errors.New("signature algorithm is not allowed")
+)
+
+// SignatureAlgorithms are the HMAC algorithms requests can be signed with
+var SignatureAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// DefaultSignatureSkew is the allowed clock skew if the verifier does not specify
+const DefaultSignatureSkew = 5 * time.Minute
+
+// HMACVerifier verifies requests signed with a shared secret
+//
+// Clients send the signing time as unix seconds in TimestampHeader and the signature
+// as "<algorithm>=<hex digest>" in SignatureHeader. The digest is the HMAC of
+// "<timestamp>.<body>", or "<timestamp>.<method>.<request uri>.<body>" if
+// IncludeRequestLine is set, keyed with the secret named in KeyIDHeader.
+type HMACVerifier struct {
+	//Keys are the shared secrets by key ID, "" is used when no key ID is sent
+	Keys map[string][]byte
+	//Algorithms are the allowed algorithms, defaulting to sha256 and sha512
+	Algorithms []string
+	//MaxSkew is how far the timestamp may be from arbor's clock
+	MaxSkew time.Duration
+	//IncludeRequestLine binds the signature to the method and request URI
+	IncludeRequestLine bool
+
+	SignatureHeader string
+	TimestampHeader string
+	KeyIDHeader     string
+}
+
+func headerOrDefault(header string, fallback string) string {
+	if header == "" {
+		return fallback
+	}
+	return header
+}
+
+// Verify checks the signature of r over body and returns the ID of the key which signed it
+func (v *HMACVerifier) Verify(r *http.Request, body []byte) (string, error) {
+	signature := r.Header.Get(headerOrDefault(v.SignatureHeader, "X-Signature"))
+	timestamp := r.Header.Get(headerOrDefault(v.TimestampHeader, "X-Signature-Timestamp"))
+	keyID := r.Header.Get(headerOrDefault(v.KeyIDHeader, "X-Signature-Key"))
+	if signature == "" || timestamp == "" {
+		return "", ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrInvalidTimestamp
+	}
+	skew := v.MaxSkew
+	if skew == 0 {
+		skew = DefaultSignatureSkew
+	}
+	offset := clock.Since(time.Unix(seconds, 0))
+	if offset > skew || offset < -skew {
+		return "", ErrSignatureSkew
+	}
+
+	separator := strings.Index(signature, "=")
+	if separator < 0 {
+		return "", ErrInvalidSignature
+	}
+	algorithm := strings.ToLower(signature[:separator])
+	allowed := v.Algorithms
+	if allowed == nil {
+		allowed = []string{"sha256", "sha512"}
+	}
+	newHash, supported := SignatureAlgorithms[algorithm]
+	if !supported || !contains(allowed, algorithm) {
+		return "", ErrUnsupportedDigest
+	}
+	digest, err := hex.DecodeString(signature[separator+1:])
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+
+	secret, known := v.Keys[keyID]
+	if !known {
+		return "", ErrUnknownKey
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(timestamp + "."))
+	if v.IncludeRequestLine {
+		mac.Write([]byte(r.Method + "." + r.URL.RequestURI() + "."))
+	}
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), digest) {
+		return "", ErrInvalidSignature
+	}
+	return keyID, nil
+}
@@ -0,0 +1,169 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// ErrTokenInactive is returned when the authorization server reports a token is not active
+var ErrTokenInactive = errors.New("token is not active")
+
+// DefaultIntrospectionCacheDuration is how long introspection results are cached if the introspector does not specify
+const DefaultIntrospectionCacheDuration = time.Minute
+
+// TokenIntrospector validates opaque bearer tokens with an OAuth2 introspection endpoint (RFC 7662)
+//
+// If Endpoint is empty it is discovered from the OpenID Connect configuration of Issuer.
+type TokenIntrospector struct {
+	//Endpoint is the introspection endpoint of the authorization server
+	Endpoint string
+	//Issuer is the OpenID Connect issuer used to discover the endpoint
+	Issuer string
+	//ClientID and ClientSecret authenticate arbor to the authorization server
+	ClientID     string
+	ClientSecret string
+	//CacheDuration is how long results are cached, never beyond the token's expiry
+	CacheDuration time.Duration
+
+	mutex sync.Mutex
+	cache map[[sha256.Size]byte]introspectionResult
+}
+
+type introspectionResult struct {
+	claims  Claims
+	err     error
+	expires time.Time
+}
+
+// Introspect asks the authorization server whether token is active and returns its claims
+func (i *TokenIntrospector) Introspect(token string) (Claims, error) {
+	key := sha256.Sum256([]byte(token))
+	now := clock.Now()
+
+	i.mutex.Lock()
+	if i.cache == nil {
+		i.cache = make(map[[sha256.Size]byte]introspectionResult)
+	}
+	result, cached := i.cache[key]
+	i.mutex.Unlock()
+	if cached && now.Before(result.expires) {
+		return result.claims, result.err
+	}
+
+	claims, err := i.introspect(token)
+	if err != nil && err != ErrTokenInactive {
+		// Failures to reach the server are not cached
+		return nil, err
+	}
+
+	cacheDuration := i.CacheDuration
+	if cacheDuration == 0 {
+		cacheDuration = DefaultIntrospectionCacheDuration
+	}
+	result = introspectionResult{claims: claims, err: err, expires: now.Add(cacheDuration)}
+	if exp, ok := claims.Time("exp"); ok && exp.Before(result.expires) {
+		result.expires = exp
+	}
+
+	i.mutex.Lock()
+	for k, r := range i.cache {
+		if now.After(r.expires) {
+			delete(i.cache, k)
+		}
+	}
+	i.cache[key] = result
+	i.mutex.Unlock()
+	return claims, err
+}
+
+func (i *TokenIntrospector) introspect(token string) (Claims, error) {
+	endpoint, err := i.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint responded with %d", resp.StatusCode)
+	}
+
+	var claims Claims
+	err = json.NewDecoder(io.LimitReader(resp.Body, MB)).Decode(&claims)
+	if err != nil {
+		return nil, err
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+	return claims, nil
+}
+
+func (i *TokenIntrospector) endpoint() (string, error) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.Endpoint != "" {
+		return i.Endpoint, nil
+	}
+	if i.Issuer == "" {
+		return "", errors.New("no introspection endpoint or issuer configured")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(i.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MB))
+	if err != nil {
+		return "", err
+	}
+	var configuration struct {
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	err = json.Unmarshal(body, &configuration)
+	if err != nil {
+		return "", err
+	}
+	if configuration.IntrospectionEndpoint == "" {
+		return "", errors.New("issuer does not publish an introspection endpoint")
+	}
+	i.Endpoint = configuration.IntrospectionEndpoint
+	return i.Endpoint, nil
+}
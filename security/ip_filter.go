@@ -0,0 +1,48 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"net"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// AllowedNetworks are the CIDRs (e.g. "10.0.0.0/8") or addresses callers of every route must come from, any if empty
+var AllowedNetworks []string
+
+// DeniedNetworks are the CIDRs or addresses callers of every route are refused from, whatever the allowed networks
+var DeniedNetworks []string
+
+// AllowsIP reports whether a caller from ip may use route
+//
+// The caller must not be in DeniedNetworks or the route's DeniedNetworks, and must be in
+// AllowedNetworks and the route's AllowedNetworks if they are set. Lists with an invalid
+// entry refuse every caller, so a mistyped network never opens a route up.
+func AllowsIP(ip net.IP, route services.Route) (bool, error) {
+	for _, denied := range [][]string{DeniedNetworks, route.DeniedNetworks} {
+		contained, err := clientip.Contains(denied, ip)
+		if err != nil || contained {
+			return false, err
+		}
+	}
+	for _, allowed := range [][]string{AllowedNetworks, route.AllowedNetworks} {
+		if len(allowed) == 0 {
+			continue
+		}
+		contained, err := clientip.Contains(allowed, ip)
+		if err != nil || !contained {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,207 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// DefaultJWKSRefreshInterval is how long a key set is cached if the verifier does not specify
+const DefaultJWKSRefreshInterval = time.Hour
+
+// jwksMinRefetchInterval limits refetching the key set when tokens reference unknown keys
+const jwksMinRefetchInterval = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwksFetch is a fetch of the key set in progress, which verifications needing it wait on
+type jwksFetch struct {
+	done chan struct{}
+}
+
+func (v *JWTVerifier) jwksKey(kid string) interface{} {
+	v.jwksMutex.Lock()
+	refresh := v.JWKSRefreshInterval
+	if refresh == 0 {
+		refresh = DefaultJWKSRefreshInterval
+	}
+	age := clock.Since(v.jwksFetched)
+	_, known := v.jwks[kid]
+
+	// The cached keys are used until the cache expires, or sooner if a key was rotated in
+	if v.jwks != nil && age <= refresh && (known || age <= jwksMinRefetchInterval) {
+		key := v.jwks[kid]
+		v.jwksMutex.Unlock()
+		return key
+	}
+	// The key set is fetched once however many verifications need it, without holding the lock
+	// so those using the keys already fetched are not kept waiting on the identity provider
+	if fetch := v.jwksFetching; fetch != nil {
+		v.jwksMutex.Unlock()
+		<-fetch.done
+		v.jwksMutex.Lock()
+		defer v.jwksMutex.Unlock()
+		return v.jwks[kid]
+	}
+	fetch := &jwksFetch{done: make(chan struct{})}
+	v.jwksFetching = fetch
+	v.jwksMutex.Unlock()
+
+	keys, err := fetchJWKS(v.JWKSURL)
+
+	v.jwksMutex.Lock()
+	defer v.jwksMutex.Unlock()
+	if err != nil {
+		logger.Log(logger.ERR, "Could not fetch JWKS: "+err.Error())
+	} else {
+		if v.jwks != nil {
+			auditRotation(v.JWKSURL, v.jwks, keys)
+		}
+		v.jwks = keys
+	}
+	v.jwksFetched = clock.Now()
+	v.jwksFetching = nil
+	close(fetch.done)
+	return v.jwks[kid]
+}
+
+// auditRotation records the signing keys added to and removed from the key set at url
+func auditRotation(url string, old map[string]interface{}, keys map[string]interface{}) {
+	var added, removed []string
+	for kid := range keys {
+		if _, ok := old[kid]; !ok {
+			added = append(added, kid)
+		}
+	}
+	for kid := range old {
+		if _, ok := keys[kid]; !ok {
+			removed = append(removed, kid)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	audit.Record(audit.Event{Type: audit.CredentialRotated, Subject: url, Details: map[string]interface{}{
+		"credential": "signing keys",
+		"added":      added,
+		"removed":    removed,
+	}})
+}
+
+func fetchJWKS(url string) (map[string]interface{}, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("key set responded with %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MB))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses the keys of a JSON Web Key Set by key ID
+//
+// Keys of unsupported types are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var set jsonWebKeySet
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		key, err := parseJWK(jwk)
+		if err != nil {
+			logger.Log(logger.WARN, "Skipping JWK "+jwk.Kid+": "+err.Error())
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func parseJWK(jwk jsonWebKey) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
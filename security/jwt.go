@@ -0,0 +1,194 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+)
+
+// Errors returned when verifying a JWT
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("no key to verify token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("token issuer is not accepted")
+	ErrInvalidAudience  = errors.New("token audience is not accepted")
+)
+
+// JWTVerifier verifies JSON Web Tokens signed with HS256, RS256 or ES256
+//
+// Keys are taken from Secret (HS256), Keys (by key ID, "" matching tokens without one)
+// and the key set published at JWKSURL.
+type JWTVerifier struct {
+	//Secret is the shared secret for HS256 tokens
+	Secret []byte
+	//Keys are public keys (*rsa.PublicKey or *ecdsa.PublicKey) by key ID
+	Keys map[string]crypto.PublicKey
+	//JWKSURL is the location of a JSON Web Key Set to fetch keys from
+	JWKSURL string
+	//JWKSRefreshInterval is how long a fetched key set is cached
+	JWKSRefreshInterval time.Duration
+	//Issuer is the required iss claim, if set
+	Issuer string
+	//Audience is the required aud claim, if set
+	Audience string
+	//Leeway is the allowed clock skew when checking exp and nbf
+	Leeway time.Duration
+
+	jwksMutex    sync.Mutex
+	jwks         map[string]interface{}
+	jwksFetched  time.Time
+	jwksFetching *jwksFetch
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and validity of token and returns its claims
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	err = v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil || claims == nil {
+		return nil, ErrMalformedToken
+	}
+
+	err = v.validateClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed []byte, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch header.Alg {
+	case "HS256":
+		secret := v.Secret
+		if key, ok := v.key(header.Kid).([]byte); ok {
+			secret = key
+		}
+		if len(secret) == 0 {
+			return ErrUnknownKey
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+	case "RS256":
+		key, ok := v.key(header.Kid).(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+			return ErrInvalidSignature
+		}
+	case "ES256":
+		key, ok := v.key(header.Kid).(*ecdsa.PublicKey)
+		if !ok || key.Curve.Params().BitSize != 256 {
+			return ErrUnknownKey
+		}
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+func (v *JWTVerifier) key(kid string) interface{} {
+	if key, ok := v.Keys[kid]; ok {
+		return key
+	}
+	if v.JWKSURL == "" {
+		return nil
+	}
+	return v.jwksKey(kid)
+}
+
+func (v *JWTVerifier) validateClaims(claims Claims) error {
+	now := clock.Now()
+	if exp, ok := claims.Time("exp"); ok && now.After(exp.Add(v.Leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+	if v.Issuer != "" && claims.Issuer() != v.Issuer {
+		return ErrInvalidIssuer
+	}
+	if v.Audience != "" {
+		found := false
+		for _, aud := range claims.Audience() {
+			if aud == v.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return ErrInvalidAudience
+		}
+	}
+	return nil
+}
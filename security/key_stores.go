@@ -0,0 +1,304 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/redis"
+)
+
+// MemoryKeyStore keeps API keys in memory
+type MemoryKeyStore struct {
+	mutex sync.RWMutex
+	keys  map[string]APIKey
+}
+
+// NewMemoryKeyStore creates an empty in memory key store
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]APIKey)}
+}
+
+// Get returns the key with the hash
+func (s *MemoryKeyStore) Get(hash string) (APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	key, exists := s.keys[hash]
+	if !exists {
+		return APIKey{}, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// Put adds or replaces a key
+func (s *MemoryKeyStore) Put(key APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[key.Hash] = key
+	return nil
+}
+
+// Delete removes the key with the hash
+func (s *MemoryKeyStore) Delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.keys[hash]; !exists {
+		return ErrKeyNotFound
+	}
+	delete(s.keys, hash)
+	return nil
+}
+
+// List returns all keys ordered by client
+func (s *MemoryKeyStore) List() ([]APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Client < keys[j].Client || (keys[i].Client == keys[j].Client && keys[i].Hash < keys[j].Hash)
+	})
+	return keys, nil
+}
+
+// fileKeyStoreCheckInterval is how often a file key store checks its file for changes
+const fileKeyStoreCheckInterval = time.Second
+
+// FileKeyStore keeps API keys in a JSON file
+//
+// The file is reloaded when it changes, so keys can be rotated by editing or replacing it.
+type FileKeyStore struct {
+	location string
+	memory   *MemoryKeyStore
+
+	mutex       sync.Mutex
+	modified    time.Time
+	lastChecked time.Time
+}
+
+// NewFileKeyStore creates a key store backed by the file at location, creating it if needed
+func NewFileKeyStore(location string) (*FileKeyStore, error) {
+	s := &FileKeyStore{location: location, memory: NewMemoryKeyStore()}
+	if _, err := os.Stat(location); os.IsNotExist(err) {
+		err = s.save()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, s.load()
+}
+
+func (s *FileKeyStore) load() error {
+	data, err := ioutil.ReadFile(s.location)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseAPIKeys(data)
+	if err != nil {
+		return err
+	}
+	memory := NewMemoryKeyStore()
+	for _, key := range keys {
+		memory.keys[key.Hash] = key
+	}
+	info, err := os.Stat(s.location)
+	if err != nil {
+		return err
+	}
+	s.memory = memory
+	s.modified = info.ModTime()
+	return nil
+}
+
+func (s *FileKeyStore) save() error {
+	keys, _ := s.memory.List()
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.location), ".keys")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.location)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if info, err := os.Stat(s.location); err == nil {
+		s.modified = info.ModTime()
+	}
+	return nil
+}
+
+// ParseAPIKeys parses the contents of an API key file
+func ParseAPIKeys(data []byte) ([]APIKey, error) {
+	var keys []APIKey
+	err := json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Hash == "" {
+			return nil, errors.New("API key without a hash")
+		}
+	}
+	return keys, nil
+}
+
+// refresh reloads the file if it changed since it was last read
+func (s *FileKeyStore) refresh() {
+	if clock.Since(s.lastChecked) < fileKeyStoreCheckInterval {
+		return
+	}
+	s.lastChecked = clock.Now()
+	info, err := os.Stat(s.location)
+	if err != nil || info.ModTime().Equal(s.modified) {
+		return
+	}
+	err = s.load()
+	if err != nil {
+		logger.Log(logger.ERR, "Could not reload API keys from "+s.location+": "+err.Error())
+	}
+}
+
+// Get returns the key with the hash
+func (s *FileKeyStore) Get(hash string) (APIKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refresh()
+	return s.memory.Get(hash)
+}
+
+// Put adds or replaces a key and saves the file
+func (s *FileKeyStore) Put(key APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refresh()
+	s.memory.Put(key)
+	return s.save()
+}
+
+// Delete removes the key with the hash and saves the file
+func (s *FileKeyStore) Delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refresh()
+	err := s.memory.Delete(hash)
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// List returns all keys
+func (s *FileKeyStore) List() ([]APIKey, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refresh()
+	return s.memory.List()
+}
+
+// RedisKeyStore keeps API keys in Redis so they are shared by all arbor replicas
+type RedisKeyStore struct {
+	Client *redis.Client
+	//Prefix namespaces the keys in Redis
+	Prefix string
+}
+
+func (s *RedisKeyStore) redisKey(hash string) string {
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "arbor:apikey:"
+	}
+	return prefix + hash
+}
+
+// Get returns the key with the hash
+func (s *RedisKeyStore) Get(hash string) (APIKey, error) {
+	data, err := s.Client.String("GET", s.redisKey(hash))
+	if err == redis.ErrNil {
+		return APIKey{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	var key APIKey
+	err = json.Unmarshal([]byte(data), &key)
+	return key, err
+}
+
+// Put adds or replaces a key, letting Redis expire it with the key
+func (s *RedisKeyStore) Put(key APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", s.redisKey(key.Hash), string(data)}
+	if !key.Expires.IsZero() {
+		ttl := key.Expires.Sub(clock.Now())
+		if ttl <= 0 {
+			return s.Delete(key.Hash)
+		}
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+	_, err = s.Client.Do(args...)
+	return err
+}
+
+// Delete removes the key with the hash
+func (s *RedisKeyStore) Delete(hash string) error {
+	n, err := s.Client.Int("DEL", s.redisKey(hash))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// List returns all keys
+func (s *RedisKeyStore) List() ([]APIKey, error) {
+	names, err := s.Client.Scan(s.redisKey("*"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, 0, len(names))
+	for _, name := range names {
+		key, err := s.Get(name[len(s.redisKey("")):])
+		if err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -11,6 +11,7 @@
 package security
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -25,12 +26,25 @@ const (
 	MaxSize = 16 * MB
 )
 
-func SanitizeRequest(r *http.Request) {
-	if !enabled {
-		return
+// ErrBodyTooLarge is returned for request bodies larger than MaxSize, which are not sanitized
+var ErrBodyTooLarge = errors.New("request body is too large to sanitize")
+
+// SanitizeRequest strips HTML from the request body
+//
+// Bodies larger than MaxSize are left as they are and ErrBodyTooLarge is returned, rather than forwarding part of them.
+func SanitizeRequest(r *http.Request) error {
+	if !enabled || r.Body == nil {
+		return nil
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxSize+1))
+	if len(content) > MaxSize {
+		return ErrBodyTooLarge
+	}
+	if err != nil {
+		return err
 	}
-	content, _ := ioutil.ReadAll(io.LimitReader(r.Body, MaxSize))
 	sanitizedHTML := sanitize.HTML(string(content))
 	r.Body = ioutil.NopCloser(strings.NewReader(sanitizedHTML))
 	r.ContentLength = int64(len(sanitizedHTML))
+	return nil
 }
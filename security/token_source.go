@@ -0,0 +1,77 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package security
+
+import (
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// DefaultTokenLifetime is how long tokens are used for if their issuer does not say when they expire
+const DefaultTokenLifetime = 5 * time.Minute
+
+// TokenSource provides the bearer tokens arbor authenticates to a backend with
+type TokenSource interface {
+	//Token returns the current token, acquiring a new one if it is due
+	Token() (string, error)
+	//Invalidate discards the current token, e.g. after a backend rejected it, so the next call acquires a new one
+	Invalidate()
+}
+
+// tokenCache caches a token source's token, acquiring a new one before it expires so backends never see an expired token
+//
+// If a new token can not be acquired, the current one is used until it expires.
+type tokenCache struct {
+	mutex     sync.Mutex
+	token     string
+	refreshAt time.Time
+	expires   time.Time
+}
+
+// get returns the cached token, calling acquire for a new one refreshBefore it expires (zero is a third of its lifetime)
+func (c *tokenCache) get(issuer string, refreshBefore time.Duration, acquire func() (string, time.Duration, error)) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := clock.Now()
+	if c.token != "" && now.Before(c.refreshAt) {
+		return c.token, nil
+	}
+
+	token, lifetime, err := acquire()
+	if err != nil {
+		if c.token != "" && now.Before(c.expires) {
+			logger.Log(logger.ERR, "Could not acquire token from "+issuer+", using the current one: "+err.Error())
+			// Retry soon rather than on every request
+			c.refreshAt = now.Add(10 * time.Second)
+			return c.token, nil
+		}
+		return "", err
+	}
+
+	if refreshBefore <= 0 || refreshBefore >= lifetime {
+		refreshBefore = lifetime / 3
+	}
+	c.token = token
+	c.expires = now.Add(lifetime)
+	c.refreshAt = c.expires.Add(-refreshBefore)
+	return c.token, nil
+}
+
+// Invalidate discards the current token, so the next call acquires a new one
+func (c *tokenCache) Invalidate() {
+	c.mutex.Lock()
+	c.token = ""
+	c.mutex.Unlock()
+}
@@ -15,6 +15,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/arbor-dev/arbor/buildinfo"
 	"github.com/arbor-dev/arbor/logger"
 	"github.com/arbor-dev/arbor/security"
 	"github.com/arbor-dev/arbor/server"
@@ -24,6 +25,8 @@ const help = `Usage: executable [-r | --register-client client_name] [-c | --che
                    -r | --register-client client_name -> registers a client, generates a token
                    -c | --check-registration token    -> checks if a token is valid and returns name of client
                    -u | --unsecured                   -> runs arbor without the security layer
+                   --dev                              -> runs arbor unsecured in development mode
+                   -v | --version                     -> prints the version of the build
                    without args                       -> runs arbor with the security layer	`
 
 // Boot is a standard server CLI
@@ -41,6 +44,12 @@ const help = `Usage: executable [-r | --register-client client_name] [-c | --che
 // 	-u | --unsecured
 // runs arbor without the security layer
 //
+// 	--dev
+// runs arbor without the security layer in development mode (see server.DevMode)
+//
+// 	-v | --version
+// prints the version of the build
+//
 //	-l | --list-clients
 //  lists all registered client names
 //
@@ -64,6 +73,13 @@ func Boot(routes RouteCollection, addr string, port uint16) *server.ArborServer
 	} else if len(os.Args) == 2 && (os.Args[1] == "--unsecured" || os.Args[1] == "-u") {
 		logger.Log(logger.WARN, "Starting Arbor in unsecured mode")
 		srv = server.StartUnsecuredServer(routes.toServiceRoutes(), addr, port)
+	} else if len(os.Args) == 2 && os.Args[1] == "--dev" {
+		logger.Log(logger.WARN, "Starting Arbor in development mode, do not expose it")
+		server.DevMode = true
+		srv = server.StartUnsecuredServer(routes.toServiceRoutes(), addr, port)
+	} else if len(os.Args) == 2 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
+		info := Version()
+		fmt.Println(info.Version + " " + info.GitSHA + " " + info.BuildTime)
 	} else if len(os.Args) == 2 && (os.Args[1] == "--help" || os.Args[1] == "-h") {
 		fmt.Println(help)
 	} else if len(os.Args) > 1 {
@@ -75,6 +91,11 @@ func Boot(routes RouteCollection, addr string, port uint16) *server.ArborServer
 	return srv
 }
 
+// Version describes the running build: its version, git SHA, build time, enabled features and the hash of the loaded routes
+func Version() buildinfo.Info {
+	return buildinfo.Get()
+}
+
 // RegisterClient will generate a access token for a client
 //
 // Currently uses a db of client names.
@@ -0,0 +1,144 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"runtime/debug"
+	rtmetrics "runtime/metrics"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// MemoryAdmission sheds new requests while arbor nears its memory limit, off by default
+var MemoryAdmission = false
+
+// MemoryLimit is the soft memory limit in bytes arbor sets for its process when the server starts,
+// 0 leaves the limit to GOMEMLIMIT
+var MemoryLimit int64
+
+// MemoryHighWatermark is the fraction of the memory limit above which new requests are not admitted
+var MemoryHighWatermark = 0.9
+
+// MemoryAdmissionWait is how long a new request waits for memory to be freed before it is shed
+var MemoryAdmissionWait = 250 * time.Millisecond
+
+// memorySampleInterval is how often memory use is sampled
+const memorySampleInterval = 100 * time.Millisecond
+
+// memoryAdmission sheds new requests while the process nears its memory limit
+//
+// It waits on real timers rather than the clock package's, as memory is freed in real time.
+type memoryAdmission struct {
+	threshold int64
+	inUse     int64
+	stop      chan struct{}
+}
+
+// newMemoryAdmission returns nil unless MemoryAdmission is on and arbor has a memory limit
+func newMemoryAdmission() *memoryAdmission {
+	if !MemoryAdmission {
+		return nil
+	}
+	limit := MemoryLimit
+	if limit <= 0 {
+		// Passing a negative limit reads the current one without changing it
+		limit = debug.SetMemoryLimit(-1)
+	}
+	if limit == math.MaxInt64 {
+		return nil
+	}
+	m := &memoryAdmission{
+		threshold: int64(float64(limit) * MemoryHighWatermark),
+		stop:      make(chan struct{}),
+	}
+	m.sample()
+	return m
+}
+
+// applyMemoryLimit sets MemoryLimit as the soft memory limit of the process, if set
+func applyMemoryLimit() {
+	if MemoryLimit > 0 {
+		debug.SetMemoryLimit(MemoryLimit)
+	}
+}
+
+// sample reads the memory counted against the limit, as the garbage collector does
+func (m *memoryAdmission) sample() {
+	samples := []rtmetrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	rtmetrics.Read(samples)
+	if samples[0].Value.Kind() != rtmetrics.KindUint64 || samples[1].Value.Kind() != rtmetrics.KindUint64 {
+		return
+	}
+	atomic.StoreInt64(&m.inUse, int64(samples[0].Value.Uint64()-samples[1].Value.Uint64()))
+}
+
+func (m *memoryAdmission) run() {
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.sample()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *memoryAdmission) overloaded() bool {
+	return atomic.LoadInt64(&m.inUse) > m.threshold
+}
+
+// admit waits up to MemoryAdmissionWait for memory use to drop below the watermark, or until r is canceled
+func (m *memoryAdmission) admit(r *http.Request) bool {
+	if !m.overloaded() {
+		return true
+	}
+	deadline := time.NewTimer(MemoryAdmissionWait)
+	defer deadline.Stop()
+	poll := time.NewTicker(memorySampleInterval / 10)
+	defer poll.Stop()
+	for {
+		select {
+		case <-poll.C:
+			if !m.overloaded() {
+				return true
+			}
+		case <-deadline.C:
+			return false
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
+
+func (m *memoryAdmission) handler(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.admit(r) {
+			logger.LogForRequest(logger.WARN, r, "Shedding request, memory use is above "+strconv.FormatInt(m.threshold, 10)+" bytes")
+			metrics.RequestsShed.Inc("memory")
+			w.Header().Set("Retry-After", "1")
+			apierror.Write(w, r, http.StatusServiceUnavailable, "", nil)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
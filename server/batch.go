@@ -0,0 +1,204 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// BatchPath is where clients POST batches of requests, empty to not serve it
+//
+// The body is a JSON array of requests, each with a method, a path and optionally headers
+// and a JSON body. Each request is served by its route as if it had been sent on its own,
+// with the caller's headers, so routes keep their authentication and limits. The responses
+// are returned in the same order, as a JSON array of their status, headers and body.
+// With ?parallel=true the requests are served concurrently.
+var BatchPath = ""
+
+// BatchMaxRequests is the most requests a batch may hold
+var BatchMaxRequests = 20
+
+// BatchParallelism is the most requests of a parallel batch served at once
+var BatchParallelism = 4
+
+// BatchRequest is a request of a batch
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a request of a batch
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	//Body is the response's JSON body, or its body as a string if it is not JSON
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// batchRecorder keeps the response to a request of a batch
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *batchRecorder) Header() http.Header {
+	return b.header
+}
+
+func (b *batchRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *batchRecorder) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+type dispatcherKey struct{}
+
+// withDispatcher makes handler, the server's top level handler, serve the requests of the batches it serves
+//
+// The requests of a batch then pass through virtual host routing and the server's middlewares,
+// as if they had been sent on their own.
+func withDispatcher(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dispatcherKey{}, handler)))
+	})
+}
+
+// batchRoute serves batches of requests with the server's top level handler, or router, the router
+// the batch was sent to, when it is not served by a server
+func batchRoute(router http.HandlerFunc) services.Route {
+	return services.Route{
+		Name:    "Batch",
+		Method:  http.MethodPost,
+		Pattern: BatchPath,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			// Batches over the limit are refused whole, as the other routes' bodies are, rather than cut short
+			limit := middleware.MaxBodySize(r)
+			if r.ContentLength > limit {
+				middleware.WriteTooLarge(w, r, limit)
+				return
+			}
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+			if err == nil && int64(len(body)) > limit {
+				middleware.WriteTooLarge(w, r, limit)
+				return
+			}
+			var batch []BatchRequest
+			if err != nil || json.Unmarshal(body, &batch) != nil {
+				apierror.Write(w, r, http.StatusBadRequest, "Batch must be a JSON array of requests", nil)
+				return
+			}
+			if len(batch) > BatchMaxRequests {
+				apierror.Write(w, r, http.StatusRequestEntityTooLarge, "Too many requests in the batch",
+					map[string]interface{}{"max_requests": BatchMaxRequests})
+				return
+			}
+			for i, sub := range batch {
+				if sub.Method == "" || !strings.HasPrefix(sub.Path, "/") || strings.SplitN(sub.Path, "?", 2)[0] == BatchPath {
+					apierror.Write(w, r, http.StatusBadRequest, "Invalid request in the batch",
+						map[string]interface{}{"index": i})
+					return
+				}
+			}
+
+			dispatch := router
+			if handler, ok := r.Context().Value(dispatcherKey{}).(http.Handler); ok {
+				dispatch = handler.ServeHTTP
+			}
+
+			parallelism := 1
+			if parallel, _ := strconv.ParseBool(r.URL.Query().Get("parallel")); parallel && BatchParallelism > 1 {
+				parallelism = BatchParallelism
+			}
+			responses := make([]BatchResponse, len(batch))
+			slots := make(chan struct{}, parallelism)
+			var served sync.WaitGroup
+			for i, sub := range batch {
+				slots <- struct{}{}
+				served.Add(1)
+				go func(i int, sub BatchRequest) {
+					defer func() {
+						<-slots
+						served.Done()
+					}()
+					responses[i] = serveBatched(dispatch, r, i, sub)
+				}(i, sub)
+			}
+			served.Wait()
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(responses)
+		},
+	}
+}
+
+// serveBatched serves the request of the caller's batch r at index i
+func serveBatched(dispatch http.HandlerFunc, r *http.Request, i int, sub BatchRequest) BatchResponse {
+	// Each request of the batch is logged and traced apart, under the batch's ID
+	ctx := requestid.NewContext(r.Context(), requestid.FromRequest(r)+"-"+strconv.Itoa(i))
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(sub.Method), sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return BatchResponse{Status: http.StatusBadRequest}
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.Host = r.Host
+	req.TLS = r.TLS
+	req.RequestURI = sub.Path
+	for k, vs := range r.Header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	req.Header.Del("Content-Length")
+	req.Header.Del("Content-Type")
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range sub.Headers {
+		req.Header.Set(k, v)
+	}
+
+	recorder := &batchRecorder{header: http.Header{}}
+	dispatch(recorder, req)
+	response := BatchResponse{Status: recorder.status, Headers: map[string]string{}}
+	if response.Status == 0 {
+		response.Status = http.StatusOK
+	}
+	for k := range recorder.header {
+		response.Headers[k] = recorder.header.Get(k)
+	}
+	body := recorder.body.Bytes()
+	if json.Valid(body) {
+		response.Body = body
+	} else if len(body) > 0 {
+		response.Body, _ = json.Marshal(string(body))
+	}
+	return response
+}
@@ -0,0 +1,230 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+)
+
+// MonitoredCertificates are PEM files of certificates, such as those pinned for backends, whose expiry is monitored
+var MonitoredCertificates []string
+
+// CertificateCheckInterval is how often certificate files are checked for changes and expiry
+var CertificateCheckInterval = time.Minute
+
+// CertificateExpiryWarning is how long before a certificate expires that warnings are logged
+var CertificateExpiryWarning = 30 * 24 * time.Hour
+
+// servedCertificate is a certificate served to clients and the files it is loaded from
+type servedCertificate struct {
+	certFile       string
+	keyFile        string
+	ocspStapleFile string
+	cert           *tls.Certificate
+	modified       time.Time
+}
+
+// filesModified is the last time any of the certificate's files changed
+func (c *servedCertificate) filesModified() time.Time {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile, c.ocspStapleFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+func newServedCertificate(certFile string, keyFile string, ocspStapleFile string) (*servedCertificate, error) {
+	c := &servedCertificate{certFile: certFile, keyFile: keyFile, ocspStapleFile: ocspStapleFile}
+	cert, err := loadCertificate(certFile, keyFile, ocspStapleFile)
+	if err != nil {
+		return nil, err
+	}
+	c.cert = cert
+	c.modified = c.filesModified()
+	return c, nil
+}
+
+// certificateMonitor serves the current certificates, reloading them when their files change,
+// and reports when certificates near expiry
+type certificateMonitor struct {
+	mutex  sync.RWMutex
+	served *servedCertificate
+	//hosts are the certificates of virtual hosts, by host name
+	hosts map[string]*servedCertificate
+	stop  chan struct{}
+}
+
+// newCertificateMonitor returns nil if there are no certificates to serve or monitor
+func newCertificateMonitor() (*certificateMonitor, error) {
+	if !tlsEnabled() && len(MonitoredCertificates) == 0 {
+		return nil, nil
+	}
+	m := &certificateMonitor{hosts: map[string]*servedCertificate{}, stop: make(chan struct{})}
+	if tlsEnabled() {
+		served, err := newServedCertificate(TLSCertFile, TLSKeyFile, TLSOCSPStapleFile)
+		if err != nil {
+			return nil, err
+		}
+		m.served = served
+		for name, vhost := range VirtualHosts {
+			if vhost.CertFile == "" || vhost.KeyFile == "" {
+				continue
+			}
+			served, err := newServedCertificate(vhost.CertFile, vhost.KeyFile, "")
+			if err != nil {
+				return nil, errors.New(name + ": " + err.Error())
+			}
+			m.hosts[strings.ToLower(name)] = served
+		}
+	}
+	m.checkExpiry()
+	return m, nil
+}
+
+// getCertificate serves the certificate of the virtual host the client asks for, or the server's
+func (m *certificateMonitor) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	name, ok := lookupHost(hostName(hello.ServerName), func(name string) bool {
+		_, exists := m.hosts[name]
+		return exists
+	})
+	if ok {
+		return m.hosts[name].cert, nil
+	}
+	return m.served.cert, nil
+}
+
+// reload replaces the served certificates whose files changed, keeping the old ones if they can not be loaded
+func (m *certificateMonitor) reload() {
+	if m.served == nil {
+		return
+	}
+	served := []*servedCertificate{m.served}
+	for _, c := range m.hosts {
+		served = append(served, c)
+	}
+	for _, c := range served {
+		modified := c.filesModified()
+		if !modified.After(c.modified) {
+			continue
+		}
+		cert, err := loadCertificate(c.certFile, c.keyFile, c.ocspStapleFile)
+		if err != nil {
+			// The files may be part way through being replaced, so they are retried next check
+			logger.Log(logger.ERR, "Could not reload TLS certificate from "+c.certFile+": "+err.Error())
+			continue
+		}
+		m.mutex.Lock()
+		c.cert = cert
+		c.modified = modified
+		m.mutex.Unlock()
+		logger.Log(logger.INFO, "Reloaded TLS certificate from "+c.certFile)
+	}
+}
+
+// checkExpiry updates the expiry metric of each certificate and warns of those expiring soon
+func (m *certificateMonitor) checkExpiry() {
+	if m.served != nil {
+		served := []*servedCertificate{m.served}
+		for _, c := range m.hosts {
+			served = append(served, c)
+		}
+		for _, c := range served {
+			m.mutex.RLock()
+			cert, err := x509.ParseCertificate(c.cert.Certificate[0])
+			m.mutex.RUnlock()
+			if err == nil {
+				reportExpiry(c.certFile, cert.NotAfter)
+			}
+		}
+	}
+	for _, file := range MonitoredCertificates {
+		notAfter, err := earliestExpiry(file)
+		if err != nil {
+			logger.Log(logger.ERR, "Could not check expiry of "+file+": "+err.Error())
+			continue
+		}
+		reportExpiry(file, notAfter)
+	}
+}
+
+func reportExpiry(file string, notAfter time.Time) {
+	remaining := notAfter.Sub(clock.Now())
+	metrics.CertificateExpiry.Set(remaining.Seconds(), file)
+	if remaining <= 0 {
+		logger.Log(logger.ERR, "Certificate "+file+" expired at "+notAfter.Format(time.RFC3339))
+	} else if remaining < CertificateExpiryWarning {
+		logger.Log(logger.WARN, "Certificate "+file+" expires at "+notAfter.Format(time.RFC3339))
+	}
+}
+
+// earliestExpiry returns when the first of the certificates in a PEM file expires
+func earliestExpiry(file string) (time.Time, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var earliest time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	if earliest.IsZero() {
+		return time.Time{}, errors.New("no certificates found")
+	}
+	return earliest, nil
+}
+
+func (m *certificateMonitor) run() {
+	ticker := clock.NewTicker(CertificateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			m.reload()
+			m.checkExpiry()
+		case <-m.stop:
+			return
+		}
+	}
+}
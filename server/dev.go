@@ -0,0 +1,315 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// DevMode makes local iteration painless: arbor serves TLS with a generated certificate, dumps
+// backend traffic unredacted to a colored console, relaxes CORS and reloads its configuration when it changes
+//
+// It is insecure and verbose, never turn it on in production.
+var DevMode = false
+
+// DevDirectory is where dev mode keeps its generated CA and certificate
+//
+// The CA is reused between runs, so it only has to be trusted once (its certificate is ca.pem).
+var DevDirectory = ".arbor-dev"
+
+// DevConfigFiles are watched in dev mode, DevReload is called when any of them changes
+var DevConfigFiles []string
+
+// DevReload re-reads the configuration after one of DevConfigFiles changed, returning the routes to serve
+//
+// If it fails, or the routes fail ValidateRoutes, the old routes are kept.
+var DevReload func() (services.RouteCollection, error)
+
+// DevReloadInterval is how often DevConfigFiles are checked for changes
+var DevReloadInterval = time.Second
+
+// DevReloadProbation is how long a reloaded configuration is watched before it is known to be good, 0 to trust it at once
+//
+// If more than DevReloadMaxErrorRate of the requests it serves in that time fail with a 5xx
+// status, the last known good configuration is restored.
+var DevReloadProbation = 30 * time.Second
+
+// DevReloadMaxErrorRate is the share of failed requests, from 0 to 1, at which a configuration on probation is rolled back
+var DevReloadMaxErrorRate = 0.5
+
+// DevReloadMinRequests is how many requests a configuration on probation must serve before it can be rolled back
+var DevReloadMinRequests int64 = 10
+
+// enableDevMode applies the settings of dev mode, generating a certificate if none is configured
+func enableDevMode() error {
+	logger.ColoredOutput = true
+	logger.LogLevel = logger.DEBUG
+	logger.DumpTraffic = true
+	logger.RedactSecrets = false
+	if tlsEnabled() {
+		return nil
+	}
+	certFile, keyFile, err := devCertificate()
+	if err != nil {
+		return err
+	}
+	TLSCertFile, TLSKeyFile = certFile, keyFile
+	logger.Log(logger.WARN, "Serving TLS with a development certificate, trust "+filepath.Join(DevDirectory, "ca.pem")+" to accept it")
+	return nil
+}
+
+// devCertificate issues a certificate for localhost and the virtual hosts from the dev CA, creating the CA if needed
+func devCertificate() (string, string, error) {
+	if err := os.MkdirAll(DevDirectory, 0700); err != nil {
+		return "", "", err
+	}
+	caFile, caKeyFile := filepath.Join(DevDirectory, "ca.pem"), filepath.Join(DevDirectory, "ca-key.pem")
+	ca, caKey, err := loadDevCA(caFile, caKeyFile)
+	if os.IsNotExist(err) {
+		ca, caKey, err = createDevCA(caFile, caKeyFile)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for name := range VirtualHosts {
+		template.DNSNames = append(template.DNSNames, strings.ToLower(name))
+	}
+	// The certificate is issued on every start, so it covers the virtual hosts currently configured
+	certFile, keyFile := filepath.Join(DevDirectory, "cert.pem"), filepath.Join(DevDirectory, "key.pem")
+	if err := issueDevCertificate(template, ca, caKey, 90*24*time.Hour, certFile, keyFile); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func createDevCA(caFile string, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "arbor development CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	if err := issueDevCertificate(template, nil, nil, 10*365*24*time.Hour, caFile, caKeyFile); err != nil {
+		return nil, nil, err
+	}
+	logger.Log(logger.INFO, "Created a development CA in "+caFile)
+	return loadDevCA(caFile, caKeyFile)
+}
+
+func loadDevCA(caFile string, caKeyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(caFile, caKeyFile)
+	if err != nil {
+		// LoadX509KeyPair wraps the error of reading the files, so check they exist first
+		if _, statErr := os.Stat(caFile); os.IsNotExist(statErr) {
+			return nil, nil, statErr
+		}
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New(caKeyFile + " is not an ECDSA key")
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// issueDevCertificate signs template with the CA, or self signs it if ca is nil, and writes it and its new key
+func issueDevCertificate(template *x509.Certificate, ca *x509.Certificate, caKey *ecdsa.PrivateKey, validity time.Duration, certFile string, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = clock.Now().Add(-time.Hour)
+	template.NotAfter = clock.Now().Add(validity)
+	if ca == nil {
+		ca, caKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// reloadingHandler serves requests with the routes of the latest configuration
+type reloadingHandler struct {
+	current atomic.Value
+	//probation holds the *probation of the configuration being served, nil once it is known to be good
+	probation atomic.Value
+	//good is the last configuration known to be good, restored if the one on probation fails
+	good *http.Handler
+	//modified is when the configuration being served last changed
+	modified time.Time
+}
+
+// probation counts the requests served by a reloaded configuration and those which failed
+type probation struct {
+	ends     time.Time
+	requests int64
+	failures int64
+}
+
+func newReloadingHandler(handler http.Handler) *reloadingHandler {
+	h := &reloadingHandler{modified: configModified(), good: &handler}
+	h.current.Store(&handler)
+	h.probation.Store((*probation)(nil))
+	return h
+}
+
+func (h *reloadingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler := *h.current.Load().(*http.Handler)
+	p := h.probation.Load().(*probation)
+	if p == nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	s := &StatusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	handler.ServeHTTP(s, r)
+	atomic.AddInt64(&p.requests, 1)
+	if s.status >= http.StatusInternalServerError {
+		atomic.AddInt64(&p.failures, 1)
+	}
+}
+
+// reload serves the routes of a new configuration, on probation if DevReloadProbation is set
+func (h *reloadingHandler) reload(routes services.RouteCollection) {
+	var handler http.Handler = newHostRouter(NewTrieRouter(routes), routes)
+	if DevReloadProbation > 0 {
+		h.probation.Store(&probation{ends: clock.Now().Add(DevReloadProbation)})
+	} else {
+		h.good = &handler
+		h.probation.Store((*probation)(nil))
+	}
+	h.current.Store(&handler)
+	// The configuration may have changed the backends to keep warm
+	go proxy.Prewarm()
+	logger.Log(logger.SPEC, "Reloaded the configuration")
+	audit.Record(audit.Event{Type: audit.ConfigurationChanged, Reason: "configuration reloaded",
+		Details: map[string]interface{}{"files": DevConfigFiles, "routes": len(routes)}})
+}
+
+// checkProbation rolls back the configuration on probation if too many of its requests failed, or keeps it once its probation ends
+func (h *reloadingHandler) checkProbation() {
+	p := h.probation.Load().(*probation)
+	if p == nil {
+		return
+	}
+	requests, failures := atomic.LoadInt64(&p.requests), atomic.LoadInt64(&p.failures)
+	if requests > 0 && requests >= DevReloadMinRequests && float64(failures)/float64(requests) > DevReloadMaxErrorRate {
+		h.current.Store(h.good)
+		h.probation.Store((*probation)(nil))
+		message := fmt.Sprintf("%d of %d requests failed since the configuration was reloaded", failures, requests)
+		logger.Log(logger.ERR, "Rolled back to the last known good configuration: "+message)
+		metrics.ConfigRollbacks.Inc("errors")
+		audit.Record(audit.Event{Type: audit.ConfigurationChanged, Reason: "configuration rolled back",
+			Details: map[string]interface{}{"requests": requests, "failures": failures}})
+		return
+	}
+	if !clock.Now().Before(p.ends) {
+		h.good = h.current.Load().(*http.Handler)
+		h.probation.Store((*probation)(nil))
+		logger.Log(logger.INFO, "The reloaded configuration passed its probation")
+	}
+}
+
+// watchConfig reloads the configuration whenever DevConfigFiles change until stop is called
+func (h *reloadingHandler) watchConfig() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		modified := h.modified
+		ticker := clock.NewTicker(DevReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				h.checkProbation()
+				latest := configModified()
+				if !latest.After(modified) {
+					continue
+				}
+				modified = latest
+				routes, err := DevReload()
+				if err == nil {
+					err = ValidateRoutes(routes)
+				}
+				if err != nil {
+					logger.Log(logger.ERR, "Could not reload the configuration, keeping the old routes: "+err.Error())
+					metrics.ConfigRollbacks.Inc("invalid")
+					continue
+				}
+				h.reload(routes)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// configModified is the last time any of DevConfigFiles changed
+func configModified() time.Time {
+	var latest time.Time
+	for _, file := range DevConfigFiles {
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
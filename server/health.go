@@ -0,0 +1,58 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// LivenessPath, ReadinessPath and HealthDetailsPath are where arbor's health is served, empty to not serve them
+//
+// Routes registered for the same paths take precedence.
+var (
+	LivenessPath      = "/healthz"
+	ReadinessPath     = "/readyz"
+	HealthDetailsPath = "/health/details"
+)
+
+func init() {
+	health.RegisterDetail("backend_load", func() interface{} { return proxy.BackendLoads() })
+}
+
+// healthRoutes serves the health endpoints which are enabled
+func healthRoutes() services.RouteCollection {
+	var routes services.RouteCollection
+	endpoints := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"Liveness", LivenessPath, health.LivenessHandler},
+		{"Readiness", ReadinessPath, health.ReadinessHandler},
+		{"HealthDetails", HealthDetailsPath, health.DetailsHandler},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.path == "" {
+			continue
+		}
+		routes = append(routes, services.Route{
+			Name:    endpoint.name,
+			Method:  http.MethodGet,
+			Pattern: endpoint.path,
+			Handler: endpoint.handler,
+		})
+	}
+	return routes
+}
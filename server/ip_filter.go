@@ -0,0 +1,41 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// filterIPs rejects callers the route or the gateway does not allow with 403 Forbidden, before the handler runs
+func filterIPs(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := services.RouteFromContext(r.Context())
+		ip := clientip.FromRequest(r)
+		allowed, err := security.AllowsIP(ip, route)
+		if err != nil {
+			logger.LogForRequest(logger.ERR, r, "Invalid network list, refusing callers of "+route.Name+": "+err.Error())
+		}
+		if !allowed {
+			logger.LogForRequest(logger.WARN, r, "Denied "+ip.String()+" access to "+route.Name+": network not allowed")
+			audit.RecordRequest(r, audit.AuthorizationDenied, "", "network not allowed", map[string]interface{}{"ip": ip.String()})
+			apierror.Write(w, r, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/arbor-dev/arbor/jobs"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// jobsRoute serves the jobs started through job routes
+func jobsRoute() services.Route {
+	return services.Route{
+		Name:    "Jobs",
+		Method:  http.MethodGet,
+		Pattern: jobs.Path + "/{id}",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			// Jobs are served to the client which started them, authenticated as when it did
+			if proxy.RunChain(w, r) {
+				jobs.Handler(w, r)
+			}
+		},
+	}
+}
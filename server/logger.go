@@ -11,16 +11,31 @@
 package server
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/arbor-dev/arbor/alerts"
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/clock"
 	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/memo"
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/services"
 )
 
+// StatusResponseWriter records the status and size of a response for the access log, passing
+// flushes and hijacks through to the ResponseWriter it wraps
 type StatusResponseWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (rec *StatusResponseWriter) WriteHeader(code int) {
@@ -28,15 +43,95 @@ func (rec *StatusResponseWriter) WriteHeader(code int) {
 	rec.ResponseWriter.WriteHeader(code)
 }
 
-func logRequest(method string, requestURI string, routeName string, responseStatus int, latency time.Duration) {
-	logger.Log(logger.INFO, fmt.Sprintf("%s\t%s\t%s\t%d\t%s", method, requestURI, routeName, responseStatus, latency))
+func (rec *StatusResponseWriter) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *StatusResponseWriter) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to the handler, for protocols which take it over from HTTP
+func (rec *StatusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("server: the connection can not be hijacked")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (rec *StatusResponseWriter) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// countingReader counts the bytes of the request body read by the handler
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytes += int64(n)
+	return n, err
+}
+
+func logRequest(r *http.Request, routeName string, responseStatus int, latency time.Duration) {
+	logger.LogForRequest(logger.INFO, r, fmt.Sprintf("%s\t%s\t%s\t%d\t%s", r.Method, r.RequestURI, routeName, responseStatus, latency))
+}
+
+// withRoute makes the route serving the request, and a memo to share lookups between its stages, available to its handlers
+func withRoute(inner http.Handler, route services.Route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(memo.NewContext(services.NewContext(r.Context(), route))))
+	})
+}
+
+// requestID assigns each request an ID and echoes it back to the client
+func requestID(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, id := requestid.Ensure(r)
+		w.Header().Set(constants.RequestIDHeaderField, id)
+		inner.ServeHTTP(w, r)
+	})
 }
 
 func httpLogger(inner http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		start := clock.Now()
 		s := &StatusResponseWriter{ResponseWriter: w, status: 200}
+		entry := &logger.AccessEntry{
+			RemoteAddr: r.RemoteAddr,
+			ClientIP:   clientip.Address(r),
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+			RequestID:  requestid.FromRequest(r),
+			Route:      name,
+			Time:       start,
+		}
+		entry.User, _, _ = r.BasicAuth()
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+		r = r.WithContext(logger.NewAccessContext(r.Context(), entry))
 		inner.ServeHTTP(s, r)
-		logRequest(r.Method, r.RequestURI, name, s.status, time.Since(start))
+		entry.Latency = clock.Since(start)
+		entry.Status = s.status
+		entry.BytesSent = s.bytes
+		entry.BytesReceived = body.bytes
+		logRequest(r, name, s.status, entry.Latency)
+		logger.LogAccess(entry)
+		metrics.RecordRequest(r, s.status, entry.Latency)
+		alerts.RecordRequest(r, s.status)
 	})
 }
@@ -0,0 +1,86 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// MigrationsPath is where the progress of backend migrations is served, empty to not serve it
+//
+// GET lists the migrations and the parity of their backends' responses, POST to
+// MigrationsPath/{backend}/promote makes the new backend of a migration serve its requests.
+// Promoting needs an admin credential, see health.AuthorizesChange.
+var MigrationsPath = ""
+
+// MigrationsExposure is who may see and promote migrations
+var MigrationsExposure = health.Local
+
+// authorizeChange refuses callers who may not change the gateway's state with 403 Forbidden, see health.AuthorizesChange
+func authorizeChange(w http.ResponseWriter, r *http.Request) bool {
+	if health.AuthorizesChange(r) {
+		return true
+	}
+	audit.RecordRequest(r, audit.AuthenticationFailed, "", "admin credential missing or invalid", nil)
+	apierror.Write(w, r, http.StatusForbidden, "An admin token or pinned certificate is required", nil)
+	return false
+}
+
+// migrationRoutes serve the progress of migrations and their promotion
+func migrationRoutes() []services.Route {
+	exposed := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !MigrationsExposure.Allows(r) {
+				apierror.Write(w, r, http.StatusNotFound, "", nil)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			handler(w, r)
+		}
+	}
+	return []services.Route{
+		{
+			Name:    "Migrations",
+			Method:  http.MethodGet,
+			Pattern: MigrationsPath,
+			Handler: exposed(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(proxy.Migrations())
+			}),
+		},
+		{
+			Name:    "PromoteMigration",
+			Method:  http.MethodPost,
+			Pattern: MigrationsPath + "/{backend}/promote",
+			Handler: exposed(func(w http.ResponseWriter, r *http.Request) {
+				if !authorizeChange(w, r) {
+					return
+				}
+				backend := mux.Vars(r)["backend"]
+				if err := proxy.PromoteMigration(backend); err != nil {
+					apierror.Write(w, r, http.StatusNotFound, err.Error(), map[string]interface{}{"backend": backend})
+					return
+				}
+				audit.RecordRequest(r, audit.ConfigurationChanged, "", "migration promoted", map[string]interface{}{"backend": backend})
+				w.WriteHeader(http.StatusNoContent)
+			}),
+		},
+	}
+}
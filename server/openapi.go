@@ -0,0 +1,48 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/openapi"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// OpenAPIPath is the path the OpenAPI document describing the registered routes is served at, empty to not serve it
+var OpenAPIPath = ""
+
+// OpenAPIInfo is the title and version given in the served OpenAPI document
+var OpenAPIInfo = openapi.Info{Title: "arbor", Version: "1.0.0"}
+
+// openAPIRoute serves the OpenAPI document of routes
+func openAPIRoute(routes services.RouteCollection) services.Route {
+	document, err := json.MarshalIndent(openapi.FromRoutes(routes, OpenAPIInfo), "", "  ")
+	if err != nil {
+		logger.Log(logger.ERR, "Could not generate OpenAPI document: "+err.Error())
+	}
+	return services.Route{
+		Name:    "OpenAPI",
+		Method:  http.MethodGet,
+		Pattern: OpenAPIPath,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if err != nil {
+				apierror.Write(w, r, http.StatusInternalServerError, "", nil)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(document)
+		},
+	}
+}
@@ -0,0 +1,210 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Router dispatches requests to routes using a trie of path segments
+//
+// Lookup is proportional to the length of the path rather than the number of routes,
+// so gateways aggregating many services route as quickly as small ones. Each route
+// keeps its own mux route for the final match, so mux.Vars works in handlers and the
+// first registered of several matching routes wins, as with a mux.Router.
+type Router struct {
+	root     *routeNode
+	fallback []*tableEntry
+	notFound http.Handler
+	count    int
+}
+
+// tableEntry is a route in the table
+type tableEntry struct {
+	index  int
+	method string
+	router *mux.Router
+}
+
+type routeNode struct {
+	static  map[string]*routeNode
+	params  []*paramNode
+	entries []*tableEntry
+}
+
+type paramNode struct {
+	template string
+	pattern  *regexp.Regexp
+	node     *routeNode
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{static: make(map[string]*routeNode)}
+}
+
+// newRouteTable creates an empty table which responds with notFound when no route matches
+func newRouteTable(notFound http.Handler) *Router {
+	return &Router{root: newRouteNode(), notFound: notFound}
+}
+
+// Handle adds a route for a method and mux path template
+func (t *Router) Handle(method string, pattern string, name string, handler http.Handler) {
+	router := mux.NewRouter()
+	router.Methods(method).Path(pattern).Name(name).Handler(handler)
+	entry := &tableEntry{index: t.count, method: strings.ToUpper(method), router: router}
+	t.count++
+
+	node := t.root
+	for _, segment := range splitPath(pattern) {
+		if !strings.Contains(segment, "{") {
+			child, exists := node.static[segment]
+			if !exists {
+				child = newRouteNode()
+				node.static[segment] = child
+			}
+			node = child
+			continue
+		}
+		pattern, indexable := segmentPattern(segment)
+		if !indexable {
+			t.fallback = append(t.fallback, entry)
+			return
+		}
+		node = node.paramChild(segment, pattern)
+	}
+	node.entries = append(node.entries, entry)
+}
+
+func (n *routeNode) paramChild(template string, pattern *regexp.Regexp) *routeNode {
+	for _, p := range n.params {
+		if p.template == template {
+			return p.node
+		}
+	}
+	p := &paramNode{template: template, pattern: pattern, node: newRouteNode()}
+	n.params = append(n.params, p)
+	return p.node
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+// segmentPattern compiles a path segment containing variables to a regexp matching the whole segment
+//
+// Segments whose variables may match a "/" can not be indexed by segment.
+func segmentPattern(segment string) (*regexp.Regexp, bool) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for len(segment) > 0 {
+		start := strings.Index(segment, "{")
+		if start < 0 {
+			expr.WriteString(regexp.QuoteMeta(segment))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(segment[:start]))
+		depth, end := 0, -1
+		for i := start; i < len(segment) && end < 0; i++ {
+			switch segment[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			return nil, false
+		}
+		variable := segment[start+1 : end]
+		pattern := "[^/]+"
+		if colon := strings.Index(variable, ":"); colon >= 0 {
+			pattern = variable[colon+1:]
+		}
+		if strings.ContainsAny(pattern, "./\\") || strings.Contains(pattern, "[^") {
+			return nil, false
+		}
+		expr.WriteString("(?:" + pattern + ")")
+		segment = segment[end+1:]
+	}
+	expr.WriteString("$")
+	re, err := regexp.Compile(expr.String())
+	return re, err == nil
+}
+
+// earliest returns the first registered of best and the routes under n matching the request,
+// whose remaining path segments are segments
+func (n *routeNode) earliest(segments []string, r *http.Request, best *tableEntry) *tableEntry {
+	if len(segments) == 0 {
+		return earliestOf(n.entries, r, best)
+	}
+	if child, exists := n.static[segments[0]]; exists {
+		best = child.earliest(segments[1:], r, best)
+	}
+	for _, p := range n.params {
+		if p.pattern.MatchString(segments[0]) {
+			best = p.node.earliest(segments[1:], r, best)
+		}
+	}
+	return best
+}
+
+// earliestOf returns the first registered of best and the entries matching the request
+func earliestOf(entries []*tableEntry, r *http.Request, best *tableEntry) *tableEntry {
+	var match mux.RouteMatch
+	for _, entry := range entries {
+		if (best == nil || entry.index < best.index) && entry.method == r.Method && entry.router.Match(r, &match) {
+			best = entry
+		}
+	}
+	return best
+}
+
+// cleanPath returns the canonical path for p, eliminating . and .. elements
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	return np
+}
+
+// ServeHTTP dispatches the request to the first registered route matching it
+func (t *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Clean path to canonical form and redirect
+	if p := cleanPath(r.URL.Path); p != r.URL.Path {
+		url := *r.URL
+		url.Path = p
+		w.Header().Set("Location", url.String())
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
+	}
+
+	best := earliestOf(t.fallback, r, t.root.earliest(splitPath(r.URL.Path), r, nil))
+	if best == nil {
+		t.notFound.ServeHTTP(w, r)
+		return
+	}
+	best.router.ServeHTTP(w, r)
+}
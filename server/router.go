@@ -11,29 +11,46 @@
 package server
 
 import (
-	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/arbor-dev/arbor/alerts"
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/jobs"
+	"github.com/arbor-dev/arbor/metrics"
 	"github.com/arbor-dev/arbor/services"
 	"github.com/arbor-dev/arbor/proxy"
 	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/proxy/middleware"
 	"github.com/gorilla/mux"
 )
 
 func notFound(w http.ResponseWriter, r *http.Request) {
-	logRequest(r.Method, r.RequestURI, "UNKNOWN", http.StatusNotFound, time.Duration(0))
-	w.WriteHeader(http.StatusNotFound)
-	io.WriteString(w, "404 Not Found")
+	logRequest(r, "UNKNOWN", http.StatusNotFound, time.Duration(0))
+	metrics.RecordRequest(r, http.StatusNotFound, time.Duration(0))
+	apierror.Write(w, r, http.StatusNotFound, "", nil)
 }
 
 func corsPreflight(methods []string) http.HandlerFunc {
 	allowedMethods := strings.Join(methods, ", ")
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", proxy.AccessControlPolicy)
+		if policy, ok := middleware.AccessControlPolicyFromContext(r.Context()); ok {
+			w.Header().Set("Access-Control-Allow-Origin", middleware.AllowedOrigin(policy, r.Header.Get("Origin")))
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", proxy.AccessControlPolicy)
+		}
 		w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
 		w.Header().Set("Access-Control-Allow-Headers", constants.AccessControlAllowHeaders)
+		// Dev mode allows any origin, including with credentials, to send any header
+		if DevMode && r.Header.Get("Origin") != "" {
+			w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
@@ -54,35 +71,100 @@ func buildPreflightRoutes(routes services.RouteCollection) services.RouteCollect
 	var preflightRoutes []services.Route
 
 	for pattern, methods := range allowedMethods {
-		preflightRoutes = append(preflightRoutes, services.Route {
-			"Preflight",
-			"OPTIONS",
-			pattern,
-			corsPreflight(methods),
+		preflightRoutes = append(preflightRoutes, services.Route{
+			Name:    "Preflight",
+			Method:  "OPTIONS",
+			Pattern: pattern,
+			Handler: corsPreflight(methods),
 		})
 	}
 
 	return preflightRoutes
 }
 
+// NewRouter creates a mux.Router serving the routes
+//
+// NewTrieRouter serves the same routes, matching them in time proportional to the length of
+// the path rather than the number of routes. ArborServer uses it.
 func NewRouter(routes services.RouteCollection) *mux.Router {
-
-	routes = append(routes, buildPreflightRoutes(routes)...)
-
 	router := mux.NewRouter()
-	router.NotFoundHandler = http.HandlerFunc(notFound)
-	for _, route := range routes {
-		var handler http.Handler
-
-		handler = route.Handler
-		//Log request
-		handler = httpLogger(handler, route.Name)
-
+	router.NotFoundHandler = notFoundHandler()
+	for _, route := range gatewayRoutes(routes, router) {
 		router.
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(handler)
+			Handler(routeHandler(route))
 	}
 	return router
 }
+
+// NewTrieRouter creates a Router serving the routes
+func NewTrieRouter(routes services.RouteCollection) *Router {
+	router := newRouteTable(notFoundHandler())
+	for _, route := range gatewayRoutes(routes, router) {
+		router.Handle(route.Method, route.Pattern, route.Name, routeHandler(route))
+	}
+	return router
+}
+
+func notFoundHandler() http.Handler {
+	return requestID(withSecurityHeaders(http.HandlerFunc(notFound)))
+}
+
+// gatewayRoutes returns the routes followed by the gateway's own routes and the CORS preflight
+// routes, batches are dispatched to router
+func gatewayRoutes(routes services.RouteCollection, router http.Handler) services.RouteCollection {
+	// Copy the routes so the caller's slice is not appended to
+	routes = routes[:len(routes):len(routes)]
+	served := routes
+	if OpenAPIPath != "" {
+		routes = append(routes, openAPIRoute(served))
+	}
+	if TopologyPath != "" {
+		routes = append(routes, topologyRoute(served))
+	}
+	routes = append(routes, healthRoutes()...)
+	if VersionPath != "" {
+		routes = append(routes, versionRoute())
+	}
+	if jobs.Path != "" {
+		routes = append(routes, jobsRoute())
+	}
+	if MigrationsPath != "" {
+		routes = append(routes, migrationRoutes()...)
+	}
+	if RoutesPath != "" {
+		routes = append(routes, routeListingRoutes(served)...)
+	}
+	if SnapshotPath != "" {
+		routes = append(routes, snapshotRoutes(served)...)
+	}
+	if BatchPath != "" {
+		routes = append(routes, batchRoute(router.ServeHTTP))
+	}
+	buildinfo.SetConfigHash(routesHash(routes))
+	alerts.SetRoutes(served)
+	metrics.LoadLatencyClasses()
+
+	return append(routes, buildPreflightRoutes(routes)...)
+}
+
+// routeHandler wraps the handler of a route with the gateway's per request handling
+func routeHandler(route services.Route) http.Handler {
+	var handler http.Handler
+
+	handler = route.Handler
+	//Refuse callers from denied networks
+	handler = filterIPs(handler)
+	//Add security headers to every response
+	handler = withSecurityHeaders(handler)
+	//Log request
+	handler = httpLogger(handler, route.Name)
+	//Expose route to handlers
+	handler = withRoute(handler, route)
+	//Assign request ID
+	handler = requestID(handler)
+
+	return handler
+}
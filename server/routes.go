@@ -0,0 +1,119 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// RoutesPath is where the registered routes and the teams owning them are listed, empty to not list them
+//
+// GET lists every route with its Docs, ?owner=<team> only the routes of a team.
+// RoutesPath/deprecated reports the deprecated routes, soonest sunset first, with
+// who to contact about them.
+var RoutesPath = ""
+
+// RoutesExposure is who may see the route listing
+var RoutesExposure = health.Local
+
+// RouteListing is a route of the route listing
+type RouteListing struct {
+	Name        string   `json:"name"`
+	Method      string   `json:"method"`
+	Pattern     string   `json:"pattern"`
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Contact     string   `json:"contact,omitempty"`
+	Deprecated  string   `json:"deprecated,omitempty"`
+	Sunset      string   `json:"sunset,omitempty"`
+}
+
+// listRoutes lists the routes in the order they were registered
+func listRoutes(routes services.RouteCollection) []RouteListing {
+	listings := make([]RouteListing, 0, len(routes))
+	for _, route := range routes {
+		listing := RouteListing{Name: route.Name, Method: route.Method, Pattern: route.Pattern}
+		if docs := route.Docs; docs != nil {
+			listing.Summary = docs.Summary
+			listing.Description = docs.Description
+			listing.Tags = docs.Tags
+			listing.Owner = docs.Owner
+			listing.Contact = docs.Contact
+			listing.Deprecated = docs.Deprecated
+			listing.Sunset = docs.Sunset
+		}
+		listings = append(listings, listing)
+	}
+	return listings
+}
+
+// routeListingRoutes serve the listing and deprecation report of routes
+func routeListingRoutes(routes services.RouteCollection) []services.Route {
+	listings := listRoutes(routes)
+	exposed := func(handler func(r *http.Request) []RouteListing) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !RoutesExposure.Allows(r) {
+				apierror.Write(w, r, http.StatusNotFound, "", nil)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(handler(r))
+		}
+	}
+	return []services.Route{
+		{
+			Name:    "Routes",
+			Method:  http.MethodGet,
+			Pattern: RoutesPath,
+			Handler: exposed(func(r *http.Request) []RouteListing {
+				owner := r.URL.Query().Get("owner")
+				if owner == "" {
+					return listings
+				}
+				owned := []RouteListing{}
+				for _, listing := range listings {
+					if listing.Owner == owner {
+						owned = append(owned, listing)
+					}
+				}
+				return owned
+			}),
+		},
+		{
+			Name:    "DeprecatedRoutes",
+			Method:  http.MethodGet,
+			Pattern: RoutesPath + "/deprecated",
+			Handler: exposed(func(r *http.Request) []RouteListing {
+				deprecated := []RouteListing{}
+				for _, listing := range listings {
+					if listing.Deprecated != "" {
+						deprecated = append(deprecated, listing)
+					}
+				}
+				// Sunsets are dates, so they sort as strings; routes without one come last
+				sort.SliceStable(deprecated, func(i, j int) bool {
+					a, b := deprecated[i].Sunset, deprecated[j].Sunset
+					return a != "" && (b == "" || a < b)
+				})
+				return deprecated
+			}),
+		},
+	}
+}
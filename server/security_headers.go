@@ -0,0 +1,112 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/services"
+)
+
+// SecurityHeaders are the headers set on every response of the gateway, replacing those sent by backends
+//
+// Routes override them with their SecurityHeaders, where an empty value drops the header.
+var SecurityHeaders = map[string]string{
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	"X-Content-Type-Options":    "nosniff",
+	"X-Frame-Options":           "DENY",
+	"Referrer-Policy":           "strict-origin-when-cross-origin",
+}
+
+// ContentSecurityPolicy is the Content-Security-Policy set on every response, empty to leave it to the backends
+//
+// For example "default-src 'none'; frame-ancestors 'none'" for gateways which only serve APIs.
+var ContentSecurityPolicy = ""
+
+// securityHeadersWriter sets the security headers of the route when the response is written
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	headers    map[string]string
+	headersSet bool
+}
+
+// setHeaders sets the security headers once, before the response's headers are sent
+func (s *securityHeadersWriter) setHeaders() {
+	if s.headersSet {
+		return
+	}
+	s.headersSet = true
+	for name, value := range s.headers {
+		if value == "" {
+			s.Header().Del(name)
+		} else {
+			s.Header().Set(name, value)
+		}
+	}
+}
+
+func (s *securityHeadersWriter) WriteHeader(status int) {
+	s.setHeaders()
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *securityHeadersWriter) Write(b []byte) (int, error) {
+	s.setHeaders()
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *securityHeadersWriter) Flush() {
+	s.setHeaders()
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to the handler, which then writes its own headers
+func (s *securityHeadersWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("server: the connection can not be hijacked")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (s *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// withSecurityHeaders adds the gateway's security headers, with the route's overrides, to the responses of inner
+func withSecurityHeaders(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := map[string]string{}
+		for name, value := range SecurityHeaders {
+			if value != "" {
+				headers[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+		if ContentSecurityPolicy != "" {
+			headers["Content-Security-Policy"] = ContentSecurityPolicy
+		}
+		if route, ok := services.RouteFromContext(r.Context()); ok {
+			for name, value := range route.SecurityHeaders {
+				headers[http.CanonicalHeaderKey(name)] = value
+			}
+		}
+		writer := &securityHeadersWriter{ResponseWriter: w, headers: headers}
+		inner.ServeHTTP(writer, r)
+		// Handlers which write nothing are answered with their headers after they return
+		writer.setHeaders()
+	})
+}
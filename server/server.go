@@ -5,33 +5,99 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/discovery"
+	"github.com/arbor-dev/arbor/features"
+	"github.com/arbor-dev/arbor/health"
 	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy"
 	"github.com/arbor-dev/arbor/security"
 	"github.com/arbor-dev/arbor/services"
-	"github.com/gorilla/mux"
 )
 
 //ArborServer is a struct that manages the proxy server
 type ArborServer struct {
-	addr   string
-	router *mux.Router
-	server *http.Server
+	addr           string
+	router         *Router
+	server         *http.Server
+	admission      *memoryAdmission
+	stopPrewarming func()
+	certificates   *certificateMonitor
+	stopProbing    func()
+	stopDiscovery  func()
+	reloading      *reloadingHandler
+	stopReloading  func()
 }
 
 //NewServer creates a new Arbor Server
 func NewArborServer(routes services.RouteCollection, addr string, port uint16) *ArborServer {
+	if err := features.FromEnvironment(); err != nil {
+		logger.Log(logger.ERR, "Could not set feature gates: "+err.Error())
+	}
+	if _, err := clientip.ParseNetworks(clientip.TrustedProxies); err != nil {
+		logger.Log(logger.ERR, "Invalid trusted proxy, no proxy is trusted: "+err.Error())
+	}
+	if DevMode {
+		if err := enableDevMode(); err != nil {
+			logger.Log(logger.FATAL, "Could not enable dev mode: "+err.Error())
+		}
+	}
 	a := new(ArborServer)
 	a.addr = fmt.Sprintf("%s:%d", addr, port)
-	a.router = NewRouter(routes)
-	a.server = &http.Server{Addr: a.addr, Handler: a.router}
+	a.router = NewTrieRouter(routes)
+	a.server = &http.Server{Addr: a.addr, Handler: newHostRouter(a.router, routes)}
+	if DevMode && DevReload != nil {
+		a.reloading = newReloadingHandler(a.server.Handler)
+		a.server.Handler = a.reloading
+	}
+	a.admission = newMemoryAdmission()
+	if a.admission != nil {
+		a.server.Handler = a.admission.handler(a.server.Handler)
+	}
+	if BatchPath != "" {
+		a.server.Handler = withDispatcher(a.server.Handler)
+	}
 	return a
 }
 
+// Handler is what serves the server's requests, routing them by host
+func (a *ArborServer) Handler() http.Handler {
+	return a.server.Handler
+}
+
 //StartServer starts the http server in a goroutine to start listening
 func (a *ArborServer) StartServer() {
 	logger.Log(logger.SPEC, "Roots being planted [Server is listening on "+a.addr+"]")
+	health.SetDraining(false)
+	applyMemoryLimit()
+	if a.admission != nil {
+		go a.admission.run()
+	}
+	a.stopDiscovery = discovery.Start()
+	a.stopPrewarming = proxy.StartPrewarming()
+	a.stopProbing = health.StartProbing()
+	if a.reloading != nil {
+		a.stopReloading = a.reloading.watchConfig()
+	}
 
-	err := a.server.ListenAndServe()
+	certificates, err := newCertificateMonitor()
+	if err != nil {
+		logger.Log(logger.FATAL, "Could not load TLS certificate: "+err.Error())
+	}
+	if certificates != nil {
+		a.certificates = certificates
+		go certificates.run()
+	}
+
+	if tlsEnabled() {
+		a.server.TLSConfig, err = newTLSConfig(certificates)
+		if err != nil {
+			logger.Log(logger.FATAL, "Could not configure TLS: "+err.Error())
+		}
+		err = a.server.ListenAndServeTLS("", "")
+	} else {
+		err = a.server.ListenAndServe()
+	}
 	if err != nil {
 		if err.Error() == "http: Server closed" {
 			return
@@ -43,7 +109,26 @@ func (a *ArborServer) StartServer() {
 //KillServer ends the http server
 func (a *ArborServer) KillServer() {
 	logger.Log(logger.SPEC, "Pulling up the roots [Shutting down the server...]")
+	health.SetDraining(true)
 	a.server.Shutdown(context.Background())
+	if a.admission != nil {
+		close(a.admission.stop)
+	}
+	if a.certificates != nil {
+		close(a.certificates.stop)
+	}
+	if a.stopPrewarming != nil {
+		a.stopPrewarming()
+	}
+	if a.stopProbing != nil {
+		a.stopProbing()
+	}
+	if a.stopDiscovery != nil {
+		a.stopDiscovery()
+	}
+	if a.stopReloading != nil {
+		a.stopReloading()
+	}
 	if security.IsEnabled() {
 		security.Shutdown()
 	}
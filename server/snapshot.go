@@ -0,0 +1,337 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/cache"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/features"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// SnapshotPath is where snapshots of the gateway's runtime state are exported and imported, empty to not serve it
+//
+// GET exports a snapshot signed with SnapshotKey. POST, which needs an admin credential (see
+// health.AuthorizesChange), imports a snapshot signed with the same key, restoring its dynamic configuration (feature gates and promoted migrations) and
+// reporting how this instance differs from the exported one. Routes, keys and certificates
+// are part of the deployment, so snapshots only reference them and never hold key material.
+var SnapshotPath = ""
+
+// SnapshotExposure is who may export and import snapshots
+var SnapshotExposure = health.Local
+
+// SnapshotKey is the HMAC-SHA256 key snapshots are signed with, instances sharing it can import each other's snapshots
+//
+// Snapshots are neither exported nor imported while it is unset.
+var SnapshotKey []byte
+
+// SnapshotMaxAge is how long after it was exported a snapshot may be imported
+//
+// Each snapshot is only imported once, so a captured snapshot can not be replayed to roll
+// back the configuration of an instance.
+var SnapshotMaxAge = 15 * time.Minute
+
+var (
+	importedMutex     sync.Mutex
+	importedSnapshots = map[string]time.Time{}
+)
+
+// Snapshot is the runtime state of the gateway
+type Snapshot struct {
+	//ID identifies the snapshot, so it is only imported once
+	ID         string                  `json:"id"`
+	Created    time.Time               `json:"created"`
+	Build      buildinfo.Info          `json:"build"`
+	Routes     []RouteListing          `json:"routes"`
+	Features   map[string]bool         `json:"features"`
+	Migrations []proxy.MigrationStatus `json:"migrations"`
+	Keys       KeyReferences           `json:"keys"`
+	//Cache is how full the response cache is, when it is kept in memory
+	Cache *cache.Stats `json:"cache,omitempty"`
+}
+
+// KeyReferences name the key material the gateway uses, without the keys
+type KeyReferences struct {
+	EncryptionPrimary string   `json:"encryption_primary,omitempty"`
+	EncryptionKeys    []string `json:"encryption_keys,omitempty"`
+	TLSCertFile       string   `json:"tls_cert_file,omitempty"`
+	TLSClientCAFile   string   `json:"tls_client_ca_file,omitempty"`
+	AdminPins         []string `json:"admin_pins,omitempty"`
+}
+
+// SignedSnapshot is a snapshot as exported, with its base64 HMAC-SHA256 signature
+type SignedSnapshot struct {
+	Snapshot  json.RawMessage `json:"snapshot"`
+	Signature string          `json:"signature"`
+}
+
+// SnapshotImport is what importing a snapshot changed and how this instance still differs from the exported one
+type SnapshotImport struct {
+	Applied     []string `json:"applied"`
+	Differences []string `json:"differences"`
+}
+
+// TakeSnapshot captures the runtime state of a gateway serving routes
+func TakeSnapshot(routes services.RouteCollection) Snapshot {
+	snapshot := Snapshot{
+		ID:         newSnapshotID(),
+		Created:    clock.Now().UTC(),
+		Build:      buildinfo.Get(),
+		Routes:     listRoutes(routes),
+		Features:   map[string]bool{},
+		Migrations: proxy.Migrations(),
+		Keys:       currentKeys(),
+	}
+	for _, gate := range features.All() {
+		snapshot.Features[gate.Name] = gate.Enabled
+	}
+	if store, ok := cache.Responses.(*cache.LRUStore); ok {
+		stats := store.Stats()
+		snapshot.Cache = &stats
+	}
+	return snapshot
+}
+
+func currentKeys() KeyReferences {
+	keys := KeyReferences{
+		TLSCertFile:     TLSCertFile,
+		TLSClientCAFile: TLSClientCAFile,
+		AdminPins:       health.AdminPins,
+	}
+	if encryption.AtRest != nil {
+		keys.EncryptionPrimary = encryption.AtRest.Primary()
+		keys.EncryptionKeys = encryption.AtRest.KeyIDs()
+	}
+	return keys
+}
+
+func newSnapshotID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Errors returned when importing a snapshot
+var (
+	ErrSnapshotExpired  = errors.New("snapshot is too old to import")
+	ErrSnapshotImported = errors.New("snapshot was already imported")
+)
+
+// claimSnapshot marks a snapshot as imported, or returns why it may not be
+func claimSnapshot(snapshot Snapshot) error {
+	now := clock.Now()
+	if age := now.Sub(snapshot.Created); age > SnapshotMaxAge || age < -SnapshotMaxAge {
+		return ErrSnapshotExpired
+	}
+	importedMutex.Lock()
+	defer importedMutex.Unlock()
+	// Snapshots past their max age are refused anyway
+	for id, created := range importedSnapshots {
+		if now.Sub(created) > SnapshotMaxAge {
+			delete(importedSnapshots, id)
+		}
+	}
+	if _, imported := importedSnapshots[snapshot.ID]; imported || snapshot.ID == "" {
+		return ErrSnapshotImported
+	}
+	importedSnapshots[snapshot.ID] = snapshot.Created
+	return nil
+}
+
+// signSnapshot signs the encoded snapshot with SnapshotKey
+func signSnapshot(snapshot []byte) string {
+	mac := hmac.New(sha256.New, SnapshotKey)
+	mac.Write(snapshot)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ImportSnapshot restores the dynamic configuration of a snapshot, and reports how this instance differs from it
+//
+// Snapshots older than SnapshotMaxAge, or which were already imported, are refused.
+func ImportSnapshot(snapshot Snapshot, routes services.RouteCollection) (SnapshotImport, error) {
+	if err := claimSnapshot(snapshot); err != nil {
+		return SnapshotImport{}, err
+	}
+	result := SnapshotImport{Applied: []string{}, Differences: []string{}}
+	differ := func(difference string) {
+		result.Differences = append(result.Differences, difference)
+	}
+
+	current := map[string]bool{}
+	for _, gate := range features.All() {
+		current[gate.Name] = gate.Enabled
+	}
+	for name, enabled := range snapshot.Features {
+		if enabled == current[name] {
+			continue
+		}
+		if err := features.Set(name, enabled); err != nil {
+			differ("feature gate " + name + ": " + err.Error())
+			continue
+		}
+		result.Applied = append(result.Applied, "feature gate "+name+" set")
+	}
+
+	promoted := map[string]bool{}
+	for _, migration := range proxy.Migrations() {
+		promoted[migration.Backend] = migration.Promoted
+	}
+	for _, migration := range snapshot.Migrations {
+		if !migration.Promoted || promoted[migration.Backend] {
+			continue
+		}
+		if err := proxy.PromoteMigration(migration.Backend); err != nil {
+			differ("migration of " + migration.Backend + ": " + err.Error())
+			continue
+		}
+		result.Applied = append(result.Applied, "migration of "+migration.Backend+" promoted")
+	}
+
+	served := map[string]bool{}
+	for _, listing := range listRoutes(routes) {
+		served[listing.Method+" "+listing.Pattern] = true
+	}
+	exported := map[string]bool{}
+	for _, listing := range snapshot.Routes {
+		key := listing.Method + " " + listing.Pattern
+		exported[key] = true
+		if !served[key] {
+			differ("route " + listing.Name + " (" + key + ") is not served")
+		}
+	}
+	for _, listing := range listRoutes(routes) {
+		if key := listing.Method + " " + listing.Pattern; !exported[key] {
+			differ("route " + listing.Name + " (" + key + ") was not in the snapshot")
+		}
+	}
+	if hash := buildinfo.Get().ConfigHash; snapshot.Build.ConfigHash != hash {
+		differ("configuration hash " + hash + " differs from the snapshot's " + snapshot.Build.ConfigHash)
+	}
+
+	keys := currentKeys()
+	held := map[string]bool{}
+	for _, id := range keys.EncryptionKeys {
+		held[id] = true
+	}
+	for _, id := range snapshot.Keys.EncryptionKeys {
+		if !held[id] {
+			differ("encryption key " + id + " is missing, data it sealed can not be opened")
+		}
+	}
+	if snapshot.Keys.EncryptionPrimary != keys.EncryptionPrimary {
+		differ("primary encryption key is " + keys.EncryptionPrimary + " rather than " + snapshot.Keys.EncryptionPrimary)
+	}
+	if snapshot.Keys.TLSCertFile != keys.TLSCertFile || snapshot.Keys.TLSClientCAFile != keys.TLSClientCAFile {
+		differ("TLS certificates are read from other files")
+	}
+	pinned := map[string]bool{}
+	for _, pin := range keys.AdminPins {
+		pinned[pin] = true
+	}
+	for _, pin := range snapshot.Keys.AdminPins {
+		if !pinned[pin] {
+			differ("admin pin " + pin + " is missing")
+		}
+	}
+	return result, nil
+}
+
+// snapshotRoutes export and imports snapshots of a gateway serving routes
+func snapshotRoutes(routes services.RouteCollection) []services.Route {
+	exposed := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !SnapshotExposure.Allows(r) {
+				apierror.Write(w, r, http.StatusNotFound, "", nil)
+				return
+			}
+			if len(SnapshotKey) == 0 {
+				apierror.Write(w, r, http.StatusServiceUnavailable, "No snapshot key is configured", nil)
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			handler(w, r)
+		}
+	}
+	return []services.Route{
+		{
+			Name:    "ExportSnapshot",
+			Method:  http.MethodGet,
+			Pattern: SnapshotPath,
+			Handler: exposed(func(w http.ResponseWriter, r *http.Request) {
+				snapshot, err := json.Marshal(TakeSnapshot(routes))
+				if err != nil {
+					apierror.Write(w, r, http.StatusInternalServerError, "", nil)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(SignedSnapshot{Snapshot: snapshot, Signature: signSnapshot(snapshot)})
+			}),
+		},
+		{
+			Name:    "ImportSnapshot",
+			Method:  http.MethodPost,
+			Pattern: SnapshotPath,
+			Handler: exposed(func(w http.ResponseWriter, r *http.Request) {
+				if !authorizeChange(w, r) {
+					return
+				}
+				var signed SignedSnapshot
+				if err := json.NewDecoder(io.LimitReader(r.Body, security.MaxSize)).Decode(&signed); err != nil {
+					apierror.Write(w, r, http.StatusBadRequest, "Body must be an exported snapshot", nil)
+					return
+				}
+				signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+				expected, _ := base64.StdEncoding.DecodeString(signSnapshot(signed.Snapshot))
+				if err != nil || !hmac.Equal(signature, expected) {
+					audit.RecordRequest(r, audit.AuthenticationFailed, "", "snapshot signature invalid", nil)
+					apierror.Write(w, r, http.StatusBadRequest, "Snapshot signature is invalid", nil)
+					return
+				}
+				var snapshot Snapshot
+				if err := json.Unmarshal(signed.Snapshot, &snapshot); err != nil {
+					apierror.Write(w, r, http.StatusBadRequest, "Body must be an exported snapshot", nil)
+					return
+				}
+				result, err := ImportSnapshot(snapshot, routes)
+				if err != nil {
+					apierror.Write(w, r, http.StatusBadRequest, "Snapshot can not be imported: "+err.Error(), nil)
+					return
+				}
+				audit.RecordRequest(r, audit.ConfigurationChanged, "", "snapshot imported",
+					map[string]interface{}{"created": snapshot.Created, "applied": result.Applied})
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(result)
+			}),
+		},
+	}
+}
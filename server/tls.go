@@ -0,0 +1,102 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+
+	"github.com/arbor-dev/arbor/health"
+)
+
+// TLSCertFile and TLSKeyFile are the PEM certificate chain and key served to clients, arbor serves TLS if both are set
+var TLSCertFile, TLSKeyFile string
+
+// TLSOCSPStapleFile is a DER encoded OCSP response for the certificate to staple to handshakes (optional)
+//
+// It is reloaded with the certificate when the file changes, see CertificateCheckInterval. arbor does not
+// fetch OCSP responses itself, so refresh the file with an external tool (e.g. openssl ocsp) on a schedule,
+// before the stapled response expires, or clients will be stapled a stale response.
+var TLSOCSPStapleFile string
+
+// TLSMinVersion is the oldest TLS version accepted from clients
+var TLSMinVersion uint16 = tls.VersionTLS12
+
+// TLSCipherSuites are the cipher suites offered to clients for TLS 1.2, nil uses Go's defaults (TLS 1.3 suites are not configurable)
+var TLSCipherSuites []uint16
+
+// TLSSessionTickets controls if clients may resume sessions with session tickets
+var TLSSessionTickets = true
+
+// TLSClientCAFile is a PEM bundle of the CAs which issue client certificates, setting it asks clients for a certificate
+//
+// The verified certificate's identity is mapped to roles with security.CertificateRoles.
+var TLSClientCAFile string
+
+// TLSClientAuth is how the listener treats client certificates when TLSClientCAFile is set
+//
+// By default every client must present a certificate issued by one of the CAs. Use
+// tls.VerifyClientCertIfGiven to let clients without a certificate authenticate otherwise.
+// Without TLSClientCAFile, clients are only asked for a certificate when health.AdminPins is set.
+// With both, the pinned certificates must be issued by one of the CAs, and TLSClientAuth must ask
+// clients for a certificate.
+var TLSClientAuth = tls.RequireAndVerifyClientCert
+
+// tlsEnabled reports if the listener is configured to serve TLS
+func tlsEnabled() bool {
+	return TLSCertFile != "" && TLSKeyFile != ""
+}
+
+// loadCertificate reads a served certificate and its OCSP staple, if it has one
+func loadCertificate(certFile string, keyFile string, ocspStapleFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if ocspStapleFile != "" {
+		cert.OCSPStaple, err = ioutil.ReadFile(ocspStapleFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+// newTLSConfig creates the configuration of the client facing listener, serving the monitor's current certificates
+func newTLSConfig(certificates *certificateMonitor) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate:         certificates.getCertificate,
+		MinVersion:             TLSMinVersion,
+		CipherSuites:           TLSCipherSuites,
+		SessionTicketsDisabled: !TLSSessionTickets,
+	}
+	if TLSClientCAFile != "" {
+		pem, err := ioutil.ReadFile(TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates in " + TLSClientCAFile)
+		}
+		// Admins could never present their pinned certificates
+		if len(health.AdminPins) > 0 && TLSClientAuth == tls.NoClientCert {
+			return nil, errors.New("health.AdminPins are set but TLSClientAuth does not ask clients for a certificate")
+		}
+		config.ClientAuth = TLSClientAuth
+	} else if len(health.AdminPins) > 0 {
+		// Admin clients present certificates which are pinned rather than issued by a CA
+		config.ClientAuth = tls.RequestClientCert
+	}
+	return config, nil
+}
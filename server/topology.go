@@ -0,0 +1,174 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// TopologyPath is where the diagram of the routes and their backends is served, empty to not serve it
+//
+// It is served as Graphviz DOT, or as a Mermaid flowchart with ?format=mermaid. Each route
+// lists the stages its requests pass through and links to the backends it has sent requests
+// to, which link to their pool instances, header splits, fallbacks, shadows and migrations.
+var TopologyPath = ""
+
+// TopologyExposure is who may see the topology, which names internal hosts
+var TopologyExposure = health.Local
+
+// topologyNode is a route or backend of the diagram
+type topologyNode struct {
+	id      string
+	lines   []string
+	backend bool
+}
+
+// topologyEdge is a link of the diagram, dashed for links other than a route's requests or a pool's instances
+type topologyEdge struct {
+	from   string
+	to     string
+	label  string
+	dashed bool
+}
+
+// topologyRoute serves the diagram of routes
+func topologyRoute(routes services.RouteCollection) services.Route {
+	return services.Route{
+		Name:    "Topology",
+		Method:  http.MethodGet,
+		Pattern: TopologyPath,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if !TopologyExposure.Allows(r) {
+				apierror.Write(w, r, http.StatusNotFound, "", nil)
+				return
+			}
+			nodes, edges := topology(routes)
+			w.Header().Set("Cache-Control", "no-store")
+			switch r.URL.Query().Get("format") {
+			case "", "dot":
+				w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+				w.Write([]byte(renderDOT(nodes, edges)))
+			case "mermaid":
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.Write([]byte(renderMermaid(nodes, edges)))
+			default:
+				apierror.Write(w, r, http.StatusBadRequest, "format must be dot or mermaid", nil)
+			}
+		},
+	}
+}
+
+// topology collects the routes, the backends they were seen sending requests to and the links between backends
+func topology(routes services.RouteCollection) ([]topologyNode, []topologyEdge) {
+	var nodes []topologyNode
+	var edges []topologyEdge
+	backendIDs := map[string]string{}
+	backend := func(host string) string {
+		if id, ok := backendIDs[host]; ok {
+			return id
+		}
+		id := "b" + strconv.Itoa(len(backendIDs))
+		backendIDs[host] = id
+		nodes = append(nodes, topologyNode{id: id, lines: []string{host}, backend: true})
+		return id
+	}
+
+	observed := proxy.RouteBackends()
+	for i, route := range routes {
+		id := "r" + strconv.Itoa(i)
+		lines := []string{route.Name, route.Method + " " + route.Pattern}
+		if stages := proxy.RouteStages(route); len(stages) > 0 {
+			lines = append(lines, strings.Join(stages, " → "))
+		}
+		nodes = append(nodes, topologyNode{id: id, lines: lines})
+		for _, host := range observed[route.Name] {
+			edges = append(edges, topologyEdge{from: id, to: backend(host)})
+		}
+	}
+	for _, link := range proxy.BackendLinks() {
+		label := link.Kind
+		if link.Detail != "" {
+			label += " " + link.Detail
+		}
+		edges = append(edges, topologyEdge{from: backend(link.From), to: backend(link.To), label: label, dashed: link.Kind != proxy.InstanceLink})
+	}
+	return nodes, edges
+}
+
+func renderDOT(nodes []topologyNode, edges []topologyEdge) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+	var dot strings.Builder
+	dot.WriteString("digraph arbor {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, node := range nodes {
+		lines := make([]string, len(node.lines))
+		for i, line := range node.lines {
+			lines[i] = escape(line)
+		}
+		dot.WriteString("  " + node.id + ` [label="` + strings.Join(lines, `\n`) + `"`)
+		if node.backend {
+			dot.WriteString(", shape=ellipse")
+		}
+		dot.WriteString("];\n")
+	}
+	for _, edge := range edges {
+		var attributes []string
+		if edge.label != "" {
+			attributes = append(attributes, `label="`+escape(edge.label)+`"`)
+		}
+		if edge.dashed {
+			attributes = append(attributes, "style=dashed")
+		}
+		dot.WriteString("  " + edge.from + " -> " + edge.to)
+		if len(attributes) > 0 {
+			dot.WriteString(" [" + strings.Join(attributes, ", ") + "]")
+		}
+		dot.WriteString(";\n")
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+func renderMermaid(nodes []topologyNode, edges []topologyEdge) string {
+	// Quotes and markup would end the label, so they are written as entities
+	escape := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace
+	var mermaid strings.Builder
+	mermaid.WriteString("flowchart LR\n")
+	for _, node := range nodes {
+		lines := make([]string, len(node.lines))
+		for i, line := range node.lines {
+			lines[i] = escape(line)
+		}
+		label := `"` + strings.Join(lines, "<br/>") + `"`
+		if node.backend {
+			mermaid.WriteString("  " + node.id + "([" + label + "])\n")
+		} else {
+			mermaid.WriteString("  " + node.id + "[" + label + "]\n")
+		}
+	}
+	for _, edge := range edges {
+		arrow := " -->"
+		if edge.dashed {
+			arrow = " -.->"
+		}
+		if edge.label != "" {
+			arrow += `|"` + escape(edge.label) + `"|`
+		}
+		mermaid.WriteString("  " + edge.from + arrow + " " + edge.to + "\n")
+	}
+	return mermaid.String()
+}
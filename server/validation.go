@@ -0,0 +1,85 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/protobuf"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/transform"
+)
+
+// ValidateRoutes returns an error describing the first route which could not be served as configured
+//
+// Routes must have a name, a method, a pattern starting with / and a handler, no two routes may
+// share a method and pattern, and their network lists, pipelines, transforms and protobuf descriptor
+// sets must be valid.
+func ValidateRoutes(routes services.RouteCollection) error {
+	seen := map[string]string{}
+	for _, route := range routes {
+		name := route.Name
+		if name == "" {
+			return errors.New("route " + route.Method + " " + route.Pattern + " has no name")
+		}
+		switch {
+		case route.Method == "":
+			return errors.New("route " + name + " has no method")
+		case !strings.HasPrefix(route.Pattern, "/"):
+			return errors.New("route " + name + " has a pattern which does not start with /")
+		case route.Handler == nil:
+			return errors.New("route " + name + " has no handler")
+		}
+		key := strings.ToUpper(route.Method) + " " + route.Pattern
+		if other, exists := seen[key]; exists {
+			return errors.New("routes " + other + " and " + name + " both serve " + key)
+		}
+		seen[key] = name
+		for _, networks := range [][]string{route.AllowedNetworks, route.DeniedNetworks} {
+			if _, err := clientip.ParseNetworks(networks); err != nil {
+				return errors.New("route " + name + " has an invalid network: " + err.Error())
+			}
+		}
+		if err := proxy.ValidatePipeline(route); err != nil {
+			return err
+		}
+		if route.Transform != nil {
+			for _, mappings := range [][]services.FieldMapping{route.Transform.Request, route.Transform.Response} {
+				if err := transform.Validate(mappings); err != nil {
+					return errors.New("route " + name + " has an invalid transform: " + err.Error())
+				}
+			}
+		}
+		if route.Protobuf != nil {
+			if err := validateProtobuf(route.Protobuf); err != nil {
+				return errors.New("route " + name + " has an invalid protobuf policy: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// validateProtobuf loads a route's descriptor set and checks it holds the route's message types
+func validateProtobuf(policy *services.ProtobufPolicy) error {
+	set, err := protobuf.LoadDescriptorSet(policy.DescriptorSet)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{policy.Request, policy.Response} {
+		if _, ok := set.Message(name); name != "" && !ok {
+			return errors.New("the descriptor set has no message " + name)
+		}
+	}
+	return nil
+}
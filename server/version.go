@@ -0,0 +1,93 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/discovery"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/ratelimit"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// VersionPath is where the build information is served, empty to not serve it
+var VersionPath = "/version"
+
+// VersionExposure is who may see the build information
+var VersionExposure = health.Local
+
+func init() {
+	buildinfo.RegisterFeature("security", security.IsEnabled)
+	buildinfo.RegisterFeature("api_keys", func() bool { return security.APIKeys != nil })
+	buildinfo.RegisterFeature("tls", tlsEnabled)
+	buildinfo.RegisterFeature("memory_admission", func() bool { return MemoryAdmission })
+	buildinfo.RegisterFeature("compression", func() bool { return proxy.Compression })
+	buildinfo.RegisterFeature("default_rate_limit", func() bool { return ratelimit.DefaultLimit != nil })
+	buildinfo.RegisterFeature("workload_identity", func() bool { return proxy.WorkloadIdentity != nil })
+	buildinfo.RegisterFeature("encryption_at_rest", func() bool { return encryption.AtRest != nil })
+	buildinfo.RegisterFeature("openapi", func() bool { return OpenAPIPath != "" })
+	buildinfo.RegisterFeature("service_discovery", func() bool { return len(discovery.Services) > 0 })
+	buildinfo.RegisterFeature("fault_injection", func() bool { return proxy.FaultInjection })
+	buildinfo.RegisterFeature("recording", func() bool { return proxy.RecordingMode != proxy.RecordingOff })
+	buildinfo.RegisterFeature("shadowing", func() bool { return len(proxy.BackendShadows) > 0 })
+}
+
+// routesHash hashes the configuration of routes, so replicas serving different routes can be told apart
+func routesHash(routes services.RouteCollection) string {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, route := range routes {
+		// Handlers can not be encoded, the rest of the route is its configuration
+		// Middlewares added by a route are handlers too, so only their names are
+		var middlewares []string
+		if route.Middlewares != nil {
+			middlewares = append(middlewares, route.Middlewares.Skip...)
+			for _, m := range route.Middlewares.Use {
+				middlewares = append(middlewares, "+"+m.Name)
+			}
+		}
+		encoder.Encode([]interface{}{
+			route.Name, route.Method, route.Pattern, route.LatencyClass, route.Scopes, route.Roles,
+			route.RateLimit, route.Cache, route.Schema, route.Job, route.SLA, middlewares, route.MaxBodySize,
+			route.RequirePreconditions, route.ExposeHeaders, route.SerializeWritesBy, route.Pipeline, route.Protected,
+			route.AllowedNetworks, route.DeniedNetworks, route.SecurityHeaders, route.BrowserFacing,
+			route.Docs, route.Idempotency, route.Transform, route.Negotiation, route.Protobuf, route.TranslateToJSON,
+		})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// versionRoute serves the build information to callers it is exposed to
+func versionRoute() services.Route {
+	return services.Route{
+		Name:    "Version",
+		Method:  http.MethodGet,
+		Pattern: VersionPath,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if !VersionExposure.Allows(r) {
+				apierror.Write(w, r, http.StatusNotFound, "", nil)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(buildinfo.Get())
+		},
+	}
+}
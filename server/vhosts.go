@@ -0,0 +1,114 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// VirtualHost is a domain arbor fronts with its own routes
+type VirtualHost struct {
+	//Routes are served to requests for the host instead of the server's routes
+	Routes services.RouteCollection
+	//AccessControlPolicy is "*" or the comma separated origins allowed by CORS, proxy.AccessControlPolicy if empty
+	AccessControlPolicy string
+	//CertFile and KeyFile are the host's TLS certificate, served to clients asking for it by SNI (optional)
+	//
+	//They are only used when the server serves TLS, with TLSCertFile for other hosts.
+	CertFile string
+	KeyFile  string
+}
+
+// VirtualHosts are the domains served with their own routes, keyed by host name (e.g. "api.example.org" or "*.example.org")
+//
+// Requests for other hosts are served the server's routes.
+var VirtualHosts = map[string]VirtualHost{}
+
+// hostRouter dispatches requests to the router of the virtual host they are for
+type hostRouter struct {
+	hosts    map[string]http.Handler
+	fallback http.Handler
+}
+
+// newHostRouter routes requests for the virtual hosts, and others to fallback
+func newHostRouter(fallback *Router, routes services.RouteCollection) http.Handler {
+	if len(VirtualHosts) == 0 {
+		return fallback
+	}
+	h := &hostRouter{hosts: map[string]http.Handler{}, fallback: fallback}
+	names := make([]string, 0, len(VirtualHosts))
+	for name := range VirtualHosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	all := append(services.RouteCollection(nil), routes...)
+	for _, name := range names {
+		vhost := VirtualHosts[name]
+		var handler http.Handler = NewTrieRouter(vhost.Routes)
+		// Dev mode allows every origin
+		if vhost.AccessControlPolicy != "" && !DevMode {
+			handler = withAccessControlPolicy(handler, vhost.AccessControlPolicy)
+		}
+		h.hosts[strings.ToLower(name)] = handler
+		for _, route := range vhost.Routes {
+			route.Name = name + " " + route.Name
+			all = append(all, route)
+		}
+	}
+	// Each router recorded the hash of its own routes, the configuration is all of them
+	buildinfo.SetConfigHash(routesHash(all))
+	return h
+}
+
+func withAccessControlPolicy(inner http.Handler, policy string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(middleware.NewAccessControlContext(r.Context(), policy)))
+	})
+}
+
+// hostName is the lower case host a request is for, without its port
+func hostName(host string) string {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// lookupHost finds the value for host in a map keyed by exact or "*." wildcard host names
+func lookupHost(host string, exact func(name string) bool) (string, bool) {
+	if exact(host) {
+		return host, true
+	}
+	if i := strings.Index(host, "."); i != -1 && exact("*"+host[i:]) {
+		return "*" + host[i:], true
+	}
+	return "", false
+}
+
+func (h *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := lookupHost(hostName(r.Host), func(name string) bool {
+		_, exists := h.hosts[name]
+		return exists
+	})
+	if !ok {
+		h.fallback.ServeHTTP(w, r)
+		return
+	}
+	h.hosts[name].ServeHTTP(w, r)
+}
@@ -11,6 +11,7 @@
 package arbor
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/arbor-dev/arbor/services"
@@ -25,13 +26,127 @@ import (
 // Pattern: The exposed url pattern for clients to hit, allows for url encoded variables to be specified with {VARIABLE}.
 //
 // HandlerFunc: The function to handle the request, this basicically should just be the proxy call, but it allows you to specify more specific things.
+//
+// LatencyClass: The latency class of the route (optional), selecting its latency histogram buckets from metrics.LatencyClasses.
+//
+// Scopes: The OAuth2 scopes the caller's token must grant to use the route (optional).
+//
+// Roles: The roles allowed to use the route, the caller must have one of them (optional).
+//
+// RateLimit: The rate each client may call the route at (optional), overriding ratelimit.DefaultLimit.
+//
+// Cache: How GET responses from the route are cached (optional), responses are only cached for routes which set it.
+//
+// Schema: A JSON Schema request bodies must match (optional), invalid bodies are rejected before reaching the service.
+//
+// Job: How jobs started by the route are tracked (optional), a 202 Accepted from the service is answered with a job at /jobs/{id}.
+//
+// SLA: How long the service may take to start responding (optional), slower requests are aborted with 504 Gateway Timeout.
+//
+// Middlewares: Changes to the middleware chain for the route (optional), skipping middlewares of the chain or adding its own.
+//
+// MaxBodySize: The largest request body in bytes the route accepts (optional), larger bodies are rejected with 413 Payload Too Large.
+// Without it JSON and XML services accept 1MB and the others, taking file uploads, 16MB.
+//
+// RequirePreconditions: Whether PUT, PATCH and DELETE requests must carry If-Match or If-Unmodified-Since (optional), others are rejected with 428 Precondition Required.
+//
+// ExposeHeaders: The response headers browsers let scripts read (optional), e.g. pagination or RateLimit-Remaining, sent in Access-Control-Expose-Headers.
+//
+// SerializeWritesBy: The path parameter naming the resource a write modifies (optional), e.g. "id". POST, PUT, PATCH and DELETE requests for the same resource are forwarded one at a time, in the order they arrived.
+//
+// Pipeline: The names of the stages the route's requests pass through, in order (optional), replacing the middleware chain. The middlewares of the chain guarding the gateway (abuse, bodysize, csrf, preprocessing, clientcert, scopes, roles, ratelimit and those added with Use) still run first unless the pipeline names them or Middlewares skips them. "cache" marks where the response cache is looked up and "proxy" where the request is proxied, the stages after it run on the response. The guarding middlewares may not be placed after "cache", where cached responses would skip them.
+//
+// Protected: Whether the route is exempt from fault injection, shadowing, recording and Alpha and Beta feature gates (optional), for payment and compliance endpoints which must only ever reach their real backend.
+//
+// AllowedNetworks: The CIDRs or addresses callers must come from (optional), others are rejected with 403 Forbidden before reaching the handler, in addition to security.AllowedNetworks.
+//
+// DeniedNetworks: The CIDRs or addresses callers are rejected from with 403 Forbidden (optional), in addition to security.DeniedNetworks.
+//
+// SecurityHeaders: Overrides of the gateway's server.SecurityHeaders for the route (optional), e.g. a Content-Security-Policy for a page. An empty value drops the header.
+//
+// BrowserFacing: Whether browsers call the route with their cookies (optional), POST, PUT, PATCH and DELETE requests must then carry their CSRF cookie's token in X-CSRF-Token, others are rejected with 403 Forbidden.
+//
+// Docs: What the route does and who owns it (optional), published in the OpenAPI document, the route listing and the deprecation report.
+//
+// Idempotency: How POST requests carrying an Idempotency-Key are deduplicated (optional), the first response for a key is replayed to retries so the service only sees the request once.
+//
+// Transform: Field mappings applied to JSON request and response bodies (optional), bridging small contract differences between the route's clients and its service.
+//
+// Negotiation: The formats the route's responses are translated to for callers whose Accept header does not accept the service's (optional), e.g. XML for a JSON service.
+//
+// Protobuf: The descriptor set and message types used to transcode the route's protobuf bodies from and to JSON (optional), for routes with the PROTOBUF format.
+//
+// TranslateToJSON: Whether the MessagePack and CBOR bodies of callers are translated to JSON for the route's service, and its JSON responses back (optional), for routes with the MSGPACK or CBOR format whose service only speaks JSON.
 type Route struct {
 	Name    string           `json:"Name"`
 	Method  string           `json:"Method"`
 	Pattern string           `json:"Pattern"`
 	Handler http.HandlerFunc `json:"Handler"`
+
+	LatencyClass string               `json:"LatencyClass"`
+	Scopes       []string             `json:"Scopes"`
+	Roles        []string             `json:"Roles"`
+	RateLimit    *RateLimit           `json:"RateLimit"`
+	Cache        *CachePolicy         `json:"Cache"`
+	Schema       json.RawMessage      `json:"Schema"`
+	Job          *JobPolicy           `json:"Job"`
+	SLA          *SLAPolicy           `json:"SLA"`
+	Middlewares  *MiddlewareOverrides `json:"Middlewares"`
+	MaxBodySize  int64                `json:"MaxBodySize"`
+
+	RequirePreconditions bool               `json:"RequirePreconditions"`
+	ExposeHeaders        []string           `json:"ExposeHeaders"`
+	SerializeWritesBy    string             `json:"SerializeWritesBy"`
+	Pipeline             []string           `json:"Pipeline"`
+	Protected            bool               `json:"Protected"`
+	AllowedNetworks      []string           `json:"AllowedNetworks"`
+	DeniedNetworks       []string           `json:"DeniedNetworks"`
+	SecurityHeaders      map[string]string  `json:"SecurityHeaders"`
+	BrowserFacing        bool               `json:"BrowserFacing"`
+	Docs                 *RouteDocs         `json:"Docs"`
+	Idempotency          *IdempotencyPolicy `json:"Idempotency"`
+	Transform            *BodyTransform     `json:"Transform"`
+	Negotiation          *NegotiationPolicy `json:"Negotiation"`
+	Protobuf             *ProtobufPolicy    `json:"Protobuf"`
+	TranslateToJSON      bool               `json:"TranslateToJSON"`
 }
 
+// RateLimit allows Requests per Per, with bursts of up to Burst requests (Requests if unset)
+type RateLimit = services.RateLimit
+
+// CachePolicy caches responses for TTL (or as long as the service allows if unset), keyed by host, path, backend and KeyHeaders
+type CachePolicy = services.CachePolicy
+
+// JobPolicy tracks the jobs a route starts by polling the status URL the service responds 202 Accepted with
+type JobPolicy = services.JobPolicy
+
+// RouteDocs describes a route and the team owning it
+type RouteDocs = services.RouteDocs
+
+// IdempotencyPolicy replays the first response for an Idempotency-Key to retries within TTL
+type IdempotencyPolicy = services.IdempotencyPolicy
+
+// BodyTransform maps the fields of JSON bodies sent to and received from a route's service
+type BodyTransform = services.BodyTransform
+
+// FieldMapping moves, copies, sets or removes a field of a JSON body
+type FieldMapping = services.FieldMapping
+
+// NegotiationPolicy translates a route's responses to the format callers accept
+type NegotiationPolicy = services.NegotiationPolicy
+
+// ProtobufPolicy transcodes a route's protobuf bodies from and to JSON
+type ProtobufPolicy = services.ProtobufPolicy
+
+// SLAPolicy aborts requests the service has not started responding to within Timeout, optionally retrying them once on another instance, and sets the route's error budget with Objective
+type SLAPolicy = services.SLAPolicy
+
+// Middleware is a named step of the chain requests pass through before being proxied, see Use
+type Middleware = services.Middleware
+
+// MiddlewareOverrides skips middlewares of the chain for a route, or adds middlewares run only for it
+type MiddlewareOverrides = services.MiddlewareOverrides
+
 // RouteCollection is a slice of routes that is used to represent a service (may change name here)
 //
 // Usage: The recomendation is to create a RouteCollection variable for all of you services and for each service create a specific one then in a registration function append all the service collections into the single master collection.
@@ -10,13 +10,181 @@
 
 package services
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
 
 type Route struct {
 	Name    string           `json:"Name"`
 	Method  string           `json:"Method"`
 	Pattern string           `json:"Pattern"`
 	Handler http.HandlerFunc `json:"Handler"`
+
+	LatencyClass string               `json:"LatencyClass"`
+	Scopes       []string             `json:"Scopes"`
+	Roles        []string             `json:"Roles"`
+	RateLimit    *RateLimit           `json:"RateLimit"`
+	Cache        *CachePolicy         `json:"Cache"`
+	Schema       json.RawMessage      `json:"Schema"`
+	Job          *JobPolicy           `json:"Job"`
+	SLA          *SLAPolicy           `json:"SLA"`
+	Middlewares  *MiddlewareOverrides `json:"Middlewares"`
+	MaxBodySize  int64                `json:"MaxBodySize"`
+
+	RequirePreconditions bool               `json:"RequirePreconditions"`
+	ExposeHeaders        []string           `json:"ExposeHeaders"`
+	SerializeWritesBy    string             `json:"SerializeWritesBy"`
+	Pipeline             []string           `json:"Pipeline"`
+	Protected            bool               `json:"Protected"`
+	AllowedNetworks      []string           `json:"AllowedNetworks"`
+	DeniedNetworks       []string           `json:"DeniedNetworks"`
+	SecurityHeaders      map[string]string  `json:"SecurityHeaders"`
+	BrowserFacing        bool               `json:"BrowserFacing"`
+	Docs                 *RouteDocs         `json:"Docs"`
+	Idempotency          *IdempotencyPolicy `json:"Idempotency"`
+	Transform            *BodyTransform     `json:"Transform"`
+	Negotiation          *NegotiationPolicy `json:"Negotiation"`
+	Protobuf             *ProtobufPolicy    `json:"Protobuf"`
+	TranslateToJSON      bool               `json:"TranslateToJSON"`
+}
+
+// RateLimit allows Requests per Per, with bursts of up to Burst requests (Requests if unset)
+type RateLimit struct {
+	Requests int           `json:"Requests"`
+	Per      time.Duration `json:"Per"`
+	Burst    int           `json:"Burst"`
+}
+
+// CachePolicy caches responses for TTL (or as long as the service allows if unset), keyed by host, path, backend and KeyHeaders
+type CachePolicy struct {
+	TTL        time.Duration `json:"TTL"`
+	KeyHeaders []string      `json:"KeyHeaders"`
+}
+
+// JobPolicy makes a route start long-running jobs, which arbor tracks by polling the status URL the service responds 202 Accepted with
+type JobPolicy struct {
+	//PollInterval is how often the status URL is polled, jobs.DefaultPollInterval if unset
+	PollInterval time.Duration `json:"PollInterval"`
+	//Timeout is how long the job may run before arbor fails it, jobs.DefaultTimeout if unset
+	Timeout time.Duration `json:"Timeout"`
+	//StatusField is the field of the status response holding the job's state, "status" if unset
+	StatusField string `json:"StatusField"`
+	//States maps the service's states to arbor's (pending, running, succeeded or failed), in addition to the common names
+	States map[string]string `json:"States"`
+}
+
+// SLAPolicy bounds how long the route's backend may take to start responding, keeping the gateway's latency predictable
+type SLAPolicy struct {
+	//Timeout is how long the backend has to send its response headers before the request is aborted with 504 Gateway Timeout
+	Timeout time.Duration `json:"Timeout"`
+	//Retry retries an aborted request once on another instance of the backend's pool, which has its own Timeout
+	//
+	//Only set it for routes which are safe to repeat, the aborted request may already have reached the backend.
+	Retry bool `json:"Retry"`
+	//Objective is the share of requests which must not fail with a 5xx error, e.g. 0.999 (optional)
+	//
+	//The rest is the route's error budget, its owner is alerted when it is spent too fast (see alerts.BurnRate).
+	Objective float64 `json:"Objective"`
+}
+
+// IdempotencyPolicy replays the first response to a POST request for an Idempotency-Key to retries of it within TTL
+type IdempotencyPolicy struct {
+	//TTL is how long responses are replayed for, idempotency.DefaultTTL if unset
+	TTL time.Duration `json:"TTL"`
+	//Required rejects POST requests without an Idempotency-Key with 400 Bad Request
+	Required bool `json:"Required"`
+}
+
+// BodyTransform maps the fields of JSON bodies, Request before they are sent to the service and Response before they are sent to the caller
+type BodyTransform struct {
+	Request  []FieldMapping `json:"Request"`
+	Response []FieldMapping `json:"Response"`
+}
+
+// FieldMapping moves the field at From to To, sets To to Value, or removes the field at From if To is unset
+//
+// From and To are JSON Pointers, where a * segment stands for every item of an array or
+// object, e.g. "/items/*/sku" to "/items/*/id". Mappings are applied in order and skip bodies
+// without the From field.
+type FieldMapping struct {
+	From string `json:"From"`
+	To   string `json:"To"`
+	//Value is the JSON value To is set to, for mappings without a From
+	Value json.RawMessage `json:"Value"`
+	//Keep copies the field at From rather than moving it
+	Keep bool `json:"Keep"`
+}
+
+// NegotiationPolicy translates a route's responses to the format callers accept when they do not accept the service's
+type NegotiationPolicy struct {
+	//Formats are the media types responses may be translated to, every format of negotiation.Codecs if empty
+	Formats []string `json:"Formats"`
+	//Strict responds 406 Not Acceptable when callers accept none of the formats, rather than sending the service's
+	Strict bool `json:"Strict"`
+}
+
+// ProtobufPolicy transcodes a route's protobuf bodies from and to JSON using the message types of a descriptor set
+type ProtobufPolicy struct {
+	//DescriptorSet is the file holding the FileDescriptorSet, as written by protoc --descriptor_set_out
+	DescriptorSet string `json:"DescriptorSet"`
+	//Request is the full name of the request message, JSON request bodies are transcoded to it if set
+	Request string `json:"Request"`
+	//Response is the full name of the response message, responses are transcoded to JSON for callers preferring it if set
+	Response string `json:"Response"`
+}
+
+// RouteDocs describes a route and the team owning it, making the gateway the source of truth for API ownership
+type RouteDocs struct {
+	//Summary and Description explain what the route does
+	Summary     string `json:"Summary"`
+	Description string `json:"Description"`
+	//Tags group the route with related routes
+	Tags []string `json:"Tags"`
+	//Owner is the team owning the route, Contact is how to reach them (e.g. an email address or a chat channel)
+	Owner   string `json:"Owner"`
+	Contact string `json:"Contact"`
+	//Deprecated is why the route is deprecated and what replaces it, empty if it is not
+	Deprecated string `json:"Deprecated"`
+	//Sunset is the date the route will be removed on, e.g. "2027-01-31"
+	Sunset string `json:"Sunset"`
+}
+
+// Middleware is a named step of the chain requests pass through before being proxied
+type Middleware struct {
+	//Name identifies the middleware, so routes can skip it
+	Name string `json:"Name"`
+	//Handler inspects or changes the request, writing a response stops the request from being proxied
+	Handler http.Handler `json:"-"`
+}
+
+// MiddlewareOverrides changes the middleware chain for one route
+type MiddlewareOverrides struct {
+	//Skip are the names of the middlewares of the chain which are not run for the route
+	Skip []string `json:"Skip"`
+	//Use are middlewares run for the route after the chain
+	Use []Middleware `json:"-"`
 }
 
 type RouteCollection []Route
+
+type routeContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the route serving the request
+func NewContext(ctx context.Context, route Route) context.Context {
+	return context.WithValue(ctx, routeContextKey{}, route)
+}
+
+// RouteFromContext returns the route serving the request, if the request was routed by arbor
+func RouteFromContext(ctx context.Context) (Route, bool) {
+	route, ok := ctx.Value(routeContextKey{}).(Route)
+	return route, ok
+}
+
+// Protected reports if the request is served by a Protected route, which testing and experimental behaviors must leave alone
+func Protected(ctx context.Context) bool {
+	route, ok := RouteFromContext(ctx)
+	return ok && route.Protected
+}
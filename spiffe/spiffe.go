@@ -0,0 +1,222 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package spiffe lets arbor take part in a SPIFFE zero-trust mesh, using an X.509 SVID
+// as its identity and verifying the SPIFFE IDs of the backends it connects to
+//
+// SVIDs are read from files kept current by the SPIRE agent's helper (spiffe-helper),
+// as the Workload API itself is served over gRPC.
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+)
+
+// ErrNoSPIFFEID is returned when a certificate does not carry a SPIFFE ID
+var ErrNoSPIFFEID = errors.New("spiffe: certificate has no SPIFFE ID")
+
+// ID is a SPIFFE ID, spiffe://trust-domain/path
+type ID struct {
+	TrustDomain string
+	Path        string
+}
+
+func (id ID) String() string {
+	return "spiffe://" + id.TrustDomain + id.Path
+}
+
+// ParseID parses and validates a SPIFFE ID
+func ParseID(s string) (ID, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ID{}, err
+	}
+	if u.Scheme != "spiffe" || u.Host == "" || u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "" {
+		return ID{}, fmt.Errorf("spiffe: invalid SPIFFE ID %q", s)
+	}
+	if strings.ToLower(u.Host) != u.Host || strings.HasSuffix(u.Path, "/") {
+		return ID{}, fmt.Errorf("spiffe: invalid SPIFFE ID %q", s)
+	}
+	return ID{TrustDomain: u.Host, Path: u.Path}, nil
+}
+
+// IDFromCertificate returns the SPIFFE ID in the URI SAN of an SVID
+func IDFromCertificate(cert *x509.Certificate) (ID, error) {
+	if len(cert.URIs) != 1 {
+		return ID{}, ErrNoSPIFFEID
+	}
+	return ParseID(cert.URIs[0].String())
+}
+
+// sourceCheckInterval is how often a source checks its files for changes
+const sourceCheckInterval = time.Second
+
+// Source provides arbor's X.509 SVID and the trust bundle of its trust domain from PEM files
+//
+// The files are reloaded when they change, so rotated SVIDs are picked up without a restart.
+type Source struct {
+	//CertFile is the SVID certificate chain, KeyFile its private key and BundleFile the trust bundle
+	CertFile   string
+	KeyFile    string
+	BundleFile string
+
+	mutex       sync.Mutex
+	cert        *tls.Certificate
+	bundle      *x509.CertPool
+	modified    time.Time
+	lastChecked time.Time
+}
+
+func modTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (s *Source) load() error {
+	modified, err := modTime(s.CertFile, s.KeyFile, s.BundleFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if _, err := IDFromCertificate(leaf); err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+	pem, err := ioutil.ReadFile(s.BundleFile)
+	if err != nil {
+		return err
+	}
+	bundle := x509.NewCertPool()
+	if !bundle.AppendCertsFromPEM(pem) {
+		return errors.New("spiffe: no certificates in trust bundle " + s.BundleFile)
+	}
+	s.cert = &cert
+	s.bundle = bundle
+	s.modified = modified
+	return nil
+}
+
+// refresh loads the files if they have changed, keeping the previous SVID if they can not be loaded
+func (s *Source) refresh() error {
+	if s.cert != nil && clock.Since(s.lastChecked) < sourceCheckInterval {
+		return nil
+	}
+	s.lastChecked = clock.Now()
+	modified, err := modTime(s.CertFile, s.KeyFile, s.BundleFile)
+	if s.cert != nil && (err != nil || !modified.After(s.modified)) {
+		return nil
+	}
+	err = s.load()
+	if err != nil && s.cert != nil {
+		logger.Log(logger.ERR, "Could not reload SVID from "+s.CertFile+": "+err.Error())
+		return nil
+	}
+	return err
+}
+
+// SVID returns arbor's current certificate and the trust bundle
+func (s *Source) SVID() (*tls.Certificate, *x509.CertPool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	err := s.refresh()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.cert, s.bundle, nil
+}
+
+// ID returns arbor's own SPIFFE ID
+func (s *Source) ID() (ID, error) {
+	cert, _, err := s.SVID()
+	if err != nil {
+		return ID{}, err
+	}
+	return IDFromCertificate(cert.Leaf)
+}
+
+// GetCertificate serves the SVID to clients, for use in tls.Config
+func (s *Source) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, _, err := s.SVID()
+	return cert, err
+}
+
+// GetClientCertificate presents the SVID to servers, for use in tls.Config
+func (s *Source) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, _, err := s.SVID()
+	return cert, err
+}
+
+// Verify checks a peer's certificate chain against the trust bundle and returns its SPIFFE ID
+//
+// SVIDs are not issued for DNS names, so the chain is verified without checking the host name.
+func (s *Source) Verify(chain []*x509.Certificate) (ID, error) {
+	if len(chain) == 0 {
+		return ID{}, errors.New("spiffe: peer presented no certificate")
+	}
+	_, bundle, err := s.SVID()
+	if err != nil {
+		return ID{}, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = chain[0].Verify(x509.VerifyOptions{
+		Roots:         bundle,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return ID{}, err
+	}
+	return IDFromCertificate(chain[0])
+}
+
+// VerifyConnection returns a tls.Config VerifyConnection callback accepting peers whose SPIFFE ID
+// is allowed by authorize
+//
+// Set InsecureSkipVerify alongside it, as it replaces the default verification.
+func (s *Source) VerifyConnection(authorize func(state tls.ConnectionState, id ID) error) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		id, err := s.Verify(state.PeerCertificates)
+		if err != nil {
+			return err
+		}
+		return authorize(state, id)
+	}
+}
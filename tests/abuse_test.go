@@ -0,0 +1,92 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/abuse"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestAbuseClassifiersStopRequestsBeforeProxying(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	bursts := &abuse.BurstScoring{Window: time.Minute, Throttle: 3, Block: 6}
+	abuse.Classifiers = []abuse.Classifier{
+		func(r *http.Request) abuse.Verdict {
+			if strings.Contains(r.UserAgent(), "scraper") {
+				return abuse.Verdict{Action: abuse.Challenge, Reason: "scraper user agent"}
+			}
+			return abuse.Verdict{}
+		},
+		bursts.Classify,
+	}
+	abuse.ChallengeURL = "https://example.com/captcha"
+	abuse.ChallengePassed = func(r *http.Request) bool {
+		_, err := r.Cookie("captcha")
+		return err == nil
+	}
+	defer func() {
+		abuse.Classifiers = nil
+		abuse.ChallengeURL = ""
+		abuse.ChallengePassed = nil
+	}()
+
+	proxied := 0
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Search",
+		Method:  "GET",
+		Pattern: "/search",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			middleware.AbuseMiddleware.ServeHTTP(w, r)
+			if w.Header().Get("Content-Type") == "" && w.Header().Get("Location") == "" {
+				proxied++
+			}
+		},
+	}})
+	get := func(ip string, userAgent string, captcha bool) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/search?q=a", http.NoBody)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("User-Agent", userAgent)
+		if captcha {
+			req.AddCookie(&http.Cookie{Name: "captcha", Value: "solved"})
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	challenged := get("198.51.100.1", "scraper/1.0", false)
+	if challenged.Code != http.StatusSeeOther || challenged.Header().Get("Location") != "https://example.com/captcha?return=%2Fsearch%3Fq%3Da" {
+		t.Errorf("expected a redirect to the challenge, got %d %s", challenged.Code, challenged.Header().Get("Location"))
+	}
+	if code := get("198.51.100.2", "scraper/1.0", true).Code; code != http.StatusOK {
+		t.Errorf("expected a caller who passed the challenge through, got %d", code)
+	}
+
+	codes := []int{}
+	for i := 0; i < 7; i++ {
+		codes = append(codes, get("203.0.113.9", "browser", false).Code)
+	}
+	expected := []int{200, 200, 200, 429, 429, 429, 403}
+	for i := range expected {
+		if codes[i] != expected[i] {
+			t.Fatalf("expected a burst to be throttled then blocked %v, got %v", expected, codes)
+		}
+	}
+	if code := get("192.0.2.1", "browser", false).Code; code != http.StatusOK {
+		t.Errorf("expected other clients to be unaffected, got %d", code)
+	}
+	fake.Advance(5 * time.Minute)
+	if code := get("203.0.113.9", "browser", false).Code; code != http.StatusOK {
+		t.Errorf("expected the score to decay, got %d", code)
+	}
+	if proxied != 6 {
+		t.Errorf("expected only allowed requests to be proxied, %d were", proxied)
+	}
+}
@@ -0,0 +1,79 @@
+package arbor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestAccessLogRecordsResponses(t *testing.T) {
+	var log bytes.Buffer
+	logger.AccessLogOutput, logger.AccessLogFormat = &log, `{{.Method}} {{.URI}} {{.Route}} {{.Status}} {{.BytesSent}} {{.BytesReceived}}`
+	defer func() { logger.AccessLogOutput, logger.AccessLogFormat = nil, logger.CombinedLogFormat }()
+
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Echo", Method: "POST", Pattern: "/echo", Handler: func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}},
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/echo", strings.NewReader("hello")))
+	if line := strings.TrimSpace(log.String()); line != "POST /echo Echo 201 5 5" {
+		t.Errorf("expected the access log line to describe the request, got %q", line)
+	}
+}
+
+func TestAccessLogPassesFlushesAndHijacksThrough(t *testing.T) {
+	flushed, hijacked := false, false
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Stream", Method: "GET", Pattern: "/stream", Handler: func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			if flushed = ok; ok {
+				w.Write([]byte("event"))
+				flusher.Flush()
+			}
+		}},
+		{Name: "Upgrade", Method: "GET", Pattern: "/upgrade", Handler: func(w http.ResponseWriter, r *http.Request) {
+			hijacker, ok := w.(http.Hijacker)
+			if !ok {
+				return
+			}
+			conn, buf, err := hijacker.Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			hijacked = true
+			buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+			buf.Flush()
+		}},
+	})
+	backend := httptest.NewServer(router)
+	defer backend.Close()
+
+	if resp, err := http.Get(backend.URL + "/stream"); err == nil {
+		resp.Body.Close()
+	}
+	if !flushed {
+		t.Error("expected the handler to be able to flush the response")
+	}
+	req, _ := http.NewRequest("GET", backend.URL+"/upgrade", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !hijacked || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("expected the handler to be able to hijack the connection, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,87 @@
+package arbor
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestAdminEndpointsRequirePinnedCertificates(t *testing.T) {
+	admin, _ := issueSVID(t, "", nil, nil)
+	other, _ := issueSVID(t, "", nil, nil)
+	health.AdminPins = []string{health.SPKIPin(admin)}
+	defer func() { health.AdminPins = nil }()
+
+	router := server.NewRouter(services.RouteCollection{})
+	get := func(cert *x509.Certificate) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/version", http.NoBody)
+		req.RemoteAddr = "127.0.0.1:1234"
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := get(admin); code != http.StatusOK {
+		t.Errorf("expected a local caller with the pinned certificate to be served, got %d", code)
+	}
+	for name, cert := range map[string]*x509.Certificate{"another certificate": other, "no certificate": nil} {
+		if code := get(cert); code == http.StatusOK {
+			t.Errorf("expected a local caller with %s to be refused", name)
+		}
+	}
+}
+
+func TestPinnedCertificatesWithAClientCA(t *testing.T) {
+	ca, caKey := issueSVID(t, "", nil, nil)
+	serverCert, serverKey := issueSVID(t, "spiffe://example.org/arbor", ca, caKey)
+	admin, adminKey := issueSVID(t, "spiffe://example.org/admin", ca, caKey)
+	other, otherKey := issueSVID(t, "spiffe://example.org/other", ca, caKey)
+	selfSigned, selfSignedKey := issueSVID(t, "", nil, nil)
+
+	dir := t.TempDir()
+	server.TLSCertFile, server.TLSKeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	server.TLSClientCAFile = filepath.Join(dir, "ca.pem")
+	writeKeyPair(t, server.TLSCertFile, server.TLSKeyFile, serverCert, serverKey)
+	writePEM(t, server.TLSClientCAFile, "CERTIFICATE", ca.Raw)
+	health.AdminPins = []string{health.SPKIPin(admin), health.SPKIPin(selfSigned)}
+	// Cleaned up after the server is killed
+	t.Cleanup(func() {
+		server.TLSCertFile, server.TLSKeyFile, server.TLSClientCAFile = "", "", ""
+		health.AdminPins = nil
+	})
+	address := startTLSServer(t)
+
+	get := func(cert *x509.Certificate, key *ecdsa.PrivateKey) (int, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{{Certificate: [][]byte{cert.Raw}, PrivateKey: key}},
+		}}}
+		resp, err := client.Get("https://" + address + "/version")
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	if code, err := get(admin, adminKey); code != http.StatusOK {
+		t.Errorf("expected the pinned certificate issued by the CA to be served, got %d (%v)", code, err)
+	}
+	if code, err := get(other, otherKey); err != nil || code == http.StatusOK {
+		t.Errorf("expected a certificate issued by the CA which is not pinned to be refused by the endpoint, got %d (%v)", code, err)
+	}
+	if _, err := get(selfSigned, selfSignedKey); err == nil {
+		t.Error("expected the handshake to refuse a pinned certificate the CA did not issue")
+	}
+}
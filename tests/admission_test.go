@@ -0,0 +1,57 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestMemoryAdmissionShedsNearTheLimit(t *testing.T) {
+	defer func() {
+		server.MemoryAdmission, server.MemoryLimit, server.MemoryAdmissionWait = false, 0, 250*time.Millisecond
+	}()
+	// The fake clock never advances, admission must not depend on it
+	defer clock.Use(clock.NewFake(time.Now()))()
+
+	routes := services.RouteCollection{{Name: "Ok", Method: "GET", Pattern: "/ok", Handler: func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}}}
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		server.NewArborServer(routes, "127.0.0.1", 0).Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/ok", nil))
+		return recorder
+	}
+	processLimit := debug.SetMemoryLimit(-1)
+
+	// A limit every process is above
+	server.MemoryLimit, server.MemoryAdmissionWait = 1, 20*time.Millisecond
+	if code := get().Code; code != http.StatusOK {
+		t.Errorf("expected admission control to be off unless enabled, got %d", code)
+	}
+
+	server.MemoryAdmission = true
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get() }()
+	select {
+	case recorder := <-done:
+		if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") != "1" {
+			t.Errorf("expected the request to be shed with 503 and Retry-After, got %d", recorder.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the request to be shed after MemoryAdmissionWait")
+	}
+
+	server.MemoryLimit = 1 << 50
+	if code := get().Code; code != http.StatusOK {
+		t.Errorf("expected requests to be admitted below the watermark, got %d", code)
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != processLimit {
+		t.Errorf("expected building the server to leave the process memory limit alone, it changed to %d", limit)
+	}
+}
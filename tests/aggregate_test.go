@@ -0,0 +1,116 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+)
+
+func TestAggregateListPagesThroughMergedSources(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	lists := map[string][]int{"http://a.local/orders": {1, 3, 5, 7}, "http://b.local/returns": {2, 4, 6}}
+	for url, created := range lists {
+		created := created
+		httpmock.RegisterResponder("GET", url, func(req *http.Request) (*http.Response, error) {
+			offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+			items := []map[string]int{}
+			for i := offset; i < len(created) && i < offset+limit; i++ {
+				items = append(items, map[string]int{"created": created[i]})
+			}
+			return httpmock.NewJsonResponse(200, map[string]interface{}{"data": items})
+		})
+	}
+	aggregation := arbor.ListAggregation{
+		Sources:   []arbor.ListSource{{URL: "http://a.local/orders", ItemsField: "data"}, {URL: "http://b.local/returns", ItemsField: "data"}},
+		SortField: "created",
+	}
+
+	var seen []int
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/activity?limit=3&cursor="+cursor, http.NoBody)
+		arbor.AggregateList(recorder, req, aggregation, "")
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", recorder.Code)
+		}
+		var list struct {
+			Items []struct {
+				Created int `json:"created"`
+			} `json:"items"`
+			NextCursor string `json:"next_cursor"`
+		}
+		json.NewDecoder(recorder.Body).Decode(&list)
+		for _, item := range list.Items {
+			seen = append(seen, item.Created)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		cursor = list.NextCursor
+	}
+
+	if len(seen) != 7 {
+		t.Fatalf("expected 7 items, got %v", seen)
+	}
+	for i, created := range seen {
+		if created != i+1 {
+			t.Fatalf("items are not merged in order: %v", seen)
+		}
+	}
+}
+
+func TestAggregateListPartialFailure(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://a.local/orders",
+		httpmock.NewStringResponder(200, `[{"created":1},{"created":3}]`))
+	httpmock.RegisterResponder("GET", "http://b.local/returns",
+		httpmock.NewStringResponder(503, ""))
+
+	aggregation := arbor.ListAggregation{
+		Sources:        []arbor.ListSource{{URL: "http://a.local/orders"}, {URL: "http://b.local/returns", Name: "returns"}},
+		SortField:      "created",
+		MaxParallelism: 1,
+	}
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/activity", http.NoBody)
+		arbor.AggregateList(recorder, req, aggregation, "")
+		return recorder
+	}
+
+	if code := get().Code; code != http.StatusBadGateway {
+		t.Errorf("failed source did not fail the request: %d", code)
+	}
+
+	aggregation.OnFailure = arbor.PartialResults
+	var list struct {
+		Items    []json.RawMessage `json:"items"`
+		Warnings []struct {
+			Source string `json:"source"`
+		} `json:"warnings"`
+	}
+	json.NewDecoder(get().Body).Decode(&list)
+	if len(list.Items) != 2 || len(list.Warnings) != 1 || list.Warnings[0].Source != "returns" {
+		t.Errorf("expected partial results with a warning, got %+v", list)
+	}
+
+	aggregation.OnFailure = arbor.SubstituteDefaults
+	aggregation.Sources[1].Default = []json.RawMessage{json.RawMessage(`{"created":2,"placeholder":true}`)}
+	list.Warnings = nil
+	json.NewDecoder(get().Body).Decode(&list)
+	if len(list.Items) != 3 || string(list.Items[1]) != `{"created":2,"placeholder":true}` || len(list.Warnings) != 0 {
+		t.Errorf("expected the default merged in, got %+v", list)
+	}
+}
@@ -0,0 +1,97 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/alerts"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestAlertsGoToTheOwningTeam(t *testing.T) {
+	var healthy int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && atomic.LoadInt32(&healthy) == 1 {
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+
+	owned := make(chan alerts.Alert, 10)
+	unowned := make(chan alerts.Alert, 10)
+	alerts.Sinks["stock"] = alerts.SinkFunc(func(alert alerts.Alert) error {
+		owned <- alert
+		return nil
+	})
+	alerts.DefaultSink = alerts.SinkFunc(func(alert alerts.Alert) error {
+		unowned <- alert
+		return nil
+	})
+	alerts.BurnMinRequests = 5
+	defer func() {
+		delete(alerts.Sinks, "stock")
+		alerts.DefaultSink = nil
+		alerts.BurnMinRequests = 20
+	}()
+	receive := func(sent chan alerts.Alert) alerts.Alert {
+		select {
+		case alert := <-sent:
+			return alert
+		case <-time.After(time.Second):
+			t.Fatal("no alert was sent")
+		}
+		return alerts.Alert{}
+	}
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Inventory",
+		Method:  "GET",
+		Pattern: "/items",
+		SLA:     &services.SLAPolicy{Objective: 0.99},
+		Docs:    &services.RouteDocs{Owner: "stock"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, backend.URL+"/items")
+		},
+	}})
+	for i := 0; i < 6; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", http.NoBody))
+	}
+	if alert := receive(owned); alert.Kind != alerts.ErrorBudgetBurn || alert.Route != "Inventory" || alert.Owner != "stock" {
+		t.Errorf("expected the route's owner to be alerted of the burn, got %+v", alert)
+	}
+
+	// The backend has no owner of its own, so its alerts go to the owner of the route sending it requests
+	health.Backends = []health.Backend{{Name: "inventory", HealthURL: backend.URL + "/health"}}
+	health.ProbeInterval = 10 * time.Millisecond
+	defer func() {
+		health.Backends = nil
+		health.ProbeInterval = 10 * time.Second
+		health.Unregister("backend:inventory")
+	}()
+	stop := health.StartProbing()
+	defer stop()
+	if alert := receive(owned); alert.Kind != alerts.BackendDown || alert.Backend != "inventory" {
+		t.Errorf("expected the owner to be alerted of the backend going down, got %+v", alert)
+	}
+	atomic.StoreInt32(&healthy, 1)
+	if alert := receive(owned); alert.Kind != alerts.BackendUp {
+		t.Errorf("expected the owner to be alerted of the backend recovering, got %+v", alert)
+	}
+
+	alerts.Send(alerts.Alert{Kind: alerts.BackendDown, Backend: "ledger"}, "ledger:8000")
+	if alert := receive(unowned); alert.Backend != "ledger" || alert.Owner != "" {
+		t.Errorf("expected an unowned alert to go to the default sink, got %+v", alert)
+	}
+	select {
+	case alert := <-owned:
+		t.Errorf("expected one alert per window, also got %+v", alert)
+	default:
+	}
+}
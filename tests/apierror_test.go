@@ -0,0 +1,66 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/apierror"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestErrorsShareOneEnvelope(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", "http://test.local/documents/1", httpmock.NewStringResponder(200, ""))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/documents/1")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Replace", Method: "PUT", Pattern: "/documents/1", Handler: handler, RequirePreconditions: true},
+	})
+	send := func(method string, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, http.NoBody))
+		return recorder
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+		code   string
+	}{
+		{"GET", "/missing", http.StatusNotFound, "not_found"},
+		{"PUT", "/documents/1", http.StatusPreconditionRequired, "precondition_required"},
+	} {
+		recorder := send(test.method, test.path)
+		var body apierror.Error
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatalf("%s %s did not respond with a JSON error: %v", test.method, test.path, err)
+		}
+		if recorder.Code != test.status || body.Status != test.status || body.Code != test.code || body.Message == "" {
+			t.Errorf("unexpected error for %s %s: %d %+v", test.method, test.path, recorder.Code, body)
+		}
+		if body.RequestID == "" || body.RequestID != recorder.Header().Get("X-Request-Id") {
+			t.Errorf("error for %s %s does not carry the request ID: %q", test.method, test.path, body.RequestID)
+		}
+	}
+
+	defaultRenderer := apierror.Renderer
+	apierror.Renderer = func(w http.ResponseWriter, r *http.Request, e apierror.Error) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(e.Status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"title": e.Message, "status": e.Status})
+	}
+	defer func() { apierror.Renderer = defaultRenderer }()
+	if recorder := send("GET", "/missing"); recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("custom renderer was not used: %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,88 @@
+package arbor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/audit"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestAuditTrailRecordsSecurityEvents(t *testing.T) {
+	var trail bytes.Buffer
+	audit.Output = &trail
+	defer func() { audit.Output = nil }()
+
+	secret := []byte("secret")
+	hs256 := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	jwt := middleware.JWTMiddlewareFactory(&security.JWTVerifier{Secret: secret})
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Admin",
+		Method:  "GET",
+		Pattern: "/admin",
+		Roles:   []string{"admin"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			jwt.ServeHTTP(w, r)
+			if w.Header().Get("WWW-Authenticate") == "" {
+				middleware.RolesMiddleware.ServeHTTP(w, r)
+			}
+		},
+	}})
+	get := func(token string) {
+		req := httptest.NewRequest("GET", "/admin", http.NoBody)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	get("")
+	get(signJWT("HS256", map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}, hs256))
+
+	keys := security.NewMemoryKeyStore()
+	issued, _ := security.IssueAPIKey(keys, security.APIKey{Client: "reports"})
+	security.RotateAPIKey(keys, security.HashAPIKey(issued), 0)
+
+	var events []audit.Event
+	decoder := json.NewDecoder(&trail)
+	for decoder.More() {
+		var event audit.Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	expected := []struct{ eventType, subject string }{
+		{audit.AuthenticationFailed, ""},
+		{audit.AuthenticationSucceeded, "alice"},
+		{audit.AuthorizationDenied, "alice"},
+		{audit.ConfigurationChanged, "reports"},
+		{audit.CredentialRotated, "reports"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		if events[i].Type != e.eventType || events[i].Subject != e.subject || events[i].Time.IsZero() {
+			t.Errorf("expected a %s event for %q, got %+v", e.eventType, e.subject, events[i])
+		}
+	}
+	if events[2].Route != "Admin" || events[2].Path != "/admin" || events[2].ClientIP != "192.0.2.1" {
+		t.Errorf("expected the denial to name the request, got %+v", events[2])
+	}
+	if bytes.Contains(trail.Bytes(), []byte(issued)) {
+		t.Error("the audit trail recorded an API key secret")
+	}
+}
@@ -0,0 +1,125 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestProxyBalancesAcrossInstances(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	hits := map[string]int{}
+	for _, host := range []string{"users-a.local", "users-b.local"} {
+		host := host
+		httpmock.RegisterResponder("GET", "http://"+host+"/v1/users/profile",
+			func(req *http.Request) (*http.Response, error) {
+				hits[host]++
+				return httpmock.NewStringResponse(200, ""), nil
+			},
+		)
+	}
+	defer delete(proxy.BackendPools, "users")
+
+	get := func(n int) {
+		for i := 0; i < n; i++ {
+			recorder := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://gateway.local/profile", http.NoBody)
+			arbor.GET(recorder, "http://users/profile", "RAW", "", req)
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d", recorder.Code)
+			}
+		}
+	}
+
+	proxy.BackendPools["users"] = &proxy.Pool{Instances: []proxy.Instance{
+		{URL: "http://users-a.local/v1/users"},
+		{URL: "http://users-b.local/v1/users"},
+	}}
+	get(4)
+	if hits["users-a.local"] != 2 || hits["users-b.local"] != 2 {
+		t.Errorf("round robin was uneven: %v", hits)
+	}
+
+	hits = map[string]int{}
+	proxy.BackendPools["users"] = &proxy.Pool{Policy: proxy.Weighted, Instances: []proxy.Instance{
+		{URL: "http://users-a.local/v1/users", Weight: 3},
+		{URL: "http://users-b.local/v1/users"},
+	}}
+	get(8)
+	if hits["users-a.local"] != 6 || hits["users-b.local"] != 2 {
+		t.Errorf("weighted split was not 3:1: %v", hits)
+	}
+}
+
+func TestProxyKeepsClientsOnTheirInstance(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	hits := map[string]int{}
+	for _, host := range []string{"carts-a.local", "carts-b.local", "carts-c.local"} {
+		host := host
+		httpmock.RegisterResponder("GET", "http://"+host+"/v1/carts",
+			func(req *http.Request) (*http.Response, error) {
+				hits[host]++
+				return httpmock.NewStringResponse(200, ""), nil
+			},
+		)
+	}
+	defer delete(proxy.BackendPools, "carts")
+	instances := []proxy.Instance{
+		{URL: "http://carts-a.local/v1/carts"},
+		{URL: "http://carts-b.local/v1/carts"},
+		{URL: "http://carts-c.local/v1/carts"},
+	}
+
+	get := func(prepare func(*http.Request)) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/carts", http.NoBody)
+		prepare(req)
+		arbor.GET(recorder, "http://carts", "RAW", "", req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", recorder.Code)
+		}
+		return recorder
+	}
+
+	proxy.BackendPools["carts"] = &proxy.Pool{Affinity: proxy.CookieAffinity, AffinityKey: "cart_instance", Instances: instances}
+	cookies := get(func(*http.Request) {}).Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "cart_instance" {
+		t.Fatalf("expected an affinity cookie, got %v", cookies)
+	}
+	hits = map[string]int{}
+	for i := 0; i < 4; i++ {
+		recorder := get(func(req *http.Request) { req.AddCookie(cookies[0]) })
+		if len(recorder.Result().Cookies()) != 0 {
+			t.Errorf("expected the affinity cookie not to be reissued")
+		}
+	}
+	if len(hits) != 1 {
+		t.Errorf("expected requests with the cookie to go to one instance: %v", hits)
+	}
+
+	proxy.BackendPools["carts"] = &proxy.Pool{Affinity: proxy.HeaderAffinity, AffinityKey: "X-Session", Instances: instances}
+	hits = map[string]int{}
+	for i := 0; i < 3; i++ {
+		get(func(req *http.Request) { req.Header.Set("X-Session", "session-1") })
+	}
+	if len(hits) != 1 {
+		t.Errorf("expected requests of one session to go to one instance: %v", hits)
+	}
+	hits = map[string]int{}
+	for i := 0; i < 30; i++ {
+		get(func(req *http.Request) { req.Header.Set("X-Session", "session-"+strconv.Itoa(i)) })
+	}
+	if len(hits) != 3 {
+		t.Errorf("expected sessions to be spread over every instance: %v", hits)
+	}
+}
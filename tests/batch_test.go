@@ -0,0 +1,136 @@
+package arbor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestBatchServesEachRequestThroughItsRoute(t *testing.T) {
+	server.BatchPath = "/$batch"
+	defer func() { server.BatchPath = "" }()
+
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Item", Method: "GET", Pattern: "/items/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id":"` + mux.Vars(r)["id"] + `"}`))
+		}},
+		{Name: "CreateItem", Method: "POST", Pattern: "/items", Handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer admin" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		}},
+	})
+
+	batch := `[
+		{"method": "GET", "path": "/items/1"},
+		{"method": "POST", "path": "/items", "body": {"name": "a"}},
+		{"method": "POST", "path": "/items", "headers": {"Authorization": "Bearer admin"}, "body": {"name": "b"}},
+		{"method": "GET", "path": "/missing"}
+	]`
+	for _, query := range []string{"", "?parallel=true"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "/$batch"+query, strings.NewReader(batch)))
+		var responses []server.BatchResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&responses); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("expected the batch to be served, got %d: %v", recorder.Code, err)
+		}
+		expected := []struct {
+			status int
+			body   string
+		}{
+			{http.StatusOK, `{"id":"1"}`},
+			{http.StatusUnauthorized, ``},
+			{http.StatusCreated, `{"name":"b"}`},
+			{http.StatusNotFound, ``},
+		}
+		if len(responses) != len(expected) {
+			t.Fatalf("expected %d responses, got %d", len(expected), len(responses))
+		}
+		for i, e := range expected {
+			if responses[i].Status != e.status || (e.body != "" && string(responses[i].Body) != e.body) {
+				t.Errorf("%s: expected response %d to be %d %s, got %d %s", query, i, e.status, e.body, responses[i].Status, responses[i].Body)
+			}
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/$batch", strings.NewReader(`[{"method": "POST", "path": "/$batch"}]`)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected a nested batch to be refused, got %d", recorder.Code)
+	}
+}
+
+func TestBatchOverTheBodyLimitIsRefused(t *testing.T) {
+	server.BatchPath = "/$batch"
+	defer func() { server.BatchPath = "" }()
+	router := server.NewRouter(services.RouteCollection{})
+
+	// A batch one byte over the limit, sent without a length so it can only be caught while reading
+	batch := `[{"method": "GET", "path": "/items", "body": "` + strings.Repeat("a", constants.MaxFileUploadSize) + `"}]`
+	req := httptest.NewRequest("POST", "/$batch", ioutil.NopCloser(strings.NewReader(batch)))
+	req.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected an oversized batch to be refused with 413, got %d", recorder.Code)
+	}
+}
+
+func TestBatchesAreServedLikeTheirHost(t *testing.T) {
+	server.BatchPath = "/$batch"
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			middleware.CORSMiddleware.ServeHTTP(w, r)
+			w.Write([]byte(body))
+		}
+	}
+	server.VirtualHosts = map[string]server.VirtualHost{
+		"api.foo.com": {
+			Routes:              services.RouteCollection{{Name: "Foo", Method: "GET", Pattern: "/things", Handler: respond("foo")}},
+			AccessControlPolicy: "https://foo.com",
+		},
+	}
+	defer func() {
+		server.BatchPath = ""
+		server.VirtualHosts = map[string]server.VirtualHost{}
+	}()
+	routes := services.RouteCollection{{Name: "Default", Method: "GET", Pattern: "/things", Handler: respond("default")}}
+	handler := server.NewArborServer(routes, "127.0.0.1", 0).Handler()
+
+	for host, expected := range map[string]struct {
+		body    string
+		allowed string
+	}{
+		"api.foo.com": {`"foo"`, ""},
+		"other.com":   {`"default"`, "https://bar.com"},
+	} {
+		req := httptest.NewRequest("POST", "/$batch", strings.NewReader(`[{"method": "GET", "path": "/things"}]`))
+		req.Host = host
+		req.Header.Set("Origin", "https://bar.com")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		var responses []server.BatchResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&responses); err != nil || len(responses) != 1 {
+			t.Fatalf("expected the batch for %s to be served, got %d: %v", host, recorder.Code, err)
+		}
+		if string(responses[0].Body) != expected.body || responses[0].Headers["Access-Control-Allow-Origin"] != expected.allowed {
+			t.Errorf("expected the request batched for %s to be served %s allowing %q, got %s allowing %q",
+				host, expected.body, expected.allowed, responses[0].Body, responses[0].Headers["Access-Control-Allow-Origin"])
+		}
+	}
+}
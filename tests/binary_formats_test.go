@@ -0,0 +1,129 @@
+package arbor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/cbor"
+	"github.com/arbor-dev/arbor/msgpack"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestBinaryFormatsRoundTripJSON(t *testing.T) {
+	document := `{"id":7,"name":"Book & pen","tags":["a","b"],"price":12.5,"neg":-300,"big":18446744073709551615,"ok":true,"none":null}`
+	codecs := map[string]struct {
+		toJSON, fromJSON func([]byte) ([]byte, error)
+		encoded          []byte
+	}{
+		"msgpack": {msgpack.ToJSON, msgpack.FromJSON, []byte{0x81, 0xa1, 'a', 0x93, 0x01, 0xff, 0xc3}},
+		"cbor":    {cbor.ToJSON, cbor.FromJSON, []byte{0xa1, 0x61, 'a', 0x83, 0x01, 0x20, 0xf5}},
+	}
+	for name, codec := range codecs {
+		encoded, err := codec.fromJSON([]byte(document))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if decoded, err := codec.toJSON(encoded); err != nil || string(decoded) != document {
+			t.Errorf("%s: expected %s back, got %s (%v)", name, document, decoded, err)
+		}
+		if encoded, _ := codec.fromJSON([]byte(`{"a": [1, -1, true]}`)); !bytes.Equal(encoded, codec.encoded) {
+			t.Errorf("%s: expected the shortest encoding %x, got %x", name, codec.encoded, encoded)
+		}
+		if _, err := codec.toJSON(codec.encoded[:4]); err == nil {
+			t.Errorf("%s: expected a truncated body to be refused", name)
+		}
+	}
+
+	decoded := map[string][]byte{
+		`"AQI="`:                 {0xc4, 0x02, 0x01, 0x02},
+		`"1970-01-01T00:00:01Z"`: {0xd6, 0xff, 0x00, 0x00, 0x00, 0x01},
+		`{"1":"x"}`:              {0x81, 0x01, 0xa1, 'x'},
+	}
+	for expected, body := range decoded {
+		if json, err := msgpack.ToJSON(body); err != nil || string(json) != expected {
+			t.Errorf("expected MessagePack %x to be %s, got %s (%v)", body, expected, json, err)
+		}
+	}
+	decoded = map[string][]byte{
+		`[1,2]`:  {0x9f, 0x01, 0x02, 0xff},
+		`1`:      {0xf9, 0x3c, 0x00},
+		`256`:    {0xc2, 0x42, 0x01, 0x00},
+		`"2013"`: {0xc0, 0x64, '2', '0', '1', '3'},
+		`"ab"`:   {0x7f, 0x61, 'a', 0x61, 'b', 0xff},
+	}
+	for expected, body := range decoded {
+		if json, err := cbor.ToJSON(body); err != nil || string(json) != expected {
+			t.Errorf("expected CBOR %x to be %s, got %s (%v)", body, expected, json, err)
+		}
+	}
+}
+
+func TestBinaryFormatsTranslateForJSONServices(t *testing.T) {
+	var received []byte
+	var contentType string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		contentType = r.Header.Get("Content-Type")
+		if r.URL.Path == "/json" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write(received)
+	}))
+	defer backend.Close()
+
+	route := func(name string, pattern string, format string, translate bool) services.Route {
+		return services.Route{Name: name, Method: "POST", Pattern: pattern, TranslateToJSON: translate, Handler: func(w http.ResponseWriter, r *http.Request) {
+			path := "/binary"
+			if translate {
+				path = "/json"
+			}
+			arbor.Proxy(w, r, backend.URL+path, arbor.WithFormat(format))
+		}}
+	}
+	router := server.NewRouter(services.RouteCollection{
+		route("Msgpack", "/msgpack", "MSGPACK", true),
+		route("CBOR", "/cbor", "CBOR", false),
+	})
+	post := func(path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	order, _ := msgpack.FromJSON([]byte(`{"id":7,"items":["a","b"]}`))
+	recorder := post("/msgpack", order, map[string]string{"Content-Type": msgpack.MediaType})
+	if string(received) != `{"id":7,"items":["a","b"]}` || contentType != "application/json" {
+		t.Errorf("expected the service to receive JSON, got %s %s", contentType, received)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), order) || recorder.Header().Get("Content-Type") != msgpack.MediaType {
+		t.Errorf("expected the caller to receive MessagePack, got %s %x", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+	recorder = post("/msgpack", order, map[string]string{"Content-Type": msgpack.MediaType, "Accept": "application/json"})
+	if recorder.Body.String() != `{"id":7,"items":["a","b"]}` || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON for callers preferring it, got %s %s", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+	if code := post("/msgpack", []byte{0x92, 0x01}, map[string]string{"Content-Type": msgpack.MediaType}).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a malformed body to be refused, got %d", code)
+	}
+
+	order, _ = cbor.FromJSON([]byte(`{"id":7}`))
+	recorder = post("/cbor", order, map[string]string{"Content-Type": cbor.MediaType})
+	if !bytes.Equal(received, order) || contentType != cbor.MediaType {
+		t.Errorf("expected the CBOR body to be sent as it is, got %s %x", contentType, received)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), order) || recorder.Header().Get("Content-Type") != cbor.MediaType {
+		t.Errorf("expected the CBOR response with its media type, got %s %x", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+	if code := post("/cbor", []byte(`{"id":7}`), map[string]string{"Content-Type": "application/json"}).Code; code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected JSON to be refused by a route which does not translate it, got %d", code)
+	}
+}
@@ -0,0 +1,74 @@
+package arbor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestBodyTransformsBridgeContracts(t *testing.T) {
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"order_id": 7, "lines": [{"sku": "a", "qty": 1}, {"sku": "b", "qty": 2}], "internal": {"shard": 3}}`))
+	}))
+	defer backend.Close()
+
+	transform := &services.BodyTransform{
+		Request: []services.FieldMapping{
+			{From: "/customer/name", To: "/customerName"},
+			{From: "/items/*/id", To: "/items/*/sku"},
+			{To: "/channel", Value: json.RawMessage(`"web"`)},
+		},
+		Response: []services.FieldMapping{
+			{From: "/order_id", To: "/id"},
+			{From: "/lines", To: "/items"},
+			{From: "/items/*/qty", To: "/items/*/quantity"},
+			{From: "/items/*/sku", To: "/items/*/id", Keep: true},
+			{From: "/internal"},
+		},
+	}
+	routes := services.RouteCollection{{
+		Name:      "CreateOrder",
+		Method:    "POST",
+		Pattern:   "/orders",
+		Transform: transform,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.POST(w, backend.URL+"/orders", "JSON", "", r)
+		},
+	}}
+	if err := server.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	router := server.NewRouter(routes)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"customer": {"name": "Ada"}, "items": [{"id": "a"}, {"id": "b"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, req)
+
+	if expected := `{"channel":"web","customer":{},"customerName":"Ada","items":[{"sku":"a"},{"sku":"b"}]}`; received != expected {
+		t.Errorf("expected the service to receive %s, got %s", expected, received)
+	}
+	if expected := `{"id":7,"items":[{"id":"a","quantity":1,"sku":"a"},{"id":"b","quantity":2,"sku":"b"}]}`; recorder.Body.String() != expected {
+		t.Errorf("expected the caller to receive %s, got %d %s", expected, recorder.Code, recorder.Body)
+	}
+	if recorder.Header().Get("ETag") == `"v1"` {
+		t.Error("expected the service's ETag not to be sent with the transformed body")
+	}
+
+	routes[0].Transform = &services.BodyTransform{Response: []services.FieldMapping{{From: "/lines/*/sku", To: "/sku"}}}
+	if err := server.ValidateRoutes(routes); err == nil {
+		t.Error("expected a mapping moving fields out of their items to be invalid")
+	}
+}
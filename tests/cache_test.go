@@ -0,0 +1,181 @@
+package arbor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/cache"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestCacheTTL(t *testing.T) {
+	policy := &services.CachePolicy{}
+	req, _ := http.NewRequest(http.MethodGet, "http://test.local/products", nil)
+
+	header := http.Header{"Cache-Control": {"public, max-age=60"}}
+	if ttl := cache.TTL(req, policy, http.StatusOK, header, 10); ttl != time.Minute {
+		t.Errorf("expected max-age to be honored, got %v", ttl)
+	}
+	header = http.Header{"Cache-Control": {"no-store"}}
+	if ttl := cache.TTL(req, &services.CachePolicy{TTL: time.Hour}, http.StatusOK, header, 10); ttl != 0 {
+		t.Errorf("no-store response was cached for %v", ttl)
+	}
+
+	req.Header.Set("Authorization", "secret")
+	header = http.Header{"Cache-Control": {"max-age=60"}}
+	if ttl := cache.TTL(req, policy, http.StatusOK, header, 10); ttl != 0 {
+		t.Errorf("authorized response was shared for %v", ttl)
+	}
+	if ttl := cache.TTL(req, &services.CachePolicy{KeyHeaders: []string{"authorization"}}, http.StatusOK, header, 10); ttl != time.Minute {
+		t.Errorf("authorized response keyed by credentials was not cached, got %v", ttl)
+	}
+}
+
+func TestLRUStoreEvicts(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(0, 0))
+	store := cache.NewLRUStore(20)
+	entry := func() *cache.Entry {
+		return &cache.Entry{Status: http.StatusOK, Body: []byte("0123456789"), Expires: fake.Now().Add(time.Minute)}
+	}
+
+	store.Set("a", entry())
+	store.Set("b", entry())
+	if e, _ := store.Get("a"); e != nil {
+		t.Error("least recently used entry was not evicted")
+	}
+	if e, _ := store.Get("b"); e == nil {
+		t.Fatal("most recent entry was evicted")
+	}
+
+	fake.Advance(time.Minute)
+	if e, _ := store.Get("b"); e != nil {
+		t.Error("expired entry was returned")
+	}
+}
+
+func TestCacheConditionalRequests(t *testing.T) {
+	arbortest.UseFakeClock(t, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	entry := cache.NewEntry(http.StatusOK, http.Header{}, []byte(`{"id":0}`), time.Minute)
+	etag := entry.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag was generated")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://test.local/products", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	if !cache.NotModified(req, entry) {
+		t.Error("matching ETag was not answered with 304")
+	}
+	req.Header.Set("If-None-Match", `"other"`)
+	req.Header.Set("If-Modified-Since", "Sun, 01 Jan 2017 00:00:00 GMT")
+	if cache.NotModified(req, entry) {
+		t.Error("If-Modified-Since was used despite If-None-Match")
+	}
+	req.Header.Del("If-None-Match")
+	if !cache.NotModified(req, entry) {
+		t.Error("unmodified entry was not answered with 304")
+	}
+}
+
+func TestVirtualHostsAreCachedApart(t *testing.T) {
+	backend := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, body)
+		}))
+	}
+	foo, bar := backend(`{"host":"foo"}`), backend(`{"host":"bar"}`)
+	defer foo.Close()
+	defer bar.Close()
+	responses := cache.Responses
+	cache.Responses = cache.NewLRUStore(1 << 20)
+	defer func() { cache.Responses = responses }()
+
+	route := func(url string) services.RouteCollection {
+		return services.RouteCollection{{
+			Name:    "Items",
+			Method:  "GET",
+			Pattern: "/items",
+			Cache:   &services.CachePolicy{TTL: time.Minute},
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				arbor.GET(w, url+"/items", "JSON", "", r)
+			},
+		}}
+	}
+	server.VirtualHosts = map[string]server.VirtualHost{
+		"foo.com": {Routes: route(foo.URL)},
+		"bar.com": {Routes: route(bar.URL)},
+	}
+	defer func() { server.VirtualHosts = map[string]server.VirtualHost{} }()
+	handler := server.NewArborServer(nil, "127.0.0.1", 0).Handler()
+
+	for _, host := range []string{"foo.com", "bar.com", "foo.com", "bar.com"} {
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Host = host
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if expected := map[string]string{"foo.com": `{"host":"foo"}`, "bar.com": `{"host":"bar"}`}[host]; recorder.Body.String() != expected {
+			t.Errorf("request for %s was served %q, expected %q", host, recorder.Body.String(), expected)
+		}
+	}
+}
+
+func TestResponsesVaryingOnUnkeyedHeadersAreNotShared(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Vary", "Accept-Encoding, Accept-Language")
+		io.WriteString(w, `{"language":"`+r.Header.Get("Accept-Language")+`"}`)
+	}))
+	defer backend.Close()
+	responses := cache.Responses
+	cache.Responses = cache.NewLRUStore(1 << 20)
+	defer func() { cache.Responses = responses }()
+
+	get := func(policy *services.CachePolicy) func(language string) string {
+		router := server.NewRouter(services.RouteCollection{{
+			Name:    "Greeting",
+			Method:  "GET",
+			Pattern: "/greeting",
+			Cache:   policy,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				arbor.Proxy(w, r, backend.URL+"/greeting")
+			},
+		}})
+		return func(language string) string {
+			req := httptest.NewRequest("GET", "/greeting", nil)
+			req.Header.Set("Accept-Language", language)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			return recorder.Body.String()
+		}
+	}
+
+	unkeyed := get(&services.CachePolicy{TTL: time.Minute})
+	if unkeyed("en") != `{"language":"en"}` || unkeyed("fr") != `{"language":"fr"}` || calls != 2 {
+		t.Errorf("expected a response varying on an unkeyed header not to be cached, the backend was called %d times", calls)
+	}
+
+	calls = 0
+	keyed := get(&services.CachePolicy{TTL: time.Minute, KeyHeaders: []string{"Accept-Encoding", "accept-language"}})
+	for _, language := range []string{"en", "fr", "en", "fr"} {
+		if body := keyed(language); body != `{"language":"`+language+`"}` {
+			t.Errorf("expected the %s response, got %s", language, body)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected a response varying on keyed headers to be cached per value, the backend was called %d times", calls)
+	}
+
+	req := httptest.NewRequest("GET", "/greeting", nil)
+	if ttl := cache.TTL(req, &services.CachePolicy{TTL: time.Minute}, http.StatusOK, http.Header{"Vary": {"*"}}, 10); ttl != 0 {
+		t.Errorf("expected a response varying on everything not to be cached, got %v", ttl)
+	}
+}
@@ -0,0 +1,102 @@
+package arbor
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// writeKeyPair writes a certificate and its key to PEM files
+func writeKeyPair(t *testing.T, certFile string, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	writePEM(t, certFile, "CERTIFICATE", cert.Raw)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+// startTLSServer starts a gateway serving TLS with server.TLSCertFile and returns its address once it listens
+func startTLSServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	srv := server.NewArborServer(services.RouteCollection{}, "127.0.0.1", uint16(port))
+	go srv.StartServer()
+	t.Cleanup(srv.KillServer)
+
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return address
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServedCertificatesAreReloaded(t *testing.T) {
+	ca, caKey := issueSVID(t, "", nil, nil)
+	first, firstKey := issueSVID(t, "spiffe://example.org/first", ca, caKey)
+	second, secondKey := issueSVID(t, "spiffe://example.org/second", ca, caKey)
+	monitored, _ := issueSVID(t, "spiffe://example.org/monitored", ca, caKey)
+
+	dir := t.TempDir()
+	server.TLSCertFile, server.TLSKeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, server.TLSCertFile, server.TLSKeyFile, first, firstKey)
+	monitoredFile := filepath.Join(dir, "monitored.pem")
+	writePEM(t, monitoredFile, "CERTIFICATE", monitored.Raw)
+	server.MonitoredCertificates = []string{monitoredFile}
+	server.CertificateCheckInterval = 5 * time.Millisecond
+	// Cleaned up after the server is killed
+	t.Cleanup(func() {
+		server.TLSCertFile, server.TLSKeyFile = "", ""
+		server.MonitoredCertificates = nil
+		server.CertificateCheckInterval = time.Minute
+	})
+	address := startTLSServer(t)
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", address, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].URIs[0].String()
+	}
+	if id := served(); id != "spiffe://example.org/first" {
+		t.Fatalf("expected the configured certificate to be served, got %s", id)
+	}
+
+	// Make sure the modification time moves forward on file systems with coarse timestamps
+	writeKeyPair(t, server.TLSCertFile, server.TLSKeyFile, second, secondKey)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(server.TLSCertFile, later, later)
+	os.Chtimes(server.TLSKeyFile, later, later)
+	deadline := time.Now().Add(time.Second)
+	for served() != "spiffe://example.org/second" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if id := served(); id != "spiffe://example.org/second" {
+		t.Errorf("expected the replaced certificate to be served, got %s", id)
+	}
+
+	for _, file := range []string{server.TLSCertFile, monitoredFile} {
+		if !strings.Contains(exposition(), `arbor_certificate_expiry_seconds{certificate="`+file+`"}`) {
+			t.Errorf("expected the expiry of %s to be reported", file)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestMiddlewareChainWithRouteOverrides(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/items", httpmock.NewStringResponder(200, "[]"))
+
+	// The chain is global, so the middleware only acts on the requests of this test
+	step := func(name string) arbor.Middleware {
+		return arbor.Middleware{Name: name, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Test-Chain") == "" {
+				return
+			}
+			w.Header().Add("X-Steps", name)
+			if r.Header.Get("X-Test-Chain") == "reject-"+name {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		})}
+	}
+	arbor.Use(step("test-first"), step("test-second"))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/items")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Chain", Method: "GET", Pattern: "/chain", Handler: handler},
+		{Name: "Overridden", Method: "GET", Pattern: "/overridden", Handler: handler, Middlewares: &services.MiddlewareOverrides{
+			Skip: []string{"test-first"},
+			Use:  []services.Middleware{step("test-route")},
+		}},
+	})
+	get := func(path string, chain string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, http.NoBody)
+		req.Header.Set("X-Test-Chain", chain)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	steps := get("/chain", "on").Header()["X-Steps"]
+	if len(steps) != 2 || steps[0] != "test-first" || steps[1] != "test-second" {
+		t.Errorf("chain ran out of order: %v", steps)
+	}
+	steps = get("/overridden", "on").Header()["X-Steps"]
+	if len(steps) != 2 || steps[0] != "test-second" || steps[1] != "test-route" {
+		t.Errorf("route overrides were not applied: %v", steps)
+	}
+	recorder := get("/chain", "reject-test-first")
+	if recorder.Code != http.StatusForbidden || len(recorder.Header()["X-Steps"]) != 1 {
+		t.Errorf("response from a middleware did not stop the chain: %d %v", recorder.Code, recorder.Header()["X-Steps"])
+	}
+}
+
+func TestRoutePipelineOrdersStages(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/items", httpmock.NewStringResponder(200, "[]"))
+
+	stage := func(name string) arbor.Middleware {
+		return arbor.Middleware{Name: name, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Test-Pipeline") == "" {
+				return
+			}
+			w.Header().Add("X-Stages", name)
+		})}
+	}
+	arbor.DefineStages(stage("test-validate"), stage("test-transform"), stage("test-respond"))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/items")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Pipeline", Method: "GET", Pattern: "/pipeline", Handler: handler,
+			Pipeline: []string{"test-route", "test-validate", arbor.CacheStage, "test-transform", arbor.ProxyStage, "test-respond"},
+			Middlewares: &services.MiddlewareOverrides{Use: []services.Middleware{stage("test-route")}}},
+		{Name: "Broken", Method: "GET", Pattern: "/broken", Handler: handler, Pipeline: []string{"test-missing", arbor.ProxyStage}},
+	})
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/pipeline", http.NoBody)
+	req.Header.Set("X-Test-Pipeline", "on")
+	router.ServeHTTP(recorder, req)
+	steps := recorder.Header()["X-Stages"]
+	if recorder.Code != http.StatusOK || len(steps) != 4 || steps[0] != "test-route" || steps[1] != "test-validate" ||
+		steps[2] != "test-transform" || steps[3] != "test-respond" {
+		t.Errorf("pipeline ran out of order: %d %v", recorder.Code, steps)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/broken", http.NoBody))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected an unknown stage to fail the request, got %d", recorder.Code)
+	}
+}
+
+func TestRoutePipelineKeepsTheGuardingMiddlewares(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/items", httpmock.NewStringResponder(200, "[]"))
+
+	arbor.Use(arbor.Middleware{Name: "test-guard", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test-Guard") == "" {
+			return
+		}
+		w.Header().Add("X-Guarded", "true")
+		if r.Header.Get("X-Test-Guard") == "reject" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	})})
+	arbor.DefineStages(arbor.Middleware{Name: "test-noop", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/items")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Unnamed", Method: "GET", Pattern: "/unnamed", Handler: handler, Pipeline: []string{"test-noop", arbor.ProxyStage}},
+		{Name: "Named", Method: "GET", Pattern: "/named", Handler: handler, Pipeline: []string{"test-guard", arbor.CacheStage, arbor.ProxyStage}},
+		{Name: "Skipped", Method: "GET", Pattern: "/skipped", Handler: handler, Pipeline: []string{arbor.ProxyStage},
+			Middlewares: &services.MiddlewareOverrides{Skip: []string{"test-guard"}}},
+	})
+	get := func(path string, guard string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, http.NoBody)
+		req.Header.Set("X-Test-Guard", guard)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for path, expected := range map[string]int{"/unnamed": http.StatusForbidden, "/named": http.StatusForbidden, "/skipped": http.StatusOK} {
+		if code := get(path, "reject").Code; code != expected {
+			t.Errorf("expected %d for %s, got %d", expected, path, code)
+		}
+	}
+	if guarded := get("/named", "on").Header()["X-Guarded"]; len(guarded) != 1 {
+		t.Errorf("expected a middleware the pipeline names to run once, it ran %d times", len(guarded))
+	}
+	if calls := httpmock.GetTotalCallCount(); calls != 2 {
+		t.Errorf("expected only the allowed requests to be proxied, %d were", calls)
+	}
+}
+
+func TestPipelinesMayNotGuardAfterTheCache(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	for pipeline, valid := range map[string]bool{
+		"roles cache proxy":      true,
+		"cache schema proxy":     true,
+		"cache roles proxy":      false,
+		"scopes cache ratelimit": false,
+		"cache proxy csrf":       false,
+		"proxy preprocessing":    false,
+	} {
+		err := server.ValidateRoutes(services.RouteCollection{{
+			Name: "Guarded", Method: "GET", Pattern: "/guarded", Handler: handler, Pipeline: strings.Fields(pipeline),
+		}})
+		if valid && err != nil {
+			t.Errorf("expected pipeline %q to be valid, got %v", pipeline, err)
+		}
+		if !valid && (err == nil || !strings.Contains(err.Error(), "after the cache")) {
+			t.Errorf("expected pipeline %q to be refused for guarding after the cache, got %v", pipeline, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package arbor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestClientCertificatesMapToRoles(t *testing.T) {
+	security.CertificateRoles = map[string][]string{"spiffe://example.org/partner": {"orders"}}
+	defer func() { security.CertificateRoles = map[string][]string{} }()
+
+	ca, caKey := issueSVID(t, "", nil, nil)
+	partner, _ := issueSVID(t, "spiffe://example.org/partner", ca, caKey)
+	stranger, _ := issueSVID(t, "spiffe://example.org/stranger", ca, caKey)
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Orders",
+		Method:  "GET",
+		Pattern: "/orders",
+		Roles:   []string{"orders"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			middleware.ClientCertificateMiddleware.ServeHTTP(w, r)
+			middleware.RolesMiddleware.ServeHTTP(w, r)
+		},
+	}})
+	get := func(cert *x509.Certificate) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/orders", http.NoBody)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca}}}
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := get(partner); code != http.StatusOK {
+		t.Errorf("expected the partner's certificate to grant its roles, got %d", code)
+	}
+	if code := get(stranger); code != http.StatusForbidden {
+		t.Errorf("expected a certificate without roles to be forbidden, got %d", code)
+	}
+	if code := get(nil); code != http.StatusUnauthorized {
+		t.Errorf("expected a caller without a certificate to authenticate, got %d", code)
+	}
+	if claims := security.CertificateClaims(partner); claims.Subject() != "test" {
+		t.Errorf("expected the common name to be the subject, got %q", claims.Subject())
+	}
+}
@@ -0,0 +1,125 @@
+package arbor
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/security"
+)
+
+func TestBackendClientCredentials(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	fake := clock.NewFake(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Use(fake)()
+
+	issued := 0
+	httpmock.RegisterResponder("POST", "http://auth.local/token", func(req *http.Request) (*http.Response, error) {
+		id, secret, _ := req.BasicAuth()
+		req.ParseForm()
+		if id != "arbor" || secret != "s3cret" || req.PostForm.Get("grant_type") != "client_credentials" || req.PostForm.Get("scope") != "products:read" {
+			return httpmock.NewStringResponse(401, ""), nil
+		}
+		issued++
+		return httpmock.NewStringResponse(200, fmt.Sprintf(`{"access_token":"token-%d","token_type":"Bearer","expires_in":300}`, issued)), nil
+	})
+	var authorization string
+	httpmock.RegisterResponder("GET", "http://test.local/products", func(req *http.Request) (*http.Response, error) {
+		authorization = req.Header.Get("Authorization")
+		return httpmock.NewStringResponse(200, "[]"), nil
+	})
+
+	proxy.BackendTokens["test.local"] = &security.ClientCredentials{
+		TokenURL:     "http://auth.local/token",
+		ClientID:     "arbor",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"products:read"},
+	}
+	defer delete(proxy.BackendTokens, "test.local")
+
+	get := func() int {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/products", http.NoBody)
+		req.Header.Set("Authorization", "Bearer caller")
+		arbor.Proxy(recorder, req, "http://test.local/products")
+		return recorder.Code
+	}
+
+	if code := get(); code != http.StatusOK || authorization != "Bearer token-1" {
+		t.Fatalf("backend did not receive the acquired token: %d %q", code, authorization)
+	}
+	fake.Advance(time.Minute)
+	if get(); authorization != "Bearer token-1" || issued != 1 {
+		t.Errorf("token was not reused while valid: %q, %d issued", authorization, issued)
+	}
+	// A third of the token's lifetime before it expires, it is replaced
+	fake.Advance(3 * time.Minute)
+	if get(); authorization != "Bearer token-2" {
+		t.Errorf("token was not refreshed before expiry: %q", authorization)
+	}
+}
+
+func TestBackendCloudIdentityTokens(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	defer clock.Use(fake)()
+
+	fetched := 0
+	httpmock.RegisterResponder("GET", "http://metadata.local/computeMetadata/v1/instance/service-accounts/default/identity", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Metadata-Flavor") != "Google" || req.URL.Query().Get("audience") != "https://run.local" {
+			return httpmock.NewStringResponse(403, ""), nil
+		}
+		fetched++
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud":"https://run.local","exp":%d}`, fake.Now().Add(time.Hour).Unix())))
+		return httpmock.NewStringResponse(200, fmt.Sprintf("header.%s.signature-%d", payload, fetched)), nil
+	})
+	httpmock.RegisterResponder("GET", "http://imds.local/metadata/identity/oauth2/token", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Metadata") != "true" || req.URL.Query().Get("resource") != "api://products" {
+			return httpmock.NewStringResponse(400, ""), nil
+		}
+		return httpmock.NewStringResponse(200, fmt.Sprintf(`{"access_token":"azure-token","expires_on":"%d"}`, fake.Now().Add(time.Hour).Unix())), nil
+	})
+	authorization := map[string]string{}
+	for _, host := range []string{"run.local", "products.local"} {
+		host := host
+		httpmock.RegisterResponder("GET", "http://"+host+"/", func(req *http.Request) (*http.Response, error) {
+			authorization[host] = req.Header.Get("Authorization")
+			return httpmock.NewStringResponse(200, ""), nil
+		})
+	}
+
+	proxy.BackendTokens["run.local"] = &security.GoogleIDToken{Audience: "https://run.local", Endpoint: "http://metadata.local"}
+	proxy.BackendTokens["products.local"] = &security.AzureManagedIdentity{Resource: "api://products", Endpoint: "http://imds.local"}
+	defer delete(proxy.BackendTokens, "run.local")
+	defer delete(proxy.BackendTokens, "products.local")
+
+	get := func(url string) {
+		req, _ := http.NewRequest("GET", "http://gateway.local/", http.NoBody)
+		arbor.Proxy(httptest.NewRecorder(), req, url)
+	}
+	get("http://run.local/")
+	get("http://products.local/")
+	if !strings.HasSuffix(authorization["run.local"], ".signature-1") || authorization["products.local"] != "Bearer azure-token" {
+		t.Fatalf("backends did not receive their identity tokens: %v", authorization)
+	}
+	fake.Advance(30 * time.Minute)
+	if get("http://run.local/"); fetched != 1 {
+		t.Errorf("ID token was fetched again while valid")
+	}
+	fake.Advance(15 * time.Minute)
+	if get("http://run.local/"); !strings.HasSuffix(authorization["run.local"], ".signature-2") {
+		t.Errorf("ID token was not refreshed before expiry: %q", authorization["run.local"])
+	}
+}
@@ -0,0 +1,61 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestComposeMergesBackendResponses(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://users.local/users/7", httpmock.NewStringResponder(200, `{"name":"Ada"}`))
+	httpmock.RegisterResponder("GET", "http://orders.local/users/7/orders", httpmock.NewStringResponder(200, `[{"id":1}]`))
+	httpmock.RegisterResponder("GET", "http://recommendations.local/users/7", httpmock.NewStringResponder(503, ""))
+
+	composition := arbor.Composition{Calls: []arbor.CompositionCall{
+		{Field: "user", URL: "http://users.local/users/{id}", Required: true},
+		{Field: "orders", URL: "http://orders.local/users/{id}/orders"},
+		{Field: "recommendations", URL: "http://recommendations.local/users/{id}"},
+	}}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Overview",
+		Method:  "GET",
+		Pattern: "/users/{id}/overview",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Compose(w, r, composition, "")
+		},
+	}})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/7/overview", http.NoBody))
+	var document struct {
+		User            map[string]string `json:"user"`
+		Orders          []map[string]int  `json:"orders"`
+		Recommendations struct {
+			Error struct {
+				Status int `json:"status"`
+			} `json:"error"`
+		} `json:"recommendations"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&document); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected a composed document, got %d: %v", recorder.Code, err)
+	}
+	if document.User["name"] != "Ada" || len(document.Orders) != 1 || document.Recommendations.Error.Status != 503 {
+		t.Errorf("unexpected document %+v", document)
+	}
+
+	httpmock.RegisterResponder("GET", "http://users.local/users/7", httpmock.NewStringResponder(500, ""))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/7/overview", http.NoBody))
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("failed required call did not fail the request: %d", recorder.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package arbor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+)
+
+func TestProxyCompressesResponses(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	body := strings.Repeat("compressible ", 200)
+	httpmock.RegisterResponder("GET", "http://test.local/text",
+		func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, body)
+			resp.Header.Set("Content-Type", "text/plain; charset=utf-8")
+			return resp, nil
+		},
+	)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://test.local/text", http.NoBody)
+	req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	arbor.GET(recorder, "http://test.local/text", "RAW", "", req)
+
+	resp := recorder.Result()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := ioutil.ReadAll(reader)
+	if string(decoded) != body {
+		t.Error("decompressed body does not match")
+	}
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://test.local/text", http.NoBody)
+	arbor.GET(recorder, "http://test.local/text", "RAW", "", req)
+	if recorder.Result().Header.Get("Content-Encoding") != "" || recorder.Body.String() != body {
+		t.Error("response was compressed for a caller which does not accept it")
+	}
+}
+
+func TestProxyDecompressesRequests(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	body := `{"id":0,"name":"Test Product","price":9.99}`
+	httpmock.RegisterResponder("POST", "http://test.local/product",
+		func(req *http.Request) (*http.Response, error) {
+			received, _ := ioutil.ReadAll(req.Body)
+			if string(received) != body || req.Header.Get("Content-Encoding") != "" {
+				t.Errorf("backend received %q encoded as %q", received, req.Header.Get("Content-Encoding"))
+			}
+			return httpmock.NewStringResponse(201, ""), nil
+		},
+	)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(body))
+	writer.Close()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://test.local/product", &compressed)
+	req.Header.Set("Content-Encoding", "gzip")
+	arbor.POST(recorder, "http://test.local/product", "JSON", "", req)
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "http://test.local/product", strings.NewReader("not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	arbor.POST(recorder, "http://test.local/product", "JSON", "", req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected malformed body to be rejected with 400, got %d", recorder.Code)
+	}
+}
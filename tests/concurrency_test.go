@@ -0,0 +1,82 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestBackendConcurrencyIsCapped(t *testing.T) {
+	arrived, release := make(chan struct{}, 8), make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer backend.Close()
+	host := backend.Listener.Addr().String()
+	proxy.BackendConcurrency = map[string]proxy.ConcurrencyLimit{host: {MaxInFlight: 2}}
+	defer func() { proxy.BackendConcurrency = map[string]proxy.ConcurrencyLimit{} }()
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Reports",
+		Method:  "GET",
+		Pattern: "/reports",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.GET(w, backend.URL+"/reports", "JSON", "", r)
+		},
+	}})
+	codes := make(chan int, 8)
+	get := func() {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/reports", nil))
+		codes <- recorder.Code
+	}
+
+	go get()
+	go get()
+	<-arrived
+	<-arrived
+	if load := proxy.BackendLoads()[host]; load.InFlight != 2 || load.MaxInFlight != 2 {
+		t.Errorf("expected the backend to be at its cap, got %+v", load)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/reports", nil))
+	if recorder.Code != http.StatusServiceUnavailable || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a request over the cap to be shed with 503 and Retry-After, got %d", recorder.Code)
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expected the requests within the cap to be served, got %d", code)
+		}
+	}
+
+	// Queued requests take the slot of a request which finishes
+	proxy.BackendConcurrency = map[string]proxy.ConcurrencyLimit{host: {MaxInFlight: 2, QueueTimeout: time.Minute}}
+	go get()
+	go get()
+	<-arrived
+	<-arrived
+	go get()
+	deadline := time.Now().Add(time.Second)
+	for proxy.BackendLoads()[host].Queued != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	release <- struct{}{}
+	<-arrived
+	close(release)
+	for i := 0; i < 3; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expected the requests within the cap and the queued one to be served, got %d", code)
+		}
+	}
+}
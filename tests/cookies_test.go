@@ -0,0 +1,50 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestCookieRewriting(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://test.local/login", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(200, "")
+		resp.Header.Add("Set-Cookie", "session=abc123; Domain=products.internal; Path=/; HttpOnly; Max-Age=3600")
+		resp.Header.Add("Set-Cookie", "cart=1; Path=/cart")
+		resp.Header.Add("Set-Cookie", "tracking=x; Domain=analytics.example.org")
+		return resp, nil
+	})
+
+	proxy.BackendCookieRewrites["test.local"] = proxy.CookieRewrite{
+		Domains:  map[string]string{"products.internal": ""},
+		Paths:    map[string]string{"/": "/products/"},
+		SameSite: http.SameSiteNoneMode,
+	}
+	defer delete(proxy.BackendCookieRewrites, "test.local")
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "http://gateway.local/products/login", http.NoBody)
+	arbor.Proxy(recorder, req, "http://test.local/login")
+
+	cookies := recorder.Header().Values("Set-Cookie")
+	expected := []string{
+		"session=abc123; Path=/products/; Max-Age=3600; HttpOnly; Secure; SameSite=None",
+		"cart=1; Path=/products/cart; Secure; SameSite=None",
+		"tracking=x; Path=/products/; Domain=analytics.example.org; Secure; SameSite=None",
+	}
+	if len(cookies) != len(expected) {
+		t.Fatalf("cookies were dropped: %q", cookies)
+	}
+	for i := range expected {
+		if cookies[i] != expected[i] {
+			t.Errorf("cookie was not rewritten as expected:\n%s\n%s", cookies[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestRoutesExposeHeadersToBrowsers(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/items", httpmock.NewStringResponder(200, "[]"))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/items")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Items", Method: "GET", Pattern: "/items", Handler: handler, ExposeHeaders: []string{"Link", "RateLimit-Remaining"}},
+		{Name: "Other", Method: "GET", Pattern: "/other", Handler: handler},
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/items", http.NoBody))
+	if exposed := recorder.Header().Get("Access-Control-Expose-Headers"); exposed != "Link, RateLimit-Remaining" {
+		t.Errorf("unexpected exposed headers %q", exposed)
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/other", http.NoBody))
+	if exposed := recorder.Header().Get("Access-Control-Expose-Headers"); exposed != "" {
+		t.Errorf("route without exposed headers exposed %q", exposed)
+	}
+}
@@ -0,0 +1,51 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestCSRFDoubleSubmitCookie(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		middleware.CSRFMiddleware.ServeHTTP(w, r)
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Page", Method: "GET", Pattern: "/cart", BrowserFacing: true, Handler: handler},
+		{Name: "Checkout", Method: "POST", Pattern: "/cart", BrowserFacing: true, Handler: handler},
+		{Name: "Webhook", Method: "POST", Pattern: "/webhook", Handler: handler},
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/cart", http.NoBody))
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || cookies[0].Value == "" || cookies[0].HttpOnly {
+		t.Fatalf("expected a CSRF cookie scripts can read, got %v", cookies)
+	}
+
+	post := func(path string, token string) int {
+		req := httptest.NewRequest("POST", path, http.NoBody)
+		req.AddCookie(cookies[0])
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	if code := post("/cart", cookies[0].Value); code != http.StatusOK {
+		t.Errorf("expected the token of the cookie to be accepted, got %d", code)
+	}
+	for _, token := range []string{"", "forged"} {
+		if code := post("/cart", token); code != http.StatusForbidden {
+			t.Errorf("expected token %q to be rejected, got %d", token, code)
+		}
+	}
+	if code := post("/webhook", ""); code != http.StatusOK {
+		t.Errorf("expected routes which are not browser-facing to be left alone, got %d", code)
+	}
+}
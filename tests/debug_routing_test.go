@@ -0,0 +1,58 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestDebugRouteTokens(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://users.local/users", httpmock.NewStringResponder(200, "shared"))
+	httpmock.RegisterResponder("GET", "http://alice-tunnel.local:9000/users", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(proxy.DebugRouteHeader) != "" {
+			t.Error("debug route token was forwarded")
+		}
+		return httpmock.NewStringResponse(200, "alice"), nil
+	})
+
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	proxy.DebugRouteKey = []byte("debug-secret")
+	defer func() { proxy.DebugRouteKey = nil }()
+	token, err := proxy.IssueDebugRoute("alice", "users.local", "http://alice-tunnel.local:9000", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(token string) string {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/users", http.NoBody)
+		if token != "" {
+			req.Header.Set(proxy.DebugRouteHeader, token)
+		}
+		arbor.GET(recorder, "http://users.local/users", "RAW", "", req)
+		return recorder.Body.String()
+	}
+
+	if body := get(""); body != "shared" {
+		t.Errorf("request without a token reached %q", body)
+	}
+	if body := get(token); body != "alice" {
+		t.Errorf("request with a token reached %q", body)
+	}
+	if body := get(token[:len(token)-2] + "xx"); body != "shared" {
+		t.Errorf("request with a forged token reached %q", body)
+	}
+	fake.Advance(2 * time.Hour)
+	if body := get(token); body != "shared" {
+		t.Errorf("request with an expired token reached %q", body)
+	}
+}
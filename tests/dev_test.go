@@ -0,0 +1,133 @@
+package arbor
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestDevModeIssuesCertificateAndReloads(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "routes.json")
+	ioutil.WriteFile(config, []byte("v1"), 0644)
+
+	var failing int32
+	server.DevMode = true
+	server.DevDirectory = filepath.Join(dir, "dev")
+	server.DevConfigFiles = []string{config}
+	server.DevReloadInterval = 10 * time.Millisecond
+	server.DevReloadProbation = 200 * time.Millisecond
+	server.DevReloadMinRequests = 3
+	server.DevReload = func() (services.RouteCollection, error) {
+		if atomic.LoadInt32(&failing) == 1 {
+			return nil, errors.New("invalid configuration")
+		}
+		data, err := ioutil.ReadFile(config)
+		routes := services.RouteCollection{{Name: "Version", Method: "GET", Pattern: "/config", Handler: func(w http.ResponseWriter, r *http.Request) {
+			if string(data) == "broken" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			w.Write(data)
+		}}}
+		if string(data) == "duplicate" {
+			routes = append(routes, routes[0])
+		}
+		return routes, err
+	}
+	defer func() {
+		server.DevMode = false
+		server.DevDirectory = ".arbor-dev"
+		server.DevConfigFiles = nil
+		server.DevReload = nil
+		server.DevReloadProbation = 30 * time.Second
+		server.DevReloadMinRequests = 10
+		server.TLSCertFile, server.TLSKeyFile = "", ""
+		logger.DumpTraffic = false
+		logger.RedactSecrets = true
+		health.SetDraining(false)
+	}()
+
+	routes, _ := server.DevReload()
+	srv := server.NewArborServer(routes, "127.0.0.1", 0)
+	go srv.StartServer()
+	defer srv.KillServer()
+
+	roots := x509.NewCertPool()
+	caPEM, err := ioutil.ReadFile(filepath.Join(server.DevDirectory, "ca.pem"))
+	if err != nil || !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("dev mode did not create a CA: %v", err)
+	}
+	certPEM, _ := ioutil.ReadFile(server.TLSCertFile)
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("dev mode did not issue a certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots}); err != nil {
+		t.Errorf("certificate is not valid for localhost under the dev CA: %v", err)
+	}
+
+	get := func() string {
+		recorder := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/config", nil))
+		body, _ := io.ReadAll(recorder.Body)
+		return string(body)
+	}
+	waitFor := func(expected string) {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if get() == expected {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("served %q, expected %q", get(), expected)
+	}
+	waitFor("v1")
+
+	// Make sure the modification time moves forward on file systems with coarse timestamps
+	ioutil.WriteFile(config, []byte("v2"), 0644)
+	os.Chtimes(config, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	waitFor("v2")
+
+	atomic.StoreInt32(&failing, 1)
+	os.Chtimes(config, time.Now().Add(2*time.Second), time.Now().Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if get() != "v2" {
+		t.Error("failed reload replaced the routes")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	ioutil.WriteFile(config, []byte("duplicate"), 0644)
+	os.Chtimes(config, time.Now().Add(3*time.Second), time.Now().Add(3*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	if get() != "v2" {
+		t.Error("a configuration which fails validation replaced the routes")
+	}
+
+	// Once v2 has served its probation, a configuration whose requests fail is rolled back to it
+	time.Sleep(250 * time.Millisecond)
+	ioutil.WriteFile(config, []byte("broken"), 0644)
+	os.Chtimes(config, time.Now().Add(4*time.Second), time.Now().Add(4*time.Second))
+	waitFor("broken")
+	get()
+	get()
+	waitFor("v2")
+}
@@ -0,0 +1,120 @@
+package arbor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/discovery"
+)
+
+func TestConsulResolvesHealthyInstances(t *testing.T) {
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/users-api" || r.URL.Query().Get("passing") != "true" {
+			t.Errorf("unexpected query %s", r.URL)
+		}
+		index := "7"
+		entries := `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":8000,"Weights":{"Passing":1}}}]`
+		if r.URL.Query().Get("index") == "7" {
+			index = "8"
+			entries = `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"","Port":8000,"Weights":{"Passing":1}}},
+				{"Node":{"Address":"10.0.0.2"},"Service":{"Address":"10.0.1.2","Port":8000,"Weights":{"Passing":3}}}]`
+		}
+		w.Header().Set("X-Consul-Index", index)
+		w.Write([]byte(entries))
+	}))
+	defer consul.Close()
+
+	resolver := &discovery.Consul{Address: consul.URL}
+	instances, index, err := resolver.Resolve(context.Background(), "users-api", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 7 || len(instances) != 1 || instances[0].Address != "10.0.0.1:8000" {
+		t.Fatalf("unexpected instances %+v at index %d", instances, index)
+	}
+
+	instances, index, err = resolver.Resolve(context.Background(), "users-api", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != 8 || len(instances) != 2 || instances[1] != (discovery.Instance{Address: "10.0.1.2:8000", Weight: 3}) {
+		t.Errorf("unexpected instances %+v at index %d", instances, index)
+	}
+}
+
+func TestEtcdResolvesInstances(t *testing.T) {
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Key      []byte `json:"key"`
+			RangeEnd []byte `json:"range_end"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		if r.URL.Path != "/v3/kv/range" || string(request.Key) != "/services/users-api/" || string(request.RangeEnd) != "/services/users-api0" {
+			t.Errorf("unexpected range %s %q %q", r.URL.Path, request.Key, request.RangeEnd)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"header": map[string]string{"revision": "42"},
+			"kvs": []map[string][]byte{
+				{"value": []byte(`{"Addr":"10.0.0.1:8000"}`)},
+				{"value": []byte("10.0.0.2:8000")},
+			},
+		})
+	}))
+	defer etcd.Close()
+
+	instances, revision, err := (&discovery.Etcd{Endpoint: etcd.URL}).Resolve(context.Background(), "users-api", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision != 42 || len(instances) != 2 || instances[0].Address != "10.0.0.1:8000" || instances[1].Address != "10.0.0.2:8000" {
+		t.Errorf("unexpected instances %+v at revision %d", instances, revision)
+	}
+}
+
+func TestKubernetesResolvesReadyEndpoints(t *testing.T) {
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices" || r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=users" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"metadata":{"resourceVersion":"1234"},"items":[{"addressType":"IPv4",
+			"ports":[{"name":"metrics","port":9090},{"name":"http","port":8080}],
+			"endpoints":[{"addresses":["10.1.0.4"],"conditions":{"ready":true}},{"addresses":["10.1.0.5"],"conditions":{"ready":false}}]}]}`))
+	}))
+	defer apiserver.Close()
+
+	resolver := &discovery.Kubernetes{Host: apiserver.URL, Namespace: "default", HTTPClient: apiserver.Client()}
+	instances, version, err := resolver.Resolve(context.Background(), "shop/users:http", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1234 || len(instances) != 1 || instances[0].Address != "10.1.0.4:8080" {
+		t.Errorf("unexpected instances %+v at version %d", instances, version)
+	}
+}
+
+func TestDNSResolvesHostAddresses(t *testing.T) {
+	resolver := &discovery.DNS{Refresh: time.Millisecond}
+	instances, index, err := resolver.Resolve(context.Background(), "localhost:8000", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index == 0 || len(instances) == 0 {
+		t.Fatalf("unexpected instances %+v at index %d", instances, index)
+	}
+	for _, instance := range instances {
+		if instance.Address != "127.0.0.1:8000" && instance.Address != "[::1]:8000" {
+			t.Errorf("localhost resolved to %s", instance.Address)
+		}
+	}
+
+	// Unchanged addresses keep waiting until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := resolver.Resolve(ctx, "localhost:8000", index); err != context.DeadlineExceeded {
+		t.Errorf("expected to wait for a change, got %v", err)
+	}
+}
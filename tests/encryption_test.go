@@ -0,0 +1,37 @@
+package arbor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/arbor-dev/arbor/encryption"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	old, err := encryption.NewKeyring("2017-01", map[string][]byte{"2017-01": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := old.Seal([]byte("payload"), []byte("record-1"))
+
+	rotated, _ := encryption.NewKeyring("2017-02", map[string][]byte{"2017-01": oldKey, "2017-02": newKey})
+	if !rotated.NeedsReseal(sealed) {
+		t.Error("data sealed with the old key does not need resealing")
+	}
+	resealed, err := rotated.Reseal(sealed, []byte("record-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := rotated.Open(resealed, []byte("record-1")); err != nil || string(plaintext) != "payload" {
+		t.Errorf("resealed data did not open: %q %v", plaintext, err)
+	}
+	if _, err := old.Open(resealed, []byte("record-1")); err != encryption.ErrUnknownKey {
+		t.Errorf("expected unknown key, got %v", err)
+	}
+	if _, err := rotated.Open(resealed, []byte("record-2")); err != encryption.ErrMalformed {
+		t.Errorf("data opened under another record's context: %v", err)
+	}
+}
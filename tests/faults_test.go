@@ -0,0 +1,50 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestFaultInjection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/products", httpmock.NewStringResponder(200, `[]`))
+
+	proxy.FaultRules = []proxy.FaultRule{
+		{Header: "X-Fault", Value: "unavailable", Fault: proxy.Fault{Kind: proxy.FaultStatus, Status: 503, Body: "down for maintenance"}},
+		{PathMarker: "/__malformed", Fault: proxy.Fault{Kind: proxy.FaultMalformedJSON}},
+	}
+	defer func() { proxy.FaultRules = nil }()
+
+	get := func(path string, header string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local"+path, http.NoBody)
+		if header != "" {
+			req.Header.Set("X-Fault", header)
+		}
+		arbor.GET(recorder, "http://test.local/products", "RAW", "", req)
+		return recorder
+	}
+
+	if recorder := get("/products", "unavailable"); recorder.Code != http.StatusOK {
+		t.Errorf("fault was injected while injection is disabled: %d", recorder.Code)
+	}
+
+	proxy.FaultInjection = true
+	defer func() { proxy.FaultInjection = false }()
+	if recorder := get("/products", "unavailable"); recorder.Code != http.StatusServiceUnavailable || recorder.Body.String() != "down for maintenance" {
+		t.Errorf("expected injected 503, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := get("/products/__malformed", ""); recorder.Code != http.StatusOK || recorder.Body.String() == "[]" {
+		t.Errorf("expected injected malformed JSON, got %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := get("/products", "other"); recorder.Body.String() != "[]" {
+		t.Errorf("fault was injected for a request which does not match: %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,36 @@
+package arbor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arbor-dev/arbor/features"
+)
+
+func TestFeatureGates(t *testing.T) {
+	features.Register("TestExperiment", features.Spec{Stage: features.Alpha})
+	features.Register("TestGraduated", features.Spec{Default: true, Stage: features.GA, LockToDefault: true})
+
+	if features.Enabled("TestExperiment") || !features.Enabled("TestGraduated") {
+		t.Fatal("gates do not start in their default state")
+	}
+	if err := features.Parse("TestExperiment=true, TestGraduated=true"); err != nil {
+		t.Fatal(err)
+	}
+	if !features.Enabled("TestExperiment") {
+		t.Error("alpha gate was not enabled")
+	}
+
+	if err := features.Parse("TestExperiment=false,TestGraduated=false"); err == nil {
+		t.Error("locked gate was disabled")
+	}
+	if !features.Enabled("TestExperiment") {
+		t.Error("invalid list partially applied")
+	}
+	if err := features.Set("TestMissing", true); !errors.Is(err, features.ErrUnknownGate) {
+		t.Errorf("expected unknown gate error, got %v", err)
+	}
+	if features.Enabled("TestMissing") {
+		t.Error("unregistered gate is enabled")
+	}
+}
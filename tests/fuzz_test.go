@@ -0,0 +1,134 @@
+package arbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+)
+
+// quietLogs silences per request logging for the rest of the fuzz target
+func quietLogs(f *testing.F) {
+	logLevel := logger.LogLevel
+	logger.LogLevel = logger.ERR
+	f.Cleanup(func() {
+		logger.LogLevel = logLevel
+	})
+}
+
+func FuzzRouterPathNormalization(f *testing.F) {
+	quietLogs(f)
+	var reached string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		reached = r.URL.Path
+	}
+	router := server.NewRouter(arbor.RouteCollection{
+		arbor.Route{Name: "Products", Method: "GET", Pattern: "/products", Handler: handler},
+		arbor.Route{Name: "Product", Method: "GET", Pattern: "/products/{id:[0-9]+}", Handler: handler},
+	}.ToServiceRoutes())
+
+	for _, seed := range []string{"/products", "/products/1", "/products/../admin", "//products", "/products/1/..", "/%2e%2e/products"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, path string) {
+		reached = ""
+		r := &http.Request{Method: "GET", URL: &neturl.URL{Path: path}, Header: http.Header{}, RequestURI: path}
+		router.ServeHTTP(httptest.NewRecorder(), r.WithContext(r.Context()))
+		for _, segment := range strings.Split(reached, "/") {
+			if segment == ".." || segment == "." {
+				t.Errorf("Handler reached with unnormalized path %q from %q", reached, path)
+			}
+		}
+	})
+}
+
+func FuzzRequestIDHeader(f *testing.F) {
+	for _, seed := range []string{"", "abc-123", "with space", "new\nline", strings.Repeat("x", 200)} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header[http.CanonicalHeaderKey("X-Request-ID")] = []string{header}
+		_, id := requestid.Ensure(r)
+		if !requestid.IsValid(id) {
+			t.Errorf("Assigned invalid request ID %q for header %q", id, header)
+		}
+	})
+}
+
+func FuzzAuthorizationHeader(f *testing.F) {
+	quietLogs(f)
+	jwt := middleware.JWTMiddlewareFactory(&security.JWTVerifier{Secret: []byte("secret")})
+	for _, seed := range []string{"", "Bearer ", "Bearer a.b.c", "bearer eyJhbGciOiJIUzI1NiJ9.e30.", "Basic dXNlcjpwYXNz"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, authorization string) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		jwt.ServeHTTP(w, r)
+		_, authenticated := security.ClaimsFromContext(r.Context())
+		if authenticated == (w.Result().StatusCode == http.StatusUnauthorized) {
+			t.Errorf("Header %q was both authenticated and rejected, or neither", authorization)
+		}
+	})
+}
+
+func FuzzJSONBodyValidation(f *testing.F) {
+	for _, seed := range []string{"", "{}", `{"id": 1}`, "[1, 2", "1e999", `"\ud800"`, "nul"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		for _, m := range middleware.JSONRequestMiddlewares {
+			m.ServeHTTP(w, r)
+		}
+		rejected := w.Result().StatusCode != http.StatusOK
+		if rejected != (len(body) > 0 && !json.Valid(body)) {
+			t.Errorf("Body %q rejected: %v", body, rejected)
+		}
+		forwarded, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Equal(forwarded, body) {
+			t.Errorf("Body %q was altered to %q", body, forwarded)
+		}
+	})
+}
+
+func FuzzAPIKeyFile(f *testing.F) {
+	for _, seed := range []string{"[]", `[{"hash": "abc", "client": "test", "routes": ["GetProducts"]}]`, `[{"client": "nohash"}]`, `{}`, `[{"hash": "abc", "expires": "not a time"}]`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		keys, err := security.ParseAPIKeys(data)
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			if key.Hash == "" {
+				t.Errorf("Loaded key without a hash from %q", data)
+			}
+		}
+	})
+}
+
+func FuzzJWKS(f *testing.F) {
+	quietLogs(f)
+	for _, seed := range []string{`{"keys": []}`, `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AA", "y": "AA"}]}`, `{"keys": [{"kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`, `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		security.ParseJWKS(data)
+	})
+}
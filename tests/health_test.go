@@ -0,0 +1,162 @@
+package arbor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/health"
+)
+
+func TestReadinessAggregatesChecks(t *testing.T) {
+	health.Register("cache", false, func(ctx context.Context) error { return errors.New("unreachable") })
+	health.Register("products", true, func(ctx context.Context) error { return nil })
+	defer health.Unregister("cache")
+	defer health.Unregister("products")
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	health.ReadinessHandler(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("failing non-critical check made arbor not ready: %d", recorder.Code)
+	}
+
+	health.Register("products", true, func(ctx context.Context) error { return errors.New("connection refused") })
+	recorder = httptest.NewRecorder()
+	health.ReadinessHandler(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("failing critical check left arbor ready: %d", recorder.Code)
+	}
+
+	// httptest requests come from a non-loopback address, so details are hidden by default
+	recorder = httptest.NewRecorder()
+	health.DetailsHandler(recorder, req)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("details were exposed to a remote caller: %d", recorder.Code)
+	}
+	req.RemoteAddr = "127.0.0.1:1234"
+	recorder = httptest.NewRecorder()
+	health.DetailsHandler(recorder, req)
+	var details struct {
+		Checks []health.Result `json:"checks"`
+	}
+	json.NewDecoder(recorder.Body).Decode(&details)
+	if len(details.Checks) != 2 {
+		t.Errorf("expected 2 checks in details, got %+v", details.Checks)
+	}
+}
+
+func TestReadinessProbesBackends(t *testing.T) {
+	var failing int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer backend.Close()
+
+	health.Backends = []health.Backend{{Name: "users", HealthURL: backend.URL + "/health", Critical: true}}
+	health.ProbeInterval = 10 * time.Millisecond
+	defer func() {
+		health.Backends = nil
+		health.ProbeInterval = 10 * time.Second
+		health.Unregister("backend:users")
+	}()
+	stop := health.StartProbing()
+	defer stop()
+
+	waitForStatus := func(status string) {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			statuses := health.BackendStatuses()
+			if len(statuses) == 1 && statuses[0].Status == status {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("backend never became %s: %+v", status, health.BackendStatuses())
+	}
+
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	waitForStatus(health.Up)
+	recorder := httptest.NewRecorder()
+	health.ReadinessHandler(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("healthy backend left arbor not ready: %d", recorder.Code)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	waitForStatus(health.Down)
+	recorder = httptest.NewRecorder()
+	health.ReadinessHandler(recorder, req)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("failing critical backend left arbor ready: %d", recorder.Code)
+	}
+	if health.Healthy(strings.TrimPrefix(backend.URL, "http://")) {
+		t.Error("failing backend is still routed to")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	waitForStatus(health.Up)
+	if !health.Healthy(strings.TrimPrefix(backend.URL, "http://")) {
+		t.Error("recovered backend is not routed to")
+	}
+}
+
+func TestGRPCHealthProbe(t *testing.T) {
+	var serving int32 = 1
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" || r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		request, _ := ioutil.ReadAll(r.Body)
+		if string(request[5:]) != "\x0a\x06orders" {
+			w.Header().Set("Grpc-Status", "5")
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, byte(atomic.LoadInt32(&serving))})
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	backend.Config.Protocols = new(http.Protocols)
+	backend.Config.Protocols.SetUnencryptedHTTP2(true)
+	backend.Start()
+	defer backend.Close()
+
+	health.Backends = []health.Backend{{Name: "orders", HealthURL: backend.URL, GRPC: true, GRPCService: "orders"}}
+	health.ProbeInterval = 10 * time.Millisecond
+	defer func() {
+		health.Backends = nil
+		health.ProbeInterval = 10 * time.Second
+		health.Unregister("backend:orders")
+	}()
+	stop := health.StartProbing()
+	defer stop()
+
+	waitForStatus := func(status string) {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			statuses := health.BackendStatuses()
+			if len(statuses) == 1 && statuses[0].Status == status {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("backend never became %s: %+v", status, health.BackendStatuses())
+	}
+	waitForStatus(health.Up)
+	atomic.StoreInt32(&serving, 2)
+	waitForStatus(health.Down)
+	if statuses := health.BackendStatuses(); statuses[0].Error != "backend is NOT_SERVING" {
+		t.Errorf("unexpected probe error %q", statuses[0].Error)
+	}
+}
@@ -0,0 +1,126 @@
+package arbor
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func signRequest(req *http.Request, algorithm string, newHash func() hash.Hash, keyID string, secret []byte, timestamp time.Time, body string) {
+	seconds := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(seconds + "." + req.Method + "." + req.URL.RequestURI() + "." + body))
+	req.Header.Set("X-Signature", algorithm+"="+hex.EncodeToString(mac.Sum(nil)))
+	req.Header.Set("X-Signature-Timestamp", seconds)
+	req.Header.Set("X-Signature-Key", keyID)
+}
+
+func TestHMACSignedRequests(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	verifier := &security.HMACVerifier{Keys: map[string][]byte{"partner": []byte("shared secret")}, IncludeRequestLine: true}
+	body := `{"amount":10}`
+
+	verify := func(sign func(req *http.Request)) error {
+		req := httptest.NewRequest("POST", "/payments?currency=usd", strings.NewReader(body))
+		sign(req)
+		_, err := verifier.Verify(req, []byte(body))
+		return err
+	}
+	for name, c := range map[string]struct {
+		sign     func(req *http.Request)
+		expected error
+	}{
+		"valid": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now(), body)
+		}, nil},
+		"unsigned": {func(req *http.Request) {}, security.ErrMissingSignature},
+		"wrong secret": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "partner", []byte("guessed"), fake.Now(), body)
+		}, security.ErrInvalidSignature},
+		"tampered body": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now(), `{"amount":1000}`)
+		}, security.ErrInvalidSignature},
+		"other request line": {func(req *http.Request) {
+			req.URL.RawQuery = "currency=eur"
+			signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now(), body)
+			req.URL.RawQuery = "currency=usd"
+		}, security.ErrInvalidSignature},
+		"stale": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now().Add(-time.Hour), body)
+		}, security.ErrSignatureSkew},
+		"bad timestamp": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now(), body)
+			req.Header.Set("X-Signature-Timestamp", "yesterday")
+		}, security.ErrInvalidTimestamp},
+		"disallowed algorithm": {func(req *http.Request) {
+			signRequest(req, "sha1", sha1.New, "partner", []byte("shared secret"), fake.Now(), body)
+		}, security.ErrUnsupportedDigest},
+		"unknown key": {func(req *http.Request) {
+			signRequest(req, "sha256", sha256.New, "stranger", []byte("shared secret"), fake.Now(), body)
+		}, security.ErrUnknownKey},
+	} {
+		if err := verify(c.sign); err != c.expected {
+			t.Errorf("%s: expected %v, got %v", name, c.expected, err)
+		}
+	}
+}
+
+func TestHMACMiddlewareRejectsBadSignatures(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	var subject string
+	httpmock.RegisterResponder("POST", "http://test.local/payments", httpmock.NewStringResponder(201, `{}`))
+
+	verifier := &security.HMACVerifier{Keys: map[string][]byte{"partner": []byte("shared secret")}, IncludeRequestLine: true}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Payments",
+		Method:  "POST",
+		Pattern: "/payments",
+		Middlewares: &services.MiddlewareOverrides{Use: []services.Middleware{
+			{Name: "test-signature", Handler: middleware.HMACMiddlewareFactory(verifier)},
+			{Name: "test-subject", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ := security.ClaimsFromContext(r.Context())
+				subject = claims.Subject()
+			})},
+		}},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.POST(w, "http://test.local/payments", "JSON", "", r)
+		},
+	}})
+	post := func(signedBody string, sentBody string) int {
+		req := httptest.NewRequest("POST", "/payments", strings.NewReader(sentBody))
+		req.Header.Set("Content-Type", "application/json")
+		signRequest(req, "sha256", sha256.New, "partner", []byte("shared secret"), fake.Now(), signedBody)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := post(`{"amount":10}`, `{"amount":10}`); code != http.StatusCreated || subject != "partner" {
+		t.Errorf("expected the signed request to be proxied as the partner, got %d as %q", code, subject)
+	}
+	if code := post(`{"amount":10}`, `{"amount":1000}`); code != http.StatusUnauthorized {
+		t.Errorf("expected a request whose body was changed to be refused, got %d", code)
+	}
+	if calls := httpmock.GetTotalCallCount(); calls != 1 {
+		t.Errorf("expected only the correctly signed request to reach the service, %d did", calls)
+	}
+}
@@ -0,0 +1,167 @@
+package arbor
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/idempotency"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestIdempotencyKeysReplayTheFirstResponse(t *testing.T) {
+	var created int32
+	arrived, release := make(chan struct{}), make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Slow") != "" {
+			close(arrived)
+			<-release
+		}
+		if r.Header.Get("X-Fail") != "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		n := atomic.AddInt32(&created, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"order":` + strconv.Itoa(int(n)) + `}`))
+	}))
+	defer backend.Close()
+	idempotency.Responses = idempotency.NewMemoryStore()
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:        "CreateOrder",
+		Method:      "POST",
+		Pattern:     "/orders",
+		Idempotency: &services.IdempotencyPolicy{Required: true},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.POST(w, backend.URL+"/orders", "JSON", "", r)
+		},
+	}})
+	post := func(key string, body string, headers ...string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		for _, header := range headers {
+			req.Header.Set(header, "1")
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first := post("a", `{"item": "book", "quantity": 1}`)
+	retry := post("a", `{"quantity": 1.0, "item": "book"}`)
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the retry to get the first response %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("expected only the replayed response to be marked as replayed")
+	}
+	if created != 1 {
+		t.Errorf("expected the service to see the request once, it saw it %d times", created)
+	}
+
+	if code := post("a", `{"item": "pen", "quantity": 1}`).Code; code != http.StatusUnprocessableEntity {
+		t.Errorf("expected a key reused for another request to be refused, got %d", code)
+	}
+	if code := post("", `{"item": "pen"}`).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a request without a key to be refused when keys are required, got %d", code)
+	}
+
+	if code := post("b", `{}`, "X-Fail").Code; code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the service's error, got %d", code)
+	}
+	if code := post("b", `{}`).Code; code != http.StatusCreated {
+		t.Errorf("expected a request which failed to be retried, got %d", code)
+	}
+
+	done := make(chan int)
+	go func() { done <- post("c", `{}`, "X-Slow").Code }()
+	<-arrived
+	if code := post("c", `{}`).Code; code != http.StatusConflict {
+		t.Errorf("expected a retry sent while the request is in flight to be refused, got %d", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("expected the request in flight to be answered, got %d", code)
+	}
+}
+
+// claimedKeys records the keys responses are stored under
+type claimedKeys struct {
+	idempotency.Store
+	keys []string
+}
+
+func (s *claimedKeys) Claim(key string, pending *idempotency.Entry) (*idempotency.Entry, error) {
+	s.keys = append(s.keys, key)
+	return s.Store.Claim(key, pending)
+}
+
+func TestIdempotencyKeysAreScopedToTheCaller(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	var created int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&created, 1)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"order":` + strconv.Itoa(int(n)) + `,"token":"` + r.Header.Get("Authorization") + `"}`))
+	}))
+	defer backend.Close()
+	store := &claimedKeys{Store: idempotency.NewMemoryStore()}
+	idempotency.Responses = store
+	defer func() { idempotency.Responses = idempotency.NewMemoryStore() }()
+
+	secrets := map[string][]byte{"alice": []byte("alice's secret"), "bob": []byte("bob's secret")}
+	verifier := &security.HMACVerifier{Keys: secrets, IncludeRequestLine: true}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:        "CreateOrder",
+		Method:      "POST",
+		Pattern:     "/orders",
+		Idempotency: &services.IdempotencyPolicy{},
+		Middlewares: &services.MiddlewareOverrides{Use: []services.Middleware{
+			{Name: "test-signature", Handler: middleware.HMACMiddlewareFactory(verifier)},
+		}},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, backend.URL+"/orders", arbor.WithToken("service-token"))
+		},
+	}})
+	post := func(caller string) string {
+		body := `{"item":"book"}`
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "order-1")
+		signRequest(req, "sha256", sha256.New, caller, secrets[caller], fake.Now(), body)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusCreated {
+			t.Fatalf("expected %s's order to be created, got %d %s", caller, recorder.Code, recorder.Body)
+		}
+		return recorder.Body.String()
+	}
+
+	alice := post("alice")
+	bob := post("bob")
+	if alice == bob || created != 2 {
+		t.Errorf("expected callers sharing a key on a route with a token to get their own responses, got %s and %s", alice, bob)
+	}
+	if retry := post("alice"); retry != alice || created != 2 {
+		t.Errorf("expected alice's retry to be replayed, got %s", retry)
+	}
+	for _, key := range store.keys {
+		if strings.Contains(key, "service-token") || strings.Contains(key, "alice") || strings.Contains(key, "bob") {
+			t.Errorf("expected the caller's identity to be hashed in %q", key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package arbor
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestChecksumVerificationRejectsCorruptedResponses(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	body := `{"id":1}`
+	md5sum := md5.Sum([]byte(body))
+	sha := sha256.Sum256([]byte(body))
+	respond := func(header string, value string, served string) {
+		httpmock.RegisterResponder("GET", "http://files.local/file", func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, served)
+			resp.Header.Set(header, value)
+			return resp, nil
+		})
+	}
+	get := func() int {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/file", http.NoBody)
+		arbor.Proxy(recorder, req, "http://files.local/file")
+		return recorder.Code
+	}
+
+	proxy.BackendChecksumVerification["files.local"] = true
+	defer delete(proxy.BackendChecksumVerification, "files.local")
+
+	respond("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]), body)
+	if code := get(); code != http.StatusOK {
+		t.Errorf("matching Content-MD5 was rejected: %d", code)
+	}
+	respond("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sha[:]), `{"id":2}`)
+	if code := get(); code != http.StatusBadGateway {
+		t.Errorf("body not matching its Digest was forwarded: %d", code)
+	}
+	respond("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sha[:])+":", body)
+	if code := get(); code != http.StatusOK {
+		t.Errorf("matching Content-Digest was rejected: %d", code)
+	}
+}
+
+func TestResponseDigests(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://files.local/file", httpmock.NewStringResponder(200, `{"id":1}`))
+
+	proxy.ResponseDigest = "sha-256"
+	defer func() { proxy.ResponseDigest = "" }()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://gateway.local/file", http.NoBody)
+	arbor.Proxy(recorder, req, "http://files.local/file")
+	sha := sha256.Sum256(recorder.Body.Bytes())
+	sum := base64.StdEncoding.EncodeToString(sha[:])
+	if recorder.Header().Get("Digest") != "SHA-256="+sum || recorder.Header().Get("Content-Digest") != "sha-256=:"+sum+":" {
+		t.Errorf("unexpected digests %q and %q", recorder.Header().Get("Digest"), recorder.Header().Get("Content-Digest"))
+	}
+}
@@ -0,0 +1,121 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// authorizationServer introspects the tokens "reader" and "writer", counting the introspections
+func authorizationServer(t *testing.T, introspections *int32) *httptest.Server {
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"introspection_endpoint": issuer.URL + "/introspect"})
+		case "/introspect":
+			atomic.AddInt32(introspections, 1)
+			if id, secret, _ := r.BasicAuth(); id != "arbor" || secret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			scopes := map[string]string{"reader": "orders:read", "writer": "orders:read orders:write"}
+			scope, active := scopes[r.FormValue("token")]
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": active, "sub": r.FormValue("token"), "scope": scope})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(1500000000, 0))
+	var introspections int32
+	issuer := authorizationServer(t, &introspections)
+	introspector := &security.TokenIntrospector{Issuer: issuer.URL, ClientID: "arbor", ClientSecret: "secret", CacheDuration: time.Minute}
+
+	claims, err := introspector.Introspect("writer")
+	if err != nil || !claims.HasScopes([]string{"orders:write"}) {
+		t.Fatalf("expected the active token's claims, got %v (%v)", claims, err)
+	}
+	if _, err := introspector.Introspect("forged"); err != security.ErrTokenInactive {
+		t.Errorf("expected %v, got %v", security.ErrTokenInactive, err)
+	}
+	introspector.Introspect("writer")
+	introspector.Introspect("forged")
+	if atomic.LoadInt32(&introspections) != 2 {
+		t.Errorf("expected results to be cached, the server was asked %d times", introspections)
+	}
+	fake.Advance(time.Minute + time.Second)
+	introspector.Introspect("writer")
+	if atomic.LoadInt32(&introspections) != 3 {
+		t.Errorf("expected expired results to be introspected again, the server was asked %d times", introspections)
+	}
+
+	wrongClient := &security.TokenIntrospector{Endpoint: issuer.URL + "/introspect", ClientID: "arbor", ClientSecret: "guessed"}
+	if _, err := wrongClient.Introspect("writer"); err == nil || err == security.ErrTokenInactive {
+		t.Errorf("expected the server's refusal to be an error, got %v", err)
+	}
+}
+
+func TestIntrospectedTokensNeedTheRouteScopes(t *testing.T) {
+	var introspections int32
+	issuer := authorizationServer(t, &introspections)
+	introspector := &security.TokenIntrospector{Endpoint: issuer.URL + "/introspect", ClientID: "arbor", ClientSecret: "secret"}
+	var proxied int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer backend.Close()
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:     "CreateOrder",
+		Method:   "POST",
+		Pattern:  "/orders",
+		Scopes:   []string{"orders:write"},
+		Pipeline: []string{"test-introspection", "scopes", arbor.ProxyStage},
+		Middlewares: &services.MiddlewareOverrides{Use: []services.Middleware{
+			{Name: "test-introspection", Handler: middleware.IntrospectionMiddlewareFactory(introspector)},
+		}},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.POST(w, backend.URL+"/orders", "JSON", "", r)
+		},
+	}})
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if code := post("writer").Code; code != http.StatusOK {
+		t.Errorf("expected a token with the scope to be allowed, got %d", code)
+	}
+	for token, expected := range map[string]int{"": http.StatusUnauthorized, "forged": http.StatusUnauthorized, "reader": http.StatusForbidden} {
+		recorder := post(token)
+		if recorder.Code != expected || recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("expected token %q to be refused with %d, got %d", token, expected, recorder.Code)
+		}
+	}
+	if atomic.LoadInt32(&proxied) != 1 {
+		t.Errorf("expected only the allowed request to reach the service, %d did", proxied)
+	}
+}
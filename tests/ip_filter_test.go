@@ -0,0 +1,96 @@
+package arbor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/ratelimit"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestIPFilteringThroughTrustedProxies(t *testing.T) {
+	clientip.TrustedProxies = []string{"192.0.2.0/24"}
+	defer func() {
+		clientip.TrustedProxies = nil
+		security.DeniedNetworks = nil
+	}()
+
+	served := 0
+	router := server.NewRouter(services.RouteCollection{{
+		Name:            "Internal",
+		Method:          "GET",
+		Pattern:         "/internal",
+		AllowedNetworks: []string{"10.0.0.0/8", "2001:db8::1"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			served++
+		},
+	}})
+	get := func(forwardedFor string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/internal", http.NoBody)
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	for forwardedFor, expected := range map[string]int{
+		"10.1.2.3":              http.StatusOK,
+		"2001:db8::1":           http.StatusOK,
+		"203.0.113.5":           http.StatusForbidden,
+		"10.1.2.3, 203.0.113.5": http.StatusForbidden,
+		"203.0.113.5, 10.1.2.3": http.StatusOK,
+		"":                      http.StatusForbidden,
+	} {
+		if code := get(forwardedFor); code != expected {
+			t.Errorf("expected %d for a client forwarded for %q, got %d", expected, forwardedFor, code)
+		}
+	}
+	if served != 3 {
+		t.Errorf("expected only the allowed requests to reach the handler, it served %d", served)
+	}
+
+	security.DeniedNetworks = []string{"10.1.2.0/24"}
+	if code := get("10.1.2.3"); code != http.StatusForbidden {
+		t.Errorf("expected a denied network to be refused, got %d", code)
+	}
+	security.DeniedNetworks = []string{"10.1.2.0/33"}
+	if code := get("10.9.9.9"); code != http.StatusForbidden {
+		t.Errorf("expected an invalid network list to refuse every caller, got %d", code)
+	}
+}
+
+func TestTrustedProxiesResolveTheSameClientEverywhere(t *testing.T) {
+	var accessLog bytes.Buffer
+	logger.AccessLogOutput = &accessLog
+	clientip.TrustedProxies = []string{"127.0.0.1"}
+	defer func() {
+		logger.AccessLogOutput = nil
+		clientip.TrustedProxies = nil
+	}()
+
+	req := httptest.NewRequest("GET", "/", http.NoBody)
+	req.RemoteAddr = "127.0.0.1:4321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	if key := ratelimit.ByClientIP(req); key != "ip:198.51.100.7" {
+		t.Errorf("expected the forwarded client to be rate limited, got %s", key)
+	}
+	if health.Local.Allows(req) {
+		t.Error("a remote client forwarded by a local proxy was treated as local")
+	}
+
+	router := server.NewRouter(services.RouteCollection{{Name: "Root", Method: "GET", Pattern: "/", Handler: func(w http.ResponseWriter, r *http.Request) {}}})
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.HasPrefix(accessLog.String(), "198.51.100.7 ") {
+		t.Errorf("expected the access log to name the forwarded client, got %q", accessLog.String())
+	}
+}
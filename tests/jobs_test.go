@@ -0,0 +1,119 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/idempotency"
+	"github.com/arbor-dev/arbor/jobs"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestJobRoutesAreTracked(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", "http://test.local/reports",
+		func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(202, `{"task":"17"}`)
+			resp.Header.Set("Location", "/tasks/17")
+			return resp, nil
+		},
+	)
+	var polls int32
+	httpmock.RegisterResponder("GET", "http://test.local/tasks/17",
+		func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&polls, 1) < 3 {
+				return httpmock.NewStringResponse(200, `{"state":"IN_PROGRESS"}`), nil
+			}
+			return httpmock.NewStringResponse(200, `{"state":"COMPLETED","url":"/reports/17"}`), nil
+		},
+	)
+
+	route := services.Route{Name: "CreateReport", Job: &services.JobPolicy{PollInterval: 5 * time.Millisecond, StatusField: "state"}}
+	req, _ := http.NewRequest("POST", "http://gateway.local/reports", http.NoBody)
+	req.RemoteAddr = "10.0.0.5:41000"
+	req = req.WithContext(services.NewContext(req.Context(), route))
+	recorder := httptest.NewRecorder()
+	arbor.POST(recorder, "http://test.local/reports", "RAW", "", req)
+
+	var job jobs.Job
+	json.NewDecoder(recorder.Body).Decode(&job)
+	if recorder.Code != http.StatusAccepted || job.Status != jobs.Pending || recorder.Header().Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("expected a pending job, got %d %+v at %q", recorder.Code, job, recorder.Header().Get("Location"))
+	}
+
+	router := server.NewRouter(nil)
+	get := func(caller string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/jobs/"+job.ID, nil)
+		req.RemoteAddr = caller
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	if code := get("10.0.0.6:41000").Code; code != http.StatusNotFound {
+		t.Errorf("job was served to another client: %d", code)
+	}
+	deadline := time.Now().Add(time.Second)
+	for job.Status != jobs.Succeeded && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		json.NewDecoder(get(req.RemoteAddr).Body).Decode(&job)
+	}
+	if job.Status != jobs.Succeeded || string(job.Result) != `{"state":"COMPLETED","url":"/reports/17"}` {
+		t.Errorf("job did not succeed with the final status as its result: %+v", job)
+	}
+}
+
+func TestRetriedJobRequestsDoNotStartAnotherJob(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	idempotency.Responses = idempotency.NewMemoryStore()
+
+	var started int32
+	httpmock.RegisterResponder("POST", "http://test.local/exports",
+		func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&started, 1)
+			resp := httpmock.NewStringResponse(202, `{"task":"18"}`)
+			resp.Header.Set("Location", "/tasks/18")
+			return resp, nil
+		},
+	)
+	httpmock.RegisterResponder("GET", "http://test.local/tasks/18", httpmock.NewStringResponder(200, `{"state":"IN_PROGRESS"}`))
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:        "CreateExport",
+		Method:      "POST",
+		Pattern:     "/exports",
+		Job:         &services.JobPolicy{PollInterval: time.Hour, StatusField: "state"},
+		Idempotency: &services.IdempotencyPolicy{},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.POST(w, "http://test.local/exports", "RAW", "", r)
+		},
+	}})
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/exports", http.NoBody)
+		req.Header.Set("Idempotency-Key", "export-1")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first, retry := post(), post()
+	if first.Code != http.StatusAccepted || retry.Code != http.StatusAccepted {
+		t.Fatalf("expected both requests to be accepted, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Header().Get("Location") != first.Header().Get("Location") || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the retry to be answered with the first job, got %q and %q", first.Header().Get("Location"), retry.Header().Get("Location"))
+	}
+	if started != 1 {
+		t.Errorf("expected the service to start one job, it started %d", started)
+	}
+}
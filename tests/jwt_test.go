@@ -0,0 +1,177 @@
+package arbor
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/security"
+)
+
+func signJWT(alg string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestJWTVerifyHS256(t *testing.T) {
+	secret := []byte("secret")
+	hs256 := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	verifier := &security.JWTVerifier{Secret: secret, Issuer: "arbor", Audience: "groot"}
+
+	valid := signJWT("HS256", map[string]interface{}{"sub": "user", "iss": "arbor", "aud": "groot", "exp": time.Now().Add(time.Hour).Unix()}, hs256)
+	claims, err := verifier.Verify(valid)
+	if err != nil || claims.Subject() != "user" {
+		t.Errorf("Expected valid token to verify, got %v", err)
+	}
+
+	expired := signJWT("HS256", map[string]interface{}{"iss": "arbor", "aud": "groot", "exp": time.Now().Add(-time.Hour).Unix()}, hs256)
+	if _, err := verifier.Verify(expired); err != security.ErrTokenExpired {
+		t.Errorf("Expected %v, got %v", security.ErrTokenExpired, err)
+	}
+
+	wrongAudience := signJWT("HS256", map[string]interface{}{"iss": "arbor", "aud": "other"}, hs256)
+	if _, err := verifier.Verify(wrongAudience); err != security.ErrInvalidAudience {
+		t.Errorf("Expected %v, got %v", security.ErrInvalidAudience, err)
+	}
+
+	if _, err := verifier.Verify(valid[:len(valid)-2] + "AA"); err != security.ErrInvalidSignature {
+		t.Errorf("Expected %v, got %v", security.ErrInvalidSignature, err)
+	}
+
+	none := signJWT("none", map[string]interface{}{"iss": "arbor", "aud": "groot"}, func([]byte) []byte { return nil })
+	if _, err := verifier.Verify(none); err != security.ErrUnsupportedAlg {
+		t.Errorf("Expected %v, got %v", security.ErrUnsupportedAlg, err)
+	}
+}
+
+func TestJWTVerifyES256(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	es256 := func(b []byte) []byte {
+		digest := sha256.Sum256(b)
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+	verifier := &security.JWTVerifier{Keys: map[string]crypto.PublicKey{"": &key.PublicKey}}
+
+	token := signJWT("ES256", map[string]interface{}{"sub": "user"}, es256)
+	if _, err := verifier.Verify(token); err != nil {
+		t.Errorf("Expected valid token to verify, got %v", err)
+	}
+
+	// A token must not be accepted by treating the public key as an HMAC secret
+	hs := signJWT("HS256", map[string]interface{}{"sub": "user"}, func(b []byte) []byte { return b })
+	if _, err := verifier.Verify(hs); err != security.ErrUnknownKey {
+		t.Errorf("Expected %v, got %v", security.ErrUnknownKey, err)
+	}
+}
+
+func TestJWTExpiryFollowsClock(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	fake := arbortest.UseFakeClock(t, start)
+
+	secret := []byte("secret")
+	token := signJWT("HS256", map[string]interface{}{"exp": start.Add(time.Minute).Unix()}, func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	})
+	verifier := &security.JWTVerifier{Secret: secret}
+
+	if _, err := verifier.Verify(token); err != nil {
+		t.Errorf("Expected token to be valid, got %v", err)
+	}
+	fake.Advance(2 * time.Minute)
+	if _, err := verifier.Verify(token); err != security.ErrTokenExpired {
+		t.Errorf("Expected %v, got %v", security.ErrTokenExpired, err)
+	}
+}
+
+func TestJWKSIsFetchedOnceWithoutBlockingKnownKeys(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	fake := arbortest.UseFakeClock(t, start)
+
+	var fetches int32
+	fetching, release := make(chan struct{}), make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := `{"keys": [{"kty": "oct", "kid": "old", "k": "b2xk"}]}`
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			close(fetching)
+			<-release
+			keys = `{"keys": [{"kty": "oct", "kid": "old", "k": "b2xk"}, {"kty": "oct", "kid": "new", "k": "bmV3"}]}`
+		}
+		w.Write([]byte(keys))
+	}))
+	defer jwks.Close()
+	hs256 := func(kid string, secret string) string {
+		header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": kid})
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user"}`))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	verifier := &security.JWTVerifier{JWKSURL: jwks.URL}
+	if _, err := verifier.Verify(hs256("old", "old")); err != nil {
+		t.Fatalf("Expected a token signed with a published key to verify, got %v", err)
+	}
+
+	// A token signed with a key rotated in refetches the key set, once for all its verifications
+	fake.Advance(2 * time.Minute)
+	var rotated sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		rotated.Add(1)
+		go func() {
+			defer rotated.Done()
+			_, err := verifier.Verify(hs256("new", "new"))
+			errs <- err
+		}()
+	}
+	<-fetching
+
+	verified := make(chan error, 1)
+	go func() {
+		_, err := verifier.Verify(hs256("old", "old"))
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Errorf("Expected a token signed with a fetched key to verify during the refetch, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected tokens signed with fetched keys to verify without waiting for the refetch")
+	}
+
+	close(release)
+	rotated.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected tokens signed with the rotated key to verify, got %v", err)
+		}
+	}
+	if fetches := atomic.LoadInt32(&fetches); fetches != 2 {
+		t.Errorf("Expected the key set to be fetched twice, got %d", fetches)
+	}
+}
@@ -0,0 +1,92 @@
+package arbor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestLongPollBuffersBackendStreams(t *testing.T) {
+	more := make(chan struct{})
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: 1\nevent: price\ndata: {\"price\": 3}\n\n: keepalive\n\ndata: multi\ndata: line\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-more:
+			fmt.Fprint(w, "data: last\n\n")
+		case <-r.Context().Done():
+		}
+	}))
+	defer func() {
+		events.CloseClientConnections()
+		events.Close()
+	}()
+	messages := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		websocket.Message.Send(conn, `{"greeting": "hello"}`)
+	}))
+	defer messages.Close()
+
+	routes := services.RouteCollection{}
+	for name, url := range map[string]string{"events": events.URL, "messages": "ws" + strings.TrimPrefix(messages.URL, "http")} {
+		poll := arbor.LongPoll{URL: url, Wait: 100 * time.Millisecond}
+		routes = append(routes, services.Route{Name: name, Method: "GET", Pattern: "/" + name, Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.ServeLongPoll(w, r, poll, "")
+		}})
+	}
+	router := server.NewRouter(routes)
+	poll := func(target string) arbor.PollResponse {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", target, http.NoBody))
+		var response arbor.PollResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("expected %s to be polled, got %d: %v", target, recorder.Code, err)
+		}
+		return response
+	}
+
+	first := poll("/events")
+	if len(first.Events) == 0 || first.Events[0].Type != "price" || string(first.Events[0].Data) != `{"price":3}` {
+		t.Fatalf("unexpected first poll %+v", first)
+	}
+	next := "/events?subscription=" + first.Subscription + "&cursor="
+	if len(first.Events) == 1 {
+		first = poll(next + "1")
+	}
+	if string(first.Events[len(first.Events)-1].Data) != `"multi\nline"` || first.Cursor != 2 {
+		t.Fatalf("expected the multi-line event, got %+v", first)
+	}
+	if repeated := poll(next + "1"); len(repeated.Events) != 1 || repeated.Events[0].Seq != 2 {
+		t.Errorf("expected a repeated poll to return the events after its cursor, got %+v", repeated)
+	}
+	if empty := poll(next + "2"); len(empty.Events) != 0 || empty.Closed {
+		t.Errorf("expected a poll without new events to time out empty, got %+v", empty)
+	}
+	close(more)
+	last := poll(next + "2")
+	if len(last.Events) != 1 || string(last.Events[0].Data) != `"last"` {
+		t.Errorf("expected the last event, got %+v", last)
+	}
+	if closed := poll(next + "3"); !closed.Closed {
+		t.Errorf("expected the subscription to close with its stream, got %+v", closed)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", next+"3", http.NoBody))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected a closed subscription to be gone, got %d", recorder.Code)
+	}
+
+	if ws := poll("/messages"); len(ws.Events) != 1 || string(ws.Events[0].Data) != `{"greeting":"hello"}` {
+		t.Errorf("expected the WebSocket message, got %+v", ws)
+	}
+}
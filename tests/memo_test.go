@@ -0,0 +1,52 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arbor-dev/arbor/memo"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestMemoSharesLookupsWithinARequest(t *testing.T) {
+	var fetches int32
+	lookup := func(r *http.Request) interface{} {
+		account, _ := memo.Fetch(r.Context(), "account:7", func() (interface{}, error) {
+			atomic.AddInt32(&fetches, 1)
+			return "account 7", nil
+		})
+		return account
+	}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Account",
+		Method:  "GET",
+		Pattern: "/account",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			// Stages running side by side wait for the lookup in flight
+			var stages sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				stages.Add(1)
+				go func() {
+					defer stages.Done()
+					if lookup(r) != "account 7" {
+						t.Error("a stage did not get the shared lookup")
+					}
+				}()
+			}
+			stages.Wait()
+		},
+	}})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/account", http.NoBody))
+	if fetches != 1 {
+		t.Errorf("expected the stages of a request to share one fetch, fetched %d times", fetches)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/account", http.NoBody))
+	if fetches != 2 {
+		t.Errorf("expected each request to fetch for itself, fetched %d times", fetches)
+	}
+}
@@ -0,0 +1,121 @@
+package arbor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor/metrics"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func exposition() string {
+	var out bytes.Buffer
+	metrics.WriteTo(&out)
+	return out.String()
+}
+
+func TestRequestMetricsUseTheRouteLatencyClass(t *testing.T) {
+	routes := services.RouteCollection{
+		{Name: "MetricsClassed", Method: "GET", Pattern: "/classed", LatencyClass: "metrics-test", Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}},
+	}
+	metrics.LatencyClasses["metrics-test"] = []float64{2, 1}
+	defer delete(metrics.LatencyClasses, "metrics-test")
+
+	server.NewRouter(routes).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/classed", nil))
+	out := exposition()
+	if !strings.Contains(out, `arbor_requests_total{route="MetricsClassed",method="GET",code="418"} 1`) {
+		t.Errorf("expected the request to be counted, got\n%s", out)
+	}
+	if !strings.Contains(out, `arbor_request_duration_seconds_bucket{route="MetricsClassed",class="metrics-test",le="1"} 1`) {
+		t.Errorf("expected the class's sorted buckets, got\n%s", out)
+	}
+
+	// Edits to the classes take effect with the next router
+	metrics.LatencyClasses["metrics-test"] = []float64{5}
+	server.NewRouter(routes).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/classed", nil))
+	out = exposition()
+	if !strings.Contains(out, `arbor_request_duration_seconds_bucket{route="MetricsClassed",class="metrics-test",le="5"} 1`) ||
+		strings.Contains(out, `class="metrics-test",le="1"`) {
+		t.Errorf("expected the edited buckets to be used, got\n%s", out)
+	}
+}
+
+func expectPanic(t *testing.T, what string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected %s to panic", what)
+		}
+	}()
+	f()
+}
+
+func TestCustomMetricsAreLabelledWithTheRoute(t *testing.T) {
+	orders := metrics.NewRouteCounter("arbor_test_orders_total", "Orders created.", "kind")
+	sizes := metrics.NewRouteHistogram("arbor_test_order_size", "Order sizes.", []float64{10, 1})
+	routes := services.RouteCollection{
+		{Name: "MetricsOrders", Method: "POST", Pattern: "/orders", Handler: func(w http.ResponseWriter, r *http.Request) {
+			orders.IncFor(r, "retail")
+			orders.AddFor(r, 2, `say "hi"`)
+			sizes.ObserveFor(r, 5)
+		}},
+	}
+
+	server.NewRouter(routes).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", nil))
+	orders.IncFor(httptest.NewRequest("POST", "/elsewhere", nil), "retail")
+
+	if v := orders.Value("MetricsOrders", "retail"); v != 1 {
+		t.Errorf("expected 1 retail order on the route, got %v", v)
+	}
+	if c := sizes.Count("MetricsOrders"); c != 1 {
+		t.Errorf("expected 1 observation on the route, got %d", c)
+	}
+	out := exposition()
+	for _, line := range []string{
+		"# TYPE arbor_test_orders_total counter",
+		`arbor_test_orders_total{route="MetricsOrders",kind="retail"} 1`,
+		`arbor_test_orders_total{route="MetricsOrders",kind="say \"hi\""} 2`,
+		`arbor_test_orders_total{route="UNKNOWN",kind="retail"} 1`,
+		"# TYPE arbor_test_order_size histogram",
+		`arbor_test_order_size_bucket{route="MetricsOrders",le="1"} 0`,
+		`arbor_test_order_size_bucket{route="MetricsOrders",le="10"} 1`,
+		`arbor_test_order_size_bucket{route="MetricsOrders",le="+Inf"} 1`,
+		`arbor_test_order_size_sum{route="MetricsOrders"} 5`,
+		`arbor_test_order_size_count{route="MetricsOrders"} 1`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in the exposition, got\n%s", line, out)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("expected the Prometheus text content type, got %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), `arbor_test_orders_total{route="MetricsOrders",kind="retail"} 1`) {
+		t.Errorf("expected the handler to serve the custom metrics, got\n%s", w.Body.String())
+	}
+}
+
+func TestInvalidMetricsAreRefused(t *testing.T) {
+	counter := metrics.NewCounter("arbor_test_refused_total", "Refused.", "reason")
+
+	expectPanic(t, "an invalid metric name", func() { metrics.NewCounter("arbor-test", "Invalid.") })
+	expectPanic(t, "an invalid label name", func() { metrics.NewCounter("arbor_test_labels_total", "Invalid.", "bad-label") })
+	expectPanic(t, "a duplicate metric", func() { metrics.NewCounter("arbor_test_refused_total", "Duplicate.") })
+	expectPanic(t, "a duplicate route metric", func() { metrics.NewRouteHistogram("arbor_test_refused_total", "Duplicate.", metrics.DefaultBuckets) })
+	expectPanic(t, "missing label values", func() { counter.Inc() })
+	expectPanic(t, "extra label values", func() { counter.Inc("a", "b") })
+
+	counter.Inc("valid")
+	if v := counter.Value("valid"); v != 1 {
+		t.Errorf("expected the counter to keep working, got %v", v)
+	}
+}
@@ -0,0 +1,91 @@
+package arbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestMigrationComparesThenPromotesNewBackend(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://legacy.local/users/1", httpmock.NewStringResponder(200, `{"id":1,"name":"Ada","served_at":"12:00"}`))
+	httpmock.RegisterResponder("GET", "http://users.local/v2/users/1", httpmock.NewStringResponder(200, `{"served_at":"12:01","name":"Ada","id":1}`))
+
+	proxy.BackendMigrations = map[string]proxy.Migration{
+		"legacy.local": {Backend: "http://users.local/v2", Rate: 1, IgnoredFields: []string{"served_at"}},
+	}
+	server.MigrationsPath = "/_migrations"
+	health.AdminToken = "admin-token"
+	defer func() {
+		proxy.BackendMigrations = map[string]proxy.Migration{}
+		server.MigrationsPath = ""
+		health.AdminToken = ""
+	}()
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "User",
+		Method:  "GET",
+		Pattern: "/users/{id}",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.GET(w, "http://legacy.local"+r.URL.Path, "RAW", "", r)
+		},
+	}})
+	get := func() string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/users/1", http.NoBody))
+		body, _ := ioutil.ReadAll(recorder.Body)
+		return string(body)
+	}
+
+	if body := get(); body != `{"id":1,"name":"Ada","served_at":"12:00"}` {
+		t.Errorf("expected the old backend to serve during the migration, got %s", body)
+	}
+	deadline := time.Now().Add(time.Second)
+	for proxy.Migrations()[0].Compared == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status := proxy.Migrations()[0]; status.Compared != 1 || status.Parity != 1 {
+		t.Errorf("expected one matching comparison, got %+v", status)
+	}
+
+	promote := func(headers map[string]string) int {
+		req := httptest.NewRequest("POST", "/_migrations/legacy.local/promote", http.NoBody)
+		req.RemoteAddr = "127.0.0.1:1234"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	for name, headers := range map[string]map[string]string{
+		"without a token":      {},
+		"with the wrong token": {"Authorization": "Bearer guessed"},
+		"from another origin":  {"Authorization": "Bearer admin-token", "Origin": "https://attacker.example"},
+		"from another site":    {"Authorization": "Bearer admin-token", "Sec-Fetch-Site": "cross-site"},
+	} {
+		if code := promote(headers); code != http.StatusForbidden {
+			t.Errorf("expected a promotion %s to be refused, got %d", name, code)
+		}
+	}
+	if body := get(); body != `{"id":1,"name":"Ada","served_at":"12:00"}` {
+		t.Errorf("expected refused promotions to leave the old backend serving, got %s", body)
+	}
+	if code := promote(map[string]string{"Authorization": "Bearer admin-token", "Origin": "http://example.com"}); code != http.StatusNoContent {
+		t.Fatalf("expected the migration to be promoted, got %d", code)
+	}
+	if body := get(); body != `{"served_at":"12:01","name":"Ada","id":1}` {
+		t.Errorf("expected the new backend to serve once promoted, got %s", body)
+	}
+}
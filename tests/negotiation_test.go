@@ -0,0 +1,58 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestResponsesAreNegotiatedByAccept(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"order": {"-id": "7", "item": ["a", "b"]}}`))
+	}))
+	defer backend.Close()
+
+	route := func(name string, pattern string, policy *services.NegotiationPolicy) services.Route {
+		return services.Route{Name: name, Method: "GET", Pattern: pattern, Negotiation: policy, Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, backend.URL+"/order")
+		}}
+	}
+	router := server.NewRouter(services.RouteCollection{
+		route("Strict", "/strict", &services.NegotiationPolicy{Formats: []string{"application/xml"}, Strict: true}),
+		route("Lenient", "/lenient", &services.NegotiationPolicy{}),
+	})
+	get := func(path string, accept string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, http.NoBody)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := get("/strict", "application/json;q=0, application/xml")
+	if !strings.HasSuffix(recorder.Body.String(), `<order id="7"><item>a</item><item>b</item></order>`) || recorder.Header().Get("Content-Type") != "application/xml" {
+		t.Errorf("expected the JSON response to be translated to XML, got %s %s", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+	for _, accept := range []string{"", "application/json", "*/*"} {
+		if recorder := get("/strict", accept); !strings.HasPrefix(recorder.Body.String(), `{"order"`) {
+			t.Errorf("expected the service's JSON for Accept %q, got %s", accept, recorder.Body)
+		}
+	}
+	if code := get("/strict", "text/csv").Code; code != http.StatusNotAcceptable {
+		t.Errorf("expected an unsupported format to be refused, got %d", code)
+	}
+	if recorder := get("/lenient", "text/csv"); recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Body.String(), `{"order"`) {
+		t.Errorf("expected the service's format when the route is not strict, got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := get("/lenient", "text/xml"); recorder.Header().Get("Content-Type") != "text/xml" {
+		t.Errorf("expected every codec to be available by default, got %s", recorder.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,79 @@
+package arbor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/openapi"
+	"github.com/arbor-dev/arbor/schema"
+)
+
+const productsSpec = `{
+	"openapi": "3.0.3",
+	"info": {"title": "Products", "version": "1.0.0"},
+	"servers": [{"url": "http://{host}:5000", "variables": {"host": {"default": "0.0.0.0"}}}],
+	"security": [{"oauth": ["products:read"]}],
+	"paths": {
+		"/products/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {"operationId": "GetProduct", "responses": {"200": {"description": "A product", "content": {"application/json": {}}}}},
+			"put": {
+				"operationId": "UpdateProduct",
+				"security": [{"oauth": ["products:write"]}],
+				"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Product"}}}},
+				"responses": {"200": {"description": "Updated"}}
+			}
+		}
+	},
+	"components": {"schemas": {"Product": {"type": "object", "required": ["name"]}}}
+}`
+
+func TestRoutesFromOpenAPI(t *testing.T) {
+	routes, err := arbor.RoutesFromOpenAPI([]byte(productsSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+	get, put := routes[0], routes[1]
+	if get.Name != "GetProduct" || get.Method != "GET" || get.Pattern != "/products/{id:[0-9]+}" {
+		t.Errorf("unexpected route %s %s %s", get.Name, get.Method, get.Pattern)
+	}
+	if !reflect.DeepEqual(get.Scopes, []string{"products:read"}) || !reflect.DeepEqual(put.Scopes, []string{"products:write"}) {
+		t.Errorf("unexpected scopes %v and %v", get.Scopes, put.Scopes)
+	}
+	if len(put.Schema) == 0 || len(get.Schema) != 0 {
+		t.Error("request body schema was not attached to the PUT route only")
+	}
+	compiled, err := schema.Compile(put.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs, _ := compiled.ValidateJSON([]byte(`{}`)); len(errs) != 1 || errs[0].Field != "/name" {
+		t.Errorf("component reference was not resolved: %v", errs)
+	}
+}
+
+func TestOpenAPIFromRoutes(t *testing.T) {
+	routes := arbor.RouteCollection{
+		{Name: "GetProduct", Method: "GET", Pattern: "/products/{id:[0-9]{1,8}}", Scopes: []string{"products:read"}},
+		{Name: "DeleteProduct", Method: "DELETE", Pattern: "/products/{id:[0-9]{1,8}}", Roles: []string{"admin"}},
+	}
+	doc := openapi.FromRoutes(routes.ToServiceRoutes(), openapi.Info{Title: "Products", Version: "1"})
+
+	item, ok := doc.Paths["/products/{id}"]
+	if !ok {
+		t.Fatalf("path template was not converted, got %v", doc.SortedPaths())
+	}
+	if len(item.Parameters) != 1 || string(item.Parameters[0].Schema) != `{"pattern":"^[0-9]{1,8}$","type":"string"}` {
+		t.Errorf("unexpected parameters %+v", item.Parameters)
+	}
+	if item.Get == nil || item.Get.Security == nil || !reflect.DeepEqual((*item.Get.Security)[0][openapi.BearerScheme], []string{"products:read"}) {
+		t.Error("scopes were not described")
+	}
+	if item.Delete == nil || !reflect.DeepEqual(item.Delete.Roles, []string{"admin"}) {
+		t.Error("roles were not described")
+	}
+}
@@ -0,0 +1,170 @@
+package arbor
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func echoBackend(t *testing.T) string {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(body))
+	}))
+	t.Cleanup(backend.Close)
+	return backend.URL
+}
+
+func TestProxyOptions(t *testing.T) {
+	backend := echoBackend(t)
+	send := func(method string, body string, authorization string, proxied func(w http.ResponseWriter, r *http.Request)) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "http://gateway.local/orders", strings.NewReader(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		proxied(recorder, req)
+		return recorder
+	}
+
+	recorder := send("PATCH", "{}", "caller", func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, backend+"/orders", arbor.WithFormat("JSON"), arbor.WithToken("service"))
+	})
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "PATCH /orders service {}" {
+		t.Errorf("expected the request with the service token, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = send("POST", "not json", "caller", func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, backend+"/orders")
+	})
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "POST /orders caller not json" {
+		t.Errorf("expected a RAW request with the caller's token, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = send("POST", "not json", "", func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, backend+"/orders", arbor.WithFormat("JSON"))
+	})
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid JSON to be rejected, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// The deprecated functions are adapters for the options
+	recorder = send("DELETE", "", "", func(w http.ResponseWriter, r *http.Request) {
+		arbor.DELETE(w, backend+"/orders", "RAW", "service", r)
+	})
+	if recorder.Body.String() != "DELETE /orders service " {
+		t.Errorf("expected the deprecated function to proxy like Proxy, got %q", recorder.Body.String())
+	}
+
+	middlewares := proxy.ProxyMiddlewaresFactory("RAW", "")
+	middlewares.RequestMiddlewares = append(middlewares.RequestMiddlewares, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Authorization", "middleware")
+	}))
+	recorder = send("GET", "", "caller", func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, backend+"/orders", arbor.WithToken("ignored"), proxy.WithMiddlewares(middlewares))
+	})
+	if recorder.Body.String() != "GET /orders middleware " {
+		t.Errorf("expected the given middlewares to replace those from the token, got %q", recorder.Body.String())
+	}
+}
+
+const deprecatedCalls = `package gateway
+
+import (
+	"net/http"
+
+	gw "github.com/arbor-dev/arbor"
+)
+
+func handlers(token string) []http.HandlerFunc {
+	return []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) { gw.GET(w, "http://users.local", "JSON", token, r) },
+		func(w http.ResponseWriter, r *http.Request) { gw.POST(w, "http://users.local", "RAW", "", r) },
+		func(w http.ResponseWriter, r *http.Request) {
+			gw := struct {
+				GET func(http.ResponseWriter, string, string, string, *http.Request)
+			}{}
+			gw.GET(w, "http://users.local", "RAW", "", r)
+		},
+	}
+}
+`
+
+const migratedCalls = `package gateway
+
+import (
+	"net/http"
+
+	gw "github.com/arbor-dev/arbor"
+)
+
+func handlers(token string) []http.HandlerFunc {
+	return []http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) {
+			gw.Proxy(w, r, "http://users.local", gw.WithFormat("JSON"), gw.WithToken(token))
+		},
+		func(w http.ResponseWriter, r *http.Request) { gw.Proxy(w, r, "http://users.local") },
+		func(w http.ResponseWriter, r *http.Request) {
+			gw := struct {
+				GET func(http.ResponseWriter, string, string, string, *http.Request)
+			}{}
+			gw.GET(w, "http://users.local", "RAW", "", r)
+		},
+	}
+}
+`
+
+func TestArbormigrateRewritesDeprecatedCalls(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "arbormigrate")
+	if out, err := exec.Command("go", "build", "-o", tool, "../cmd/arbormigrate").CombinedOutput(); err != nil {
+		t.Fatalf("could not build arbormigrate: %v\n%s", err, out)
+	}
+	source := filepath.Join(dir, "gateway", "handlers.go")
+	os.Mkdir(filepath.Dir(source), 0755)
+	if err := ioutil.WriteFile(source, []byte(deprecatedCalls), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, int) {
+		cmd := exec.Command(tool, args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if exit, ok := err.(*exec.ExitError); ok {
+			return string(out), exit.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return string(out), 0
+	}
+	contents := func() string {
+		data, _ := ioutil.ReadFile(source)
+		return string(data)
+	}
+
+	out, code := run()
+	if code != 1 || strings.Count(out, "can be") != 2 || !strings.Contains(out, `gw.Proxy(w, r, "http://users.local")`) {
+		t.Errorf("expected the two deprecated calls to be reported, got %d:\n%s", code, out)
+	}
+	if contents() != deprecatedCalls {
+		t.Error("expected reporting to leave the file alone")
+	}
+
+	if out, code := run("-w", "./..."); code != 0 {
+		t.Fatalf("expected the calls to be rewritten, got %d:\n%s", code, out)
+	}
+	if contents() != migratedCalls {
+		t.Errorf("unexpected rewrite:\n%s", contents())
+	}
+	if out, code := run("gateway"); code != 0 || out != "" {
+		t.Errorf("expected nothing left to migrate, got %d:\n%s", code, out)
+	}
+}
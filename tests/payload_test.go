@@ -0,0 +1,29 @@
+package arbor
+
+import (
+	"testing"
+
+	"github.com/arbor-dev/arbor/payload"
+)
+
+func TestPayloadHashIgnoresFields(t *testing.T) {
+	ignored := payload.IgnoredFields
+	payload.IgnoredFields = []string{"timestamp", "/meta/nonce"}
+	defer func() { payload.IgnoredFields = ignored }()
+
+	a := payload.Hash("application/json", []byte(`{"name":"Test Product","price":9.99,"timestamp":1,"meta":{"nonce":"a"}}`))
+	b := payload.Hash("application/json; charset=utf-8", []byte(`{"meta":{"nonce":"b"},"price":9.990,"timestamp":2,"name":"Test Product"}`))
+	if a != b {
+		t.Error("semantically identical JSON bodies hashed differently")
+	}
+	c := payload.Hash("application/json", []byte(`{"name":"Test Product","price":10,"meta":{"nonce":"a"}}`))
+	if a == c {
+		t.Error("different JSON bodies hashed the same")
+	}
+
+	d := payload.Hash("application/x-www-form-urlencoded", []byte("b=2&a=1&timestamp=3"))
+	e := payload.Hash("application/x-www-form-urlencoded", []byte("a=1&b=2"))
+	if d != e {
+		t.Error("semantically identical form bodies hashed differently")
+	}
+}
@@ -0,0 +1,52 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestWritesMustBeConditional(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("PUT", "http://test.local/documents/1", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-Match") != `"v1"` {
+			return httpmock.NewStringResponse(http.StatusPreconditionFailed, ""), nil
+		}
+		return httpmock.NewStringResponse(200, ""), nil
+	})
+	httpmock.RegisterResponder("GET", "http://test.local/documents/1", httpmock.NewStringResponder(200, ""))
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/documents/1")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Replace", Method: "PUT", Pattern: "/documents/1", Handler: handler, RequirePreconditions: true},
+		{Name: "Get", Method: "GET", Pattern: "/documents/1", Handler: handler, RequirePreconditions: true},
+	})
+	send := func(method string, ifMatch string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/documents/1", http.NoBody)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := send("PUT", ""); code != http.StatusPreconditionRequired {
+		t.Errorf("unconditional write was not rejected with 428: %d", code)
+	}
+	if code := send("PUT", `"v1"`); code != http.StatusOK {
+		t.Errorf("If-Match was not passed to the service: %d", code)
+	}
+	if code := send("GET", ""); code != http.StatusOK {
+		t.Errorf("read was required to be conditional: %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package arbor
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestPrewarmedConnectionsAreReused(t *testing.T) {
+	var connections int32
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			arrived <- struct{}{}
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	proxy.PrewarmBackends, proxy.PrewarmConnections = []string{backend.URL}, 4
+	defer func() { proxy.PrewarmBackends, proxy.PrewarmConnections = nil, 0 }()
+	proxy.Prewarm()
+	if atomic.LoadInt32(&connections) != 4 {
+		t.Fatalf("expected 4 warm connections, %d were opened", connections)
+	}
+
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Items",
+		Method:  "GET",
+		Pattern: "/items",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.GET(w, backend.URL+"/items", "JSON", "", r)
+		},
+	}})
+	var requests sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-arrived
+	}
+	close(release)
+	requests.Wait()
+	if atomic.LoadInt32(&connections) != 4 {
+		t.Errorf("expected concurrent requests to use the warm connections, %d connections were opened", connections)
+	}
+}
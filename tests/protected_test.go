@@ -0,0 +1,60 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/features"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestProtectedRoutesSkipFaultsAndExperiments(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://payments.local/charges", httpmock.NewStringResponder(201, `{"charged":true}`))
+
+	proxy.FaultInjection = true
+	proxy.FaultRules = []proxy.FaultRule{{Header: "X-Fault", Fault: proxy.Fault{Kind: proxy.FaultStatus, Status: 503}}}
+	defer func() {
+		proxy.FaultInjection = false
+		proxy.FaultRules = nil
+	}()
+	features.Register("TestProtectedExperiment", features.Spec{Default: true, Stage: features.Alpha})
+	features.Register("TestProtectedGraduated", features.Spec{Default: true, Stage: features.GA})
+
+	experiments := map[string]bool{}
+	charge := func(w http.ResponseWriter, r *http.Request) {
+		experiments[r.URL.Path] = features.EnabledFor(r.Context(), "TestProtectedExperiment")
+		if !features.EnabledFor(r.Context(), "TestProtectedGraduated") {
+			t.Error("a GA gate was disabled for a protected route")
+		}
+		arbor.POST(w, "http://payments.local/charges", "RAW", "", r)
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Charge", Method: "POST", Pattern: "/charges", Handler: charge, Protected: true},
+		{Name: "ChargeTest", Method: "POST", Pattern: "/test-charges", Handler: charge},
+	})
+	post := func(path string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, http.NoBody)
+		req.Header.Set("X-Fault", "on")
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := post("/charges"); code != http.StatusCreated {
+		t.Errorf("expected the protected route to reach its backend, got %d", code)
+	}
+	if code := post("/test-charges"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a fault to be injected in other routes, got %d", code)
+	}
+	if experiments["/charges"] || !experiments["/test-charges"] {
+		t.Errorf("expected the alpha gate to only apply to the unprotected route, got %v", experiments)
+	}
+}
@@ -0,0 +1,172 @@
+package arbor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/protobuf"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+// pb appends protobuf fields, to write descriptor sets without protoc
+type pb []byte
+
+func (b pb) varint(v uint64) pb {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func (b pb) number(field int, v uint64) pb {
+	return b.varint(uint64(field << 3)).varint(v)
+}
+
+func (b pb) bytes(field int, v []byte) pb {
+	return append(b.varint(uint64(field<<3|2)).varint(uint64(len(v))), v...)
+}
+
+func (b pb) str(field int, v string) pb {
+	return b.bytes(field, []byte(v))
+}
+
+// writeOrdersDescriptorSet writes the descriptor set of
+//
+//	package orders;
+//	enum Status { PENDING = 0; SHIPPED = 1; }
+//	message Order { int64 id = 1; string name = 2; repeated int32 qty = 3; Status status = 4; map<string, int32> counts = 5; }
+func writeOrdersDescriptorSet(t *testing.T) string {
+	field := func(name string, number int, label int, fieldType int, typeName string) []byte {
+		f := pb{}.str(1, name).number(3, uint64(number)).number(4, uint64(label)).number(5, uint64(fieldType))
+		if typeName != "" {
+			f = f.str(6, typeName)
+		}
+		return f
+	}
+	entry := pb{}.str(1, "CountsEntry").
+		bytes(2, field("key", 1, 1, 9, "")).
+		bytes(2, field("value", 2, 1, 5, "")).
+		bytes(7, pb{}.number(7, 1))
+	order := pb{}.str(1, "Order").
+		bytes(2, field("id", 1, 1, 3, "")).
+		bytes(2, field("name", 2, 1, 9, "")).
+		bytes(2, field("qty", 3, 3, 5, "")).
+		bytes(2, field("status", 4, 1, 14, ".orders.Status")).
+		bytes(2, field("counts", 5, 3, 11, ".orders.Order.CountsEntry")).
+		bytes(3, entry)
+	status := pb{}.str(1, "Status").
+		bytes(2, pb{}.str(1, "PENDING").number(2, 0)).
+		bytes(2, pb{}.str(1, "SHIPPED").number(2, 1))
+	file := pb{}.str(1, "orders.proto").str(2, "orders").bytes(4, order).bytes(5, status)
+
+	path := filepath.Join(t.TempDir(), "orders.pb")
+	if err := ioutil.WriteFile(path, pb{}.bytes(1, file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProtobufTranscodesJSON(t *testing.T) {
+	set, err := protobuf.LoadDescriptorSet(writeOrdersDescriptorSet(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, ok := set.Message("orders.Order")
+	if !ok {
+		t.Fatal("expected the descriptor set to hold orders.Order")
+	}
+
+	document := `{"id":"-42","name":"Book","qty":[1,300],"status":"SHIPPED","counts":{"a":1,"b":2}}`
+	encoded, err := order.FromJSON([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := pb{}.number(1, 1<<64-42).str(2, "Book").bytes(3, []byte{1, 0xac, 0x02})
+	if !bytes.HasPrefix(encoded, expected) {
+		t.Errorf("expected the proto3 encoding %x, got %x", expected, encoded)
+	}
+	decoded, err := order.ToJSON(encoded)
+	if err != nil || string(decoded) != document {
+		t.Errorf("expected %s back, got %s (%v)", document, decoded, err)
+	}
+
+	for _, invalid := range []string{`{"price": 1}`, `{"qty": ["a"]}`, `{"status": "LOST"}`, `[1]`} {
+		if _, err := order.FromJSON([]byte(invalid)); err == nil {
+			t.Errorf("expected %s to be refused", invalid)
+		}
+	}
+	if _, err := order.ToJSON([]byte{0x0a, 0x05}); err == nil {
+		t.Error("expected a truncated message to be refused")
+	}
+}
+
+func TestProtobufServicesPassThroughAndTranscode(t *testing.T) {
+	descriptors := writeOrdersDescriptorSet(t)
+	response := pb{}.number(1, 7).number(4, 1)
+	var received []byte
+	var contentType string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		contentType = r.Header.Get("Content-Type")
+		w.Write(response)
+	}))
+	defer backend.Close()
+
+	routes := services.RouteCollection{{Name: "Orders", Method: "POST", Pattern: "/orders", MaxBodySize: 64,
+		Protobuf: &services.ProtobufPolicy{DescriptorSet: descriptors, Request: "orders.Order", Response: "orders.Order"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, backend.URL+"/orders", arbor.WithFormat("PROTOBUF"))
+		}}}
+	if err := server.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	router := server.NewRouter(routes)
+	post := func(body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/orders", bytes.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := post(pb{}.str(2, "Book"), map[string]string{"Content-Type": protobuf.MediaType})
+	if !bytes.Equal(received, pb{}.str(2, "Book")) || contentType != protobuf.MediaType {
+		t.Errorf("expected the protobuf body to be sent as it is, got %s %x", contentType, received)
+	}
+	if !bytes.Equal(recorder.Body.Bytes(), response) || recorder.Header().Get("Content-Type") != protobuf.MediaType {
+		t.Errorf("expected the protobuf response with its media type, got %s %x", recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+
+	recorder = post([]byte(`{"name": "Book"}`), map[string]string{"Content-Type": "application/json", "Accept": "application/json"})
+	if !bytes.Equal(received, pb{}.str(2, "Book")) || contentType != protobuf.MediaType {
+		t.Errorf("expected the JSON body to be transcoded, got %s %x", contentType, received)
+	}
+	if expected := `{"id":"7","status":"SHIPPED"}`; recorder.Body.String() != expected || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the caller to receive %s, got %s %s", expected, recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+
+	if code := post([]byte(`{"price": 1}`), map[string]string{"Content-Type": "application/json"}).Code; code != http.StatusBadRequest {
+		t.Errorf("expected JSON which does not fit the message to be refused, got %d", code)
+	}
+	if code := post([]byte("name=Book"), map[string]string{"Content-Type": "text/plain"}).Code; code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected other formats to be refused, got %d", code)
+	}
+	if code := post(bytes.Repeat([]byte{0}, 65), map[string]string{"Content-Type": protobuf.MediaType}).Code; code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected bodies over the route's limit to be refused, got %d", code)
+	}
+
+	routes[0].Protobuf = &services.ProtobufPolicy{DescriptorSet: descriptors, Request: "orders.Invoice"}
+	if err := server.ValidateRoutes(routes); err == nil || !strings.Contains(err.Error(), "orders.Invoice") {
+		t.Errorf("expected a missing message to be reported, got %v", err)
+	}
+}
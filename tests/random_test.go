@@ -0,0 +1,122 @@
+package arbor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/random"
+)
+
+func draws() []interface{} {
+	var values []interface{}
+	for i := 0; i < 5; i++ {
+		values = append(values, random.Intn(1000), random.Int63n(1000), random.Float64(), random.Sample(0.5), random.Jitter(time.Second, 0.1))
+	}
+	return values
+}
+
+func TestSeedMakesRandomValuesReproducible(t *testing.T) {
+	restore := random.Seed(42)
+	first := draws()
+	restore()
+	restore = random.Seed(42)
+	second := draws()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same values from the same seed, draw %d was %v then %v", i, first[i], second[i])
+		}
+	}
+
+	// Restoring a nested seed continues the previous sequence
+	random.Seed(7)()
+	next := random.Float64()
+	restore()
+	random.Seed(42)
+	draws()
+	if expected := random.Float64(); next != expected {
+		t.Errorf("expected the outer sequence to continue after restoring, got %v instead of %v", next, expected)
+	}
+	restore()
+
+	t.Run("arbortest", func(t *testing.T) {
+		arbortest.Seed(t, 42)
+		if values := draws(); values[0] != first[0] || values[len(values)-1] != first[len(first)-1] {
+			t.Errorf("expected arbortest.Seed to seed the source, got %v", values)
+		}
+	})
+}
+
+func TestSampleAndJitterBounds(t *testing.T) {
+	arbortest.Seed(t, 1)
+	for i := 0; i < 100; i++ {
+		if random.Sample(0) || random.Sample(-1) {
+			t.Fatal("expected a rate of 0 never to sample")
+		}
+		if !random.Sample(1) || !random.Sample(2) {
+			t.Fatal("expected a rate of 1 always to sample")
+		}
+		if d := random.Jitter(time.Second, 0.1); d < 900*time.Millisecond || d > 1100*time.Millisecond {
+			t.Fatalf("expected jitter within 10%%, got %v", d)
+		}
+	}
+	if d := random.Jitter(time.Second, 0); d != time.Second {
+		t.Errorf("expected no jitter without a fraction, got %v", d)
+	}
+	if d := random.Jitter(-time.Second, 0.5); d != -time.Second {
+		t.Errorf("expected non-positive durations to be left alone, got %v", d)
+	}
+}
+
+func TestSeededShadowSamplingIsReproducible(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "primary")
+	}))
+	defer primary.Close()
+	mirrored := make(chan struct{}, 100)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mirrored <- struct{}{}
+	}))
+	defer shadow.Close()
+
+	proxy.BackendShadows = map[string]proxy.Shadow{
+		strings.TrimPrefix(primary.URL, "http://"): {Backend: shadow.URL, Rate: 0.5},
+	}
+	defer func() { proxy.BackendShadows = map[string]proxy.Shadow{} }()
+
+	const requests = 20
+	restore := random.Seed(99)
+	expected := 0
+	for i := 0; i < requests; i++ {
+		if random.Sample(0.5) {
+			expected++
+		}
+	}
+	restore()
+	if expected == 0 || expected == requests {
+		t.Fatalf("seed samples all or nothing (%d), pick another", expected)
+	}
+
+	arbortest.Seed(t, 99)
+	for i := 0; i < requests; i++ {
+		arbor.Proxy(httptest.NewRecorder(), httptest.NewRequest("GET", "http://gateway.local/orders", nil), primary.URL+"/orders")
+	}
+	for i := 0; i < expected; i++ {
+		select {
+		case <-mirrored:
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d mirrored requests, got %d", expected, i)
+		}
+	}
+	select {
+	case <-mirrored:
+		t.Errorf("expected exactly %d mirrored requests, got more", expected)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,127 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/ratelimit"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestMemoryStoreRefills(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(0, 0))
+	store := ratelimit.NewMemoryStore()
+	limit := services.RateLimit{Requests: 2, Per: time.Second}
+
+	for i := 0; i < 2; i++ {
+		res, _ := store.Take("client", limit)
+		if !res.Allowed {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+	res, _ := store.Take("client", limit)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("expected limit with 500ms retry, got %+v", res)
+	}
+	if res, _ := store.Take("other", limit); !res.Allowed {
+		t.Fatal("clients should have separate buckets")
+	}
+
+	fake.Advance(500 * time.Millisecond)
+	if res, _ := store.Take("client", limit); !res.Allowed {
+		t.Fatal("bucket did not refill")
+	}
+}
+
+// rateLimitedRouter serves a route limited to two requests a minute, proxied to a backend
+func rateLimitedRouter(t *testing.T, name string) http.Handler {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(backend.Close)
+	return server.NewRouter(services.RouteCollection{{
+		Name:      name,
+		Method:    "GET",
+		Pattern:   "/limited",
+		RateLimit: &services.RateLimit{Requests: 2, Per: time.Minute},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.GET(w, backend.URL+"/limited", "JSON", "", r)
+		},
+	}})
+}
+
+func TestRateLimitMiddlewareRejectsClientsOverTheirLimit(t *testing.T) {
+	arbortest.UseFakeClock(t, time.Unix(0, 0))
+	router := rateLimitedRouter(t, "RateLimited")
+
+	// Made up keys are not verified identities, so they do not get buckets of their own
+	for i, key := range []string{"a", "b", "c"} {
+		req := httptest.NewRequest("GET", "/limited", nil)
+		req.RemoteAddr = "10.0.0.9:41000"
+		req.Header.Set("Authorization", key)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		expected, remaining := http.StatusOK, []string{"1", "0", "0"}[i]
+		if i == 2 {
+			expected = http.StatusTooManyRequests
+		}
+		if recorder.Code != expected {
+			t.Fatalf("expected request %d to get %d, got %d", i, expected, recorder.Code)
+		}
+		if recorder.Header().Get("RateLimit-Limit") != "2" || recorder.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("unexpected rate limit headers for request %d: %v", i, recorder.Header())
+		}
+		if retry := recorder.Header().Get("Retry-After"); (i == 2) != (retry == "30") {
+			t.Errorf("unexpected Retry-After %q for request %d", retry, i)
+		}
+	}
+}
+
+func TestRateLimitsCountVerifiedAPIKeysApart(t *testing.T) {
+	arbortest.UseFakeClock(t, time.Unix(0, 0))
+	dir := t.TempDir()
+	registry, accessLog := security.ClientRegistryLocation, security.AccessLogLocation
+	security.ClientRegistryLocation = filepath.Join(dir, "clients.db")
+	security.AccessLogLocation = filepath.Join(dir, "access.log")
+	defer func() { security.ClientRegistryLocation, security.AccessLogLocation = registry, accessLog }()
+	security.Init()
+	defer security.Shutdown()
+	keys := security.NewMemoryKeyStore()
+	security.APIKeys = keys
+	defer func() { security.APIKeys = nil }()
+	first, _ := security.IssueAPIKey(keys, security.APIKey{Client: "first"})
+	second, _ := security.IssueAPIKey(keys, security.APIKey{Client: "second"})
+	router := rateLimitedRouter(t, "RateLimitedByKey")
+
+	get := func(key string) int {
+		req := httptest.NewRequest("GET", "/limited", nil)
+		req.RemoteAddr = "10.0.0.9:41000"
+		req.Header.Set("Authorization", key)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := get(first); code != http.StatusOK {
+			t.Fatalf("expected request %d of the first key to be allowed, got %d", i, code)
+		}
+	}
+	if code := get(first); code != http.StatusTooManyRequests {
+		t.Errorf("expected the first key to be over its limit, got %d", code)
+	}
+	if code := get(second); code != http.StatusOK {
+		t.Errorf("expected the second key to have its own limit, got %d", code)
+	}
+	if code := get("made-up"); code != http.StatusForbidden {
+		t.Errorf("expected an unknown key to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/security"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestRolesAreRequiredByRoutes(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("DELETE", "http://test.local/users/7", httpmock.NewStringResponder(204, ""))
+
+	var caller security.Claims
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "DeleteUser",
+		Method:  "DELETE",
+		Pattern: "/users/7",
+		Roles:   []string{"admin", "support"},
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if caller != nil {
+				r = r.WithContext(security.NewClaimsContext(r.Context(), caller))
+			}
+			arbor.DELETE(w, "http://test.local/users/7", "JSON", "", r)
+		},
+	}})
+	remove := func(claims security.Claims) *httptest.ResponseRecorder {
+		caller = claims
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/users/7", nil))
+		return recorder
+	}
+
+	if code := remove(security.Claims{"sub": "ops", "roles": []interface{}{"viewer", "support"}}).Code; code != http.StatusNoContent {
+		t.Errorf("expected a caller with one of the roles to be allowed, got %d", code)
+	}
+	if code := remove(security.Claims{"sub": "ops", "roles": "admin"}).Code; code != http.StatusNoContent {
+		t.Errorf("expected roles in a space separated claim to be allowed, got %d", code)
+	}
+
+	denied := remove(security.Claims{"sub": "guest", "roles": []interface{}{"viewer"}})
+	var body struct {
+		Details struct {
+			Route         string   `json:"route"`
+			RequiredRoles []string `json:"required_roles"`
+		} `json:"details"`
+	}
+	json.Unmarshal(denied.Body.Bytes(), &body)
+	if denied.Code != http.StatusForbidden || body.Details.Route != "DeleteUser" || len(body.Details.RequiredRoles) != 2 {
+		t.Errorf("expected a caller without the roles to be forbidden with the required roles, got %d %s", denied.Code, denied.Body)
+	}
+
+	anonymous := remove(nil)
+	if anonymous.Code != http.StatusUnauthorized || anonymous.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected an anonymous caller to be asked to authenticate, got %d", anonymous.Code)
+	}
+	if calls := httpmock.GetTotalCallCount(); calls != 2 {
+		t.Errorf("expected only the allowed callers to reach the service, %d did", calls)
+	}
+}
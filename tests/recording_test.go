@@ -0,0 +1,109 @@
+package arbor
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/encryption"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"query":"`+string(body)+`"}`)
+	}))
+
+	proxy.RecordingDirectory = t.TempDir()
+	defer func() {
+		proxy.RecordingMode = proxy.RecordingOff
+		proxy.RecordingDirectory = "recordings"
+	}()
+
+	search := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "http://gateway.local/search", strings.NewReader(query))
+		arbor.Proxy(recorder, req, backend.URL+"/search")
+		return recorder
+	}
+
+	proxy.RecordingMode = proxy.Record
+	search("shoes")
+	backend.Close()
+
+	proxy.RecordingMode = proxy.Replay
+	recorder := search("shoes")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"query":"shoes"}` || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("recording was not replayed: %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder := search("boots"); recorder.Code == http.StatusOK {
+		t.Errorf("request with another body was served a recording: %q", recorder.Body.String())
+	}
+}
+
+func TestRecordingsAreEncryptedAtRest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret-session")
+		io.WriteString(w, `{"card":"4111111111111111"}`)
+	}))
+
+	keyring, err := encryption.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption.AtRest = keyring
+	proxy.RecordingDirectory = t.TempDir()
+	defer func() {
+		encryption.AtRest = nil
+		proxy.RecordingMode = proxy.RecordingOff
+		proxy.RecordingDirectory = "recordings"
+	}()
+
+	fetch := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		arbor.Proxy(recorder, httptest.NewRequest("GET", "http://gateway.local"+path, nil), backend.URL+path)
+		return recorder
+	}
+
+	proxy.RecordingMode = proxy.Record
+	fetch("/cards")
+	fetch("/other")
+	backend.Close()
+
+	files, _ := filepath.Glob(filepath.Join(proxy.RecordingDirectory, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("expected two recordings, got %v", files)
+	}
+	for _, file := range files {
+		data, _ := ioutil.ReadFile(file)
+		if bytes.Contains(data, []byte("4111111111111111")) || bytes.Contains(data, []byte("secret-session")) || bytes.Contains(data, []byte("/cards")) {
+			t.Errorf("expected %s to be encrypted, got %s", file, data)
+		}
+	}
+
+	proxy.RecordingMode = proxy.Replay
+	if recorder := fetch("/cards"); recorder.Code != http.StatusOK || recorder.Body.String() != `{"card":"4111111111111111"}` {
+		t.Errorf("expected the encrypted recording to be replayed, got %d %q", recorder.Code, recorder.Body.String())
+	}
+
+	// A recording moved to another request's file does not open
+	data, _ := ioutil.ReadFile(files[0])
+	ioutil.WriteFile(files[1], data, 0600)
+	replayed := 0
+	for _, path := range []string{"/cards", "/other"} {
+		if fetch(path).Code == http.StatusOK {
+			replayed++
+		}
+	}
+	if replayed != 1 {
+		t.Errorf("expected only the recording in its own file to be replayed, %d were", replayed)
+	}
+}
@@ -0,0 +1,91 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestRedirectsPointAtTheGateway(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var status int
+	var location string
+	httpmock.RegisterResponder("POST", "http://test.local/products/1", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(status, "")
+		resp.Header.Set("Location", location)
+		return resp, nil
+	})
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Product", Method: "POST", Pattern: "/api/products/1", Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://test.local/products/1")
+		}},
+	})
+
+	for _, test := range []struct {
+		status   int
+		location string
+		expected string
+	}{
+		{http.StatusMovedPermanently, "http://test.local/products/2", "http://gateway.local/api/products/2"},
+		{http.StatusFound, "/products/2?tab=reviews", "/api/products/2?tab=reviews"},
+		{http.StatusSeeOther, "http://test.local/orders/7", "http://gateway.local/api/orders/7"},
+		{http.StatusTemporaryRedirect, "https://login.example.org/", "https://login.example.org/"},
+		{http.StatusPermanentRedirect, "reviews", "reviews"},
+	} {
+		status, location = test.status, test.location
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", "http://gateway.local/api/products/1", http.NoBody))
+		if recorder.Code != test.status || recorder.Header().Get("Location") != test.expected {
+			t.Errorf("%d to %s was passed through as %d to %s", test.status, test.location, recorder.Code, recorder.Header().Get("Location"))
+		}
+	}
+
+	proxy.PublicURL = "https://api.example.org"
+	defer func() { proxy.PublicURL = "" }()
+	status, location = http.StatusMovedPermanently, "http://test.local/products/2"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "http://gateway.local/api/products/1", http.NoBody))
+	if recorder.Header().Get("Location") != "https://api.example.org/api/products/2" {
+		t.Errorf("redirect was not moved onto the public URL: %s", recorder.Header().Get("Location"))
+	}
+}
+
+func TestURLRewrites(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://test.local/products", func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(200, "[]")
+		resp.Header.Set("Content-Location", "http://products.internal:8000/v2/products?page=1")
+		resp.Header.Add("Link", `<http://products.internal:8000/v2/products?page=2>; rel="next", <https://docs.example.org/products>; rel="help"`)
+		resp.Header.Add("Link", `<http://products.internal:8000/v2/reviews/products>; rel="related"`)
+		return resp, nil
+	})
+	proxy.URLRewrites = map[string]string{
+		"http://products.internal:8000/":            "https://api.example.org/legacy/",
+		"http://products.internal:8000/v2/":         "https://api.example.org/",
+		"http://products.internal:8000/v2/reviews/": "https://reviews.example.org/",
+	}
+	defer func() { proxy.URLRewrites = map[string]string{} }()
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://gateway.local/products", http.NoBody)
+	arbor.Proxy(recorder, req, "http://test.local/products")
+
+	if location := recorder.Header().Get("Content-Location"); location != "https://api.example.org/products?page=1" {
+		t.Errorf("Content-Location was not rewritten: %s", location)
+	}
+	links := recorder.Header().Values("Link")
+	if len(links) != 2 || links[0] != `<https://api.example.org/products?page=2>; rel="next", <https://docs.example.org/products>; rel="help"` ||
+		links[1] != `<https://reviews.example.org/products>; rel="related"` {
+		t.Errorf("Link was not rewritten: %q", links)
+	}
+}
@@ -0,0 +1,325 @@
+package arbor
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/redis"
+	"github.com/arbor-dev/arbor/security"
+)
+
+// fakeRedis is a Redis server speaking enough RESP for arbor's stores
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mutex       sync.Mutex
+	values      map[string]string
+	commands    [][]string
+	connections int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, password: password, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mutex.Lock()
+			f.connections++
+			f.mutex.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeRedis) client() *redis.Client {
+	return &redis.Client{Addr: f.listener.Addr().String(), Password: f.password, Timeout: time.Second}
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		f.mutex.Lock()
+		f.commands = append(f.commands, args)
+		var reply string
+		switch command := strings.ToUpper(args[0]); {
+		case command == "AUTH":
+			authenticated = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authenticated {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		default:
+			reply = f.reply(command, args[1:])
+		}
+		f.mutex.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		arg := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:length])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n"
+}
+
+func (f *fakeRedis) reply(command string, args []string) string {
+	switch command {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		if value, ok := f.values[args[0]]; ok {
+			return bulk(value)
+		}
+		return "$-1\r\n"
+	case "SET":
+		if _, exists := f.values[args[0]]; exists && len(args) > 2 && strings.EqualFold(args[len(args)-1], "NX") {
+			return "$-1\r\n"
+		}
+		f.values[args[0]] = args[1]
+		return "+OK\r\n"
+	case "DEL":
+		_, exists := f.values[args[0]]
+		delete(f.values, args[0])
+		if exists {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "SCAN":
+		// One key per page, so clients have to follow the cursor
+		var keys []string
+		for key := range f.values {
+			if strings.HasPrefix(key, strings.TrimSuffix(args[2], "*")) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		cursor, _ := strconv.Atoi(args[0])
+		if cursor >= len(keys) {
+			return "*2\r\n" + bulk("0") + "*0\r\n"
+		}
+		next := strconv.Itoa(cursor + 1)
+		if cursor+1 >= len(keys) {
+			next = "0"
+		}
+		return "*2\r\n" + bulk(next) + "*1\r\n" + bulk(keys[cursor])
+	case "MGET":
+		reply := "*" + strconv.Itoa(len(args)) + "\r\n"
+		for _, key := range args {
+			if value, ok := f.values[key]; ok {
+				reply += bulk(value)
+			} else {
+				reply += "$-1\r\n"
+			}
+		}
+		return reply
+	}
+	return "-ERR unknown command '" + command + "'\r\n"
+}
+
+func (f *fakeRedis) sent(command string) [][]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var sent [][]string
+	for _, args := range f.commands {
+		if strings.EqualFold(args[0], command) {
+			sent = append(sent, args)
+		}
+	}
+	return sent
+}
+
+func TestRedisClientSpeaksRESP(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	client := server.client()
+	defer client.Close()
+
+	if reply, err := client.String("PING"); err != nil || reply != "PONG" {
+		t.Fatalf("expected PONG, got %q (%v)", reply, err)
+	}
+	if auth := server.sent("AUTH"); len(auth) != 1 || auth[0][1] != "secret" {
+		t.Errorf("expected the connection to authenticate once, got %v", auth)
+	}
+
+	// Values are binary safe, including line breaks
+	value := "line\r\nbreak \x00 bytes"
+	if _, err := client.Do("SET", "k", value); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.String("GET", "k"); err != nil || got != value {
+		t.Errorf("expected %q back, got %q (%v)", value, got, err)
+	}
+	if _, err := client.String("GET", "missing"); err != redis.ErrNil {
+		t.Errorf("expected ErrNil for a missing key, got %v", err)
+	}
+	if n, err := client.Int("DEL", "k"); err != nil || n != 1 {
+		t.Errorf("expected 1 key deleted, got %d (%v)", n, err)
+	}
+	if values, err := client.Do("MGET", "a", "b"); err != nil || len(values.([]interface{})) != 2 || values.([]interface{})[0] != nil {
+		t.Errorf("expected an array of nils, got %v (%v)", values, err)
+	}
+
+	_, err := client.Do("NOPE")
+	if replyErr, ok := err.(redis.Error); !ok || !strings.Contains(replyErr.Error(), "unknown command") {
+		t.Errorf("expected the error reply, got %v", err)
+	}
+	server.mutex.Lock()
+	connections := server.connections
+	server.mutex.Unlock()
+	if connections != 1 {
+		t.Errorf("expected error replies to keep the connection, %d were opened", connections)
+	}
+
+	for _, key := range []string{"p:a", "p:b", "p:c", "other"} {
+		client.Do("SET", key, "v")
+	}
+	if keys, err := client.Scan("p:*"); err != nil || strings.Join(keys, ",") != "p:a,p:b,p:c" {
+		t.Errorf("expected SCAN to be followed to its end, got %v (%v)", keys, err)
+	}
+
+	wrong := server.client()
+	wrong.Password = "guess"
+	if _, err := wrong.Do("PING"); err == nil {
+		t.Error("expected a wrong password to be refused")
+	}
+}
+
+func TestRedisClientReconnectsAfterBrokenConnections(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			readCommand(reader)
+			if i == 0 {
+				// A reply cut short leaves the connection in an unknown state
+				io.WriteString(conn, "$10\r\nshort")
+				conn.Close()
+				continue
+			}
+			io.WriteString(conn, "+PONG\r\n")
+			conn.Close()
+		}
+	}()
+	client := &redis.Client{Addr: listener.Addr().String(), Timeout: time.Second}
+	if _, err := client.Do("PING"); err == nil {
+		t.Error("expected a truncated reply to fail")
+	}
+	if reply, err := client.String("PING"); err != nil || reply != "PONG" {
+		t.Errorf("expected a new connection to be used, got %q (%v)", reply, err)
+	}
+}
+
+func TestAPIKeyStores(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Use(fake)()
+
+	server := newFakeRedis(t, "")
+	stores := map[string]security.KeyStore{
+		"memory": security.NewMemoryKeyStore(),
+		"redis":  &security.RedisKeyStore{Client: server.client()},
+	}
+	for name, store := range stores {
+		secret, err := security.IssueAPIKey(store, security.APIKey{Client: "reports", Routes: []string{"Reports"}, Expires: fake.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		hash := security.HashAPIKey(secret)
+		if key, err := security.AuthorizeAPIKey(store, secret, "Reports", "GET"); err != nil || key.Client != "reports" {
+			t.Errorf("%s: expected the key to be authorized, got %v", name, err)
+		}
+		if _, err := security.AuthorizeAPIKey(store, secret, "Admin", "GET"); err != security.ErrKeyNotPermitted {
+			t.Errorf("%s: expected another route to be refused, got %v", name, err)
+		}
+
+		// A grace period longer than the key had left does not extend it
+		replacement, err := security.RotateAPIKey(store, hash, 24*time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		old, err := store.Get(hash)
+		if err != nil || !old.Expires.Equal(fake.Now().Add(time.Hour)) {
+			t.Errorf("%s: expected the old key to keep its expiry, got %v (%v)", name, old.Expires, err)
+		}
+		// A shorter grace period brings it forward
+		security.RotateAPIKey(store, security.HashAPIKey(replacement), time.Minute)
+		if key, _ := store.Get(security.HashAPIKey(replacement)); !key.Expires.Equal(fake.Now().Add(time.Minute)) {
+			t.Errorf("%s: expected the grace period to shorten the expiry, got %v", name, key.Expires)
+		}
+
+		if keys, err := store.List(); err != nil || len(keys) != 3 {
+			t.Errorf("%s: expected 3 keys, got %d (%v)", name, len(keys), err)
+		}
+		if err := store.Delete(hash); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err := store.Delete(hash); err != security.ErrKeyNotFound {
+			t.Errorf("%s: expected deleting twice to report ErrKeyNotFound, got %v", name, err)
+		}
+	}
+
+	// Redis expires keys with them
+	for _, set := range server.sent("SET") {
+		if len(set) != 5 || set[3] != "PX" {
+			t.Errorf("expected keys to be stored with their expiry, got %v", set)
+		}
+	}
+	if first := server.sent("SET")[0]; first[4] != "3600000" {
+		t.Errorf("expected the first key to expire in an hour, got %v", first)
+	}
+}
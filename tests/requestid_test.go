@@ -0,0 +1,64 @@
+package arbor
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/requestid"
+	"github.com/arbor-dev/arbor/server"
+)
+
+func TestRequestIDForwarded(t *testing.T) {
+	var forwarded string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Request-ID")
+	}))
+	defer backend.Close()
+
+	routes := arbor.RouteCollection{
+		arbor.Route{
+			Name:    "Echo",
+			Method:  "GET",
+			Pattern: "/echo",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				arbor.GET(w, backend.URL, "RAW", "", r)
+			},
+		},
+	}
+	gateway := httptest.NewServer(server.NewRouter(routes.ToServiceRoutes()))
+	defer gateway.Close()
+
+	res, err := http.Get(gateway.URL + "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := res.Header.Get("X-Request-ID")
+	if generated == "" || generated != forwarded {
+		t.Errorf("Expected generated ID %q to be forwarded, got %q", generated, forwarded)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/echo", nil)
+	req.Header.Set("X-Request-ID", "client-supplied-id")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("X-Request-ID") != "client-supplied-id" || forwarded != "client-supplied-id" {
+		t.Errorf("Expected incoming ID to be honored, got %q and %q", res.Header.Get("X-Request-ID"), forwarded)
+	}
+}
+
+func TestRequestIDsAreGeneratedWithoutEntropy(t *testing.T) {
+	defer func(entropy io.Reader) { requestid.Entropy = entropy }(requestid.Entropy)
+	requestid.Entropy = iotest.ErrReader(errors.New("no entropy"))
+
+	first, second := requestid.Generate(), requestid.Generate()
+	if !requestid.IsValid(first) || !requestid.IsValid(second) || first == second {
+		t.Errorf("Expected distinct valid IDs without entropy, got %q and %q", first, second)
+	}
+}
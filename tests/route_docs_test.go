@@ -0,0 +1,60 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor/openapi"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestRouteDocsFlowIntoOpenAPIAndListings(t *testing.T) {
+	server.RoutesPath = "/admin/routes"
+	defer func() { server.RoutesPath = "" }()
+
+	routes := services.RouteCollection{
+		{Name: "ListOrders", Method: "GET", Pattern: "/orders", Docs: &services.RouteDocs{
+			Summary: "Lists orders", Tags: []string{"orders"}, Owner: "checkout", Contact: "#checkout",
+		}},
+		{Name: "LegacyOrders", Method: "GET", Pattern: "/v1/orders", Docs: &services.RouteDocs{
+			Owner: "checkout", Deprecated: "use GET /orders", Sunset: "2027-03-01",
+		}},
+		{Name: "OldCart", Method: "GET", Pattern: "/v1/cart", Docs: &services.RouteDocs{
+			Owner: "cart", Deprecated: "use GET /cart", Sunset: "2026-12-01",
+		}},
+		{Name: "Health", Method: "GET", Pattern: "/ping"},
+	}
+
+	doc := openapi.FromRoutes(routes, openapi.Info{Title: "t", Version: "1"})
+	if op := doc.Paths["/orders"].Get; op.Summary != "Lists orders" || op.Owner != "checkout" || op.Contact != "#checkout" || len(op.Tags) != 1 {
+		t.Errorf("expected the route's docs in its operation, got %+v", op)
+	}
+	if op := doc.Paths["/v1/orders"].Get; !op.Deprecated || op.Sunset != "2027-03-01" {
+		t.Errorf("expected the deprecated operation to be marked, got %+v", op)
+	}
+
+	router := server.NewRouter(routes)
+	list := func(path string) []server.RouteListing {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, http.NoBody)
+		req.RemoteAddr = "127.0.0.1:1234"
+		router.ServeHTTP(recorder, req)
+		var listings []server.RouteListing
+		if err := json.NewDecoder(recorder.Body).Decode(&listings); err != nil {
+			t.Fatalf("expected a listing at %s, got %d: %v", path, recorder.Code, err)
+		}
+		return listings
+	}
+	if all := list("/admin/routes"); len(all) != 4 || all[0].Owner != "checkout" {
+		t.Errorf("expected every route listed with its owner, got %+v", all)
+	}
+	if owned := list("/admin/routes?owner=cart"); len(owned) != 1 || owned[0].Name != "OldCart" {
+		t.Errorf("expected the routes of a team, got %+v", owned)
+	}
+	if report := list("/admin/routes/deprecated"); len(report) != 2 || report[0].Name != "OldCart" || report[1].Name != "LegacyOrders" {
+		t.Errorf("expected the deprecated routes soonest sunset first, got %+v", report)
+	}
+}
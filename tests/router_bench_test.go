@@ -0,0 +1,95 @@
+package arbor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/gorilla/mux"
+)
+
+func benchmarkRoutes(n int) arbor.RouteCollection {
+	routes := make(arbor.RouteCollection, 0, 2*n)
+	for i := 0; i < n; i++ {
+		routes = append(routes,
+			arbor.Route{Name: fmt.Sprintf("List%d", i), Method: "GET", Pattern: fmt.Sprintf("/service%d/items", i), Handler: func(w http.ResponseWriter, r *http.Request) {}},
+			arbor.Route{Name: fmt.Sprintf("Get%d", i), Method: "GET", Pattern: fmt.Sprintf("/service%d/items/{id:[0-9]+}", i), Handler: func(w http.ResponseWriter, r *http.Request) {}},
+		)
+	}
+	return routes
+}
+
+func benchmarkRouter(b *testing.B, router http.Handler, n int) {
+	logLevel := logger.LogLevel
+	logger.LogLevel = logger.FATAL
+	defer func() { logger.LogLevel = logLevel }()
+
+	r := httptest.NewRequest("GET", fmt.Sprintf("/service%d/items/42", n-1), nil)
+	w := httptest.NewRecorder()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkRouteTable(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 5000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			benchmarkRouter(b, server.NewTrieRouter(benchmarkRoutes(n).ToServiceRoutes()), n)
+		})
+	}
+}
+
+// BenchmarkLinearMux matches the same routes with a plain mux.Router for comparison
+func BenchmarkLinearMux(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 5000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			router := mux.NewRouter()
+			for _, route := range benchmarkRoutes(n) {
+				router.Methods(route.Method).Path(route.Pattern).Name(route.Name).Handler(route.Handler)
+			}
+			benchmarkRouter(b, router, n)
+		})
+	}
+}
+
+func TestRouteTableMatchesFirstRegistered(t *testing.T) {
+	var reached string
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			reached = name + ":" + mux.Vars(r)["id"]
+		}
+	}
+	routes := arbor.RouteCollection{
+		arbor.Route{Name: "Product", Method: "GET", Pattern: "/products/{id}", Handler: handler("Product")},
+		arbor.Route{Name: "NewProduct", Method: "GET", Pattern: "/products/new", Handler: handler("NewProduct")},
+		arbor.Route{Name: "Files", Method: "GET", Pattern: "/files/{id:.*}", Handler: handler("Files")},
+	}.ToServiceRoutes()
+
+	for name, router := range map[string]http.Handler{
+		"NewTrieRouter": server.NewTrieRouter(routes),
+		"NewRouter":     server.NewRouter(routes),
+	} {
+		for path, expected := range map[string]string{
+			"/products/new": "Product:new",
+			"/products/7":   "Product:7",
+			"/files/a/b":    "Files:a/b",
+		} {
+			reached = ""
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+			if reached != expected {
+				t.Errorf("%s: for %s expected %s, got %s", name, path, expected, reached)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/products/7", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected %d for unregistered method, got %d", name, http.StatusNotFound, w.Code)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestHeaderRoutingRules(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://users-v1.local/users", httpmock.NewStringResponder(200, "v1"))
+	httpmock.RegisterResponder("GET", "http://users-v2.local/users", httpmock.NewStringResponder(200, "v2"))
+	httpmock.RegisterResponder("GET", "http://acme.local/users", httpmock.NewStringResponder(200, "acme"))
+
+	proxy.BackendHeaderRules["users-v1.local"] = []proxy.HeaderRule{
+		{Header: "X-Tenant", Value: "acme", Backend: "http://acme.local"},
+		{Header: "X-API-Version", Value: "2", Backend: "http://users-v2.local"},
+	}
+	defer delete(proxy.BackendHeaderRules, "users-v1.local")
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/users", http.NoBody)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		arbor.GET(recorder, "http://users-v1.local/users", "RAW", "", req)
+		return recorder
+	}
+
+	cases := []struct {
+		headers  map[string]string
+		expected string
+	}{
+		{nil, "v1"},
+		{map[string]string{"X-API-Version": "2"}, "v2"},
+		{map[string]string{"X-API-Version": "3"}, "v1"},
+		{map[string]string{"X-API-Version": "2", "X-Tenant": "acme"}, "acme"},
+	}
+	for _, c := range cases {
+		recorder := get(c.headers)
+		if recorder.Body.String() != c.expected {
+			t.Errorf("%v was routed to %q, expected %q", c.headers, recorder.Body.String(), c.expected)
+		}
+		if vary := recorder.Header().Values("Vary"); len(vary) < 2 || vary[0] != "X-Tenant" || vary[1] != "X-Api-Version" {
+			t.Errorf("response does not vary by the rule headers: %v", recorder.Header().Values("Vary"))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package arbor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestSagaCompensatesSucceededSteps(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var reserved string
+	httpmock.RegisterResponder("POST", "http://orders.local/orders", func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		reserved = string(body)
+		return httpmock.NewStringResponse(201, `{"id":"o-1"}`), nil
+	})
+	cancelled := 0
+	httpmock.RegisterResponder("DELETE", "http://orders.local/orders/o-1", func(req *http.Request) (*http.Response, error) {
+		cancelled++
+		return httpmock.NewStringResponse(204, ""), nil
+	})
+	httpmock.RegisterResponder("POST", "http://payments.local/users/7/charges", httpmock.NewStringResponder(402, ""))
+
+	saga := arbor.Saga{Sequential: true, Steps: []arbor.SagaStep{
+		{Name: "order", URL: "http://orders.local/orders", BodyField: "order",
+			Compensation: &arbor.Compensation{URL: "http://orders.local/orders/{id}"}},
+		{Name: "payment", URL: "http://payments.local/users/{user}/charges", BodyField: "payment"},
+		{Name: "shipment", URL: "http://shipping.local/shipments"},
+	}}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Checkout",
+		Method:  "POST",
+		Pattern: "/users/{user}/checkout",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.RunSaga(w, r, saga, "")
+		},
+	}})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/users/7/checkout", strings.NewReader(`{"order":{"sku":"a"},"payment":{"amount":5}}`)))
+	if recorder.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected the failed step's 402, got %d", recorder.Code)
+	}
+	if reserved != `{"sku":"a"}` {
+		t.Errorf("expected the order step to be sent its field of the body, got %q", reserved)
+	}
+	if cancelled != 1 {
+		t.Errorf("expected the order to be cancelled once, it was cancelled %d times", cancelled)
+	}
+	var response struct {
+		Details struct {
+			Outcome string              `json:"outcome"`
+			Steps   []arbor.StepOutcome `json:"steps"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Details.Outcome != arbor.SagaCompensated || len(response.Details.Steps) != 3 {
+		t.Fatalf("unexpected outcome %+v", response.Details)
+	}
+	for i, status := range []string{"compensated", "failed", "skipped"} {
+		if response.Details.Steps[i].Status != status {
+			t.Errorf("expected step %d to be %s, got %s", i, status, response.Details.Steps[i].Status)
+		}
+	}
+
+	httpmock.RegisterResponder("POST", "http://payments.local/users/7/charges", httpmock.NewStringResponder(201, `{"charged":5}`))
+	httpmock.RegisterResponder("POST", "http://shipping.local/shipments", httpmock.NewStringResponder(201, ""))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/users/7/checkout", strings.NewReader(`{"order":{"sku":"a"},"payment":{"amount":5}}`)))
+	var outcome arbor.SagaOutcome
+	if err := json.NewDecoder(recorder.Body).Decode(&outcome); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("expected the saga to commit, got %d: %v", recorder.Code, err)
+	}
+	if outcome.Outcome != arbor.SagaCommitted || string(outcome.Steps[1].Response) != `{"charged":5}` {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+}
@@ -0,0 +1,46 @@
+package arbor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arbor-dev/arbor/schema"
+)
+
+const productSchema = `{
+	"type": "object",
+	"required": ["name", "price"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer", "minimum": 0},
+		"name": {"type": "string", "minLength": 1},
+		"price": {"type": "number", "exclusiveMinimum": 0, "multipleOf": 0.01},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true}
+	},
+	"$defs": {"tag": {"type": "string", "pattern": "^[a-z]+$"}}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := schema.Compile([]byte(productSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := s.ValidateJSON([]byte(`{"id":0,"name":"Test Product","price":9.99,"tags":["new","sale"]}`))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("valid body was rejected: %v %v", errs, err)
+	}
+
+	errs, _ = s.ValidateJSON([]byte(`{"id":1.5,"price":-1,"tags":["new","new","Sale"],"colour":"red"}`))
+	expected := []schema.FieldError{
+		{Field: "/name", Message: "is required"},
+		{Field: "/colour", Message: "is not allowed"},
+		{Field: "/id", Message: "must be of type integer, got number"},
+		{Field: "/price", Message: "must be greater than 0"},
+		{Field: "/tags", Message: "must have unique items, 0 and 1 are equal"},
+		{Field: "/tags/2", Message: "must match ^[a-z]+$"},
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("expected %v, got %v", expected, errs)
+	}
+}
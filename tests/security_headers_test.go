@@ -0,0 +1,49 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestSecurityHeadersOnEveryResponse(t *testing.T) {
+	server.ContentSecurityPolicy = "default-src 'none'"
+	defer func() { server.ContentSecurityPolicy = "" }()
+
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "API", Method: "GET", Pattern: "/api", Handler: func(w http.ResponseWriter, r *http.Request) {
+			// Backends' headers are replaced rather than repeated
+			w.Header().Add("X-Frame-Options", "SAMEORIGIN")
+			w.Write([]byte("{}"))
+		}},
+		{Name: "Widget", Method: "GET", Pattern: "/widget", SecurityHeaders: map[string]string{
+			"X-Frame-Options":         "",
+			"content-security-policy": "default-src 'self'",
+		}, Handler: func(w http.ResponseWriter, r *http.Request) {}},
+	})
+	get := func(path string) http.Header {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", path, http.NoBody))
+		return recorder.Header()
+	}
+
+	for _, path := range []string{"/api", "/missing"} {
+		headers := get(path)
+		if len(headers["X-Frame-Options"]) != 1 || headers.Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: expected X-Frame-Options DENY, got %v", path, headers["X-Frame-Options"])
+		}
+		if headers.Get("X-Content-Type-Options") != "nosniff" || headers.Get("Strict-Transport-Security") == "" {
+			t.Errorf("%s: missing security headers in %v", path, headers)
+		}
+		if headers.Get("Content-Security-Policy") != "default-src 'none'" {
+			t.Errorf("%s: expected the gateway's policy, got %q", path, headers.Get("Content-Security-Policy"))
+		}
+	}
+	widget := get("/widget")
+	if _, framed := widget["X-Frame-Options"]; framed || widget.Get("Content-Security-Policy") != "default-src 'self'" {
+		t.Errorf("expected the route's overrides, got %v", widget)
+	}
+}
@@ -0,0 +1,73 @@
+package arbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestWritesToAResourceAreSerialized(t *testing.T) {
+	var mutex sync.Mutex
+	inFlight := map[string]int{}
+	overlapped := map[string]bool{}
+	var order []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := strings.TrimPrefix(req.URL.Path, "/documents/")
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		inFlight[id]++
+		overlapped[id] = overlapped[id] || inFlight[id] > 1
+		if id == "1" {
+			order = append(order, string(body))
+		}
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mutex.Lock()
+		inFlight[id]--
+		mutex.Unlock()
+	}))
+	defer backend.Close()
+
+	route := services.Route{Name: "Document", Method: "PUT", Pattern: "/documents/{id}", Handler: func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, backend.URL+r.URL.Path)
+	}}
+	put := func(router http.Handler) {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			for _, id := range []string{"1", "2"} {
+				wg.Add(1)
+				go func(id string, body string) {
+					defer wg.Done()
+					router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PUT", "/documents/"+id, strings.NewReader(body)))
+				}(id, strconv.Itoa(i))
+			}
+			// Let each write arrive before the next
+			time.Sleep(5 * time.Millisecond)
+		}
+		wg.Wait()
+	}
+
+	put(server.NewRouter(services.RouteCollection{route}))
+	if !overlapped["1"] {
+		t.Fatalf("writes to the same resource were not concurrent without serialization")
+	}
+
+	overlapped, order = map[string]bool{}, nil
+	route.SerializeWritesBy = "id"
+	put(server.NewRouter(services.RouteCollection{route}))
+	if overlapped["1"] || overlapped["2"] {
+		t.Errorf("writes to the same resource were interleaved: %v", overlapped)
+	}
+	if strings.Join(order, ",") != "0,1,2,3" {
+		t.Errorf("writes were not forwarded in the order they arrived: %v", order)
+	}
+}
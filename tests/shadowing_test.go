@@ -0,0 +1,58 @@
+package arbor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestShadowingMirrorsRequests(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "primary")
+	}))
+	defer primary.Close()
+	mirrored := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.Path + " " + string(body) + " " + r.Header.Get(proxy.ShadowHeader)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	proxy.BackendShadows = map[string]proxy.Shadow{
+		strings.TrimPrefix(primary.URL, "http://"): {Backend: shadow.URL + "/v2", Rate: 1, Methods: []string{"POST"}},
+	}
+	defer func() { proxy.BackendShadows = map[string]proxy.Shadow{} }()
+
+	send := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "http://gateway.local/orders", strings.NewReader("order"))
+		arbor.Proxy(recorder, req, primary.URL+"/orders")
+		return recorder
+	}
+
+	if recorder := send("POST"); recorder.Body.String() != "primary" {
+		t.Errorf("shadow affected the response: %d %q", recorder.Code, recorder.Body.String())
+	}
+	select {
+	case request := <-mirrored:
+		if request != "POST /v2/orders order true" {
+			t.Errorf("unexpected mirrored request %q", request)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not mirrored")
+	}
+
+	send("GET")
+	select {
+	case request := <-mirrored:
+		t.Errorf("request with a method which is not shadowed was mirrored: %q", request)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,125 @@
+package arbor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy/constants"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestRouteBodySizeLimits(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://test.local/notes", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		return httpmock.NewBytesResponse(200, body), nil
+	})
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/notes")
+	}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Note", Method: "POST", Pattern: "/notes", Handler: handler, MaxBodySize: 10},
+		{Name: "Large", Method: "POST", Pattern: "/large", Handler: handler},
+	})
+	post := func(path string, body string, chunked bool) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if chunked {
+			req.ContentLength = -1
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if recorder := post("/notes", "short", false); recorder.Code != http.StatusOK || recorder.Body.String() != "short" {
+		t.Errorf("body within the limit was rejected: %d %q", recorder.Code, recorder.Body.String())
+	}
+	for _, chunked := range []bool{false, true} {
+		recorder := post("/notes", "far too long for the route", chunked)
+		var body struct {
+			Status  int `json:"status"`
+			Details struct {
+				Limit int `json:"limit"`
+			} `json:"details"`
+		}
+		json.NewDecoder(recorder.Body).Decode(&body)
+		if recorder.Code != http.StatusRequestEntityTooLarge || body.Details.Limit != 10 {
+			t.Errorf("oversized body (chunked %v) was not rejected with the limit: %d %+v", chunked, recorder.Code, body)
+		}
+	}
+	if recorder := post("/large", "far too long for the other route", false); recorder.Code != http.StatusOK {
+		t.Errorf("route without a limit rejected a small body: %d", recorder.Code)
+	}
+}
+
+func TestOversizedBodiesAreNeverTruncated(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	forwarded := 0
+	httpmock.RegisterResponder("POST", "http://test.local/notes", func(req *http.Request) (*http.Response, error) {
+		forwarded++
+		return httpmock.NewStringResponse(200, ""), nil
+	})
+
+	// Without the bodysize middleware the body is only checked where it is read
+	skip := &services.MiddlewareOverrides{Skip: []string{"bodysize"}}
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "Raw", Method: "POST", Pattern: "/raw", MaxBodySize: 10, Middlewares: skip, Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://test.local/notes")
+		}},
+		{Name: "JSON", Method: "POST", Pattern: "/json", MaxBodySize: 10, Middlewares: skip, Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://test.local/notes", arbor.WithFormat("JSON"))
+		}},
+	})
+	for _, path := range []string{"/raw", "/json"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", path, strings.NewReader(`{"note": "far too long"}`)))
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("oversized body to %s was not rejected: %d", path, recorder.Code)
+		}
+	}
+	if forwarded != 0 {
+		t.Errorf("%d truncated bodies were forwarded", forwarded)
+	}
+}
+
+func TestUnconfiguredJSONRoutesAcceptRequestSizedBodies(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("POST", "http://test.local/notes", httpmock.NewStringResponder(200, ""))
+
+	router := server.NewRouter(services.RouteCollection{
+		{Name: "JSON", Method: "POST", Pattern: "/json", Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://test.local/notes", arbor.WithFormat("JSON"))
+		}},
+		{Name: "Upload", Method: "POST", Pattern: "/upload", Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://test.local/notes")
+		}},
+	})
+	post := func(path string, size int) int {
+		body := `"` + strings.Repeat("a", size-2) + `"`
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return recorder.Code
+	}
+
+	if code := post("/json", constants.MaxRequestSize); code != http.StatusOK {
+		t.Errorf("expected a JSON body of the request size to be accepted, got %d", code)
+	}
+	if code := post("/json", constants.MaxRequestSize+1); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a JSON body over the request size to be rejected, got %d", code)
+	}
+	if code := post("/upload", constants.MaxRequestSize+1); code != http.StatusOK {
+		t.Errorf("expected an upload over the request size to be accepted, got %d", code)
+	}
+}
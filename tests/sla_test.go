@@ -0,0 +1,64 @@
+package arbor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestSLAAbortsSlowBackends(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+
+	proxy.BackendPools["search"] = &proxy.Pool{Instances: []proxy.Instance{{URL: slow.URL}, {URL: fast.URL}}}
+	defer delete(proxy.BackendPools, "search")
+
+	sla := &services.SLAPolicy{Timeout: 50 * time.Millisecond, Retry: true}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Search",
+		Method:  "GET",
+		Pattern: "/search",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://search/search")
+		},
+		SLA: sla,
+	}})
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/search", http.NoBody))
+		return recorder
+	}
+
+	start := time.Now()
+	if recorder := get(); recorder.Code != http.StatusOK || recorder.Body.String() != "fast" {
+		t.Errorf("request was not retried on another instance: %d %q", recorder.Code, recorder.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow instance was waited for: %s", elapsed)
+	}
+
+	sla.Retry = false
+	// Round robin sends every other request to the slow instance
+	codes := []int{get().Code, get().Code}
+	if (codes[0] == http.StatusGatewayTimeout) == (codes[1] == http.StatusGatewayTimeout) {
+		t.Errorf("expected one request to be aborted with 504, got %v", codes)
+	}
+}
@@ -0,0 +1,95 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/features"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestSnapshotsRestoreRuntimeState(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	server.SnapshotPath = "/admin/snapshot"
+	server.SnapshotKey = []byte("shared between instances")
+	health.AdminToken = "admin-token"
+	defer func() {
+		server.SnapshotPath = ""
+		server.SnapshotKey = nil
+		health.AdminToken = ""
+	}()
+	features.Register("TestSnapshotGate", features.Spec{Stage: features.Alpha})
+	features.Set("TestSnapshotGate", true)
+	defer features.Set("TestSnapshotGate", false)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	items := services.Route{Name: "Items", Method: "GET", Pattern: "/items", Handler: handler}
+	orders := services.Route{Name: "Orders", Method: "GET", Pattern: "/orders", Handler: handler}
+	serveAs := func(router http.Handler, method string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/admin/snapshot", strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	serve := func(router http.Handler, method string, body string) *httptest.ResponseRecorder {
+		return serveAs(router, method, body, map[string]string{"Authorization": "Bearer admin-token"})
+	}
+
+	exported := serve(server.NewRouter(services.RouteCollection{items, orders}), "GET", "")
+	var signed server.SignedSnapshot
+	if err := json.Unmarshal(exported.Body.Bytes(), &signed); err != nil || exported.Code != http.StatusOK {
+		t.Fatalf("expected a snapshot, got %d %s", exported.Code, exported.Body)
+	}
+	var snapshot server.Snapshot
+	json.Unmarshal(signed.Snapshot, &snapshot)
+	if !snapshot.Features["TestSnapshotGate"] || len(snapshot.Routes) != 2 || snapshot.Cache == nil {
+		t.Errorf("expected the snapshot to hold the gates, routes and cache stats, got %s", signed.Snapshot)
+	}
+
+	features.Set("TestSnapshotGate", false)
+	for name, headers := range map[string]map[string]string{
+		"without a token":     {},
+		"from another origin": {"Authorization": "Bearer admin-token", "Origin": "http://attacker.example"},
+	} {
+		if code := serveAs(server.NewRouter(services.RouteCollection{items}), "POST", exported.Body.String(), headers).Code; code != http.StatusForbidden {
+			t.Errorf("expected an import %s to be refused, got %d", name, code)
+		}
+	}
+	if features.Enabled("TestSnapshotGate") {
+		t.Error("expected refused imports not to restore the feature gates")
+	}
+	imported := serve(server.NewRouter(services.RouteCollection{items}), "POST", exported.Body.String())
+	var result server.SnapshotImport
+	json.Unmarshal(imported.Body.Bytes(), &result)
+	if imported.Code != http.StatusOK || !features.Enabled("TestSnapshotGate") {
+		t.Errorf("expected the snapshot's feature gates to be restored, got %d %s", imported.Code, imported.Body)
+	}
+	if !strings.Contains(strings.Join(result.Differences, "\n"), "route Orders (GET /orders) is not served") {
+		t.Errorf("expected the missing route to be reported, got %v", result.Differences)
+	}
+
+	tampered := strings.Replace(exported.Body.String(), `"TestSnapshotGate":true`, `"TestSnapshotGate":false`, 1)
+	if code := serve(server.NewRouter(services.RouteCollection{items}), "POST", tampered).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a tampered snapshot to be refused, got %d", code)
+	}
+
+	if code := serve(server.NewRouter(services.RouteCollection{items}), "POST", exported.Body.String()).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a snapshot to only be imported once, got %d", code)
+	}
+	stale := serve(server.NewRouter(services.RouteCollection{items}), "GET", "")
+	fake.Advance(server.SnapshotMaxAge + time.Second)
+	if code := serve(server.NewRouter(services.RouteCollection{items}), "POST", stale.Body.String()).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a snapshot older than the max age to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,143 @@
+package arbor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+	"github.com/arbor-dev/arbor/spiffe"
+)
+
+func issueSVID(t *testing.T, id string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+	if id == "" {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		uri, _ := neturl.Parse(id)
+		template.URIs = []*neturl.URL{uri}
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSPIFFESourceVerify(t *testing.T) {
+	if _, err := spiffe.ParseID("spiffe://example.org/gateway/"); err == nil {
+		t.Error("ID with trailing slash was accepted")
+	}
+
+	ca, caKey := issueSVID(t, "", nil, nil)
+	svid, svidKey := issueSVID(t, "spiffe://example.org/arbor", ca, caKey)
+	backend, _ := issueSVID(t, "spiffe://example.org/products", ca, caKey)
+	otherCA, otherKey := issueSVID(t, "", nil, nil)
+	impostor, _ := issueSVID(t, "spiffe://example.org/products", otherCA, otherKey)
+
+	dir := t.TempDir()
+	keyDER, _ := x509.MarshalECPrivateKey(svidKey)
+	source := &spiffe.Source{
+		CertFile:   filepath.Join(dir, "svid.pem"),
+		KeyFile:    filepath.Join(dir, "svid_key.pem"),
+		BundleFile: filepath.Join(dir, "bundle.pem"),
+	}
+	writePEM(t, source.CertFile, "CERTIFICATE", svid.Raw)
+	writePEM(t, source.KeyFile, "EC PRIVATE KEY", keyDER)
+	writePEM(t, source.BundleFile, "CERTIFICATE", ca.Raw)
+
+	if id, err := source.ID(); err != nil || id.String() != "spiffe://example.org/arbor" {
+		t.Fatalf("unexpected own ID %v (%v)", id, err)
+	}
+	if id, err := source.Verify([]*x509.Certificate{backend}); err != nil || id.Path != "/products" {
+		t.Errorf("backend SVID was not verified: %v %v", id, err)
+	}
+	if _, err := source.Verify([]*x509.Certificate{impostor}); err == nil {
+		t.Error("SVID from another CA was verified")
+	}
+}
+
+func TestBackendsAreConnectedToWithTheWorkloadSVID(t *testing.T) {
+	ca, caKey := issueSVID(t, "", nil, nil)
+	svid, svidKey := issueSVID(t, "spiffe://example.org/arbor", ca, caKey)
+	backendCert, backendKey := issueSVID(t, "spiffe://example.org/products", ca, caKey)
+
+	dir := t.TempDir()
+	keyDER, _ := x509.MarshalECPrivateKey(svidKey)
+	source := &spiffe.Source{
+		CertFile:   filepath.Join(dir, "svid.pem"),
+		KeyFile:    filepath.Join(dir, "svid_key.pem"),
+		BundleFile: filepath.Join(dir, "bundle.pem"),
+	}
+	writePEM(t, source.CertFile, "CERTIFICATE", svid.Raw)
+	writePEM(t, source.KeyFile, "EC PRIVATE KEY", keyDER)
+	writePEM(t, source.BundleFile, "CERTIFICATE", ca.Raw)
+
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := spiffe.IDFromCertificate(r.TLS.PeerCertificates[0])
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"caller":"`+id.String()+`"}`)
+	}))
+	backend.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{backendCert.Raw}, PrivateKey: backendKey}},
+		ClientAuth:   tls.RequireAnyClientCert,
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	proxy.WorkloadIdentity = source
+	defer func() { proxy.WorkloadIdentity = nil }()
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Products",
+		Method:  "GET",
+		Pattern: "/products",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.GET(w, backend.URL+"/products", "JSON", "", r)
+		},
+	}})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/products", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != `{"caller":"spiffe://example.org/arbor"}` {
+		t.Errorf("expected the backend to be presented arbor's SVID, got %d %s", recorder.Code, recorder.Body)
+	}
+}
@@ -0,0 +1,72 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestSuccessStatusesPassThrough(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	respond := func(status int, body string, header http.Header) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(status, body)
+			for k, vs := range header {
+				resp.Header[k] = vs
+			}
+			return resp, nil
+		}
+	}
+	httpmock.RegisterResponder("POST", "http://test.local/products", respond(http.StatusCreated, `{"id":1}`, http.Header{"Location": {"/products/1"}, "Content-Type": {"application/json"}}))
+	httpmock.RegisterResponder("PUT", "http://test.local/products", respond(http.StatusAccepted, `{"queued":true}`, http.Header{"Content-Type": {"application/json"}}))
+	httpmock.RegisterResponder("DELETE", "http://test.local/products", respond(http.StatusNoContent, "", nil))
+	httpmock.RegisterResponder("PATCH", "http://test.local/products", respond(http.StatusNoContent, "ignored", nil))
+	httpmock.RegisterResponder("GET", "http://test.local/products", respond(http.StatusPartialContent, strings.Repeat("a", 2048)[:1024],
+		http.Header{"Content-Range": {"bytes 0-1023/2048"}, "Content-Type": {"text/plain"}}))
+
+	proxy.Compression = true
+	defer func() { proxy.Compression = false }()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		arbor.Proxy(w, r, "http://test.local/products", arbor.WithFormat("JSON"))
+	}
+	var routes services.RouteCollection
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		routes = append(routes, services.Route{Name: method, Method: method, Pattern: "/products", Handler: handler})
+	}
+	router := server.NewRouter(routes)
+
+	for _, test := range []struct {
+		method string
+		status int
+		body   string
+		header string
+		value  string
+	}{
+		{"POST", http.StatusCreated, `{"id":1}`, "Location", "/products/1"},
+		{"PUT", http.StatusAccepted, `{"queued":true}`, "Content-Type", "application/json"},
+		{"DELETE", http.StatusNoContent, "", "", ""},
+		{"PATCH", http.StatusNoContent, "", "", ""},
+		{"GET", http.StatusPartialContent, strings.Repeat("a", 1024), "Content-Range", "bytes 0-1023/2048"},
+	} {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(test.method, "/products", http.NoBody)
+		req.Header.Set("Accept-Encoding", "gzip")
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != test.status || recorder.Body.String() != test.body {
+			t.Errorf("%s was not passed through: %d %q", test.method, recorder.Code, recorder.Body.String())
+		}
+		if test.header != "" && recorder.Header().Get(test.header) != test.value {
+			t.Errorf("%s lost its %s header: %q", test.method, test.header, recorder.Header().Get(test.header))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package arbor
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestTransformStreamFiltersEventsAsTheyArrive(t *testing.T) {
+	more := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: payment\ndata: {\"amount\": 5, \"card\": \"4111\"}\n\ndata: not json\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"amount\": 5, \"card\": \"4111\"}\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-more:
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprint(w, "{\"amount\": 0}\n{\"amount\": 7, \"card\": \"5500\"}")
+	}))
+	defer func() {
+		backend.CloseClientConnections()
+		backend.Close()
+	}()
+
+	transformation := arbor.StreamTransformation{URL: backend.URL + "/{stream}", Transforms: []arbor.StreamTransform{
+		arbor.FilterJSON(func(r *http.Request, data map[string]interface{}) bool {
+			return data["amount"] != 0.0
+		}),
+		arbor.MapJSON(func(r *http.Request, data map[string]interface{}) map[string]interface{} {
+			delete(data, "card")
+			return data
+		}),
+	}}
+	router := server.NewRouter(services.RouteCollection{{
+		Name:    "Payments",
+		Method:  "GET",
+		Pattern: "/{stream}",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.TransformStream(w, r, transformation, "")
+		},
+	}})
+	gateway := httptest.NewServer(router)
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewReader(resp.Body)
+	// The first event arrives while the backend is still streaming
+	if line, _ := lines.ReadString('\n'); line != "{\"amount\":5}\n" {
+		t.Fatalf("expected the first event redacted, got %q", line)
+	}
+	close(more)
+	if rest, _ := ioutil.ReadAll(lines); string(rest) != "{\"amount\":7}\n" {
+		t.Errorf("expected the remaining events filtered and redacted, got %q", rest)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/events", http.NoBody))
+	if body := recorder.Body.String(); body != "event: payment\ndata: {\"amount\":5}\n\n" {
+		t.Errorf("expected the Server-Sent Event redacted and the unreadable one dropped, got %q", body)
+	}
+}
@@ -0,0 +1,78 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/proxy"
+)
+
+func TestThrottledRequestsAreRetried(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	calls := 0
+	retryAfter := "0"
+	httpmock.RegisterResponder("GET", "http://retry.local/products", func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls%2 == 1 {
+			resp := httpmock.NewStringResponse(http.StatusTooManyRequests, "")
+			resp.Header.Set("Retry-After", retryAfter)
+			return resp, nil
+		}
+		return httpmock.NewStringResponse(200, "[]"), nil
+	})
+	proxy.BackendThrottling["retry.local"] = proxy.Throttling{Action: proxy.RetryThrottled, MaxWait: time.Second}
+	defer delete(proxy.BackendThrottling, "retry.local")
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/products", http.NoBody)
+		arbor.Proxy(recorder, req, "http://retry.local/products")
+		return recorder
+	}
+	if recorder := get(); recorder.Code != http.StatusOK || calls != 2 {
+		t.Errorf("throttled request was not retried: %d after %d calls", recorder.Code, calls)
+	}
+	calls, retryAfter = 0, "60"
+	if recorder := get(); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "60" || calls != 1 {
+		t.Errorf("throttled request was retried beyond the longest wait: %d after %d calls", recorder.Code, calls)
+	}
+}
+
+func TestThrottlingBackendsArePaused(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	fake := clock.NewFake(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	defer clock.Use(fake)()
+	calls := 0
+	httpmock.RegisterResponder("GET", "http://pause.local/products", func(req *http.Request) (*http.Response, error) {
+		calls++
+		resp := httpmock.NewStringResponse(http.StatusTooManyRequests, "")
+		resp.Header.Set("Retry-After", "30")
+		return resp, nil
+	})
+	proxy.BackendThrottling["pause.local"] = proxy.Throttling{Action: proxy.PauseThrottled, MaxWait: time.Minute}
+	defer delete(proxy.BackendThrottling, "pause.local")
+
+	get := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://gateway.local/products", http.NoBody)
+		arbor.Proxy(recorder, req, "http://pause.local/products")
+		return recorder
+	}
+	get()
+	fake.Advance(10 * time.Second)
+	if recorder := get(); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "20" || calls != 1 {
+		t.Errorf("paused backend was sent a request: %d %q after %d calls", recorder.Code, recorder.Header().Get("Retry-After"), calls)
+	}
+	fake.Advance(21 * time.Second)
+	if get(); calls != 2 {
+		t.Errorf("backend was not resumed after its pause")
+	}
+}
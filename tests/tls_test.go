@@ -0,0 +1,131 @@
+package arbor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+)
+
+func TestListenerTLSSettings(t *testing.T) {
+	ca, caKey := issueSVID(t, "", nil, nil)
+	cert, key := issueSVID(t, "spiffe://example.org/gateway", ca, caKey)
+	dir := t.TempDir()
+	server.TLSCertFile, server.TLSKeyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, server.TLSCertFile, server.TLSKeyFile, cert, key)
+	server.TLSOCSPStapleFile = filepath.Join(dir, "staple.der")
+	ioutil.WriteFile(server.TLSOCSPStapleFile, []byte("first staple"), 0600)
+	server.TLSCipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+	server.TLSSessionTickets = false
+	server.CertificateCheckInterval = 5 * time.Millisecond
+	// Cleaned up after the server is killed
+	t.Cleanup(func() {
+		server.TLSCertFile, server.TLSKeyFile, server.TLSOCSPStapleFile = "", "", ""
+		server.TLSMinVersion = tls.VersionTLS12
+		server.TLSCipherSuites = nil
+		server.TLSSessionTickets = true
+		server.CertificateCheckInterval = time.Minute
+	})
+	address := startTLSServer(t)
+
+	dial := func(config *tls.Config) (tls.ConnectionState, error) {
+		config.InsecureSkipVerify = true
+		conn, err := tls.Dial("tcp", address, config)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState(), nil
+	}
+
+	state, err := dial(&tls.Config{MaxVersion: tls.VersionTLS12})
+	if err != nil || state.CipherSuite != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("expected the configured cipher suite to be negotiated, got %s %v", tls.CipherSuiteName(state.CipherSuite), err)
+	}
+	if string(state.OCSPResponse) != "first staple" {
+		t.Errorf("expected the OCSP response to be stapled, got %q", state.OCSPResponse)
+	}
+	if _, err := dial(&tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305}}); err == nil {
+		t.Error("expected a client without the configured cipher suites to be refused")
+	}
+	if _, err := dial(&tls.Config{MaxVersion: tls.VersionTLS11}); err == nil {
+		t.Error("expected a client older than the minimum version to be refused")
+	}
+
+	sessions := tls.NewLRUClientSessionCache(1)
+	dial(&tls.Config{MaxVersion: tls.VersionTLS12, ClientSessionCache: sessions})
+	if state, _ := dial(&tls.Config{MaxVersion: tls.VersionTLS12, ClientSessionCache: sessions}); state.DidResume {
+		t.Error("expected sessions not to be resumed without session tickets")
+	}
+
+	// The staple is reloaded when its file changes
+	ioutil.WriteFile(server.TLSOCSPStapleFile, []byte("second staple"), 0600)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(server.TLSOCSPStapleFile, later, later)
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if state, _ := dial(&tls.Config{}); string(state.OCSPResponse) == "second staple" {
+			return
+		}
+	}
+	t.Error("expected the refreshed OCSP response to be stapled")
+}
+
+func TestBackendTLSSettings(t *testing.T) {
+	backend := func(config *tls.Config) (*httptest.Server, *x509.CertPool) {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = config
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		return srv, roots
+	}
+	dial := func(srv *httptest.Server, config *tls.Config) (tls.ConnectionState, error) {
+		conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), config)
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer conn.Close()
+		return conn.ConnectionState(), nil
+	}
+	defer func() {
+		proxy.BackendTLSMinVersion = tls.VersionTLS12
+		proxy.BackendTLSCipherSuites = nil
+		proxy.BackendTLSSessionCacheSize = 0
+	}()
+
+	legacy, legacyRoots := backend(&tls.Config{MaxVersion: tls.VersionTLS11})
+	config := proxy.BackendTLSConfig()
+	config.RootCAs, config.ServerName = legacyRoots, "127.0.0.1"
+	if _, err := dial(legacy, config); err == nil {
+		t.Error("expected a backend older than the minimum version to be refused")
+	}
+
+	modern, roots := backend(&tls.Config{MaxVersion: tls.VersionTLS12})
+	proxy.BackendTLSCipherSuites = []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}
+	config = proxy.BackendTLSConfig()
+	config.RootCAs, config.ServerName = roots, "127.0.0.1"
+	state, err := dial(modern, config)
+	if err != nil || state.CipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("expected the configured cipher suite to be negotiated, got %s %v", tls.CipherSuiteName(state.CipherSuite), err)
+	}
+	if state, _ := dial(modern, config); !state.DidResume {
+		t.Error("expected the backend session to be resumed")
+	}
+
+	proxy.BackendTLSSessionCacheSize = -1
+	config = proxy.BackendTLSConfig()
+	config.RootCAs, config.ServerName = roots, "127.0.0.1"
+	dial(modern, config)
+	if state, _ := dial(modern, config); state.DidResume {
+		t.Error("expected backend sessions not to be resumed with resumption disabled")
+	}
+}
@@ -0,0 +1,65 @@
+package arbor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestTopologyExport(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "http://catalog.local/items", httpmock.NewStringResponder(200, "[]"))
+
+	server.TopologyPath = "/topology"
+	proxy.BackendShadows["catalog.local"] = proxy.Shadow{Backend: "http://catalog-next.local", Rate: 0.1}
+	defer func() {
+		server.TopologyPath = ""
+		delete(proxy.BackendShadows, "catalog.local")
+	}()
+	router := server.NewRouter(services.RouteCollection{{
+		Name: "Catalog", Method: "GET", Pattern: "/catalog",
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			arbor.Proxy(w, r, "http://catalog.local/items")
+		},
+		Pipeline: []string{"schema", arbor.CacheStage, arbor.ProxyStage},
+	}})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/catalog", http.NoBody))
+
+	get := func(query string) string {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/topology"+query, http.NoBody)
+		req.RemoteAddr = "127.0.0.1:1234"
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected the topology, got %d", recorder.Code)
+		}
+		return recorder.Body.String()
+	}
+
+	dot := get("")
+	for _, expected := range []string{
+		`r0 [label="Catalog\nGET /catalog\nschema → cache → proxy"];`,
+		`b0 [label="catalog.local", shape=ellipse];`,
+		"r0 -> b0;",
+		`b0 -> b1 [label="shadow 10%", style=dashed];`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("expected %q in the DOT topology:\n%s", expected, dot)
+		}
+	}
+	mermaid := get("?format=mermaid")
+	for _, expected := range []string{"flowchart LR", `b1(["catalog-next.local"])`, "r0 --> b0", `b0 -.->|"shadow 10%"| b1`} {
+		if !strings.Contains(mermaid, expected) {
+			t.Errorf("expected %q in the Mermaid topology:\n%s", expected, mermaid)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arbor-dev/arbor/arbortest"
+	"github.com/arbor-dev/arbor/vault"
+)
+
+func TestVaultCredentialRenewsLease(t *testing.T) {
+	fake := arbortest.UseFakeClock(t, time.Unix(0, 0))
+	arbortest.Seed(t, 1)
+
+	reads, renewals := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/database/creds/products":
+			reads++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_id": "database/creds/products/1", "lease_duration": 60, "renewable": true,
+				"data": map[string]string{"username": "arbor", "password": "secret"},
+			})
+		case "/v1/sys/leases/renew":
+			renewals++
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"lease_id": "database/creds/products/1", "lease_duration": 60, "renewable": true,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	credential := &vault.Credential{
+		Client:   &vault.Client{Address: srv.URL, Token: "root"},
+		Path:     "database/creds/products",
+		Header:   "Authorization",
+		Template: `Basic {{base64 (print .username ":" .password)}}`,
+	}
+	value, err := credential.Value()
+	if err != nil || value != "Basic YXJib3I6c2VjcmV0" {
+		t.Fatalf("unexpected credential %q (%v)", value, err)
+	}
+
+	credential.Value()
+	if reads != 1 || renewals != 0 {
+		t.Errorf("fresh secret was fetched again: %d reads, %d renewals", reads, renewals)
+	}
+	fake.Advance(50 * time.Second)
+	credential.Value()
+	if reads != 1 || renewals != 1 {
+		t.Errorf("expected lease to be renewed: %d reads, %d renewals", reads, renewals)
+	}
+}
@@ -0,0 +1,123 @@
+package arbor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/buildinfo"
+	"github.com/arbor-dev/arbor/clientip"
+	"github.com/arbor-dev/arbor/health"
+	"github.com/arbor-dev/arbor/proxy"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func versionRoutes(pattern string) services.RouteCollection {
+	return services.RouteCollection{{
+		Name: "Versioned", Method: "GET", Pattern: pattern,
+		Handler: func(w http.ResponseWriter, r *http.Request) {},
+	}}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildTime = "v1.2.0", "abc123", "2026-10-15T00:00:00Z"
+	proxy.BackendShadows["versioned.local"] = proxy.Shadow{Backend: "http://versioned-next.local", Rate: 0.1}
+	defer func() {
+		buildinfo.Version, buildinfo.GitSHA, buildinfo.BuildTime = "", "", ""
+		delete(proxy.BackendShadows, "versioned.local")
+	}()
+
+	router := server.NewRouter(versionRoutes("/versioned"))
+	get := func(remote string) (*httptest.ResponseRecorder, buildinfo.Info) {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/version", http.NoBody)
+		req.RemoteAddr = remote
+		router.ServeHTTP(recorder, req)
+		var info buildinfo.Info
+		if recorder.Code == http.StatusOK {
+			if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+				t.Fatalf("expected the build information, got %q: %v", recorder.Body.String(), err)
+			}
+		}
+		return recorder, info
+	}
+
+	recorder, info := get("127.0.0.1:1234")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the build information locally, got %d", recorder.Code)
+	}
+	if cc := recorder.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("expected the build information not to be cached, got %q", cc)
+	}
+	if info.Version != "v1.2.0" || info.GitSHA != "abc123" || info.BuildTime != "2026-10-15T00:00:00Z" || info.GoVersion != runtime.Version() {
+		t.Errorf("expected the linked build variables, got %+v", info)
+	}
+	if !containsString(info.Features, "shadowing") {
+		t.Errorf("expected shadowing to be reported as enabled, got %v", info.Features)
+	}
+	if info.ConfigHash == "" || info.ConfigHash != arbor.Version().ConfigHash {
+		t.Errorf("expected the hash of the loaded routes, got %q and %q", info.ConfigHash, arbor.Version().ConfigHash)
+	}
+
+	delete(proxy.BackendShadows, "versioned.local")
+	if _, info := get("127.0.0.1:1234"); containsString(info.Features, "shadowing") {
+		t.Errorf("expected features to be checked on each request, got %v", info.Features)
+	}
+
+	server.NewRouter(versionRoutes("/other"))
+	if arbor.Version().ConfigHash == info.ConfigHash {
+		t.Error("expected different routes to have a different config hash")
+	}
+}
+
+func TestVersionEndpointExposure(t *testing.T) {
+	clientip.TrustedProxies = []string{"127.0.0.0/8"}
+	defer func() {
+		clientip.TrustedProxies = nil
+		server.VersionExposure = health.Local
+		server.VersionPath = "/version"
+	}()
+
+	status := func(remote string, forwardedFor string) int {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/version", http.NoBody)
+		req.RemoteAddr = remote
+		if forwardedFor != "" {
+			req.Header.Set(clientip.ForwardedForHeader, forwardedFor)
+		}
+		server.NewRouter(versionRoutes("/versioned")).ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	if code := status("192.0.2.1:1234", ""); code != http.StatusNotFound {
+		t.Errorf("expected remote callers to be refused, got %d", code)
+	}
+	if code := status("127.0.0.1:1234", "192.0.2.1"); code != http.StatusNotFound {
+		t.Errorf("expected remote callers forwarded by a local proxy to be refused, got %d", code)
+	}
+	server.VersionExposure = health.Hidden
+	if code := status("127.0.0.1:1234", ""); code != http.StatusNotFound {
+		t.Errorf("expected hidden build information to be refused, got %d", code)
+	}
+	server.VersionExposure = health.Public
+	if code := status("192.0.2.1:1234", ""); code != http.StatusOK {
+		t.Errorf("expected public build information to be served to everyone, got %d", code)
+	}
+	server.VersionPath = ""
+	if code := status("127.0.0.1:1234", ""); code != http.StatusNotFound {
+		t.Errorf("expected no version route without a path, got %d", code)
+	}
+}
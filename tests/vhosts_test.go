@@ -0,0 +1,54 @@
+package arbor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arbor-dev/arbor/proxy/middleware"
+	"github.com/arbor-dev/arbor/server"
+	"github.com/arbor-dev/arbor/services"
+)
+
+func TestVirtualHostsServeTheirOwnRoutes(t *testing.T) {
+	respond := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			middleware.CORSMiddleware.ServeHTTP(w, r)
+			io.WriteString(w, body)
+		}
+	}
+	server.VirtualHosts = map[string]server.VirtualHost{
+		"api.foo.com": {
+			Routes:              services.RouteCollection{{Name: "Foo", Method: "GET", Pattern: "/things", Handler: respond("foo")}},
+			AccessControlPolicy: "https://foo.com",
+		},
+		"*.bar.com": {
+			Routes: services.RouteCollection{{Name: "Bar", Method: "GET", Pattern: "/things", Handler: respond("bar")}},
+		},
+	}
+	defer func() { server.VirtualHosts = map[string]server.VirtualHost{} }()
+	routes := services.RouteCollection{{Name: "Default", Method: "GET", Pattern: "/things", Handler: respond("default")}}
+	handler := server.NewArborServer(routes, "127.0.0.1", 0).Handler()
+
+	for host, expected := range map[string]string{"api.foo.com": "foo", "API.FOO.COM:443": "foo", "api.bar.com": "bar", "other.com": "default"} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		req.Host = host
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Body.String() != expected {
+			t.Errorf("request for %s was served %q, expected %q", host, recorder.Body.String(), expected)
+		}
+	}
+
+	for origin, allowed := range map[string]string{"https://foo.com": "https://foo.com", "https://evil.com": ""} {
+		req := httptest.NewRequest("GET", "/things", nil)
+		req.Host = "api.foo.com"
+		req.Header.Set("Origin", origin)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != allowed {
+			t.Errorf("origin %s was allowed %q, expected %q", origin, got, allowed)
+		}
+	}
+}
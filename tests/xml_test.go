@@ -0,0 +1,71 @@
+package arbor
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arbor-dev/arbor"
+	"github.com/arbor-dev/arbor/xmljson"
+)
+
+func TestXMLTranslationPreservesStructure(t *testing.T) {
+	document := `<order xmlns:x="urn:x" id="7"><item sku="a">Book &amp; pen</item><item sku="b">Pen</item><x:note>Gift</x:note></order>`
+	translated := `{"order":{"-xmlns:x":"urn:x","-id":"7","item":[{"-sku":"a","#text":"Book & pen"},{"-sku":"b","#text":"Pen"}],"x:note":"Gift"}}`
+
+	json, err := xmljson.ToJSON([]byte(document))
+	if err != nil || string(json) != translated {
+		t.Fatalf("expected %s, got %s (%v)", translated, json, err)
+	}
+	back, err := xmljson.FromJSON(json)
+	if err != nil || !strings.HasSuffix(string(back), document) {
+		t.Errorf("expected the translation back to XML to be %s, got %s (%v)", document, back, err)
+	}
+
+	xmljson.IgnoreAttributes = true
+	json, _ = xmljson.ToJSON([]byte(document))
+	xmljson.IgnoreAttributes = false
+	if expected := `{"order":{"item":["Book & pen","Pen"],"x:note":"Gift"}}`; string(json) != expected {
+		t.Errorf("expected the attributes to be left out, got %s", json)
+	}
+}
+
+func TestXMLServicesSpeakJSONToCallers(t *testing.T) {
+	var received, contentType string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received, contentType = string(body), r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<?xml version="1.0"?><receipt status="ok"><id>7</id></receipt>`))
+	}))
+	defer backend.Close()
+
+	post := func(body string, headers map[string]string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		arbor.Proxy(recorder, req, backend.URL+"/orders", arbor.WithFormat("XML"))
+		return recorder
+	}
+
+	recorder := post(`{"order": {"-id": "7", "item": ["a", "b"]}}`, map[string]string{"Content-Type": "application/json"})
+	if !strings.HasSuffix(received, `<order id="7"><item>a</item><item>b</item></order>`) || !xmljson.IsXML(contentType) {
+		t.Errorf("expected the service to receive XML, got %s %s", contentType, received)
+	}
+	if expected := `{"receipt":{"-status":"ok","id":"7"}}`; recorder.Body.String() != expected || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the caller to receive %s, got %d %s", expected, recorder.Code, recorder.Body)
+	}
+
+	recorder = post(`<order id="8"/>`, map[string]string{"Content-Type": "application/xml", "Accept": "application/xml"})
+	if received != `<order id="8"/>` || !strings.Contains(recorder.Body.String(), `<receipt status="ok">`) {
+		t.Errorf("expected XML to pass through for callers speaking it, sent %s and got %s", received, recorder.Body)
+	}
+
+	if code := post(`<order>`, map[string]string{"Content-Type": "application/xml"}).Code; code != http.StatusBadRequest {
+		t.Errorf("expected malformed XML to be refused, got %d", code)
+	}
+}
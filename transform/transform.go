@@ -0,0 +1,250 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package transform maps the fields of JSON bodies with the FieldMappings of a route's BodyTransform
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/arbor-dev/arbor/services"
+)
+
+// ErrNotJSON is returned for bodies which are not a single JSON value
+var ErrNotJSON = errors.New("transform: body is not JSON")
+
+// IsJSON reports whether a content type is JSON, which are the bodies mappings apply to
+func IsJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Validate returns an error describing the first mapping which can not be applied
+func Validate(mappings []services.FieldMapping) error {
+	for _, m := range mappings {
+		from, err := parsePointer(m.From)
+		if err != nil {
+			return err
+		}
+		to, err := parsePointer(m.To)
+		if err != nil {
+			return err
+		}
+		switch {
+		case m.From == "" && m.To == "":
+			return errors.New("transform: mapping has neither a From nor a To")
+		case m.From == "" && len(m.Value) == 0:
+			return errors.New("transform: mapping to " + m.To + " has neither a From nor a Value")
+		case m.From != "" && len(m.Value) > 0:
+			return errors.New("transform: mapping from " + m.From + " has both a From and a Value")
+		case len(m.Value) > 0 && !json.Valid(m.Value):
+			return errors.New("transform: mapping to " + m.To + " has a Value which is not JSON")
+		}
+		// Items are mapped within themselves, so both pointers must go through the same items
+		if m.From != "" && m.To != "" {
+			last := lastWildcard(from)
+			if lastWildcard(to) != last || last >= 0 && strings.Join(from[:last+1], "/") != strings.Join(to[:last+1], "/") {
+				return errors.New("transform: mapping from " + m.From + " to " + m.To + " does not go through the same items")
+			}
+		}
+	}
+	return nil
+}
+
+// Apply applies mappings, in order, to a JSON body
+func Apply(body []byte, mappings []services.FieldMapping) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are kept as they were written
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil || decoder.More() {
+		return nil, ErrNotJSON
+	}
+	for _, m := range mappings {
+		from, err := parsePointer(m.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parsePointer(m.To)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.Value) > 0 && !json.Valid(m.Value) {
+			return nil, errors.New("transform: mapping to " + m.To + " has a Value which is not JSON")
+		}
+		document = apply(document, from, to, m)
+	}
+	return json.Marshal(document)
+}
+
+// parsePointer splits a JSON Pointer into its unescaped segments, nil for an unset pointer
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer == "/" || !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("transform: " + pointer + " is not a JSON Pointer to a field")
+	}
+	segments := strings.Split(pointer[1:], "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+	}
+	return segments, nil
+}
+
+func lastWildcard(segments []string) int {
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] == "*" {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply applies a mapping to node, returning the updated node
+func apply(node interface{}, from, to []string, m services.FieldMapping) interface{} {
+	path := from
+	if path == nil {
+		path = to
+	}
+	for i, segment := range path {
+		if segment != "*" || (from != nil && to != nil && (i >= len(to) || to[i] != "*")) {
+			continue
+		}
+		// Each item is mapped on its own, with the rest of the pointers
+		container, found := get(node, path[:i])
+		if !found {
+			return node
+		}
+		rest := func(segments []string) []string {
+			if segments == nil {
+				return nil
+			}
+			return segments[i+1:]
+		}
+		switch items := container.(type) {
+		case []interface{}:
+			for j, item := range items {
+				items[j] = apply(item, rest(from), rest(to), m)
+			}
+		case map[string]interface{}:
+			for name, item := range items {
+				items[name] = apply(item, rest(from), rest(to), m)
+			}
+		}
+		return node
+	}
+
+	var value interface{}
+	if from == nil {
+		// Each item gets its own copy of the value
+		decoder := json.NewDecoder(bytes.NewReader(m.Value))
+		decoder.UseNumber()
+		decoder.Decode(&value)
+	} else {
+		var found bool
+		value, found = get(node, from)
+		if !found {
+			return node
+		}
+		if !m.Keep {
+			node = remove(node, from)
+		}
+	}
+	if to != nil {
+		node = set(node, to, value)
+	}
+	return node
+}
+
+// index parses an array index segment
+func index(segment string, length int) (int, bool) {
+	i, err := strconv.Atoi(segment)
+	return i, err == nil && i >= 0 && i < length && (segment == "0" || segment[0] != '0')
+}
+
+func get(node interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[segment]
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case []interface{}:
+			i, ok := index(segment, len(n))
+			if !ok {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func remove(node interface{}, path []string) interface{} {
+	last := len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			delete(n, path[0])
+		} else if child, ok := n[path[0]]; ok {
+			n[path[0]] = remove(child, path[1:])
+		}
+	case []interface{}:
+		i, ok := index(path[0], len(n))
+		if !ok {
+			return node
+		}
+		if last {
+			return append(n[:i:i], n[i+1:]...)
+		}
+		n[i] = remove(n[i], path[1:])
+	}
+	return node
+}
+
+// set sets the field at path to value, creating the objects leading to it
+func set(node interface{}, path []string, value interface{}) interface{} {
+	last := len(path) == 1
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if last {
+			n[path[0]] = value
+		} else {
+			n[path[0]] = set(n[path[0]], path[1:], value)
+		}
+	case []interface{}:
+		// - appends to the array, as in JSON Patch
+		if path[0] == "-" && last {
+			return append(n, value)
+		}
+		i, ok := index(path[0], len(n))
+		if !ok {
+			return node
+		}
+		if last {
+			n[i] = value
+		} else {
+			n[i] = set(n[i], path[1:], value)
+		}
+	case nil:
+		return set(map[string]interface{}{}, path, value)
+	}
+	return node
+}
@@ -0,0 +1,142 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/arbor-dev/arbor/clock"
+	"github.com/arbor-dev/arbor/logger"
+	"github.com/arbor-dev/arbor/random"
+)
+
+// DefaultRefreshInterval is how often secrets without a lease, such as KV secrets, are read again
+var DefaultRefreshInterval = 5 * time.Minute
+
+// minimumLease is the shortest lease worth renewing, below it the secret is read again
+const minimumLease = 10 * time.Second
+
+var templateFuncs = template.FuncMap{
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+}
+
+// Credential is a header value built from a Vault secret, whose lease is renewed as it is used
+//
+// The lease is renewed two thirds of the way through; once it can no longer be renewed
+// the secret is read again, so callers always see a valid value.
+type Credential struct {
+	Client *Client
+	//Path is the secret to read, e.g. "database/creds/products"
+	Path string
+	//Header is the header the value is sent to the backend in, e.g. "Authorization"
+	Header string
+	//Template builds the value from the secret's data, e.g. `Basic {{base64 (print .username ":" .password)}}`
+	Template string
+
+	mutex    sync.Mutex
+	template *template.Template
+	secret   *Secret
+	value    string
+	renewAt  time.Time
+	expires  time.Time
+}
+
+// Value returns the current header value, reading or renewing the secret if it is due
+func (c *Credential) Value() (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := clock.Now()
+	if c.secret != nil && now.Before(c.renewAt) {
+		return c.value, nil
+	}
+
+	err := c.refresh(now)
+	if err != nil {
+		if c.secret != nil && (c.expires.IsZero() || now.Before(c.expires)) {
+			logger.Log(logger.ERR, "Could not refresh Vault secret "+c.Path+", using the current lease: "+err.Error())
+			// Retry soon rather than on every request
+			c.renewAt = now.Add(minimumLease)
+			return c.value, nil
+		}
+		return "", err
+	}
+	return c.value, nil
+}
+
+// refresh renews the lease if it can and reads the secret again otherwise
+func (c *Credential) refresh(now time.Time) error {
+	if c.secret != nil && c.secret.Renewable && c.secret.LeaseID != "" {
+		renewed, err := c.Client.Renew(c.secret.LeaseID, c.secret.Lease())
+		if err == nil && renewed.Lease() >= minimumLease {
+			c.schedule(now, renewed.Lease())
+			return nil
+		}
+		if err != nil {
+			logger.Log(logger.WARN, "Could not renew Vault lease for "+c.Path+", reading it again: "+err.Error())
+		}
+	}
+
+	secret, err := c.Client.Read(c.Path)
+	if err != nil {
+		return err
+	}
+	value, err := c.render(secret)
+	if err != nil {
+		return err
+	}
+	c.secret = secret
+	c.value = value
+	lease := secret.Lease()
+	if lease == 0 {
+		c.renewAt = now.Add(random.Jitter(DefaultRefreshInterval, 0.1))
+		// Secrets without a lease do not expire
+		c.expires = time.Time{}
+		return nil
+	}
+	c.schedule(now, lease)
+	return nil
+}
+
+// schedule renews a lease two thirds of the way through, jittered so replicas do not renew together
+func (c *Credential) schedule(now time.Time, lease time.Duration) {
+	c.expires = now.Add(lease)
+	c.renewAt = now.Add(random.Jitter(lease*2/3, 0.1))
+}
+
+func (c *Credential) render(secret *Secret) (string, error) {
+	if c.template == nil {
+		if c.Template == "" {
+			return "", errors.New("vault: credential for " + c.Path + " has no template")
+		}
+		t, err := template.New(c.Path).Funcs(templateFuncs).Option("missingkey=error").Parse(c.Template)
+		if err != nil {
+			return "", err
+		}
+		c.template = t
+	}
+	data := secret.Data
+	// KV version 2 nests the secret's data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	var value bytes.Buffer
+	err := c.template.Execute(&value, data)
+	if err != nil {
+		return "", err
+	}
+	return value.String(), nil
+}
@@ -0,0 +1,124 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package vault fetches short-lived backend credentials from HashiCorp Vault and renews their leases
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client talks to the Vault HTTP API
+type Client struct {
+	//Address is the address of the Vault server (e.g. "https://vault.example.org:8200")
+	Address string
+	//Token authenticates arbor to Vault
+	Token string
+	//Namespace is the Vault Enterprise namespace (optional)
+	Namespace string
+	//HTTPClient makes the requests, nil uses a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client configured from the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables
+func NewClient() *Client {
+	return &Client{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+// Secret is a secret read from Vault
+type Secret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// Lease is how long the secret is valid for
+func (s *Secret) Lease() time.Duration {
+	return time.Duration(s.LeaseDuration) * time.Second
+}
+
+// Error is an error response from Vault
+type Error struct {
+	StatusCode int
+	Errors     []string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("vault: %d %s", e.StatusCode, strings.Join(e.Errors, "; "))
+}
+
+func (c *Client) do(method string, path string, body interface{}) (*Secret, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Address, "/")+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", c.Token)
+	req.Header.Set("X-Vault-Request", "true")
+	if c.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.Namespace)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errorResponse struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&errorResponse)
+		return nil, &Error{StatusCode: resp.StatusCode, Errors: errorResponse.Errors}
+	}
+	secret := new(Secret)
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(secret)
+	if err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Read reads the secret at path, e.g. "database/creds/products"
+func (c *Client) Read(path string) (*Secret, error) {
+	return c.do(http.MethodGet, path, nil)
+}
+
+// Renew extends the lease of a secret by increment, Vault may grant less
+func (c *Client) Renew(leaseID string, increment time.Duration) (*Secret, error) {
+	return c.do(http.MethodPut, "sys/leases/renew", map[string]interface{}{
+		"lease_id":  leaseID,
+		"increment": int(increment / time.Second),
+	})
+}
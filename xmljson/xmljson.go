@@ -0,0 +1,397 @@
+/**
+* Copyright © 2017, ACM@UIUC
+*
+* This file is part of the Groot Project.
+*
+* The Groot Project is open source software, released under the University of
+* Illinois/NCSA Open Source License. You should have received a copy of
+* this license in a file with the distribution.
+**/
+
+// Package xmljson translates between XML and JSON without losing attributes, namespaces or the order of elements
+//
+// An element becomes a JSON object whose members are, in document order, its attributes (named
+// with AttributePrefix), its child elements and its text (named TextKey). Elements with neither
+// attributes nor children become their text. Repeated child elements become an array, placed
+// where the first of them was. Values stay strings, as XML does not type them. For example
+//
+//	<order id="7"><item sku="a">Book</item><item sku="b">Pen</item><note>Gift</note></order>
+//
+// translates to
+//
+//	{"order":{"-id":"7","item":[{"-sku":"a","#text":"Book"},{"-sku":"b","#text":"Pen"}],"note":"Gift"}}
+//
+// and back. Namespace prefixes are kept in names, e.g. "soap:Body", with their declarations as attributes.
+package xmljson
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+	"unicode"
+)
+
+// AttributePrefix is prepended to the names of attributes in JSON
+var AttributePrefix = "-"
+
+// TextKey names the text of elements which also have attributes or children in JSON
+var TextKey = "#text"
+
+// IgnoreAttributes leaves attributes out of the JSON translation of XML
+var IgnoreAttributes = false
+
+// RootName names the root element of JSON which is not an object with a single member
+var RootName = "root"
+
+// ErrNoRoot is returned for XML without a root element
+var ErrNoRoot = errors.New("xmljson: no root element")
+
+// IsXML reports whether a content type is XML
+func IsXML(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Valid reports whether body is well formed XML with a single root element
+func Valid(body []byte) bool {
+	_, err := parse(body)
+	return err == nil
+}
+
+// element is an XML element, with its children in document order
+type element struct {
+	name     string
+	attrs    []xml.Attr
+	children []*element
+	text     strings.Builder
+}
+
+func qualified(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// parse reads the root element of an XML document, leaving out comments and processing instructions
+func parse(body []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var root *element
+	var open []*element
+	for {
+		// Raw tokens keep namespace prefixes as written
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &element{name: qualified(t.Name), attrs: t.Attr}
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.children = append(parent.children, e)
+			} else if root != nil {
+				return nil, errors.New("xmljson: more than one root element")
+			} else {
+				root = e
+			}
+			open = append(open, e)
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1].name != qualified(t.Name) {
+				return nil, errors.New("xmljson: unexpected end element " + qualified(t.Name))
+			}
+			open = open[:len(open)-1]
+		case xml.CharData:
+			if len(open) > 0 {
+				open[len(open)-1].text.Write(t)
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("xmljson: text outside of the root element")
+			}
+		}
+	}
+	if root == nil {
+		return nil, ErrNoRoot
+	}
+	if len(open) > 0 {
+		return nil, errors.New("xmljson: element " + open[len(open)-1].name + " is not closed")
+	}
+	return root, nil
+}
+
+// ToJSON translates an XML document to JSON
+func ToJSON(body []byte) ([]byte, error) {
+	root, err := parse(body)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeString(&buf, root.name)
+	buf.WriteByte(':')
+	writeElement(&buf, root)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Encode ends the value with a newline
+	buf.Truncate(buf.Len() - 1)
+}
+
+// writeElement writes the JSON value of an element
+func writeElement(buf *bytes.Buffer, e *element) {
+	attrs := e.attrs
+	if IgnoreAttributes {
+		attrs = nil
+	}
+	if len(attrs) == 0 && len(e.children) == 0 {
+		writeString(buf, e.text.String())
+		return
+	}
+
+	buf.WriteByte('{')
+	first := true
+	member := func(name string) {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		writeString(buf, name)
+		buf.WriteByte(':')
+	}
+	for _, attr := range attrs {
+		member(AttributePrefix + qualified(attr.Name))
+		writeString(buf, attr.Value)
+	}
+	// Children sharing a name are grouped where the first of them is
+	written := map[string]bool{}
+	for _, child := range e.children {
+		if written[child.name] {
+			continue
+		}
+		written[child.name] = true
+		var siblings []*element
+		for _, sibling := range e.children {
+			if sibling.name == child.name {
+				siblings = append(siblings, sibling)
+			}
+		}
+		member(child.name)
+		if len(siblings) == 1 {
+			writeElement(buf, child)
+			continue
+		}
+		buf.WriteByte('[')
+		for i, sibling := range siblings {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeElement(buf, sibling)
+		}
+		buf.WriteByte(']')
+	}
+	// Whitespace between child elements is indentation rather than text
+	if text := e.text.String(); strings.TrimSpace(text) != "" {
+		if len(e.children) > 0 {
+			text = strings.TrimSpace(text)
+		}
+		member(TextKey)
+		writeString(buf, text)
+	}
+	buf.WriteByte('}')
+}
+
+// member is a member of a JSON object, objects are decoded as their members in order
+type member struct {
+	key   string
+	value interface{}
+}
+
+// decodeValue decodes the next JSON value, keeping the order of the members of objects
+func decodeValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			var members []member
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				members = append(members, member{key: key.(string), value: value})
+			}
+			_, err = decoder.Token()
+			return members, err
+		case '[':
+			items := []interface{}{}
+			for decoder.More() {
+				item, err := decodeValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			_, err = decoder.Token()
+			return items, err
+		}
+	}
+	return token, nil
+}
+
+// FromJSON translates JSON to an XML document
+//
+// A JSON object with a single member is the root element, other JSON is wrapped in a RootName element.
+func FromJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	value, err := decodeValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("xmljson: more than one JSON value")
+	}
+
+	name := RootName
+	if members, ok := value.([]member); ok && len(members) == 1 {
+		if _, isArray := members[0].value.([]interface{}); !isArray {
+			name, value = members[0].key, members[0].value
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	if err := encodeElement(encoder, name, value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// validName reports whether name may name an element or attribute, with a namespace prefix or not
+func validName(name string) bool {
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' || r == ':' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return name != ""
+}
+
+// encodeElement writes value as an element named name, arrays as one element per item
+func encodeElement(encoder *xml.Encoder, name string, value interface{}) error {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if err := encodeElement(encoder, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !validName(name) {
+		return errors.New("xmljson: " + name + " is not a valid element name")
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	var children []member
+	text := ""
+	switch v := value.(type) {
+	case []member:
+		for _, m := range v {
+			switch {
+			case AttributePrefix != "" && strings.HasPrefix(m.key, AttributePrefix):
+				attr := strings.TrimPrefix(m.key, AttributePrefix)
+				if !validName(attr) {
+					return errors.New("xmljson: " + attr + " is not a valid attribute name")
+				}
+				start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attr}, Value: scalar(m.value)})
+			case m.key == TextKey:
+				text = scalar(m.value)
+			default:
+				children = append(children, m)
+			}
+		}
+	default:
+		text = scalar(v)
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := encodeElement(encoder, child.key, child.value); err != nil {
+			return err
+		}
+	}
+	if text != "" {
+		if err := encoder.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// scalar is the text of a JSON value, empty for null
+func scalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		// Objects and arrays where text is expected are kept as JSON
+		encoded, _ := json.Marshal(plain(v))
+		return string(encoded)
+	}
+}
+
+// plain converts ordered members back to maps, for encoding them as JSON
+func plain(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []member:
+		m := make(map[string]interface{}, len(v))
+		for _, member := range v {
+			m[member.key] = plain(member.value)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = plain(item)
+		}
+		return items
+	}
+	return value
+}